@@ -0,0 +1,220 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the values of the HardwareType and Operation fields of the ARPPacket
+// used for ARP over Ethernet. See RFC 826.
+const (
+	ARPHardwareTypeEthernet uint16 = 1
+
+	ARPOperationRequest uint16 = 1
+	ARPOperationReply   uint16 = 2
+
+	arpHeaderLen int = 8
+)
+
+// ARPPacket is a struct representing an Address Resolution Protocol packet. The
+// protocol addresses are addresses of the ProtocolType, so if it's EtherTypeIPv4
+// they must both be IPv4 addresses.
+//
+// The HardwareSize and ProtocolSize fields are the lengths of the addresses, in
+// bytes. If they are zero they are determined from the sender's addresses at the
+// time of marshaling, defaulting to the sizes of Ethernet and IPv4 addresses. The
+// ProtocolSize is always 4 if the ProtocolType is EtherTypeIPv4.
+type ARPPacket struct {
+	HardwareType          uint16
+	ProtocolType          uint16 // the EtherType of the protocol addresses
+	HardwareSize          uint8
+	ProtocolSize          uint8
+	Operation             uint16
+	SenderHardwareAddress net.HardwareAddr
+	SenderProtocolAddress netip.Addr
+	TargetHardwareAddress net.HardwareAddr
+	TargetProtocolAddress netip.Addr
+}
+
+// NewARPRequest is a function that returns an *ARPPacket asking who has the
+// target IPv4 address (who-has). The target hardware address is all zeroes, as
+// it's the address being requested.
+//
+// This and the other functions for creating an *ARPPacket are only for IPv4
+// addresses, or IPv4-mapped IPv6 addresses, and always set the ProtocolType to
+// EtherTypeIPv4. IPv6 doesn't use ARP, but Neighbor Discovery (RFC 4861) instead,
+// so marshaling a packet created with an IPv6 address returns an error.
+func NewARPRequest(senderMAC net.HardwareAddr, senderIP, targetIP netip.Addr) *ARPPacket {
+	return newARPPacket(ARPOperationRequest, senderMAC, senderIP, make(net.HardwareAddr, len(senderMAC)), targetIP)
+}
+
+// NewARPReply is a function that returns an *ARPPacket telling the target that
+// the sender's IPv4 address is at the sender's hardware address (is-at).
+func NewARPReply(senderMAC net.HardwareAddr, senderIP netip.Addr, targetMAC net.HardwareAddr, targetIP netip.Addr) *ARPPacket {
+	return newARPPacket(ARPOperationReply, senderMAC, senderIP, targetMAC, targetIP)
+}
+
+// NewGratuitousARP is a function that returns a gratuitous *ARPPacket, which
+// announces that the IPv4 address is at the hardware address. It's a request
+// with the sender and target IPv4 addresses both set to the address being
+// announced, per RFC 5227.
+func NewGratuitousARP(mac net.HardwareAddr, ip netip.Addr) *ARPPacket {
+	return newARPPacket(ARPOperationRequest, mac, ip, make(net.HardwareAddr, len(mac)), ip)
+}
+
+func newARPPacket(op uint16, sha net.HardwareAddr, spa netip.Addr, tha net.HardwareAddr, tpa netip.Addr) *ARPPacket {
+	return &ARPPacket{
+		HardwareType:          ARPHardwareTypeEthernet,
+		ProtocolType:          EtherTypeIPv4,
+		Operation:             op,
+		SenderHardwareAddress: sha,
+		SenderProtocolAddress: spa.Unmap(),
+		TargetHardwareAddress: tha,
+		TargetProtocolAddress: tpa.Unmap(),
+	}
+}
+
+// UnmarshalARPPacket is a function that takes a byte slice and parses it in to an
+// instance of *ARPPacket. Any data following the packet, such as the padding of
+// an Ethernet frame, is ignored.
+//
+// The error is a packetserr.DecodeError wrapping the packetserr.ARPPacketTruncated
+// type if there is less data than the address sizes specify, or
+// packetserr.ARPProtocolSizeUnsupported if the protocol addresses are neither IPv4
+// nor IPv6 addresses.
+func UnmarshalARPPacket(data []byte) (*ARPPacket, error) {
+	return unmarshalARPPacket(data)
+}
+
+// Marshal is a function to marshal the *ARPPacket instance to a byte slice. The
+// *ARPPacket instance is not modified.
+//
+// The error will be of the packetserr.ARPAddressSizeMismatch type if any of the
+// addresses don't match the size of the sender's addresses, or the HardwareSize
+// and ProtocolSize fields if they are set. If the ProtocolType is EtherTypeIPv4
+// the protocol addresses, and the ProtocolSize if it's set, must be 4 bytes. The
+// address sizes must be no more than 255 bytes.
+func (arp *ARPPacket) Marshal() ([]byte, error) {
+	return arp.marshalARPPacket()
+}
+
+// arpFields returns the fields of an ARP packet with addresses of the sizes
+// provided, for describing where decoding failed.
+func arpFields(hlen, plen int) []headerField {
+	return []headerField{
+		{0, "HardwareType"}, {2, "ProtocolType"}, {4, "HardwareSize"}, {5, "ProtocolSize"},
+		{6, "Operation"}, {8, "SenderHardwareAddress"}, {8 + hlen, "SenderProtocolAddress"},
+		{8 + hlen + plen, "TargetHardwareAddress"}, {8 + hlen*2 + plen, "TargetProtocolAddress"},
+	}
+}
+
+func unmarshalARPPacket(data []byte) (*ARPPacket, error) {
+	if len(data) < arpHeaderLen {
+		err := packetserr.ARPPacketTruncated{ExpectedSize: arpHeaderLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeARP, arpFields(0, 0), len(data), err)
+	}
+
+	arp := &ARPPacket{
+		HardwareType: binary.BigEndian.Uint16(data[0:2]),
+		ProtocolType: binary.BigEndian.Uint16(data[2:4]),
+		HardwareSize: data[4],
+		ProtocolSize: data[5],
+		Operation:    binary.BigEndian.Uint16(data[6:8]),
+	}
+
+	if arp.ProtocolSize != 4 && arp.ProtocolSize != 16 {
+		return nil, decodeError(LayerTypeARP, "ProtocolSize", 5, packetserr.ARPProtocolSizeUnsupported{Size: arp.ProtocolSize})
+	}
+
+	hlen, plen := int(arp.HardwareSize), int(arp.ProtocolSize)
+	packetLen := arpHeaderLen + hlen*2 + plen*2
+
+	if len(data) < packetLen {
+		err := packetserr.ARPPacketTruncated{ExpectedSize: packetLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeARP, arpFields(hlen, plen), len(data), err)
+	}
+
+	offset := arpHeaderLen
+
+	arp.SenderHardwareAddress = net.HardwareAddr(copyBytes(data[offset : offset+hlen]))
+	offset += hlen
+
+	arp.SenderProtocolAddress, _ = netip.AddrFromSlice(data[offset : offset+plen])
+	offset += plen
+
+	arp.TargetHardwareAddress = net.HardwareAddr(copyBytes(data[offset : offset+hlen]))
+	offset += hlen
+
+	arp.TargetProtocolAddress, _ = netip.AddrFromSlice(data[offset : offset+plen])
+
+	return arp, nil
+}
+
+func (arp *ARPPacket) marshalARPPacket() ([]byte, error) {
+	hlen := int(arp.HardwareSize)
+
+	if hlen == 0 {
+		hlen = ethernetAddrLen
+
+		if len(arp.SenderHardwareAddress) > 0 {
+			hlen = len(arp.SenderHardwareAddress)
+		}
+	}
+
+	plen := int(arp.ProtocolSize)
+
+	switch {
+	case arp.ProtocolType == EtherTypeIPv4:
+		if plen != 0 && plen != 4 {
+			return nil, packetserr.ARPAddressSizeMismatch{Field: "ProtocolSize", Size: 4, Len: plen}
+		}
+
+		plen = 4
+	case plen == 0:
+		plen = 4
+
+		if arp.SenderProtocolAddress.Is6() {
+			plen = 16
+		}
+	}
+
+	if hlen > 255 {
+		return nil, packetserr.ARPAddressSizeMismatch{Field: "SenderHardwareAddress", Size: 255, Len: hlen}
+	}
+
+	spa := arp.SenderProtocolAddress.AsSlice()
+	tpa := arp.TargetProtocolAddress.AsSlice()
+
+	switch {
+	case len(arp.SenderHardwareAddress) != hlen:
+		return nil, packetserr.ARPAddressSizeMismatch{Field: "SenderHardwareAddress", Size: hlen, Len: len(arp.SenderHardwareAddress)}
+	case len(arp.TargetHardwareAddress) != hlen:
+		return nil, packetserr.ARPAddressSizeMismatch{Field: "TargetHardwareAddress", Size: hlen, Len: len(arp.TargetHardwareAddress)}
+	case len(spa) != plen:
+		return nil, packetserr.ARPAddressSizeMismatch{Field: "SenderProtocolAddress", Size: plen, Len: len(spa)}
+	case len(tpa) != plen:
+		return nil, packetserr.ARPAddressSizeMismatch{Field: "TargetProtocolAddress", Size: plen, Len: len(tpa)}
+	}
+
+	data := make([]byte, arpHeaderLen, arpHeaderLen+hlen*2+plen*2)
+
+	binary.BigEndian.PutUint16(data[0:], arp.HardwareType)
+	binary.BigEndian.PutUint16(data[2:], arp.ProtocolType)
+	data[4] = uint8(hlen)
+	data[5] = uint8(plen)
+	binary.BigEndian.PutUint16(data[6:], arp.Operation)
+
+	data = append(data, arp.SenderHardwareAddress...)
+	data = append(data, spa...)
+	data = append(data, arp.TargetHardwareAddress...)
+	data = append(data, tpa...)
+
+	return data, nil
+}
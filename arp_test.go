@@ -0,0 +1,180 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+var arpRequest = []byte{
+	0x00, 0x01, // HardwareType
+	0x08, 0x00, // ProtocolType
+	0x06,       // HardwareSize
+	0x04,       // ProtocolSize
+	0x00, 0x01, // Operation
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, // SenderHardwareAddress
+	0xc0, 0xa8, 0x00, 0x01, // SenderProtocolAddress
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // TargetHardwareAddress
+	0xc0, 0xa8, 0x00, 0x02, // TargetProtocolAddress
+}
+
+func (t *TestSuite) TestUnmarshalARPPacket(c *C) {
+	// include the padding of a minimum size frame
+	arp, err := packets.UnmarshalARPPacket(append(arpRequest, make([]byte, 18)...))
+	c.Assert(err, IsNil)
+
+	c.Check(arp.HardwareType, Equals, packets.ARPHardwareTypeEthernet)
+	c.Check(arp.ProtocolType, Equals, packets.EtherTypeIPv4)
+	c.Check(arp.HardwareSize, Equals, uint8(6))
+	c.Check(arp.ProtocolSize, Equals, uint8(4))
+	c.Check(arp.Operation, Equals, packets.ARPOperationRequest)
+	c.Check(arp.SenderHardwareAddress, DeepEquals, net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+	c.Check(arp.SenderProtocolAddress, Equals, netip.MustParseAddr("192.168.0.1"))
+	c.Check(arp.TargetHardwareAddress, DeepEquals, make(net.HardwareAddr, 6))
+	c.Check(arp.TargetProtocolAddress, Equals, netip.MustParseAddr("192.168.0.2"))
+
+	//
+	// TEST packetserr.ARPPacketTruncated
+	//
+	arp, err = packets.UnmarshalARPPacket(arpRequest[:7])
+	c.Assert(err, Not(IsNil))
+	c.Check(arp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ARP",
+		Field:  "Operation",
+		Offset: 6,
+		Err:    packetserr.ARPPacketTruncated{ExpectedSize: 8, Len: 7},
+	})
+
+	arp, err = packets.UnmarshalARPPacket(arpRequest[:27])
+	c.Assert(err, Not(IsNil))
+	c.Check(arp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ARP",
+		Field:  "TargetProtocolAddress",
+		Offset: 24,
+		Err:    packetserr.ARPPacketTruncated{ExpectedSize: 28, Len: 27},
+	})
+
+	//
+	// TEST packetserr.ARPProtocolSizeUnsupported
+	//
+	data := make([]byte, len(arpRequest))
+	copy(data, arpRequest)
+
+	data[5] = 6
+
+	arp, err = packets.UnmarshalARPPacket(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(arp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ARP",
+		Field:  "ProtocolSize",
+		Offset: 5,
+		Err:    packetserr.ARPProtocolSizeUnsupported{Size: 6},
+	})
+}
+
+func (t *TestSuite) TestARPPacket_Marshal(c *C) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	peer := net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+
+	//
+	// TEST WHO-HAS
+	//
+	arp := packets.NewARPRequest(mac, netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("192.168.0.2"))
+
+	data, err := arp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, arpRequest)
+
+	// the sizes are only filled in on the marshaled data
+	c.Check(arp.HardwareSize, Equals, uint8(0))
+	c.Check(arp.ProtocolSize, Equals, uint8(0))
+
+	//
+	// TEST IS-AT
+	//
+	arp = packets.NewARPReply(peer, netip.MustParseAddr("192.168.0.2"), mac, netip.MustParseAddr("192.168.0.1"))
+
+	data, err = arp.Marshal()
+	c.Assert(err, IsNil)
+
+	arp, err = packets.UnmarshalARPPacket(data)
+	c.Assert(err, IsNil)
+	c.Check(arp.Operation, Equals, packets.ARPOperationReply)
+	c.Check(arp.SenderHardwareAddress, DeepEquals, peer)
+	c.Check(arp.SenderProtocolAddress, Equals, netip.MustParseAddr("192.168.0.2"))
+	c.Check(arp.TargetHardwareAddress, DeepEquals, mac)
+	c.Check(arp.TargetProtocolAddress, Equals, netip.MustParseAddr("192.168.0.1"))
+
+	//
+	// TEST GRATUITOUS ARP
+	//
+	arp = packets.NewGratuitousARP(mac, netip.MustParseAddr("::ffff:192.168.0.1"))
+
+	data, err = arp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 28)
+
+	arp, err = packets.UnmarshalARPPacket(data)
+	c.Assert(err, IsNil)
+	c.Check(arp.Operation, Equals, packets.ARPOperationRequest)
+	c.Check(arp.ProtocolType, Equals, packets.EtherTypeIPv4)
+	c.Check(arp.SenderProtocolAddress, Equals, netip.MustParseAddr("192.168.0.1"))
+	c.Check(arp.TargetProtocolAddress, Equals, arp.SenderProtocolAddress)
+	c.Check(arp.TargetHardwareAddress, DeepEquals, make(net.HardwareAddr, 6))
+
+	//
+	// TEST packetserr.ARPAddressSizeMismatch
+	//
+	arp = packets.NewARPReply(mac, netip.MustParseAddr("192.168.0.1"), nil, netip.MustParseAddr("192.168.0.2"))
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "TargetHardwareAddress", Size: 6, Len: 0})
+
+	arp = packets.NewARPRequest(mac, netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("fe80::1"))
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "TargetProtocolAddress", Size: 4, Len: 16})
+
+	arp = packets.NewGratuitousARP(mac, netip.MustParseAddr("fe80::1"))
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "SenderProtocolAddress", Size: 4, Len: 16})
+
+	arp = packets.NewGratuitousARP(mac, netip.MustParseAddr("192.168.0.1"))
+	arp.ProtocolSize = 16
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "ProtocolSize", Size: 4, Len: 16})
+
+	arp = &packets.ARPPacket{HardwareSize: 8, SenderHardwareAddress: mac}
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "SenderHardwareAddress", Size: 8, Len: 6})
+
+	arp = &packets.ARPPacket{SenderHardwareAddress: mac, TargetHardwareAddress: peer}
+
+	data, err = arp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ARPAddressSizeMismatch{Field: "SenderProtocolAddress", Size: 4, Len: 0})
+}
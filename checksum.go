@@ -0,0 +1,103 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// InternetChecksum is a function for computing the Internet checksum of the data,
+// as defined in RFC 1071. This is the one's complement of the one's complement sum
+// of the data as 16-bit big-endian words. If the data is of an odd length it's
+// padded with a zero byte for the purpose of the computation.
+//
+// This is the checksum used by the IPv4 header, as well as by TCP and UDP over
+// their pseudo-headers (see ChecksumIPv4 and ChecksumIPv6).
+func InternetChecksum(data []byte) uint16 {
+	return ^checksumFold(checksumSum(0, data))
+}
+
+// ChecksumUpdate16 is a function for incrementally updating an Internet checksum
+// when a 16-bit word covered by it changes from old to new, as defined by equation
+// 3 of RFC 1624. This avoids having to re-sum all of the data, for example when
+// rewriting the SourcePort of a TCPHeader:
+//
+//	csum = ChecksumUpdate16(csum, tcp.SourcePort, newPort)
+//
+// The word must have been aligned on a 16-bit boundary within the checksummed data.
+func ChecksumUpdate16(csum, old, new uint16) uint16 {
+	sum := uint64(^csum) + uint64(^old) + uint64(new)
+
+	return ^checksumFold(sum)
+}
+
+// ChecksumUpdate32 is a function for incrementally updating an Internet checksum
+// when a 32-bit value covered by it changes from old to new. It's the same as
+// calling ChecksumUpdate16 for each half of the value, and is meant for things like
+// rewriting an IPv4 address, which is part of both the IPv4 header checksum and the
+// TCP or UDP pseudo-header checksum.
+func ChecksumUpdate32(csum uint16, old, new uint32) uint16 {
+	sum := uint64(^csum) +
+		uint64(^uint16(old>>16)) + uint64(^uint16(old)) +
+		uint64(uint16(new>>16)) + uint64(uint16(new))
+
+	return ^checksumFold(sum)
+}
+
+// verifyChecksum checks the checksum at the offset within the TCP or UDP data,
+// computing it over the pseudo-header for the addresses with the checksum field
+// treated as zero. The error is packetserr.ChecksumMismatch if it isn't correct.
+func verifyChecksum(data []byte, offset int, kind string, src, dst netip.Addr) error {
+	actual := binary.BigEndian.Uint16(data[offset:])
+
+	b := copyBytes(data)
+	b[offset], b[offset+1] = 0, 0
+
+	expected, err := checksumIPAddr(b, kind, src, dst)
+	if err != nil {
+		return err
+	}
+
+	// a UDP checksum of zero is sent as its one's complement
+	// equivalent, as zero means there isn't a checksum
+	if expected == 0 && kind == "udp" {
+		expected = 0xffff
+	}
+
+	if expected != actual {
+		return packetserr.ChecksumMismatch{Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
+// checksumSum adds the data to the running one's complement sum as 16-bit
+// big-endian words. The carries are folded in by checksumFold.
+func checksumSum(sum uint64, data []byte) uint64 {
+	end := len(data) &^ 1
+
+	for i := 0; i < end; i += 2 {
+		sum += uint64(data[i])<<8 | uint64(data[i+1])
+	}
+
+	// if there's an odd byte left over, pad it with a zero byte
+	if end != len(data) {
+		sum += uint64(data[end]) << 8
+	}
+
+	return sum
+}
+
+// checksumFold folds the carries of the sum back in to the lower 16 bits.
+func checksumFold(sum uint64) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return uint16(sum)
+}
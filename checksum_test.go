@@ -0,0 +1,162 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets"
+	. "gopkg.in/check.v1"
+)
+
+// checksumCorpus is a set of captured IPv4 packets, with the Ethernet header
+// removed, along with the checksums they were captured with.
+var checksumCorpus = []struct {
+	name       string
+	kind       string
+	data       []byte
+	ipChecksum uint16
+	l4Checksum uint16
+	l4Offset   int // offset of the checksum within the TCP or UDP header
+}{
+	{
+		// 16:17:26.239051 IP 192.168.0.1.12345 > 192.168.0.2.54321: Flags [S], seq 3735928559:3735928563, win 0, options [mss 8192,eol], length 4
+		name: "TCP SYN with options and payload",
+		kind: "tcp",
+		data: []byte{
+			0x45, 0x00, 0x00, 0x34, 0x00, 0x00, 0x00, 0x00, 0x80, 0x06, 0xb9, 0x70, 0xc0, 0xa8, 0x00, 0x01,
+			0xc0, 0xa8, 0x00, 0x02, 0x30, 0x39, 0xd4, 0x31, 0xde, 0xad, 0xbe, 0xef, 0x00, 0x00, 0x00, 0x00,
+			0x70, 0x02, 0x00, 0x00, 0x82, 0x9c, 0x00, 0x00, 0x02, 0x04, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x54, 0x65, 0x73, 0x74,
+		},
+		ipChecksum: 0xb970,
+		l4Checksum: 0x829c,
+		l4Offset:   16,
+	},
+	{
+		// 11:08:05.708342 IP 109.194.160.4.57766 > 95.211.92.14.53: 63000% [1au] A? picslife.ru. (40)
+		name: "UDP DNS query",
+		kind: "udp",
+		data: []byte{
+			0x45, 0x00, 0x00, 0x44, 0x89, 0xc4, 0x00, 0x00, 0x38, 0x11, 0x2f, 0x3d, 0x6d, 0xc2, 0xa0, 0x04,
+			0x5f, 0xd3, 0x5c, 0x0e, 0xe1, 0xa6, 0x00, 0x35, 0x00, 0x30, 0xa5, 0x97, 0xf6, 0x18, 0x00, 0x10,
+			0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x70, 0x69, 0x63, 0x73, 0x6c, 0x69, 0x66,
+			0x65, 0x02, 0x72, 0x75, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x29, 0x10, 0x00, 0x00, 0x00,
+			0x80, 0x00, 0x00, 0x00,
+		},
+		ipChecksum: 0x2f3d,
+		l4Checksum: 0xa597,
+		l4Offset:   6,
+	},
+	{
+		// 10:30:00.389666 IP 10.77.43.131.60718 > 10.1.0.17.53: 18245 updateD [b2&3=0x5420] [18516a] [12064q] [21584n] [12081au][|domain]
+		name: "UDP with an odd length",
+		kind: "udp",
+		data: []byte{
+			0x45, 0x00, 0x00, 0x39, 0xd4, 0x31, 0x00, 0x00, 0xf3, 0x11, 0xb3, 0xa0, 0x0a, 0x4d, 0x2b, 0x83,
+			0x0a, 0x01, 0x00, 0x11, 0xed, 0x2e, 0x00, 0x35, 0x00, 0x25, 0x08, 0x32, 0x47, 0x45, 0x54, 0x20,
+			0x2f, 0x20, 0x48, 0x54, 0x54, 0x50, 0x2f, 0x31, 0x2e, 0x31, 0x0d, 0x0a, 0x48, 0x6f, 0x73, 0x74,
+			0x3a, 0x20, 0x77, 0x77, 0x77, 0x0d, 0x0a, 0x0d, 0x0a,
+		},
+		ipChecksum: 0xb3a0,
+		l4Checksum: 0x0832,
+		l4Offset:   6,
+	},
+}
+
+func (t *TestSuite) TestInternetChecksum(c *C) {
+	// the example from section 3 of RFC 1071
+	c.Check(packets.InternetChecksum([]byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}), Equals, uint16(0x220d))
+
+	// the odd byte should be treated as the high byte of a zero-padded word
+	c.Check(packets.InternetChecksum([]byte{0x00, 0x01, 0xf2}), Equals, ^uint16(0xf201))
+	c.Check(packets.InternetChecksum([]byte{}), Equals, uint16(0xffff))
+
+	// the example IPv4 header used by the Wikipedia article on the IPv4 header checksum
+	header := []byte{
+		0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11,
+		0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7,
+	}
+
+	c.Check(packets.InternetChecksum(header), Equals, uint16(0xb861))
+
+	for _, p := range checksumCorpus {
+		data := make([]byte, len(p.data))
+		copy(data, p.data)
+
+		// a header containing a valid checksum should sum to zero
+		c.Check(packets.InternetChecksum(data[:20]), Equals, uint16(0), Commentf(p.name))
+
+		binary.BigEndian.PutUint16(data[10:12], 0)
+		c.Check(packets.InternetChecksum(data[:20]), Equals, p.ipChecksum, Commentf(p.name))
+
+		l4 := data[20:]
+		binary.BigEndian.PutUint16(l4[p.l4Offset:], 0)
+
+		src := netip.AddrFrom4([4]byte(data[12:16])).String()
+		dst := netip.AddrFrom4([4]byte(data[16:20])).String()
+
+		csum, err := packets.ChecksumIPv4(l4, p.kind, src, dst)
+		c.Assert(err, IsNil)
+		c.Check(csum, Equals, p.l4Checksum, Commentf(p.name))
+	}
+}
+
+func (t *TestSuite) TestIPv4Header_Marshal_ChecksumCorpus(c *C) {
+	for _, p := range checksumCorpus {
+		header, err := packets.UnmarshalIPv4Header(p.data)
+		c.Assert(err, IsNil)
+
+		header.Checksum = 0
+
+		data, err := header.Marshal()
+		c.Assert(err, IsNil)
+		c.Check(data, DeepEquals, p.data, Commentf(p.name))
+	}
+}
+
+func (t *TestSuite) TestChecksumUpdate16(c *C) {
+	data := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+
+	csum := packets.InternetChecksum(data)
+
+	binary.BigEndian.PutUint16(data[2:4], 0x1234)
+
+	c.Check(packets.ChecksumUpdate16(csum, 0xf203, 0x1234), Equals, packets.InternetChecksum(data))
+
+	// a change that doesn't change the value shouldn't change the checksum
+	c.Check(packets.ChecksumUpdate16(csum, 0xf203, 0xf203), Equals, csum)
+}
+
+func (t *TestSuite) TestChecksumUpdate32(c *C) {
+	// rewrite the source address and port of the captured TCP segment,
+	// the same as a NAT would, and make sure the incrementally updated
+	// checksums match the ones calculated from scratch
+	p := checksumCorpus[0]
+
+	data := make([]byte, len(p.data))
+	copy(data, p.data)
+
+	oldAddr, newAddr := binary.BigEndian.Uint32(data[12:16]), uint32(0x0a000001) // 10.0.0.1
+	oldPort, newPort := binary.BigEndian.Uint16(data[20:22]), uint16(40000)
+
+	ipCsum := packets.ChecksumUpdate32(p.ipChecksum, oldAddr, newAddr)
+	tcpCsum := packets.ChecksumUpdate32(p.l4Checksum, oldAddr, newAddr)
+	tcpCsum = packets.ChecksumUpdate16(tcpCsum, oldPort, newPort)
+
+	binary.BigEndian.PutUint32(data[12:16], newAddr)
+	binary.BigEndian.PutUint16(data[20:22], newPort)
+
+	// zero the checksums to calculate them from scratch
+	binary.BigEndian.PutUint16(data[10:12], 0)
+	binary.BigEndian.PutUint16(data[20+p.l4Offset:], 0)
+
+	c.Check(ipCsum, Equals, packets.InternetChecksum(data[:20]))
+
+	expected, err := packets.ChecksumIPv4(data[20:], p.kind, "10.0.0.1", "192.168.0.2")
+	c.Assert(err, IsNil)
+	c.Check(tcpCsum, Equals, expected)
+}
@@ -0,0 +1,466 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import "github.com/theckman/packets/err"
+
+// LayerType is the type used to identify the protocol of a Layer, and to tell
+// Decode() what the first layer of the data is.
+type LayerType uint8
+
+// These are the types of the layers that can be decoded by Decode().
+const (
+	LayerTypeEthernet LayerType = iota + 1
+	LayerTypeIPv4
+	LayerTypeIPv6
+	LayerTypeTCP
+	LayerTypeUDP
+	LayerTypeUnknownPayload
+	LayerTypeARP
+	LayerTypeICMPv4
+	LayerTypeICMPv6
+	LayerTypeIPv6HopByHop
+	LayerTypeIPv6Routing
+	LayerTypeIPv6Fragment
+	LayerTypeIPv6DestinationOptions
+)
+
+// These are the IP protocol numbers (the IPv4 Protocol and IPv6 NextHeader
+// fields) of the protocols understood by this package.
+const (
+	IPProtocolIPv6HopByHop           uint8 = 0
+	IPProtocolICMPv4                 uint8 = 1
+	IPProtocolTCP                    uint8 = 6
+	IPProtocolUDP                    uint8 = 17
+	IPProtocolIPv6Routing            uint8 = 43
+	IPProtocolIPv6Fragment           uint8 = 44
+	IPProtocolICMPv6                 uint8 = 58
+	IPProtocolIPv6NoNextHeader       uint8 = 59
+	IPProtocolIPv6DestinationOptions uint8 = 60
+)
+
+var layerTypeNames = map[LayerType]string{
+	LayerTypeEthernet:       "Ethernet",
+	LayerTypeIPv4:           "IPv4",
+	LayerTypeIPv6:           "IPv6",
+	LayerTypeTCP:            "TCP",
+	LayerTypeUDP:            "UDP",
+	LayerTypeUnknownPayload: "UnknownPayload",
+	LayerTypeARP:            "ARP",
+	LayerTypeICMPv4:         "ICMPv4",
+	LayerTypeICMPv6:         "ICMPv6",
+
+	LayerTypeIPv6HopByHop:           "IPv6HopByHop",
+	LayerTypeIPv6Routing:            "IPv6Routing",
+	LayerTypeIPv6Fragment:           "IPv6Fragment",
+	LayerTypeIPv6DestinationOptions: "IPv6DestinationOptions",
+}
+
+func (lt LayerType) String() string {
+	if name, ok := layerTypeNames[lt]; ok {
+		return name
+	}
+
+	return "Unknown"
+}
+
+// Layer is the interface implemented by each of the layers of a decoded Packet.
+// Use a type assertion, or one of the Packet methods, to get to the concrete
+// type of the layer.
+type Layer interface {
+	LayerType() LayerType
+}
+
+// LayerType returns LayerTypeEthernet.
+func (eth *EthernetHeader) LayerType() LayerType { return LayerTypeEthernet }
+
+// LayerType returns LayerTypeARP.
+func (arp *ARPPacket) LayerType() LayerType { return LayerTypeARP }
+
+// LayerType returns LayerTypeIPv4.
+func (ip *IPv4Header) LayerType() LayerType { return LayerTypeIPv4 }
+
+// LayerType returns LayerTypeIPv6.
+func (ip *IPv6Header) LayerType() LayerType { return LayerTypeIPv6 }
+
+// LayerType returns LayerTypeIPv6HopByHop.
+func (h *IPv6HopByHopHeader) LayerType() LayerType { return LayerTypeIPv6HopByHop }
+
+// LayerType returns LayerTypeIPv6Routing.
+func (h *IPv6RoutingHeader) LayerType() LayerType { return LayerTypeIPv6Routing }
+
+// LayerType returns LayerTypeIPv6Fragment.
+func (h *IPv6FragmentHeader) LayerType() LayerType { return LayerTypeIPv6Fragment }
+
+// LayerType returns LayerTypeIPv6DestinationOptions.
+func (h *IPv6DestinationOptionsHeader) LayerType() LayerType { return LayerTypeIPv6DestinationOptions }
+
+// LayerType returns LayerTypeICMPv4.
+func (icmp *ICMPv4Message) LayerType() LayerType { return LayerTypeICMPv4 }
+
+// LayerType returns LayerTypeICMPv6.
+func (icmp *ICMPv6Message) LayerType() LayerType { return LayerTypeICMPv6 }
+
+// LayerType returns LayerTypeTCP.
+func (tcp *TCPHeader) LayerType() LayerType { return LayerTypeTCP }
+
+// LayerType returns LayerTypeUDP.
+func (udp *UDPHeader) LayerType() LayerType { return LayerTypeUDP }
+
+// UnknownPayload is a Layer holding data that Decode() doesn't understand. This
+// is the case for any protocol without a decoder in this package, as well as
+// for IPv4 fragments. The Protocol of the previous layer can be used to figure
+// out what the data is.
+type UnknownPayload struct {
+	Data []byte
+}
+
+// LayerType returns LayerTypeUnknownPayload.
+func (p *UnknownPayload) LayerType() LayerType { return LayerTypeUnknownPayload }
+
+// Packet is a struct holding the layers of decoded data, in the order they
+// were found.
+type Packet struct {
+	Layers []Layer
+}
+
+// Decode is a function that takes a byte slice and decodes each of the layers
+// within it, starting with the type of layer provided. The type of each layer
+// following the first is determined by the previous one, using the EtherType
+// of Ethernet headers and the protocol number of IP headers. Decoding stops
+// after the ARP packet or ICMP message, or the TCP or UDP header whose Payload
+// holds the rest of the data.
+//
+// If a layer's protocol isn't understood, the rest of the data is returned as an
+// UnknownPayload layer instead of as an error. This includes the first layer, if
+// its type isn't one that can be decoded. The layers are parsed with the
+// Unmarshal functions of each type, so they don't share memory with the data
+// provided, and the data is validated the same way.
+//
+// If a layer fails to decode, the returned *Packet contains the layers which
+// were decoded before it along with the error from that layer. This allows the
+// headers of a truncated packet to be inspected. The error is a
+// packetserr.DecodeError, with the Offset counted from the start of the data
+// provided rather than the start of the layer.
+func Decode(data []byte, first LayerType) (*Packet, error) {
+	packet := &Packet{}
+
+	var start int
+
+	for next := first; ; {
+		layer, nextType, rest, n, err := decodeLayer(data, next)
+		if err != nil {
+			return packet, shiftDecodeError(err, start)
+		}
+
+		packet.Layers = append(packet.Layers, layer)
+
+		if nextType == 0 {
+			return packet, nil
+		}
+
+		next, data = nextType, rest
+		start += n
+	}
+}
+
+// decodeLayer decodes a single layer of the type provided, returning the type
+// and data of the layer following it, along with the offset of that data within
+// the data provided. If there isn't one, the type is zero.
+func decodeLayer(data []byte, lt LayerType) (Layer, LayerType, []byte, int, error) {
+	switch lt {
+	case LayerTypeEthernet:
+		eth, err := unmarshalEthernetHeader(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return eth, etherTypeLayerType(eth.EtherType), eth.Payload, len(data) - len(eth.Payload), nil
+	case LayerTypeARP:
+		arp, err := unmarshalARPPacket(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return arp, 0, nil, 0, nil
+	case LayerTypeIPv4:
+		ip, err := unmarshalIPv4Header(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		// only the first fragment contains the transport header, and even
+		// that won't contain the whole of the segment or datagram
+		if ip.MF || ip.FragmentOffset != 0 {
+			return ip, payloadLayerType(ip.Payload), ip.Payload, int(ip.IHL) * 4, nil
+		}
+
+		return ip, ipv4ProtocolLayerType(ip.Protocol, ip.Payload), ip.Payload, int(ip.IHL) * 4, nil
+	case LayerTypeIPv6:
+		ip, err := unmarshalIPv6Header(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return ip, ipv6NextHeaderLayerType(ip.NextHeader, ip.Payload), ip.Payload, ipv6HeaderLen, nil
+	case LayerTypeIPv6HopByHop, LayerTypeIPv6Routing, LayerTypeIPv6Fragment, LayerTypeIPv6DestinationOptions:
+		header, n, err := unmarshalIPv6ExtensionHeader(ipv6ExtensionHeaderType(lt), data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		rest := data[n:]
+
+		// like IPv4, only the first fragment contains the
+		// headers following the Fragment header
+		if frag, ok := header.(*IPv6FragmentHeader); ok && (frag.M || frag.FragmentOffset != 0) {
+			return header, payloadLayerType(rest), rest, n, nil
+		}
+
+		return header, ipv6NextHeaderLayerType(header.nextHeader(), rest), rest, n, nil
+	case LayerTypeICMPv4:
+		icmp, err := unmarshalICMPv4Message(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return icmp, 0, nil, 0, nil
+	case LayerTypeICMPv6:
+		icmp, err := unmarshalICMPv6Message(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return icmp, 0, nil, 0, nil
+	case LayerTypeTCP:
+		tcp, err := unmarshalTCPHeader(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return tcp, 0, nil, 0, nil
+	case LayerTypeUDP:
+		udp, err := unmarshalUDPHeader(data)
+		if err != nil {
+			return nil, 0, nil, 0, err
+		}
+
+		return udp, 0, nil, 0, nil
+	default:
+		return &UnknownPayload{Data: copyBytes(data)}, 0, nil, 0, nil
+	}
+}
+
+// headerField is the name of a field of a header, along with its offset from
+// the start of the header, for describing where decoding failed.
+type headerField struct {
+	offset int
+	name   string
+}
+
+// fieldAt returns the field containing the byte at the offset, from the fields
+// of a header in the order they appear.
+func fieldAt(fields []headerField, offset int) headerField {
+	field := fields[0]
+
+	for _, f := range fields[1:] {
+		if f.offset > offset {
+			break
+		}
+
+		field = f
+	}
+
+	return field
+}
+
+// decodeError wraps the error from decoding the field at the offset within the
+// layer in a packetserr.DecodeError.
+func decodeError(lt LayerType, field string, offset int, err error) error {
+	return packetserr.DecodeError{Layer: lt.String(), Field: field, Offset: offset, Err: err}
+}
+
+// truncatedError wraps the error for data that ends after n bytes, in the middle
+// of one of the fields of the header, in a packetserr.DecodeError for that field.
+func truncatedError(lt LayerType, fields []headerField, n int, err error) error {
+	field := fieldAt(fields, n)
+
+	return decodeError(lt, field.name, field.offset, err)
+}
+
+// shiftDecodeError adds n to the Offset of a packetserr.DecodeError, for when the
+// data that was decoded starts n bytes in to the data the caller provided.
+func shiftDecodeError(err error, n int) error {
+	if de, ok := err.(packetserr.DecodeError); ok {
+		de.Offset += n
+		return de
+	}
+
+	return err
+}
+
+func etherTypeLayerType(etherType uint16) LayerType {
+	switch etherType {
+	case EtherTypeIPv4:
+		return LayerTypeIPv4
+	case EtherTypeARP:
+		return LayerTypeARP
+	case EtherTypeIPv6:
+		return LayerTypeIPv6
+	default:
+		return LayerTypeUnknownPayload
+	}
+}
+
+func ipv4ProtocolLayerType(protocol uint8, payload []byte) LayerType {
+	if protocol == IPProtocolICMPv4 {
+		return LayerTypeICMPv4
+	}
+
+	return ipProtocolLayerType(protocol, payload)
+}
+
+func ipv6NextHeaderLayerType(nextHeader uint8, payload []byte) LayerType {
+	switch nextHeader {
+	case IPProtocolICMPv6:
+		return LayerTypeICMPv6
+	case IPProtocolIPv6HopByHop:
+		return LayerTypeIPv6HopByHop
+	case IPProtocolIPv6Routing:
+		return LayerTypeIPv6Routing
+	case IPProtocolIPv6Fragment:
+		return LayerTypeIPv6Fragment
+	case IPProtocolIPv6DestinationOptions:
+		return LayerTypeIPv6DestinationOptions
+	default:
+		return ipProtocolLayerType(nextHeader, payload)
+	}
+}
+
+// ipv6ExtensionHeaderType returns the IP protocol number of the layer type of an
+// IPv6 extension header.
+func ipv6ExtensionHeaderType(lt LayerType) uint8 {
+	switch lt {
+	case LayerTypeIPv6HopByHop:
+		return IPProtocolIPv6HopByHop
+	case LayerTypeIPv6Routing:
+		return IPProtocolIPv6Routing
+	case LayerTypeIPv6Fragment:
+		return IPProtocolIPv6Fragment
+	default:
+		return IPProtocolIPv6DestinationOptions
+	}
+}
+
+// ipProtocolLayerType returns the type of the layers common to IPv4 and IPv6.
+func ipProtocolLayerType(protocol uint8, payload []byte) LayerType {
+	switch protocol {
+	case IPProtocolTCP:
+		return LayerTypeTCP
+	case IPProtocolUDP:
+		return LayerTypeUDP
+	default:
+		return payloadLayerType(payload)
+	}
+}
+
+// payloadLayerType returns LayerTypeUnknownPayload, unless there is no data in
+// which case there is no layer to decode.
+func payloadLayerType(payload []byte) LayerType {
+	if len(payload) == 0 {
+		return 0
+	}
+
+	return LayerTypeUnknownPayload
+}
+
+// Layer is a method to find the first layer of the type provided. If there
+// isn't one, nil is returned.
+func (p *Packet) Layer(lt LayerType) Layer {
+	for _, layer := range p.Layers {
+		if layer.LayerType() == lt {
+			return layer
+		}
+	}
+
+	return nil
+}
+
+// Ethernet is a method to get the first *EthernetHeader of the Packet. If there
+// isn't one, nil is returned.
+func (p *Packet) Ethernet() *EthernetHeader {
+	eth, _ := p.Layer(LayerTypeEthernet).(*EthernetHeader)
+	return eth
+}
+
+// ARP is a method to get the *ARPPacket of the Packet. If there isn't one, nil
+// is returned.
+func (p *Packet) ARP() *ARPPacket {
+	arp, _ := p.Layer(LayerTypeARP).(*ARPPacket)
+	return arp
+}
+
+// IPv4 is a method to get the first *IPv4Header of the Packet. If there isn't
+// one, nil is returned.
+func (p *Packet) IPv4() *IPv4Header {
+	ip, _ := p.Layer(LayerTypeIPv4).(*IPv4Header)
+	return ip
+}
+
+// IPv6 is a method to get the first *IPv6Header of the Packet. If there isn't
+// one, nil is returned.
+func (p *Packet) IPv6() *IPv6Header {
+	ip, _ := p.Layer(LayerTypeIPv6).(*IPv6Header)
+	return ip
+}
+
+// IPv6ExtensionHeaders is a method to get the IPv6 extension headers of the
+// Packet, in the order they appear. If there aren't any, nil is returned.
+func (p *Packet) IPv6ExtensionHeaders() IPv6ExtensionHeaders {
+	var hdrs IPv6ExtensionHeaders
+
+	for _, layer := range p.Layers {
+		if header, ok := layer.(IPv6ExtensionHeader); ok {
+			hdrs = append(hdrs, header)
+		}
+	}
+
+	return hdrs
+}
+
+// ICMPv4 is a method to get the *ICMPv4Message of the Packet. If there isn't
+// one, nil is returned.
+func (p *Packet) ICMPv4() *ICMPv4Message {
+	icmp, _ := p.Layer(LayerTypeICMPv4).(*ICMPv4Message)
+	return icmp
+}
+
+// ICMPv6 is a method to get the *ICMPv6Message of the Packet. If there isn't
+// one, nil is returned.
+func (p *Packet) ICMPv6() *ICMPv6Message {
+	icmp, _ := p.Layer(LayerTypeICMPv6).(*ICMPv6Message)
+	return icmp
+}
+
+// TCP is a method to get the *TCPHeader of the Packet. If there isn't one, nil
+// is returned.
+func (p *Packet) TCP() *TCPHeader {
+	tcp, _ := p.Layer(LayerTypeTCP).(*TCPHeader)
+	return tcp
+}
+
+// UDP is a method to get the *UDPHeader of the Packet. If there isn't one, nil
+// is returned.
+func (p *Packet) UDP() *UDPHeader {
+	udp, _ := p.Layer(LayerTypeUDP).(*UDPHeader)
+	return udp
+}
+
+// UnknownPayload is a method to get the *UnknownPayload of the Packet. If there
+// isn't one, nil is returned.
+func (p *Packet) UnknownPayload() *UnknownPayload {
+	payload, _ := p.Layer(LayerTypeUnknownPayload).(*UnknownPayload)
+	return payload
+}
@@ -0,0 +1,334 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+// ethernetFrame prepends an Ethernet header, with the EtherType provided, to
+// the data.
+func ethernetFrame(etherType uint16, data []byte) []byte {
+	frame := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb,
+		uint8(etherType >> 8), uint8(etherType),
+	}
+
+	return append(frame, data...)
+}
+
+func (t *TestSuite) TestDecode_IPv4TCP(c *C) {
+	p := checksumCorpus[0]
+
+	// include the padding of a minimum size frame
+	frame := append(ethernetFrame(packets.EtherTypeIPv4, p.data), make([]byte, 8)...)
+
+	packet, err := packets.Decode(frame, packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 3)
+
+	c.Check(packet.Layers[0].LayerType(), Equals, packets.LayerTypeEthernet)
+	c.Check(packet.Layers[1].LayerType(), Equals, packets.LayerTypeIPv4)
+	c.Check(packet.Layers[2].LayerType(), Equals, packets.LayerTypeTCP)
+
+	c.Check(packet.Ethernet(), Equals, packet.Layers[0])
+	c.Check(packet.Ethernet().EtherType, Equals, packets.EtherTypeIPv4)
+
+	ip, err := packets.UnmarshalIPv4Header(p.data)
+	c.Assert(err, IsNil)
+	c.Check(packet.IPv4(), DeepEquals, ip)
+
+	tcp, err := packets.UnmarshalTCPHeader(p.data[20:])
+	c.Assert(err, IsNil)
+	c.Check(packet.TCP(), DeepEquals, tcp)
+	c.Check(string(packet.TCP().Payload), Equals, "Test")
+
+	c.Check(packet.IPv6(), IsNil)
+	c.Check(packet.UDP(), IsNil)
+	c.Check(packet.UnknownPayload(), IsNil)
+
+	//
+	// TEST STARTING FROM THE IP LAYER
+	//
+	packet, err = packets.Decode(p.data, packets.LayerTypeIPv4)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.Ethernet(), IsNil)
+	c.Check(packet.TCP(), DeepEquals, tcp)
+}
+
+func (t *TestSuite) TestDecode_IPv6UDP(c *C) {
+	udp, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	t.ip6.Payload = udp
+
+	ip, err := t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err := packets.Decode(ethernetFrame(packets.EtherTypeIPv6, ip), packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 3)
+
+	c.Check(packet.IPv6().NextHeader, Equals, packets.IPProtocolUDP)
+	c.Check(packet.UDP().SourcePort, Equals, uint16(4242))
+	c.Check(packet.UDP().DestinationPort, Equals, uint16(53))
+	c.Check(packet.UDP().Payload, DeepEquals, []byte{42, 128, 0, 0})
+}
+
+func (t *TestSuite) TestDecode_IPv6ExtensionHeaders(c *C) {
+	udp, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	hdrs := packets.IPv6ExtensionHeaders{
+		&packets.IPv6HopByHopHeader{
+			Options: []*packets.IPv6Option{
+				{Type: packets.IPv6OptionTypeRouterAlert, Data: []byte{0x00, 0x00}},
+			},
+		},
+		&packets.IPv6FragmentHeader{Identification: 0xdeadbeef},
+	}
+
+	ext, err := hdrs.Marshal(packets.IPProtocolUDP)
+	c.Assert(err, IsNil)
+
+	t.ip6.NextHeader = hdrs.NextHeader(packets.IPProtocolUDP)
+	t.ip6.Payload = append(ext, udp...)
+
+	ip, err := t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err := packets.Decode(ip, packets.LayerTypeIPv6)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 4)
+
+	c.Check(packet.Layers[1].LayerType(), Equals, packets.LayerTypeIPv6HopByHop)
+	c.Check(packet.Layers[2].LayerType(), Equals, packets.LayerTypeIPv6Fragment)
+	c.Check(packet.Layers[3].LayerType(), Equals, packets.LayerTypeUDP)
+	c.Check(packet.UDP().DestinationPort, Equals, uint16(53))
+
+	decoded := packet.IPv6ExtensionHeaders()
+	c.Assert(len(decoded), Equals, 2)
+	c.Check(decoded[1].(*packets.IPv6FragmentHeader).Identification, Equals, uint32(0xdeadbeef))
+
+	//
+	// TEST A FRAGMENTED PACKET
+	//
+	hdrs[1].(*packets.IPv6FragmentHeader).M = true
+
+	ext, err = hdrs.Marshal(packets.IPProtocolUDP)
+	c.Assert(err, IsNil)
+
+	t.ip6.Payload = append(ext, udp...)
+
+	ip, err = t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err = packets.Decode(ip, packets.LayerTypeIPv6)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 4)
+	c.Check(packet.UDP(), IsNil)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, udp)
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderTruncated
+	//
+	t.ip6.Payload = ext[:12]
+
+	ip, err = t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err = packets.Decode(ip, packets.LayerTypeIPv6)
+	c.Assert(err, Not(IsNil))
+	c.Check(len(packet.Layers), Equals, 2)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6Fragment",
+		Field:  "Identification",
+		Offset: 52,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6Fragment, ExpectedSize: 8, Len: 4},
+	})
+}
+
+func (t *TestSuite) TestDecode_UnknownPayload(c *C) {
+	// an unknown EtherType
+	packet, err := packets.Decode(ethernetFrame(0x88cc, []byte{1, 2, 3}), packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{1, 2, 3})
+
+	// an unknown IP protocol
+	t.ip4.Protocol = 47
+
+	ip, err := t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err = packets.Decode(ip, packets.LayerTypeIPv4)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.IPv4().Protocol, Equals, uint8(47))
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{42, 128, 0, 0})
+
+	// an unknown IP protocol without a payload has no payload layer
+	t.ip4.Payload = nil
+
+	ip, err = t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err = packets.Decode(ip, packets.LayerTypeIPv4)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 1)
+
+	// the first layer isn't one that can be decoded
+	packet, err = packets.Decode([]byte{1, 2, 3}, packets.LayerTypeUnknownPayload)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 1)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{1, 2, 3})
+
+	packet, err = packets.Decode([]byte{1, 2, 3}, 0)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 1)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{1, 2, 3})
+}
+
+func (t *TestSuite) TestDecode_Fragment(c *C) {
+	// fragments aren't decoded past the IP layer,
+	// even if it's the first fragment
+	t.ip4.MF = true
+	t.ip4.DF = false
+
+	ip, err := t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err := packets.Decode(ip, packets.LayerTypeIPv4)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.UDP(), IsNil)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{42, 128, 0, 0})
+
+	t.ip4.MF = false
+	t.ip4.FragmentOffset = 185
+
+	ip, err = t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err = packets.Decode(ip, packets.LayerTypeIPv4)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.UnknownPayload().Data, DeepEquals, []byte{42, 128, 0, 0})
+}
+
+func (t *TestSuite) TestDecode_Truncated(c *C) {
+	p := checksumCorpus[0]
+
+	// chop the TCP header off part way through its options, after
+	// fixing up the IPv4 TotalLength so that it's still valid
+	data := make([]byte, 44)
+	copy(data, p.data)
+
+	data[3] = 44
+
+	packet, err := packets.Decode(ethernetFrame(packets.EtherTypeIPv4, data), packets.LayerTypeEthernet)
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "Options",
+		Offset: 54,
+		Err:    packetserr.TCPHeaderTruncated{ExpectedSize: 28, Len: 24},
+	})
+
+	// the layers before the TCP header are still available
+	c.Assert(packet, Not(IsNil))
+	c.Assert(len(packet.Layers), Equals, 2)
+	c.Check(packet.Ethernet(), Not(IsNil))
+	c.Check(packet.IPv4().TotalLength, Equals, uint16(44))
+	c.Check(packet.TCP(), IsNil)
+
+	// the error can be checked for by its category, or its type
+	c.Check(errors.Is(err, packetserr.ErrTruncated), Equals, true)
+
+	var truncated packetserr.TCPHeaderTruncated
+
+	c.Assert(errors.As(err, &truncated), Equals, true)
+	c.Check(truncated.ExpectedSize, Equals, 28)
+
+	// truncated at the first layer
+	packet, err = packets.Decode(data[:10], packets.LayerTypeEthernet)
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "Ethernet",
+		Field:  "SourceAddress",
+		Offset: 6,
+		Err:    packetserr.EthernetHeaderTruncated{ExpectedSize: 14, Len: 10},
+	})
+	c.Assert(packet, Not(IsNil))
+	c.Check(len(packet.Layers), Equals, 0)
+}
+
+func (t *TestSuite) TestLayerType_String(c *C) {
+	c.Check(packets.LayerTypeEthernet.String(), Equals, "Ethernet")
+	c.Check(packets.LayerTypeTCP.String(), Equals, "TCP")
+	c.Check(packets.LayerTypeUnknownPayload.String(), Equals, "UnknownPayload")
+	c.Check(packets.LayerTypeIPv6Fragment.String(), Equals, "IPv6Fragment")
+	c.Check(packets.LayerType(0).String(), Equals, "Unknown")
+}
+
+func (t *TestSuite) TestDecode_VLAN(c *C) {
+	eth := &packets.EthernetHeader{
+		DestinationAddress: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		SourceAddress:      net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb},
+		VLANTags:           []packets.VLANTag{{VID: 100}, {VID: 42}},
+		EtherType:          packets.EtherTypeIPv4,
+		Payload:            checksumCorpus[1].data,
+	}
+
+	frame, err := eth.Marshal()
+	c.Assert(err, IsNil)
+
+	packet, err := packets.Decode(frame, packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 3)
+
+	c.Check(len(packet.Ethernet().VLANTags), Equals, 2)
+	c.Check(packet.UDP().DestinationPort, Equals, uint16(53))
+}
+
+func (t *TestSuite) TestDecode_ARP(c *C) {
+	packet, err := packets.Decode(ethernetFrame(packets.EtherTypeARP, arpRequest), packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 2)
+
+	c.Check(packet.Layers[1].LayerType(), Equals, packets.LayerTypeARP)
+	c.Check(packet.ARP().Operation, Equals, packets.ARPOperationRequest)
+	c.Check(packet.IPv4(), IsNil)
+}
+
+func (t *TestSuite) TestDecode_ICMPv4(c *C) {
+	packet, err := packets.Decode(icmpUnreachableFrame, packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 3)
+
+	c.Check(packet.Layers[2].LayerType(), Equals, packets.LayerTypeICMPv4)
+	c.Check(packet.ICMPv4().Type, Equals, packets.ICMPv4TypeDestinationUnreachable)
+	c.Check(packet.ICMPv4().Code, Equals, packets.ICMPv4CodeCommunicationProhibited)
+	c.Check(len(packet.ICMPv4().Data), Equals, 28)
+}
+
+func (t *TestSuite) TestDecode_ICMPv6(c *C) {
+	packet, err := packets.Decode(icmpv6RouterAdvertisementFrame, packets.LayerTypeEthernet)
+	c.Assert(err, IsNil)
+	c.Assert(len(packet.Layers), Equals, 3)
+
+	c.Check(packet.IPv6().NextHeader, Equals, packets.IPProtocolICMPv6)
+	c.Check(packet.Layers[2].LayerType(), Equals, packets.LayerTypeICMPv6)
+	c.Check(packet.ICMPv6().Type, Equals, packets.ICMPv6TypeRouterAdvertisement)
+	c.Check(len(packet.ICMPv6().Options), Equals, 3)
+	c.Check(packet.ICMPv4(), IsNil)
+}
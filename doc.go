@@ -5,7 +5,16 @@
 // Package packets is for the creation/manipulation of raw TCP packets for sending over the network.
 // It was designed to have a idiomatic (or so I think) interface.
 //
+// Marshaling never modifies the header being marshaled. Any fields that are filled in
+// automatically, such as lengths and checksums, are only filled in within the marshaled
+// data. This means the same header can be marshaled from multiple goroutines at once, as
+// long as nothing modifies it at the same time.
+//
 // This package does have some internal error types that can be returned as errors from within
 // this package. It's recommended you take a look at the packetserr package documenation as well.
 // The packetserr package is a sub-package of packets.
+//
+// Errors from decoding data are returned as a packetserr.DecodeError, which says which
+// layer and field failed to decode and where it is in the data. Every error belongs to a
+// category, such as packetserr.ErrTruncated, that can be checked for with errors.Is().
 package packets
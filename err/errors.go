@@ -4,20 +4,120 @@
 
 // Package packetserr is the package which contains the errors for the packets package.
 // This package on its own doesn't do much and is depended on by the packets package.
+//
+// Every error belongs to one of the categories ErrTruncated, ErrInvalid, ErrTooLarge,
+// ErrChecksum, and ErrUnsupported, which can be checked for with errors.Is() without
+// knowing the specific type of the error:
+//
+//	if errors.Is(err, packetserr.ErrTruncated) {
+//		// wait for more data
+//	}
+//
+// The specific types can still be compared against, or extracted with errors.As().
+// Errors from decoding data are wrapped in a DecodeError, which describes the layer,
+// field, and byte offset where decoding failed.
 package packetserr
 
 import (
 	"errors"
 	"fmt"
+	"io"
 )
 
+// These are the categories of errors. Each of the errors of this package wraps one of
+// them, so they're meant to be used with errors.Is() rather than returned on their own.
+var (
+	// ErrTruncated is the category of errors for data that ends before what's being
+	// decoded does.
+	ErrTruncated = errors.New("data truncated")
+
+	// ErrInvalid is the category of errors for fields and values that aren't valid,
+	// whether they were decoded or are being marshaled.
+	ErrInvalid = errors.New("invalid value")
+
+	// ErrTooLarge is the category of errors for data or values that are too large to
+	// be represented, or to fit the space available.
+	ErrTooLarge = errors.New("value too large")
+
+	// ErrChecksum is the category of errors for checksums that don't match the data.
+	ErrChecksum = errors.New("checksum mismatch")
+
+	// ErrUnsupported is the category of errors for data that may be valid, but that
+	// isn't supported by the packets package.
+	ErrUnsupported = errors.New("unsupported value")
+)
+
+// categoryError is the type of the errors of this package that don't have any
+// fields, so that they wrap their category.
+type categoryError struct {
+	msg      string
+	category error
+}
+
+func newError(category error, msg string) error {
+	return &categoryError{msg: msg, category: category}
+}
+
+func (e *categoryError) Error() string { return e.msg }
+
+func (e *categoryError) Unwrap() error { return e.category }
+
+// DecodeError is a type that implements the error interface. It's used for errors
+// decoding data, wrapping the error that caused decoding to fail with where it failed:
+// the Layer being decoded, the Field of its header, and the Offset of the field in bytes
+// from the start of the data. The Err is one of the other errors of this package, and
+// can be extracted with errors.As() or unwrapped with errors.Unwrap().
+type DecodeError struct {
+	Layer  string
+	Field  string
+	Offset int
+	Err    error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("decoding %s %s at offset %d: %s", e.Layer, e.Field, e.Offset, e.Err)
+}
+
+func (e DecodeError) Unwrap() error { return e.Err }
+
 // TCPDataOffsetInvalid is a type that implements the error interface. It's used for errors
 // marshaling the TCPHeader data.
-var TCPDataOffsetInvalid = errors.New("DataOffset field must be at least 5 and no more than 15")
+var TCPDataOffsetInvalid = newError(ErrInvalid, "DataOffset field must be at least 5 and no more than 15")
 
 // ChecksumInvalidKind is a type that implements the error interface. It's used when
-// an invalid packet kind is provided to the ChecksumIPv4 function.
-var ChecksumInvalidKind = errors.New("Checksum kind should either be 'tcp' OR 'udp'.")
+// an invalid packet kind is provided to the ChecksumIPv4 or ChecksumIPv6 functions.
+// The 'icmpv6' kind is only valid for ChecksumIPv6, as ICMPv6 is only carried by IPv6.
+var ChecksumInvalidKind = newError(ErrInvalid, "Checksum kind should be 'tcp', 'udp', or 'icmpv6' (IPv6 only).")
+
+// ChecksumAddressFamilyMismatch is a type that implements the error interface. It's used
+// when the local and remote addresses provided for checksumming aren't both IPv4 or
+// both IPv6 addresses.
+var ChecksumAddressFamilyMismatch = newError(ErrInvalid, "Checksum addresses must both be either IPv4 or IPv6 addresses")
+
+// IPv4IHLInvalid is a type that implements the error interface. It's used for errors
+// marshaling and unmarshaling the IPv4Header data.
+var IPv4IHLInvalid = newError(ErrInvalid, "IHL field must be at least 5 and no more than 15")
+
+// IPv4TotalLengthInvalid is a type that implements the error interface. It's used for
+// errors unmarshaling the IPv4Header data. Specifically, this is used when the TotalLength
+// field is smaller than the header itself.
+var IPv4TotalLengthInvalid = newError(ErrInvalid, "TotalLength field must be at least as large as the header")
+
+// IPv4FragmentationProhibited is a type that implements the error interface. It's used
+// when fragmenting an IPv4 packet. Specifically, this is used when the packet doesn't fit
+// in the MTU, but the DF field is set.
+var IPv4FragmentationProhibited = newError(ErrTooLarge, "DF field is set, but the packet must be fragmented to fit the MTU")
+
+// IPv4FragmentInvalid is a type that implements the error interface. It's used when
+// reassembling IPv4 fragments. Specifically, this is used when a fragment isn't a multiple
+// of 8 bytes without being the last fragment, extends past the maximum size of a packet,
+// or disagrees with the other fragments about where the packet ends.
+var IPv4FragmentInvalid = newError(ErrInvalid, "IPv4 fragment is inconsistent with the packet it belongs to")
+
+// PcapTimestampInvalid is a type that implements the error interface. It's used for errors
+// writing pcap and pcapng files. Specifically, this is used when the timestamp of a record
+// is before 1970, or too far in the future for the timestamp fields of the file.
+var PcapTimestampInvalid = newError(ErrInvalid, "pcap timestamp can't be represented in the file")
 
 // TCPDataOffsetTooSmall is a type that implements the error interface. It's used for errors
 // marshaling the TCPHeader data. Specifically, this is used when the DataOffset is too small
@@ -33,6 +133,8 @@ func (e TCPDataOffsetTooSmall) Error() string {
 	)
 }
 
+func (e TCPDataOffsetTooSmall) Is(target error) bool { return target == ErrInvalid }
+
 // TCPOptionsOverflow is a type that implements the error interface. It's used for errors
 // marshaling the TCPHeader data. Specifically, this is used when the TCP Options field exceeds
 // its maximum length as specified by the RFC.
@@ -44,6 +146,8 @@ func (e TCPOptionsOverflow) Error() string {
 	return fmt.Sprintf("TCP Options are too large, must be less than %d total bytes", e.MaxSize)
 }
 
+func (e TCPOptionsOverflow) Is(target error) bool { return target == ErrTooLarge }
+
 // TCPOptionDataInvalid is a type that implements the error interface. It's used for errors
 // marshaling the TCPHeader data. Specifically, this is used when the TCP Options Length field
 // doesn't match the data provided.
@@ -55,6 +159,8 @@ func (e TCPOptionDataInvalid) Error() string {
 	return fmt.Sprintf("Option %d Length doesn't match length of data", e.Index)
 }
 
+func (e TCPOptionDataInvalid) Is(target error) bool { return target == ErrInvalid }
+
 // TCPOptionDataTooLong is a type that implements the error interface. It's used for errors
 // marshaling the TCPHeader data. Specifically, this is use for when the TCP Options Data field is
 // too long for the Options field as per the RFC.
@@ -66,6 +172,86 @@ func (e TCPOptionDataTooLong) Error() string {
 	return fmt.Sprintf("Option %d Data cannot be larger than 253 bytes", e.Index)
 }
 
+func (e TCPOptionDataTooLong) Is(target error) bool { return target == ErrTooLarge }
+
+// TCPOptionLengthInvalid is a type that implements the error interface. It's used for errors
+// decoding a TCP option. Specifically, this is used when the Length of the option isn't valid
+// for its Kind.
+type TCPOptionLengthInvalid struct {
+	Kind, Length uint8
+}
+
+func (e TCPOptionLengthInvalid) Error() string {
+	return fmt.Sprintf("Option kind %d has an invalid Length of %d", e.Kind, e.Length)
+}
+
+func (e TCPOptionLengthInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// TCPOptionKindMismatch is a type that implements the error interface. It's used for errors
+// decoding a TCP option. Specifically, this is used when the option is decoded as a different
+// Kind than it is.
+type TCPOptionKindMismatch struct {
+	Expected, Kind uint8
+}
+
+func (e TCPOptionKindMismatch) Error() string {
+	return fmt.Sprintf("Option kind %d cannot be decoded as kind %d", e.Kind, e.Expected)
+}
+
+func (e TCPOptionKindMismatch) Is(target error) bool { return target == ErrInvalid }
+
+// TCPOptionWindowScaleTooLarge is a type that implements the error interface. It's used for
+// errors creating a Window Scale TCP option. Specifically, this is used when the shift count
+// is larger than the maximum of 14 specified by RFC 7323.
+type TCPOptionWindowScaleTooLarge struct {
+	Shift uint8
+}
+
+func (e TCPOptionWindowScaleTooLarge) Error() string {
+	return fmt.Sprintf("Window Scale shift count must be no more than 14, was %d", e.Shift)
+}
+
+func (e TCPOptionWindowScaleTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// TCPOptionSACKBlocksInvalid is a type that implements the error interface. It's used for
+// errors creating a SACK TCP option. Specifically, this is used when there are no blocks or
+// more blocks than can fit in the TCP Options field.
+type TCPOptionSACKBlocksInvalid struct {
+	Count int
+}
+
+func (e TCPOptionSACKBlocksInvalid) Error() string {
+	return fmt.Sprintf("SACK option must have between 1 and 4 blocks, had %d", e.Count)
+}
+
+func (e TCPOptionSACKBlocksInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// TCPOptionTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling TCP options. Specifically, this is used when an option extends past the end
+// of the data.
+type TCPOptionTruncated struct {
+	Offset int
+}
+
+func (e TCPOptionTruncated) Error() string {
+	return fmt.Sprintf("Option at offset %d is truncated", e.Offset)
+}
+
+func (e TCPOptionTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// TCPHeaderTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the TCPHeader data. Specifically, this is used when there is less data than
+// the minimum header size, or less than the size specified by the DataOffset field.
+type TCPHeaderTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e TCPHeaderTruncated) Error() string {
+	return fmt.Sprintf("TCP header should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e TCPHeaderTruncated) Is(target error) bool { return target == ErrTruncated }
+
 // UDPPayloadTooLarge is a type that implements the error interface. It's used for errors
 // marshaling the UDPHeader data. Specifically, this is use for when the UDP payload is too large.
 type UDPPayloadTooLarge struct {
@@ -78,3 +264,587 @@ func (e UDPPayloadTooLarge) Error() string {
 		e.MaxSize, e.Len,
 	)
 }
+
+func (e UDPPayloadTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv4IHLTooSmall is a type that implements the error interface. It's used for errors
+// marshaling the IPv4Header data. Specifically, this is used when the IHL is too small
+// for the amount of data in the IPv4 header.
+type IPv4IHLTooSmall struct {
+	ExpectedSize uint8
+}
+
+func (e IPv4IHLTooSmall) Error() string {
+	return fmt.Sprintf(
+		"The IHL field is too small for the data provided. It should be at least %d",
+		e.ExpectedSize,
+	)
+}
+
+func (e IPv4IHLTooSmall) Is(target error) bool { return target == ErrInvalid }
+
+// IPv4OptionsOverflow is a type that implements the error interface. It's used for errors
+// marshaling the IPv4Header data. Specifically, this is used when the IPv4 Options field
+// exceeds its maximum length as specified by the RFC.
+type IPv4OptionsOverflow struct {
+	MaxSize int
+}
+
+func (e IPv4OptionsOverflow) Error() string {
+	return fmt.Sprintf("IPv4 Options are too large, must be less than %d total bytes", e.MaxSize)
+}
+
+func (e IPv4OptionsOverflow) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv4PayloadTooLarge is a type that implements the error interface. It's used for errors
+// marshaling the IPv4Header data. Specifically, this is used for when the IPv4 payload
+// is too large to be represented by the TotalLength field.
+type IPv4PayloadTooLarge struct {
+	MaxSize, Len int
+}
+
+func (e IPv4PayloadTooLarge) Error() string {
+	return fmt.Sprintf(
+		"IPv4 Payload must not be larger than %d bytes, was %d bytes",
+		e.MaxSize, e.Len,
+	)
+}
+
+func (e IPv4PayloadTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv4FieldTooLarge is a type that implements the error interface. It's used for errors
+// marshaling the IPv4Header data. Specifically, this is used when a field holds a value
+// too large for the number of bits it occupies in the header.
+type IPv4FieldTooLarge struct {
+	Field    string
+	MaxValue int
+}
+
+func (e IPv4FieldTooLarge) Error() string {
+	return fmt.Sprintf("IPv4 %s field must be no more than %d", e.Field, e.MaxValue)
+}
+
+func (e IPv4FieldTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv4AddressInvalid is a type that implements the error interface. It's used when
+// an address that should be an IPv4 address is not one.
+type IPv4AddressInvalid struct {
+	Address string
+}
+
+func (e IPv4AddressInvalid) Error() string {
+	return fmt.Sprintf("%q is not a valid IPv4 address", e.Address)
+}
+
+func (e IPv4AddressInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// IPv4PacketTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the IPv4Header data. Specifically, this is used when there is less data than
+// the size of the header, or less than the size of the packet specified by the TotalLength field.
+type IPv4PacketTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e IPv4PacketTruncated) Error() string {
+	return fmt.Sprintf("IPv4 packet should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e IPv4PacketTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// IPv6PayloadTooLarge is a type that implements the error interface. It's used for errors
+// marshaling the IPv6Header data. Specifically, this is used for when the IPv6 payload
+// is too large to be represented by the PayloadLength field.
+type IPv6PayloadTooLarge struct {
+	MaxSize, Len int
+}
+
+func (e IPv6PayloadTooLarge) Error() string {
+	return fmt.Sprintf(
+		"IPv6 Payload must not be larger than %d bytes, was %d bytes",
+		e.MaxSize, e.Len,
+	)
+}
+
+func (e IPv6PayloadTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv6FieldTooLarge is a type that implements the error interface. It's used for errors
+// marshaling the IPv6Header data. Specifically, this is used when a field holds a value
+// too large for the number of bits it occupies in the header.
+type IPv6FieldTooLarge struct {
+	Field    string
+	MaxValue int
+}
+
+func (e IPv6FieldTooLarge) Error() string {
+	return fmt.Sprintf("IPv6 %s field must be no more than %d", e.Field, e.MaxValue)
+}
+
+func (e IPv6FieldTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv6AddressInvalid is a type that implements the error interface. It's used when
+// an address that should be an IPv6 address is not one.
+type IPv6AddressInvalid struct {
+	Address string
+}
+
+func (e IPv6AddressInvalid) Error() string {
+	return fmt.Sprintf("%q is not a valid IPv6 address", e.Address)
+}
+
+func (e IPv6AddressInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// IPv6PacketTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the IPv6Header data. Specifically, this is used when there is less data than
+// the size of the header, or less than the size of the packet specified by the PayloadLength field.
+type IPv6PacketTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e IPv6PacketTruncated) Error() string {
+	return fmt.Sprintf("IPv6 packet should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e IPv6PacketTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// UDPHeaderTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the UDPHeader data. Specifically, this is used when there is less data than
+// the size of the UDP header.
+type UDPHeaderTruncated struct {
+	Len int
+}
+
+func (e UDPHeaderTruncated) Error() string {
+	return fmt.Sprintf("UDP header should be 8 bytes, was %d bytes", e.Len)
+}
+
+func (e UDPHeaderTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// UDPLengthInvalid is a type that implements the error interface. It's used for errors
+// unmarshaling the UDPHeader data. Specifically, this is used when the Length field is
+// smaller than the UDP header, or larger than the data provided.
+type UDPLengthInvalid struct {
+	Length uint16
+	Len    int
+}
+
+func (e UDPLengthInvalid) Error() string {
+	return fmt.Sprintf("UDP Length field of %d is invalid for %d bytes of data", e.Length, e.Len)
+}
+
+func (e UDPLengthInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// BufferTooSmall is a type that implements the error interface. It's used for errors
+// marshaling in to a caller-provided buffer. Specifically, this is used when the buffer
+// is smaller than the marshaled data.
+type BufferTooSmall struct {
+	ExpectedSize, Len int
+}
+
+func (e BufferTooSmall) Error() string {
+	return fmt.Sprintf("buffer should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e BufferTooSmall) Is(target error) bool { return target == ErrTooLarge }
+
+// EthernetHeaderTruncated is a type that implements the error interface. It's used for
+// errors unmarshaling the EthernetHeader data. Specifically, this is used when there is
+// less data than the size of the Ethernet header.
+type EthernetHeaderTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e EthernetHeaderTruncated) Error() string {
+	return fmt.Sprintf("Ethernet header should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e EthernetHeaderTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// EthernetAddressInvalid is a type that implements the error interface. It's used for
+// errors marshaling the EthernetHeader data. Specifically, this is used when an address
+// is not a 6 byte MAC address.
+type EthernetAddressInvalid struct {
+	Address string
+}
+
+func (e EthernetAddressInvalid) Error() string {
+	return fmt.Sprintf("%q is not a valid Ethernet address", e.Address)
+}
+
+func (e EthernetAddressInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// VLANFieldTooLarge is a type that implements the error interface. It's used for errors
+// marshaling the VLAN tags of the EthernetHeader data. Specifically, this is used when a
+// field of the tag at the Index holds a value too large for the number of bits it occupies.
+type VLANFieldTooLarge struct {
+	Index    int
+	Field    string
+	MaxValue int
+}
+
+func (e VLANFieldTooLarge) Error() string {
+	return fmt.Sprintf("VLAN tag %d %s field must be no more than %d", e.Index, e.Field, e.MaxValue)
+}
+
+func (e VLANFieldTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// ARPPacketTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the ARPPacket data. Specifically, this is used when there is less data than
+// the size of the packet, including the addresses.
+type ARPPacketTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e ARPPacketTruncated) Error() string {
+	return fmt.Sprintf("ARP packet should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e ARPPacketTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// ARPProtocolSizeUnsupported is a type that implements the error interface. It's used for
+// errors unmarshaling the ARPPacket data. Specifically, this is used when the protocol
+// addresses are neither IPv4 nor IPv6 addresses.
+type ARPProtocolSizeUnsupported struct {
+	Size uint8
+}
+
+func (e ARPProtocolSizeUnsupported) Error() string {
+	return fmt.Sprintf("ARP protocol address size of %d is not supported, must be 4 or 16", e.Size)
+}
+
+func (e ARPProtocolSizeUnsupported) Is(target error) bool { return target == ErrUnsupported }
+
+// ARPAddressSizeMismatch is a type that implements the error interface. It's used for
+// errors marshaling the ARPPacket data. Specifically, this is used when the address in
+// the Field is not the Size of the other addresses of the same kind.
+type ARPAddressSizeMismatch struct {
+	Field     string
+	Size, Len int
+}
+
+func (e ARPAddressSizeMismatch) Error() string {
+	return fmt.Sprintf("ARP %s should be %d bytes, was %d bytes", e.Field, e.Size, e.Len)
+}
+
+func (e ARPAddressSizeMismatch) Is(target error) bool { return target == ErrInvalid }
+
+// ICMPMessageTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the ICMPv4Message and ICMPv6Message data. Specifically, this is used when
+// there is less data than the size of the ICMP header, or the body of the type of message.
+type ICMPMessageTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e ICMPMessageTruncated) Error() string {
+	return fmt.Sprintf("ICMP message should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e ICMPMessageTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// NDPOptionTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the NDPOptionSlice data. Specifically, this is used when the option at the
+// Offset runs past the end of the data.
+type NDPOptionTruncated struct {
+	Offset int
+}
+
+func (e NDPOptionTruncated) Error() string {
+	return fmt.Sprintf("NDP option at offset %d is truncated", e.Offset)
+}
+
+func (e NDPOptionTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// NDPOptionLengthInvalid is a type that implements the error interface. It's used for errors
+// unmarshaling and decoding NDP options. Specifically, this is used when the Length of an
+// option is zero, or is invalid for the Type of option.
+type NDPOptionLengthInvalid struct {
+	Type, Length uint8
+}
+
+func (e NDPOptionLengthInvalid) Error() string {
+	return fmt.Sprintf("NDP option type %d has an invalid Length of %d", e.Type, e.Length)
+}
+
+func (e NDPOptionLengthInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// NDPOptionTypeMismatch is a type that implements the error interface. It's used when
+// decoding an NDP option as the Expected type of option, when it's of a different Type.
+type NDPOptionTypeMismatch struct {
+	Expected, Type uint8
+}
+
+func (e NDPOptionTypeMismatch) Error() string {
+	return fmt.Sprintf("NDP option should be type %d, was type %d", e.Expected, e.Type)
+}
+
+func (e NDPOptionTypeMismatch) Is(target error) bool { return target == ErrInvalid }
+
+// NDPOptionDataInvalid is a type that implements the error interface. It's used for errors
+// marshaling the NDPOptionSlice data. Specifically, this is used when the Data of the option
+// at the Index can't be represented in units of 8 bytes, or disagrees with its Length.
+type NDPOptionDataInvalid struct {
+	Index int
+}
+
+func (e NDPOptionDataInvalid) Error() string {
+	return fmt.Sprintf("NDP option at index %d has Data that doesn't fit its Length", e.Index)
+}
+
+func (e NDPOptionDataInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// NDPOptionDataTooLarge is a type that implements the error interface. It's used for errors
+// creating NDP options. Specifically, this is used when the data of the option is too large
+// for the Length field to represent.
+type NDPOptionDataTooLarge struct {
+	MaxSize, Len int
+}
+
+func (e NDPOptionDataTooLarge) Error() string {
+	return fmt.Sprintf("NDP option data must be no more than %d bytes, was %d bytes", e.MaxSize, e.Len)
+}
+
+func (e NDPOptionDataTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// ICMPMessageNotError is a type that implements the error interface. It's used when
+// extracting the packet quoted by an ICMP message. Specifically, this is used when the
+// Type of message is not an error message, so it doesn't quote a packet.
+type ICMPMessageNotError struct {
+	Type uint8
+}
+
+func (e ICMPMessageNotError) Error() string {
+	return fmt.Sprintf("ICMP message type %d is not an error message", e.Type)
+}
+
+func (e ICMPMessageNotError) Is(target error) bool { return target == ErrInvalid }
+
+// QuotedPacketTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the QuotedPacket data. Specifically, this is used when there is less data than
+// the size of the quoted IP header.
+type QuotedPacketTruncated struct {
+	ExpectedSize, Len int
+}
+
+func (e QuotedPacketTruncated) Error() string {
+	return fmt.Sprintf("quoted packet should be at least %d bytes, was %d bytes", e.ExpectedSize, e.Len)
+}
+
+func (e QuotedPacketTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// QuotedPacketVersionInvalid is a type that implements the error interface. It's used for
+// errors unmarshaling the QuotedPacket data. Specifically, this is used when the Version of
+// the quoted IP header is neither 4 nor 6.
+type QuotedPacketVersionInvalid struct {
+	Version uint8
+}
+
+func (e QuotedPacketVersionInvalid) Error() string {
+	return fmt.Sprintf("quoted packet IP version should be 4 or 6, was %d", e.Version)
+}
+
+func (e QuotedPacketVersionInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// IPv4MTUTooSmall is a type that implements the error interface. It's used when
+// fragmenting an IPv4 packet. Specifically, this is used when the MTU can't fit the
+// IPv4 header and at least 8 bytes of the payload.
+type IPv4MTUTooSmall struct {
+	MTU, MinMTU int
+}
+
+func (e IPv4MTUTooSmall) Error() string {
+	return fmt.Sprintf("MTU must be at least %d bytes to fragment this packet, was %d bytes", e.MinMTU, e.MTU)
+}
+
+func (e IPv4MTUTooSmall) Is(target error) bool { return target == ErrInvalid }
+
+// IPv4FragmentOverlap is a type that implements the error interface. It's used when
+// reassembling IPv4 fragments with the OverlapDrop policy. Specifically, this is used
+// when the fragment at the Offset overlaps data already received, and so the packet is
+// discarded.
+type IPv4FragmentOverlap struct {
+	Offset int
+}
+
+func (e IPv4FragmentOverlap) Error() string {
+	return fmt.Sprintf("IPv4 fragment at offset %d overlaps a previous fragment", e.Offset)
+}
+
+func (e IPv4FragmentOverlap) Is(target error) bool { return target == ErrInvalid }
+
+// ReassemblyBufferFull is a type that implements the error interface. It's used when
+// reassembling IPv4 fragments. Specifically, this is used when a packet would need more
+// than the MaxBytes of the Reassembler to be buffered, even after discarding every other
+// packet.
+type ReassemblyBufferFull struct {
+	MaxBytes, Len int
+}
+
+func (e ReassemblyBufferFull) Error() string {
+	return fmt.Sprintf("reassembly buffer can hold %d bytes, packet needs %d bytes", e.MaxBytes, e.Len)
+}
+
+func (e ReassemblyBufferFull) Is(target error) bool { return target == ErrTooLarge }
+
+// IPv6ExtensionHeaderTruncated is a type that implements the error interface. It's used for
+// errors unmarshaling the IPv6 extension headers. Specifically, this is used when there is
+// less data than the size of the extension header of the Type provided.
+type IPv6ExtensionHeaderTruncated struct {
+	Type              uint8
+	ExpectedSize, Len int
+}
+
+func (e IPv6ExtensionHeaderTruncated) Error() string {
+	return fmt.Sprintf("IPv6 extension header type %d should be at least %d bytes, was %d bytes", e.Type, e.ExpectedSize, e.Len)
+}
+
+func (e IPv6ExtensionHeaderTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// IPv6ExtensionHeaderLengthInvalid is a type that implements the error interface. It's used
+// for errors marshaling the IPv6 extension headers. Specifically, this is used when the
+// extension header of the Type provided isn't a multiple of 8 bytes, or is larger than the
+// 2048 bytes an extension header can be.
+type IPv6ExtensionHeaderLengthInvalid struct {
+	Type uint8
+	Len  int
+}
+
+func (e IPv6ExtensionHeaderLengthInvalid) Error() string {
+	return fmt.Sprintf("IPv6 extension header type %d can't be %d bytes long", e.Type, e.Len)
+}
+
+func (e IPv6ExtensionHeaderLengthInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// IPv6OptionTruncated is a type that implements the error interface. It's used for errors
+// unmarshaling the options of the IPv6 Hop-by-Hop Options and Destination Options headers.
+// Specifically, this is used when the option at the Offset runs past the end of the header.
+type IPv6OptionTruncated struct {
+	Offset int
+}
+
+func (e IPv6OptionTruncated) Error() string {
+	return fmt.Sprintf("IPv6 option at offset %d is truncated", e.Offset)
+}
+
+func (e IPv6OptionTruncated) Is(target error) bool { return target == ErrTruncated }
+
+// PcapMagicInvalid is a type that implements the error interface. It's used for errors
+// reading pcap files. Specifically, this is used when the file doesn't start with one of
+// the magic numbers of the pcap format, in either byte order.
+type PcapMagicInvalid struct {
+	Magic uint32
+}
+
+func (e PcapMagicInvalid) Error() string {
+	return fmt.Sprintf("pcap magic number 0x%08x is not valid", e.Magic)
+}
+
+func (e PcapMagicInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// PcapVersionUnsupported is a type that implements the error interface. It's used for
+// errors reading pcap files. Specifically, this is used when the major version of the
+// file format isn't 2.
+type PcapVersionUnsupported struct {
+	Major, Minor uint16
+}
+
+func (e PcapVersionUnsupported) Error() string {
+	return fmt.Sprintf("pcap version %d.%d is not supported", e.Major, e.Minor)
+}
+
+func (e PcapVersionUnsupported) Is(target error) bool { return target == ErrUnsupported }
+
+// PcapRecordTooLarge is a type that implements the error interface. It's used for errors
+// reading pcap files. Specifically, this is used when the captured length of a record is
+// larger than the snapshot length of the file allows.
+type PcapRecordTooLarge struct {
+	MaxSize, Len int
+}
+
+func (e PcapRecordTooLarge) Error() string {
+	return fmt.Sprintf("pcap record must be no more than %d bytes, was %d bytes", e.MaxSize, e.Len)
+}
+
+func (e PcapRecordTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// PcapFileTruncated is a type that implements the error interface. It's used for errors
+// reading pcap and pcapng files. Specifically, this is used when the file ends part way
+// through the Part being read, such as a "record" or "block". It wraps io.ErrUnexpectedEOF,
+// so it can be checked for with errors.Is() as either that or ErrTruncated.
+type PcapFileTruncated struct {
+	Part string
+}
+
+func (e PcapFileTruncated) Error() string {
+	return fmt.Sprintf("pcap file ends part way through a %s", e.Part)
+}
+
+func (e PcapFileTruncated) Is(target error) bool { return target == ErrTruncated }
+
+func (e PcapFileTruncated) Unwrap() error { return io.ErrUnexpectedEOF }
+
+// PcapngBlockLengthInvalid is a type that implements the error interface. It's used for
+// errors reading pcapng files. Specifically, this is used when the length of a block of the
+// Type provided isn't a multiple of 4 bytes, disagrees with the length at the end of the
+// block, or is too small for the contents of the block.
+type PcapngBlockLengthInvalid struct {
+	Type uint32
+	Len  int
+}
+
+func (e PcapngBlockLengthInvalid) Error() string {
+	return fmt.Sprintf("pcapng block type 0x%08x can't be %d bytes long", e.Type, e.Len)
+}
+
+func (e PcapngBlockLengthInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// PcapngBlockTooLarge is a type that implements the error interface. It's used for
+// errors reading and writing pcapng files. Specifically, this is used when a block of
+// the Type provided is larger than the largest block that's read or written.
+type PcapngBlockTooLarge struct {
+	Type         uint32
+	MaxSize, Len int
+}
+
+func (e PcapngBlockTooLarge) Error() string {
+	return fmt.Sprintf("pcapng block type 0x%08x must be no more than %d bytes, was %d bytes", e.Type, e.MaxSize, e.Len)
+}
+
+func (e PcapngBlockTooLarge) Is(target error) bool { return target == ErrTooLarge }
+
+// PcapngInterfaceInvalid is a type that implements the error interface. It's used for
+// errors reading and writing pcapng files. Specifically, this is used when a packet refers
+// to an interface that hasn't been described in the section.
+type PcapngInterfaceInvalid struct {
+	Index int
+}
+
+func (e PcapngInterfaceInvalid) Error() string {
+	return fmt.Sprintf("pcapng interface %d has not been described", e.Index)
+}
+
+func (e PcapngInterfaceInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// PcapngResolutionInvalid is a type that implements the error interface. It's used for
+// errors reading and writing pcapng files. Specifically, this is used when the timestamp
+// resolution of an interface is too fine for the timestamps to fit in 64 bits.
+type PcapngResolutionInvalid struct {
+	Resolution uint8
+}
+
+func (e PcapngResolutionInvalid) Error() string {
+	return fmt.Sprintf("pcapng timestamp resolution 0x%02x is not valid", e.Resolution)
+}
+
+func (e PcapngResolutionInvalid) Is(target error) bool { return target == ErrInvalid }
+
+// ChecksumMismatch is a type that implements the error interface. It's used for errors
+// verifying the checksum of a decoded header. Specifically, this is used when the checksum
+// that was received doesn't match the one computed over the data.
+type ChecksumMismatch struct {
+	Expected, Actual uint16
+}
+
+func (e ChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum should be 0x%04x, was 0x%04x", e.Expected, e.Actual)
+}
+
+func (e ChecksumMismatch) Is(target error) bool { return target == ErrChecksum }
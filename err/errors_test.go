@@ -5,6 +5,8 @@
 package packetserr_test
 
 import (
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/theckman/packets/err"
@@ -22,7 +24,27 @@ func (t *TestSuite) TestTCPDataOffsetInvalid_Error(c *C) {
 }
 
 func (t *TestSuite) TestChecksumInvalidKind_Error(c *C) {
-	c.Check(packetserr.ChecksumInvalidKind.Error(), Equals, "Checksum kind should either be 'tcp' OR 'udp'.")
+	c.Check(packetserr.ChecksumInvalidKind.Error(), Equals, "Checksum kind should be 'tcp', 'udp', or 'icmpv6' (IPv6 only).")
+}
+
+func (t *TestSuite) TestChecksumAddressFamilyMismatch_Error(c *C) {
+	c.Check(packetserr.ChecksumAddressFamilyMismatch.Error(), Equals, "Checksum addresses must both be either IPv4 or IPv6 addresses")
+}
+
+func (t *TestSuite) TestIPv4IHLInvalid_Error(c *C) {
+	c.Check(packetserr.IPv4IHLInvalid.Error(), Equals, "IHL field must be at least 5 and no more than 15")
+}
+
+func (t *TestSuite) TestIPv4TotalLengthInvalid_Error(c *C) {
+	c.Check(packetserr.IPv4TotalLengthInvalid.Error(), Equals, "TotalLength field must be at least as large as the header")
+}
+
+func (t *TestSuite) TestIPv4FragmentationProhibited_Error(c *C) {
+	c.Check(packetserr.IPv4FragmentationProhibited.Error(), Equals, "DF field is set, but the packet must be fragmented to fit the MTU")
+}
+
+func (t *TestSuite) TestIPv4FragmentInvalid_Error(c *C) {
+	c.Check(packetserr.IPv4FragmentInvalid.Error(), Equals, "IPv4 fragment is inconsistent with the packet it belongs to")
 }
 
 func (t *TestSuite) TestTCPDataOffsetTooSmall_Error(c *C) {
@@ -57,6 +79,42 @@ func (t *TestSuite) TestTCPOptionDataTooLong_Error(c *C) {
 	c.Check(e.Error(), Equals, "Option 42 Data cannot be larger than 253 bytes")
 }
 
+func (t *TestSuite) TestTCPOptionLengthInvalid_Error(c *C) {
+	e := packetserr.TCPOptionLengthInvalid{Kind: 2, Length: 5}
+
+	c.Check(e.Error(), Equals, "Option kind 2 has an invalid Length of 5")
+}
+
+func (t *TestSuite) TestTCPOptionKindMismatch_Error(c *C) {
+	e := packetserr.TCPOptionKindMismatch{Expected: 2, Kind: 8}
+
+	c.Check(e.Error(), Equals, "Option kind 8 cannot be decoded as kind 2")
+}
+
+func (t *TestSuite) TestTCPOptionWindowScaleTooLarge_Error(c *C) {
+	e := packetserr.TCPOptionWindowScaleTooLarge{Shift: 15}
+
+	c.Check(e.Error(), Equals, "Window Scale shift count must be no more than 14, was 15")
+}
+
+func (t *TestSuite) TestTCPOptionSACKBlocksInvalid_Error(c *C) {
+	e := packetserr.TCPOptionSACKBlocksInvalid{Count: 5}
+
+	c.Check(e.Error(), Equals, "SACK option must have between 1 and 4 blocks, had 5")
+}
+
+func (t *TestSuite) TestTCPOptionTruncated_Error(c *C) {
+	e := packetserr.TCPOptionTruncated{Offset: 4}
+
+	c.Check(e.Error(), Equals, "Option at offset 4 is truncated")
+}
+
+func (t *TestSuite) TestTCPHeaderTruncated_Error(c *C) {
+	e := packetserr.TCPHeaderTruncated{ExpectedSize: 28, Len: 24}
+
+	c.Check(e.Error(), Equals, "TCP header should be at least 28 bytes, was 24 bytes")
+}
+
 func (t *TestSuite) TestUDPPayloadTooLarge_Error(c *C) {
 	var e packetserr.UDPPayloadTooLarge
 
@@ -67,3 +125,405 @@ func (t *TestSuite) TestUDPPayloadTooLarge_Error(c *C) {
 
 	c.Check(e.Error(), Equals, "UDP Payload must not be larger than 42 byte, was 84 bytes")
 }
+
+func (t *TestSuite) TestIPv4IHLTooSmall_Error(c *C) {
+	e := packetserr.IPv4IHLTooSmall{ExpectedSize: 7}
+
+	c.Check(e.Error(), Equals, "The IHL field is too small for the data provided. It should be at least 7")
+}
+
+func (t *TestSuite) TestIPv4OptionsOverflow_Error(c *C) {
+	e := packetserr.IPv4OptionsOverflow{MaxSize: 40}
+
+	c.Check(e.Error(), Equals, "IPv4 Options are too large, must be less than 40 total bytes")
+}
+
+func (t *TestSuite) TestIPv4PayloadTooLarge_Error(c *C) {
+	e := packetserr.IPv4PayloadTooLarge{
+		MaxSize: 42,
+		Len:     84,
+	}
+
+	c.Check(e.Error(), Equals, "IPv4 Payload must not be larger than 42 bytes, was 84 bytes")
+}
+
+func (t *TestSuite) TestIPv4FieldTooLarge_Error(c *C) {
+	e := packetserr.IPv4FieldTooLarge{Field: "DSCP", MaxValue: 63}
+
+	c.Check(e.Error(), Equals, "IPv4 DSCP field must be no more than 63")
+}
+
+func (t *TestSuite) TestIPv4AddressInvalid_Error(c *C) {
+	e := packetserr.IPv4AddressInvalid{Address: "10.0.0"}
+
+	c.Check(e.Error(), Equals, `"10.0.0" is not a valid IPv4 address`)
+}
+
+func (t *TestSuite) TestIPv4PacketTruncated_Error(c *C) {
+	e := packetserr.IPv4PacketTruncated{ExpectedSize: 42, Len: 21}
+
+	c.Check(e.Error(), Equals, "IPv4 packet should be at least 42 bytes, was 21 bytes")
+}
+
+func (t *TestSuite) TestIPv6PayloadTooLarge_Error(c *C) {
+	e := packetserr.IPv6PayloadTooLarge{
+		MaxSize: 42,
+		Len:     84,
+	}
+
+	c.Check(e.Error(), Equals, "IPv6 Payload must not be larger than 42 bytes, was 84 bytes")
+}
+
+func (t *TestSuite) TestIPv6FieldTooLarge_Error(c *C) {
+	e := packetserr.IPv6FieldTooLarge{Field: "FlowLabel", MaxValue: 1048575}
+
+	c.Check(e.Error(), Equals, "IPv6 FlowLabel field must be no more than 1048575")
+}
+
+func (t *TestSuite) TestIPv6AddressInvalid_Error(c *C) {
+	e := packetserr.IPv6AddressInvalid{Address: "fe80::1::2"}
+
+	c.Check(e.Error(), Equals, `"fe80::1::2" is not a valid IPv6 address`)
+}
+
+func (t *TestSuite) TestIPv6PacketTruncated_Error(c *C) {
+	e := packetserr.IPv6PacketTruncated{ExpectedSize: 42, Len: 21}
+
+	c.Check(e.Error(), Equals, "IPv6 packet should be at least 42 bytes, was 21 bytes")
+}
+
+func (t *TestSuite) TestUDPHeaderTruncated_Error(c *C) {
+	e := packetserr.UDPHeaderTruncated{Len: 4}
+
+	c.Check(e.Error(), Equals, "UDP header should be 8 bytes, was 4 bytes")
+}
+
+func (t *TestSuite) TestUDPLengthInvalid_Error(c *C) {
+	e := packetserr.UDPLengthInvalid{Length: 42, Len: 12}
+
+	c.Check(e.Error(), Equals, "UDP Length field of 42 is invalid for 12 bytes of data")
+}
+
+func (t *TestSuite) TestBufferTooSmall_Error(c *C) {
+	e := packetserr.BufferTooSmall{ExpectedSize: 24, Len: 20}
+
+	c.Check(e.Error(), Equals, "buffer should be at least 24 bytes, was 20 bytes")
+}
+
+func (t *TestSuite) TestEthernetHeaderTruncated_Error(c *C) {
+	e := packetserr.EthernetHeaderTruncated{ExpectedSize: 14, Len: 12}
+
+	c.Check(e.Error(), Equals, "Ethernet header should be at least 14 bytes, was 12 bytes")
+}
+
+func (t *TestSuite) TestEthernetAddressInvalid_Error(c *C) {
+	e := packetserr.EthernetAddressInvalid{Address: "00:11:22"}
+
+	c.Check(e.Error(), Equals, `"00:11:22" is not a valid Ethernet address`)
+}
+
+func (t *TestSuite) TestVLANFieldTooLarge_Error(c *C) {
+	e := packetserr.VLANFieldTooLarge{Index: 1, Field: "VID", MaxValue: 4095}
+
+	c.Check(e.Error(), Equals, "VLAN tag 1 VID field must be no more than 4095")
+}
+
+func (t *TestSuite) TestARPPacketTruncated_Error(c *C) {
+	e := packetserr.ARPPacketTruncated{ExpectedSize: 28, Len: 20}
+
+	c.Check(e.Error(), Equals, "ARP packet should be at least 28 bytes, was 20 bytes")
+}
+
+func (t *TestSuite) TestARPProtocolSizeUnsupported_Error(c *C) {
+	e := packetserr.ARPProtocolSizeUnsupported{Size: 6}
+
+	c.Check(e.Error(), Equals, "ARP protocol address size of 6 is not supported, must be 4 or 16")
+}
+
+func (t *TestSuite) TestARPAddressSizeMismatch_Error(c *C) {
+	e := packetserr.ARPAddressSizeMismatch{Field: "TargetHardwareAddress", Size: 6, Len: 0}
+
+	c.Check(e.Error(), Equals, "ARP TargetHardwareAddress should be 6 bytes, was 0 bytes")
+}
+
+func (t *TestSuite) TestICMPMessageTruncated_Error(c *C) {
+	e := packetserr.ICMPMessageTruncated{ExpectedSize: 24, Len: 8}
+
+	c.Check(e.Error(), Equals, "ICMP message should be at least 24 bytes, was 8 bytes")
+}
+
+func (t *TestSuite) TestNDPOptionTruncated_Error(c *C) {
+	e := packetserr.NDPOptionTruncated{Offset: 8}
+
+	c.Check(e.Error(), Equals, "NDP option at offset 8 is truncated")
+}
+
+func (t *TestSuite) TestNDPOptionLengthInvalid_Error(c *C) {
+	e := packetserr.NDPOptionLengthInvalid{Type: 3, Length: 0}
+
+	c.Check(e.Error(), Equals, "NDP option type 3 has an invalid Length of 0")
+}
+
+func (t *TestSuite) TestNDPOptionTypeMismatch_Error(c *C) {
+	e := packetserr.NDPOptionTypeMismatch{Expected: 5, Type: 1}
+
+	c.Check(e.Error(), Equals, "NDP option should be type 5, was type 1")
+}
+
+func (t *TestSuite) TestNDPOptionDataInvalid_Error(c *C) {
+	e := packetserr.NDPOptionDataInvalid{Index: 2}
+
+	c.Check(e.Error(), Equals, "NDP option at index 2 has Data that doesn't fit its Length")
+}
+
+func (t *TestSuite) TestNDPOptionDataTooLarge_Error(c *C) {
+	e := packetserr.NDPOptionDataTooLarge{MaxSize: 2038, Len: 2039}
+
+	c.Check(e.Error(), Equals, "NDP option data must be no more than 2038 bytes, was 2039 bytes")
+}
+
+func (t *TestSuite) TestICMPMessageNotError_Error(c *C) {
+	e := packetserr.ICMPMessageNotError{Type: 8}
+
+	c.Check(e.Error(), Equals, "ICMP message type 8 is not an error message")
+}
+
+func (t *TestSuite) TestQuotedPacketTruncated_Error(c *C) {
+	e := packetserr.QuotedPacketTruncated{ExpectedSize: 20, Len: 12}
+
+	c.Check(e.Error(), Equals, "quoted packet should be at least 20 bytes, was 12 bytes")
+}
+
+func (t *TestSuite) TestQuotedPacketVersionInvalid_Error(c *C) {
+	e := packetserr.QuotedPacketVersionInvalid{Version: 5}
+
+	c.Check(e.Error(), Equals, "quoted packet IP version should be 4 or 6, was 5")
+}
+
+func (t *TestSuite) TestIPv4MTUTooSmall_Error(c *C) {
+	e := packetserr.IPv4MTUTooSmall{MTU: 24, MinMTU: 28}
+
+	c.Check(e.Error(), Equals, "MTU must be at least 28 bytes to fragment this packet, was 24 bytes")
+}
+
+func (t *TestSuite) TestIPv4FragmentOverlap_Error(c *C) {
+	e := packetserr.IPv4FragmentOverlap{Offset: 1480}
+
+	c.Check(e.Error(), Equals, "IPv4 fragment at offset 1480 overlaps a previous fragment")
+}
+
+func (t *TestSuite) TestReassemblyBufferFull_Error(c *C) {
+	e := packetserr.ReassemblyBufferFull{MaxBytes: 1024, Len: 1480}
+
+	c.Check(e.Error(), Equals, "reassembly buffer can hold 1024 bytes, packet needs 1480 bytes")
+}
+
+func (t *TestSuite) TestIPv6ExtensionHeaderTruncated_Error(c *C) {
+	e := packetserr.IPv6ExtensionHeaderTruncated{Type: 44, ExpectedSize: 8, Len: 6}
+
+	c.Check(e.Error(), Equals, "IPv6 extension header type 44 should be at least 8 bytes, was 6 bytes")
+}
+
+func (t *TestSuite) TestIPv6ExtensionHeaderLengthInvalid_Error(c *C) {
+	e := packetserr.IPv6ExtensionHeaderLengthInvalid{Type: 43, Len: 12}
+
+	c.Check(e.Error(), Equals, "IPv6 extension header type 43 can't be 12 bytes long")
+}
+
+func (t *TestSuite) TestIPv6OptionTruncated_Error(c *C) {
+	e := packetserr.IPv6OptionTruncated{Offset: 4}
+
+	c.Check(e.Error(), Equals, "IPv6 option at offset 4 is truncated")
+}
+
+func (t *TestSuite) TestPcapTimestampInvalid_Error(c *C) {
+	c.Check(packetserr.PcapTimestampInvalid.Error(), Equals, "pcap timestamp can't be represented in the file")
+}
+
+func (t *TestSuite) TestPcapMagicInvalid_Error(c *C) {
+	e := packetserr.PcapMagicInvalid{Magic: 0x0a0d0d0a}
+
+	c.Check(e.Error(), Equals, "pcap magic number 0x0a0d0d0a is not valid")
+}
+
+func (t *TestSuite) TestPcapVersionUnsupported_Error(c *C) {
+	e := packetserr.PcapVersionUnsupported{Major: 1, Minor: 0}
+
+	c.Check(e.Error(), Equals, "pcap version 1.0 is not supported")
+}
+
+func (t *TestSuite) TestPcapRecordTooLarge_Error(c *C) {
+	e := packetserr.PcapRecordTooLarge{MaxSize: 262144, Len: 300000}
+
+	c.Check(e.Error(), Equals, "pcap record must be no more than 262144 bytes, was 300000 bytes")
+}
+
+func (t *TestSuite) TestPcapFileTruncated_Error(c *C) {
+	e := packetserr.PcapFileTruncated{Part: "record"}
+
+	c.Check(e.Error(), Equals, "pcap file ends part way through a record")
+}
+
+func (t *TestSuite) TestPcapFileTruncated_Unwrap(c *C) {
+	var err error = packetserr.PcapFileTruncated{Part: "block"}
+
+	c.Check(errors.Unwrap(err), Equals, io.ErrUnexpectedEOF)
+	c.Check(errors.Is(err, io.ErrUnexpectedEOF), Equals, true)
+	c.Check(errors.Is(err, packetserr.ErrTruncated), Equals, true)
+}
+
+func (t *TestSuite) TestPcapngBlockLengthInvalid_Error(c *C) {
+	e := packetserr.PcapngBlockLengthInvalid{Type: 6, Len: 30}
+
+	c.Check(e.Error(), Equals, "pcapng block type 0x00000006 can't be 30 bytes long")
+}
+
+func (t *TestSuite) TestPcapngBlockTooLarge_Error(c *C) {
+	e := packetserr.PcapngBlockTooLarge{Type: 6, MaxSize: 16777216, Len: 16777220}
+
+	c.Check(e.Error(), Equals, "pcapng block type 0x00000006 must be no more than 16777216 bytes, was 16777220 bytes")
+}
+
+func (t *TestSuite) TestPcapngInterfaceInvalid_Error(c *C) {
+	e := packetserr.PcapngInterfaceInvalid{Index: 2}
+
+	c.Check(e.Error(), Equals, "pcapng interface 2 has not been described")
+}
+
+func (t *TestSuite) TestPcapngResolutionInvalid_Error(c *C) {
+	e := packetserr.PcapngResolutionInvalid{Resolution: 0x14}
+
+	c.Check(e.Error(), Equals, "pcapng timestamp resolution 0x14 is not valid")
+}
+
+func (t *TestSuite) TestChecksumMismatch_Error(c *C) {
+	e := packetserr.ChecksumMismatch{Expected: 0xbeef, Actual: 0x0042}
+
+	c.Check(e.Error(), Equals, "checksum should be 0xbeef, was 0x0042")
+}
+
+func (t *TestSuite) TestDecodeError_Error(c *C) {
+	e := packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "DataOffset",
+		Offset: 12,
+		Err:    packetserr.TCPDataOffsetInvalid,
+	}
+
+	c.Check(e.Error(), Equals, "decoding TCP DataOffset at offset 12: DataOffset field must be at least 5 and no more than 15")
+}
+
+func (t *TestSuite) TestDecodeError_Unwrap(c *C) {
+	var err error = packetserr.DecodeError{
+		Layer:  "UDP",
+		Field:  "Checksum",
+		Offset: 6,
+		Err:    packetserr.UDPHeaderTruncated{Len: 7},
+	}
+
+	c.Check(errors.Unwrap(err), Equals, packetserr.UDPHeaderTruncated{Len: 7})
+	c.Check(errors.Is(err, packetserr.ErrTruncated), Equals, true)
+	c.Check(errors.Is(err, packetserr.ErrInvalid), Equals, false)
+
+	var truncated packetserr.UDPHeaderTruncated
+
+	c.Assert(errors.As(err, &truncated), Equals, true)
+	c.Check(truncated.Len, Equals, 7)
+
+	var decodeErr packetserr.DecodeError
+
+	c.Assert(errors.As(err, &decodeErr), Equals, true)
+	c.Check(decodeErr.Layer, Equals, "UDP")
+	c.Check(decodeErr.Field, Equals, "Checksum")
+	c.Check(decodeErr.Offset, Equals, 6)
+
+	// the sentinel errors keep their identity when wrapped
+	err = packetserr.DecodeError{Layer: "IPv4", Field: "IHL", Err: packetserr.IPv4IHLInvalid}
+
+	c.Check(errors.Is(err, packetserr.IPv4IHLInvalid), Equals, true)
+	c.Check(errors.Is(err, packetserr.ErrInvalid), Equals, true)
+}
+
+func (t *TestSuite) TestErrorCategories(c *C) {
+	categories := []error{
+		packetserr.ErrTruncated,
+		packetserr.ErrInvalid,
+		packetserr.ErrTooLarge,
+		packetserr.ErrChecksum,
+		packetserr.ErrUnsupported,
+	}
+
+	tests := []struct {
+		err      error
+		category error
+	}{
+		{packetserr.TCPDataOffsetInvalid, packetserr.ErrInvalid},
+		{packetserr.ChecksumInvalidKind, packetserr.ErrInvalid},
+		{packetserr.ChecksumAddressFamilyMismatch, packetserr.ErrInvalid},
+		{packetserr.IPv4IHLInvalid, packetserr.ErrInvalid},
+		{packetserr.IPv4TotalLengthInvalid, packetserr.ErrInvalid},
+		{packetserr.IPv4FragmentationProhibited, packetserr.ErrTooLarge},
+		{packetserr.IPv4FragmentInvalid, packetserr.ErrInvalid},
+		{packetserr.PcapTimestampInvalid, packetserr.ErrInvalid},
+		{packetserr.TCPDataOffsetTooSmall{}, packetserr.ErrInvalid},
+		{packetserr.TCPOptionsOverflow{}, packetserr.ErrTooLarge},
+		{packetserr.TCPOptionDataInvalid{}, packetserr.ErrInvalid},
+		{packetserr.TCPOptionDataTooLong{}, packetserr.ErrTooLarge},
+		{packetserr.TCPOptionLengthInvalid{}, packetserr.ErrInvalid},
+		{packetserr.TCPOptionKindMismatch{}, packetserr.ErrInvalid},
+		{packetserr.TCPOptionWindowScaleTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.TCPOptionSACKBlocksInvalid{}, packetserr.ErrInvalid},
+		{packetserr.TCPOptionTruncated{}, packetserr.ErrTruncated},
+		{packetserr.TCPHeaderTruncated{}, packetserr.ErrTruncated},
+		{packetserr.UDPPayloadTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.IPv4IHLTooSmall{}, packetserr.ErrInvalid},
+		{packetserr.IPv4OptionsOverflow{}, packetserr.ErrTooLarge},
+		{packetserr.IPv4PayloadTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.IPv4FieldTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.IPv4AddressInvalid{}, packetserr.ErrInvalid},
+		{packetserr.IPv4PacketTruncated{}, packetserr.ErrTruncated},
+		{packetserr.IPv6PayloadTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.IPv6FieldTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.IPv6AddressInvalid{}, packetserr.ErrInvalid},
+		{packetserr.IPv6PacketTruncated{}, packetserr.ErrTruncated},
+		{packetserr.UDPHeaderTruncated{}, packetserr.ErrTruncated},
+		{packetserr.UDPLengthInvalid{}, packetserr.ErrInvalid},
+		{packetserr.BufferTooSmall{}, packetserr.ErrTooLarge},
+		{packetserr.EthernetHeaderTruncated{}, packetserr.ErrTruncated},
+		{packetserr.EthernetAddressInvalid{}, packetserr.ErrInvalid},
+		{packetserr.VLANFieldTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.ARPPacketTruncated{}, packetserr.ErrTruncated},
+		{packetserr.ARPProtocolSizeUnsupported{}, packetserr.ErrUnsupported},
+		{packetserr.ARPAddressSizeMismatch{}, packetserr.ErrInvalid},
+		{packetserr.ICMPMessageTruncated{}, packetserr.ErrTruncated},
+		{packetserr.NDPOptionTruncated{}, packetserr.ErrTruncated},
+		{packetserr.NDPOptionLengthInvalid{}, packetserr.ErrInvalid},
+		{packetserr.NDPOptionTypeMismatch{}, packetserr.ErrInvalid},
+		{packetserr.NDPOptionDataInvalid{}, packetserr.ErrInvalid},
+		{packetserr.NDPOptionDataTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.ICMPMessageNotError{}, packetserr.ErrInvalid},
+		{packetserr.QuotedPacketTruncated{}, packetserr.ErrTruncated},
+		{packetserr.QuotedPacketVersionInvalid{}, packetserr.ErrInvalid},
+		{packetserr.IPv4MTUTooSmall{}, packetserr.ErrInvalid},
+		{packetserr.IPv4FragmentOverlap{}, packetserr.ErrInvalid},
+		{packetserr.ReassemblyBufferFull{}, packetserr.ErrTooLarge},
+		{packetserr.IPv6ExtensionHeaderTruncated{}, packetserr.ErrTruncated},
+		{packetserr.IPv6ExtensionHeaderLengthInvalid{}, packetserr.ErrInvalid},
+		{packetserr.IPv6OptionTruncated{}, packetserr.ErrTruncated},
+		{packetserr.PcapMagicInvalid{}, packetserr.ErrInvalid},
+		{packetserr.PcapVersionUnsupported{}, packetserr.ErrUnsupported},
+		{packetserr.PcapRecordTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.PcapFileTruncated{}, packetserr.ErrTruncated},
+		{packetserr.PcapngBlockLengthInvalid{}, packetserr.ErrInvalid},
+		{packetserr.PcapngBlockTooLarge{}, packetserr.ErrTooLarge},
+		{packetserr.PcapngInterfaceInvalid{}, packetserr.ErrInvalid},
+		{packetserr.PcapngResolutionInvalid{}, packetserr.ErrInvalid},
+		{packetserr.ChecksumMismatch{}, packetserr.ErrChecksum},
+	}
+
+	for _, test := range tests {
+		for _, category := range categories {
+			c.Check(errors.Is(test.err, category), Equals, category == test.category, Commentf("%T is %v", test.err, category))
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the EtherType values of the protocols understood by this package.
+// EtherTypeVLAN and EtherTypeQinQ are the Tag Protocol Identifiers of 802.1Q
+// and 802.1ad VLAN tags.
+const (
+	EtherTypeIPv4 uint16 = 0x0800
+	EtherTypeARP  uint16 = 0x0806
+	EtherTypeVLAN uint16 = 0x8100
+	EtherTypeIPv6 uint16 = 0x86dd
+	EtherTypeQinQ uint16 = 0x88a8
+
+	ethernetHeaderLen int = 14
+	ethernetAddrLen   int = 6
+	ethernetMinLen    int = 60 // the minimum frame size, less the frame check sequence
+	vlanTagLen        int = 4
+
+	vlanMaxPCP uint8  = 7
+	vlanMaxVID uint16 = 4095
+)
+
+// VLANTag is a struct representing an 802.1Q or 802.1ad VLAN tag of an Ethernet
+// header. The TPID is the Tag Protocol Identifier, which is the EtherType value
+// that identifies the tag.
+type VLANTag struct {
+	TPID uint16 // if set to 0 this becomes EtherTypeVLAN, or EtherTypeQinQ if this isn't the last tag
+	PCP  uint8  // priority code point; must be no more than 7 (3 bits)
+	DEI  bool   // drop eligible indicator
+	VID  uint16 // VLAN identifier; must be no more than 4095 (12 bits)
+}
+
+// EthernetHeader is a struct representing an Ethernet II header, along with the
+// data carried by the frame in the Payload field. The EtherType identifies the
+// protocol of the Payload.
+//
+// Stacked VLAN tags are held in the VLANTags field, outermost tag first. The
+// EtherType is always that of the Payload, and not the TPID of the first tag.
+type EthernetHeader struct {
+	DestinationAddress net.HardwareAddr
+	SourceAddress      net.HardwareAddr
+	VLANTags           []VLANTag
+	EtherType          uint16
+	Payload            []byte
+}
+
+// UnmarshalEthernetHeader is a function that takes a byte slice and parses it in
+// to an instance of *EthernetHeader. Any 802.1Q or 802.1ad VLAN tags are parsed
+// in to the VLANTags field. The Payload is everything following the header, which
+// may include any padding added to reach the minimum frame size.
+//
+// The error is a packetserr.DecodeError wrapping the packetserr.EthernetHeaderTruncated
+// type if there is less data than the size of the header, including its VLAN tags.
+func UnmarshalEthernetHeader(data []byte) (*EthernetHeader, error) {
+	return unmarshalEthernetHeader(data)
+}
+
+// Marshal is a function to marshal the *EthernetHeader instance to a byte slice,
+// including the payload. If the frame is smaller than the minimum Ethernet frame
+// size of 60 bytes (64 bytes, less the frame check sequence) it's padded with
+// zeroes. The *EthernetHeader instance is not modified.
+//
+// The error field may be of packetserr.EthernetAddressInvalid or
+// packetserr.VLANFieldTooLarge types. See their documentation for more information.
+func (eth *EthernetHeader) Marshal() ([]byte, error) {
+	return eth.marshalEthernetHeader()
+}
+
+// ethernetFields are the fields of the Ethernet header without any VLAN tags, for
+// describing where decoding failed.
+var ethernetFields = []headerField{
+	{0, "DestinationAddress"}, {6, "SourceAddress"}, {12, "EtherType"},
+}
+
+func unmarshalEthernetHeader(data []byte) (*EthernetHeader, error) {
+	if len(data) < ethernetHeaderLen {
+		err := packetserr.EthernetHeaderTruncated{ExpectedSize: ethernetHeaderLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeEthernet, ethernetFields, len(data), err)
+	}
+
+	header := &EthernetHeader{
+		DestinationAddress: net.HardwareAddr(copyBytes(data[0:ethernetAddrLen])),
+		SourceAddress:      net.HardwareAddr(copyBytes(data[ethernetAddrLen : ethernetAddrLen*2])),
+	}
+
+	offset := ethernetAddrLen * 2
+	etherType := binary.BigEndian.Uint16(data[offset:])
+
+	// each VLAN tag sits where the EtherType would be,
+	// and is followed by the EtherType or another tag
+	for etherType == EtherTypeVLAN || etherType == EtherTypeQinQ {
+		headerLen := offset + vlanTagLen + 2
+
+		if len(data) < headerLen {
+			err := packetserr.EthernetHeaderTruncated{ExpectedSize: headerLen, Len: len(data)}
+
+			if len(data) < offset+vlanTagLen {
+				return nil, decodeError(LayerTypeEthernet, "VLANTags", offset, err)
+			}
+
+			return nil, decodeError(LayerTypeEthernet, "EtherType", offset+vlanTagLen, err)
+		}
+
+		tci := binary.BigEndian.Uint16(data[offset+2:])
+
+		header.VLANTags = append(header.VLANTags, VLANTag{
+			TPID: etherType,
+			PCP:  uint8(tci >> 13),
+			DEI:  tci&0x1000 != 0,
+			VID:  tci & vlanMaxVID,
+		})
+
+		offset += vlanTagLen
+		etherType = binary.BigEndian.Uint16(data[offset:])
+	}
+
+	header.EtherType = etherType
+	header.Payload = copyBytes(data[offset+2:])
+
+	return header, nil
+}
+
+func (eth *EthernetHeader) marshalEthernetHeader() ([]byte, error) {
+	if len(eth.DestinationAddress) != ethernetAddrLen {
+		return nil, packetserr.EthernetAddressInvalid{Address: eth.DestinationAddress.String()}
+	}
+
+	if len(eth.SourceAddress) != ethernetAddrLen {
+		return nil, packetserr.EthernetAddressInvalid{Address: eth.SourceAddress.String()}
+	}
+
+	headerLen := ethernetHeaderLen + len(eth.VLANTags)*vlanTagLen
+	frameLen := headerLen + len(eth.Payload)
+
+	if frameLen < ethernetMinLen {
+		frameLen = ethernetMinLen
+	}
+
+	data := make([]byte, frameLen)
+
+	copy(data[0:], eth.DestinationAddress)
+	copy(data[ethernetAddrLen:], eth.SourceAddress)
+
+	offset := ethernetAddrLen * 2
+
+	for i, tag := range eth.VLANTags {
+		switch {
+		case tag.PCP > vlanMaxPCP:
+			return nil, packetserr.VLANFieldTooLarge{Index: i, Field: "PCP", MaxValue: int(vlanMaxPCP)}
+		case tag.VID > vlanMaxVID:
+			return nil, packetserr.VLANFieldTooLarge{Index: i, Field: "VID", MaxValue: int(vlanMaxVID)}
+		}
+
+		tpid := tag.TPID
+
+		// the outer tags of stacked VLANs are service tags (802.1ad),
+		// and the innermost tag is a customer tag (802.1Q)
+		if tpid == 0 {
+			tpid = EtherTypeVLAN
+
+			if i != len(eth.VLANTags)-1 {
+				tpid = EtherTypeQinQ
+			}
+		}
+
+		tci := uint16(tag.PCP)<<13 | tag.VID
+
+		if tag.DEI {
+			tci |= 0x1000
+		}
+
+		binary.BigEndian.PutUint16(data[offset:], tpid)
+		binary.BigEndian.PutUint16(data[offset+2:], tci)
+
+		offset += vlanTagLen
+	}
+
+	binary.BigEndian.PutUint16(data[offset:], eth.EtherType)
+	copy(data[headerLen:], eth.Payload)
+
+	return data, nil
+}
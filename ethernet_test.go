@@ -0,0 +1,180 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestUnmarshalEthernetHeader(c *C) {
+	data := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, // destination
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, // source
+		0x86, 0xdd, // EtherType
+		42, 128, 0, 0,
+	}
+
+	header, err := packets.UnmarshalEthernetHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.DestinationAddress, DeepEquals, net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+	c.Check(header.SourceAddress, DeepEquals, net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb})
+	c.Check(header.EtherType, Equals, packets.EtherTypeIPv6)
+	c.Check(header.Payload, DeepEquals, []byte{42, 128, 0, 0})
+
+	// the header doesn't share memory with the data
+	data[0], data[14] = 0xff, 0xff
+	c.Check(header.DestinationAddress[0], Equals, uint8(0x00))
+	c.Check(header.Payload[0], Equals, uint8(42))
+
+	//
+	// TEST packetserr.EthernetHeaderTruncated
+	//
+	header, err = packets.UnmarshalEthernetHeader(data[:13])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "Ethernet",
+		Field:  "EtherType",
+		Offset: 12,
+		Err:    packetserr.EthernetHeaderTruncated{ExpectedSize: 14, Len: 13},
+	})
+}
+
+func (t *TestSuite) TestUnmarshalEthernetHeader_VLANTags(c *C) {
+	data := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb,
+		0x88, 0xa8, 0x00, 0x64, // 802.1ad, VID 100
+		0x81, 0x00, 0xb0, 0x2a, // 802.1Q, PCP 5, DEI, VID 42
+		0x08, 0x00, // EtherType
+		42, 128, 0, 0,
+	}
+
+	header, err := packets.UnmarshalEthernetHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.EtherType, Equals, packets.EtherTypeIPv4)
+	c.Check(header.Payload, DeepEquals, []byte{42, 128, 0, 0})
+	c.Check(header.VLANTags, DeepEquals, []packets.VLANTag{
+		{TPID: packets.EtherTypeQinQ, VID: 100},
+		{TPID: packets.EtherTypeVLAN, PCP: 5, DEI: true, VID: 42},
+	})
+
+	//
+	// TEST packetserr.EthernetHeaderTruncated
+	//
+	header, err = packets.UnmarshalEthernetHeader(data[:19])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "Ethernet",
+		Field:  "VLANTags",
+		Offset: 16,
+		Err:    packetserr.EthernetHeaderTruncated{ExpectedSize: 22, Len: 19},
+	})
+}
+
+func (t *TestSuite) TestEthernetHeader_Marshal(c *C) {
+	eth := &packets.EthernetHeader{
+		DestinationAddress: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		SourceAddress:      net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb},
+		EtherType:          packets.EtherTypeIPv4,
+		Payload:            []byte{42, 128, 0, 0},
+	}
+
+	data, err := eth.Marshal()
+	c.Assert(err, IsNil)
+
+	// the frame is padded to the minimum size
+	c.Assert(len(data), Equals, 60)
+	c.Check(data[:18], DeepEquals, []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb,
+		0x08, 0x00,
+		42, 128, 0, 0,
+	})
+	c.Check(data[18:], DeepEquals, make([]byte, 42))
+
+	// a large enough frame isn't padded
+	eth.Payload = make([]byte, 100)
+
+	data, err = eth.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 114)
+
+	//
+	// TEST VLAN TAGS
+	//
+	eth.Payload = []byte{42, 128, 0, 0}
+	eth.VLANTags = []packets.VLANTag{
+		{VID: 100},
+		{PCP: 5, DEI: true, VID: 42},
+	}
+
+	data, err = eth.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 60)
+	c.Check(data[12:26], DeepEquals, []byte{
+		0x88, 0xa8, 0x00, 0x64,
+		0x81, 0x00, 0xb0, 0x2a,
+		0x08, 0x00,
+		42, 128, 0, 0,
+	})
+
+	// the TPIDs are only filled in on the marshaled data
+	c.Check(eth.VLANTags[0].TPID, Equals, uint16(0))
+
+	header, err := packets.UnmarshalEthernetHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.VLANTags[0].TPID, Equals, packets.EtherTypeQinQ)
+	c.Check(header.VLANTags[1], DeepEquals, packets.VLANTag{TPID: packets.EtherTypeVLAN, PCP: 5, DEI: true, VID: 42})
+	c.Check(header.EtherType, Equals, packets.EtherTypeIPv4)
+	c.Check(header.Payload[:4], DeepEquals, []byte{42, 128, 0, 0})
+
+	// an explicit TPID is used as-is
+	eth.VLANTags = []packets.VLANTag{{TPID: 0x9100, VID: 1}}
+
+	data, err = eth.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[12:18], DeepEquals, []byte{0x91, 0x00, 0x00, 0x01, 0x08, 0x00})
+
+	//
+	// TEST packetserr.VLANFieldTooLarge
+	//
+	eth.VLANTags = []packets.VLANTag{{VID: 1}, {PCP: 8}}
+
+	data, err = eth.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.VLANFieldTooLarge{Index: 1, Field: "PCP", MaxValue: 7})
+
+	eth.VLANTags = []packets.VLANTag{{VID: 4096}}
+
+	data, err = eth.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.VLANFieldTooLarge{Index: 0, Field: "VID", MaxValue: 4095})
+
+	//
+	// TEST packetserr.EthernetAddressInvalid
+	//
+	eth.VLANTags = nil
+	eth.SourceAddress = net.HardwareAddr{0x00, 0x11, 0x22}
+
+	data, err = eth.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.EthernetAddressInvalid{Address: "00:11:22"})
+
+	eth.DestinationAddress = nil
+
+	data, err = eth.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.EthernetAddressInvalid{Address: ""})
+}
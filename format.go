@@ -0,0 +1,252 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tcpOptionNames are the names of the TCP options used by VerboseString().
+var tcpOptionNames = map[uint8]string{
+	TCPOptionKindEOL:           "End of Option List",
+	TCPOptionKindNOP:           "No-Operation",
+	TCPOptionKindMSS:           "Maximum Segment Size",
+	TCPOptionKindWindowScale:   "Window Scale",
+	TCPOptionKindSACKPermitted: "SACK Permitted",
+	TCPOptionKindSACK:          "SACK",
+	TCPOptionKindTimestamps:    "Timestamps",
+}
+
+// tcpOptionShortNames are the names tcpdump uses for the TCP options that have
+// data, for when the option is malformed.
+var tcpOptionShortNames = map[uint8]string{
+	TCPOptionKindMSS:           "mss",
+	TCPOptionKindWindowScale:   "wscale",
+	TCPOptionKindSACKPermitted: "sackOK",
+	TCPOptionKindSACK:          "sack",
+	TCPOptionKindTimestamps:    "TS",
+}
+
+// tcpFlags are the control bits of the TCP header, in the order they're printed,
+// along with their tcpdump abbreviation and name.
+var tcpFlags = []struct {
+	abbrev, name string
+	value        func(tcp *TCPHeader) bool
+}{
+	{"F", "FIN", func(tcp *TCPHeader) bool { return tcp.FIN }},
+	{"S", "SYN", func(tcp *TCPHeader) bool { return tcp.SYN }},
+	{"R", "RST", func(tcp *TCPHeader) bool { return tcp.RST }},
+	{"P", "PSH", func(tcp *TCPHeader) bool { return tcp.PSH }},
+	{".", "ACK", func(tcp *TCPHeader) bool { return tcp.ACK }},
+	{"U", "URG", func(tcp *TCPHeader) bool { return tcp.URG }},
+	{"E", "ECE", func(tcp *TCPHeader) bool { return tcp.ECE }},
+	{"W", "CWR", func(tcp *TCPHeader) bool { return tcp.CWR }},
+	{"e", "NS", func(tcp *TCPHeader) bool { return tcp.NS }},
+}
+
+// String is a method to summarize the TCPOption the way tcpdump does, such as
+// "mss 1460" or "wscale 7". Options that are malformed have their length noted,
+// and options of an unknown kind are printed with their data in hex.
+func (opt *TCPOption) String() string {
+	switch opt.Kind {
+	case TCPOptionKindEOL:
+		return "eol"
+	case TCPOptionKindNOP:
+		return "nop"
+	case TCPOptionKindMSS:
+		if mss, err := opt.MSS(); err == nil {
+			return fmt.Sprintf("mss %d", mss)
+		}
+	case TCPOptionKindWindowScale:
+		if shift, err := opt.WindowScale(); err == nil {
+			return fmt.Sprintf("wscale %d", shift)
+		}
+	case TCPOptionKindSACKPermitted:
+		if _, err := opt.typedData(TCPOptionKindSACKPermitted, 0); err == nil {
+			return "sackOK"
+		}
+	case TCPOptionKindSACK:
+		if blocks, err := opt.SACKBlocks(); err == nil {
+			var b strings.Builder
+
+			fmt.Fprintf(&b, "sack %d ", len(blocks))
+
+			for _, block := range blocks {
+				fmt.Fprintf(&b, "{%d:%d}", block.Left, block.Right)
+			}
+
+			return b.String()
+		}
+	case TCPOptionKindTimestamps:
+		if tsval, tsecr, err := opt.Timestamps(); err == nil {
+			return fmt.Sprintf("TS val %d ecr %d", tsval, tsecr)
+		}
+	default:
+		return fmt.Sprintf("unknown-%d 0x%x", opt.Kind, opt.Data)
+	}
+
+	return fmt.Sprintf("%s [bad length %d]", tcpOptionShortNames[opt.Kind], opt.length())
+}
+
+// length returns the Length of the option, or what it will be once marshaled if
+// it's zero. The EOL and NOP options are a single byte.
+func (opt *TCPOption) length() int {
+	switch {
+	case opt.Kind == TCPOptionKindEOL, opt.Kind == TCPOptionKindNOP:
+		return 1
+	case opt.Length == 0:
+		return len(opt.Data) + 2
+	}
+
+	return int(opt.Length)
+}
+
+// String is a method to summarize the TCPOptionSlice the way tcpdump does, as a
+// comma-separated list of the options in brackets: "[mss 1460,nop,wscale 7]".
+func (tcpos TCPOptionSlice) String() string {
+	strs := make([]string, 0, len(tcpos))
+
+	for _, opt := range tcpos {
+		if opt != nil {
+			strs = append(strs, opt.String())
+		}
+	}
+
+	return "[" + strings.Join(strs, ",") + "]"
+}
+
+// VerboseString is a method to describe each of the options on its own line,
+// naming the kind of the option along with its value.
+func (tcpos TCPOptionSlice) VerboseString() string {
+	var b strings.Builder
+
+	for _, opt := range tcpos {
+		if opt == nil {
+			continue
+		}
+
+		name, ok := tcpOptionNames[opt.Kind]
+		if !ok {
+			name = "Unknown"
+		}
+
+		fmt.Fprintf(&b, "%s (%d), length %d", name, opt.Kind, opt.length())
+
+		switch opt.Kind {
+		case TCPOptionKindEOL, TCPOptionKindNOP:
+		default:
+			fmt.Fprintf(&b, ": %s", opt.String())
+		}
+
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// String is a method to summarize the TCPHeader on a single line, the way tcpdump
+// does:
+//
+//	12345 > 80 Flags [S.], seq 1, ack 2, win 65535, options [mss 1460,nop,wscale 7]
+//
+// The acknowledgment number and urgent pointer are only included when the ACK and
+// URG flags are set, and the options and length of the Payload when there are any.
+func (tcp *TCPHeader) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d > %d Flags [", tcp.SourcePort, tcp.DestinationPort)
+
+	var none = true
+
+	for _, flag := range tcpFlags {
+		if flag.value(tcp) {
+			b.WriteString(flag.abbrev)
+			none = false
+		}
+	}
+
+	if none {
+		b.WriteString("none")
+	}
+
+	fmt.Fprintf(&b, "], seq %d", tcp.SeqNum)
+
+	if tcp.ACK {
+		fmt.Fprintf(&b, ", ack %d", tcp.AckNum)
+	}
+
+	fmt.Fprintf(&b, ", win %d", tcp.WindowSize)
+
+	if tcp.URG {
+		fmt.Fprintf(&b, ", urg %d", tcp.UrgentPointer)
+	}
+
+	if len(tcp.Options) > 0 {
+		fmt.Fprintf(&b, ", options %s", tcp.Options)
+	}
+
+	if len(tcp.Payload) > 0 {
+		fmt.Fprintf(&b, ", length %d", len(tcp.Payload))
+	}
+
+	return b.String()
+}
+
+// VerboseString is a method to describe each of the fields of the TCPHeader on
+// its own line, followed by each of the options.
+func (tcp *TCPHeader) VerboseString() string {
+	var b strings.Builder
+
+	var flags []string
+
+	for _, flag := range tcpFlags {
+		if flag.value(tcp) {
+			flags = append(flags, flag.name)
+		}
+	}
+
+	fmt.Fprintf(&b, "TCP %d > %d\n", tcp.SourcePort, tcp.DestinationPort)
+	fmt.Fprintf(&b, "  SeqNum: %d\n", tcp.SeqNum)
+	fmt.Fprintf(&b, "  AckNum: %d\n", tcp.AckNum)
+	fmt.Fprintf(&b, "  DataOffset: %d\n", tcp.DataOffset)
+	fmt.Fprintf(&b, "  Flags: [%s]\n", strings.Join(flags, " "))
+	fmt.Fprintf(&b, "  WindowSize: %d\n", tcp.WindowSize)
+	fmt.Fprintf(&b, "  Checksum: 0x%04x\n", tcp.Checksum)
+	fmt.Fprintf(&b, "  UrgentPointer: %d\n", tcp.UrgentPointer)
+
+	if len(tcp.Options) > 0 {
+		b.WriteString("  Options:\n")
+
+		for _, line := range strings.SplitAfter(tcp.Options.VerboseString(), "\n") {
+			if line != "" {
+				b.WriteString("    " + line)
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "  Payload: %d bytes\n", len(tcp.Payload))
+
+	return b.String()
+}
+
+// String is a method to summarize the UDPHeader on a single line, the way tcpdump
+// does: "4242 > 53 UDP, length 4". The length is that of the Payload.
+func (udp *UDPHeader) String() string {
+	return fmt.Sprintf("%d > %d UDP, length %d", udp.SourcePort, udp.DestinationPort, len(udp.Payload))
+}
+
+// VerboseString is a method to describe each of the fields of the UDPHeader on
+// its own line.
+func (udp *UDPHeader) VerboseString() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "UDP %d > %d\n", udp.SourcePort, udp.DestinationPort)
+	fmt.Fprintf(&b, "  Length: %d\n", udp.Length)
+	fmt.Fprintf(&b, "  Checksum: 0x%04x\n", udp.Checksum)
+	fmt.Fprintf(&b, "  Payload: %d bytes\n", len(udp.Payload))
+
+	return b.String()
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"fmt"
+
+	"github.com/theckman/packets"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestTCPOption_String(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	sack, err := packets.NewSACKOption([]packets.SACKBlock{{Left: 1, Right: 2}, {Left: 3, Right: 4}})
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		opt *packets.TCPOption
+		str string
+	}{
+		{&packets.TCPOption{Kind: packets.TCPOptionKindEOL}, "eol"},
+		{&packets.TCPOption{Kind: packets.TCPOptionKindNOP}, "nop"},
+		{packets.NewMSSOption(1460), "mss 1460"},
+		{wscale, "wscale 7"},
+		{packets.NewSACKPermittedOption(), "sackOK"},
+		{sack, "sack 2 {1:2}{3:4}"},
+		{packets.NewTimestampOption(42, 84), "TS val 42 ecr 84"},
+		{&packets.TCPOption{Kind: 30, Length: 4, Data: []byte{0xde, 0xad}}, "unknown-30 0xdead"},
+		{&packets.TCPOption{Kind: packets.TCPOptionKindMSS, Length: 3, Data: []byte{0x05}}, "mss [bad length 3]"},
+		{&packets.TCPOption{Kind: packets.TCPOptionKindTimestamps, Data: []byte{0x01}}, "TS [bad length 3]"},
+	}
+
+	for _, test := range tests {
+		c.Check(test.opt.String(), Equals, test.str)
+	}
+}
+
+func (t *TestSuite) TestTCPOptionSlice_String(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	opts := packets.TCPOptionSlice{
+		packets.NewMSSOption(1460),
+		nil,
+		{Kind: packets.TCPOptionKindNOP},
+		wscale,
+	}
+
+	c.Check(opts.String(), Equals, "[mss 1460,nop,wscale 7]")
+	c.Check(fmt.Sprint(opts), Equals, "[mss 1460,nop,wscale 7]")
+	c.Check(packets.TCPOptionSlice(nil).String(), Equals, "[]")
+
+	c.Check(opts.VerboseString(), Equals, "Maximum Segment Size (2), length 4: mss 1460\n"+
+		"No-Operation (1), length 1\n"+
+		"Window Scale (3), length 3: wscale 7\n")
+
+	opts = packets.TCPOptionSlice{{Kind: 30, Length: 2}}
+
+	c.Check(opts.VerboseString(), Equals, "Unknown (30), length 2: unknown-30 0x\n")
+}
+
+func (t *TestSuite) TestTCPHeader_String(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	tcp := &packets.TCPHeader{
+		SourcePort:      12345,
+		DestinationPort: 80,
+		SeqNum:          1,
+		AckNum:          2,
+		SYN:             true,
+		ACK:             true,
+		WindowSize:      65535,
+		Options: packets.TCPOptionSlice{
+			packets.NewMSSOption(1460),
+			{Kind: packets.TCPOptionKindNOP},
+			wscale,
+		},
+	}
+
+	c.Check(tcp.String(), Equals, "12345 > 80 Flags [S.], seq 1, ack 2, win 65535, options [mss 1460,nop,wscale 7]")
+	c.Check(fmt.Sprint(tcp), Equals, tcp.String())
+
+	tcp = &packets.TCPHeader{
+		SourcePort:      80,
+		DestinationPort: 12345,
+		SeqNum:          3,
+		AckNum:          4,
+		WindowSize:      512,
+		UrgentPointer:   2,
+		Payload:         []byte("hello"),
+	}
+
+	c.Check(tcp.String(), Equals, "80 > 12345 Flags [none], seq 3, win 512, length 5")
+
+	tcp.FIN, tcp.SYN, tcp.RST, tcp.PSH, tcp.ACK = true, true, true, true, true
+	tcp.URG, tcp.ECE, tcp.CWR, tcp.NS = true, true, true, true
+
+	c.Check(tcp.String(), Equals, "80 > 12345 Flags [FSRP.UEWe], seq 3, ack 4, win 512, urg 2, length 5")
+}
+
+func (t *TestSuite) TestTCPHeader_VerboseString(c *C) {
+	tcp := &packets.TCPHeader{
+		SourcePort:      12345,
+		DestinationPort: 80,
+		SeqNum:          1,
+		AckNum:          2,
+		DataOffset:      6,
+		SYN:             true,
+		ACK:             true,
+		WindowSize:      65535,
+		Checksum:        0xbeef,
+		Options:         packets.TCPOptionSlice{packets.NewMSSOption(1460)},
+	}
+
+	c.Check(tcp.VerboseString(), Equals, "TCP 12345 > 80\n"+
+		"  SeqNum: 1\n"+
+		"  AckNum: 2\n"+
+		"  DataOffset: 6\n"+
+		"  Flags: [SYN ACK]\n"+
+		"  WindowSize: 65535\n"+
+		"  Checksum: 0xbeef\n"+
+		"  UrgentPointer: 0\n"+
+		"  Options:\n"+
+		"    Maximum Segment Size (2), length 4: mss 1460\n"+
+		"  Payload: 0 bytes\n")
+}
+
+func (t *TestSuite) TestUDPHeader_String(c *C) {
+	udp := &packets.UDPHeader{
+		SourcePort:      4242,
+		DestinationPort: 53,
+		Length:          12,
+		Checksum:        0x1234,
+		Payload:         []byte("test"),
+	}
+
+	c.Check(udp.String(), Equals, "4242 > 53 UDP, length 4")
+	c.Check(fmt.Sprint(udp), Equals, udp.String())
+
+	c.Check(udp.VerboseString(), Equals, "UDP 4242 > 53\n"+
+		"  Length: 12\n"+
+		"  Checksum: 0x1234\n"+
+		"  Payload: 4 bytes\n")
+}
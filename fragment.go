@@ -0,0 +1,510 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theckman/packets/err"
+)
+
+const (
+	ipv4FragmentUnit    int   = 8 // the FragmentOffset field is in units of 8 bytes
+	ipv4OptionCopiedBit uint8 = 0x80
+
+	reassemblyDefaultTimeout  time.Duration = 30 * time.Second
+	reassemblyDefaultMaxBytes int           = 4 << 20
+)
+
+// Fragment is a function to split the payload in to IPv4 fragments which each fit
+// in the MTU, including their headers. Every fragment is a copy of the header
+// provided, with its MF, FragmentOffset, Options, and Payload fields set for its
+// part of the payload. The Payload field of the header provided is ignored, and
+// the Payload of each fragment references the payload provided.
+//
+// The ID field is shared by all of the fragments, so it should be set to a value
+// that's unique for the source, destination, and protocol. The IHL, TotalLength,
+// and Checksum fields of the fragments are zeroed, so that they are calculated
+// when each fragment is marshaled. Only the first fragment carries all of the
+// Options; the others only carry the options with the copied flag set, as required
+// by RFC 791.
+//
+// If the packet already fits in the MTU a single fragment is returned, which isn't
+// actually fragmented. Fragmenting a fragment is supported, with the FragmentOffset
+// and MF fields of the header provided being taken in to account.
+//
+// The error may be of the packetserr.IPv4FragmentationProhibited type if the DF
+// field is set, packetserr.IPv4MTUTooSmall if the MTU can't fit at least 8 bytes
+// of the payload, or packetserr.IPv4PayloadTooLarge if the payload can't fit in an
+// IPv4 packet.
+func Fragment(ip *IPv4Header, payload []byte, mtu int) ([]*IPv4Header, error) {
+	headerLen := ipv4HeaderLen(len(ip.Options))
+	base := int(ip.FragmentOffset) * ipv4FragmentUnit
+
+	if headerLen+base+len(payload) > maxUint16 {
+		return nil, packetserr.IPv4PayloadTooLarge{
+			MaxSize: maxUint16 - headerLen - base,
+			Len:     len(payload),
+		}
+	}
+
+	if headerLen+len(payload) <= mtu {
+		return []*IPv4Header{newIPv4Fragment(ip, ip.Options, payload, ip.FragmentOffset, ip.MF)}, nil
+	}
+
+	if ip.DF {
+		return nil, packetserr.IPv4FragmentationProhibited
+	}
+
+	copied := ipv4CopiedOptions(ip.Options)
+
+	// every fragment but the last must carry a multiple of 8 bytes,
+	// and the later fragments may have a smaller header than the first
+	firstLen := (mtu - headerLen) &^ (ipv4FragmentUnit - 1)
+	laterLen := (mtu - ipv4HeaderLen(len(copied))) &^ (ipv4FragmentUnit - 1)
+
+	if firstLen < ipv4FragmentUnit {
+		return nil, packetserr.IPv4MTUTooSmall{MTU: mtu, MinMTU: headerLen + ipv4FragmentUnit}
+	}
+
+	var frags []*IPv4Header
+
+	for offset := 0; offset < len(payload); {
+		opts, n := copied, laterLen
+
+		if offset == 0 {
+			opts, n = ip.Options, firstLen
+		}
+
+		end := offset + n
+
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		// the last fragment is only followed by more
+		// fragments if the packet itself was a fragment
+		mf := end < len(payload) || ip.MF
+		fragOffset := uint16((base + offset) / ipv4FragmentUnit)
+
+		frags = append(frags, newIPv4Fragment(ip, opts, payload[offset:end], fragOffset, mf))
+
+		offset = end
+	}
+
+	return frags, nil
+}
+
+func newIPv4Fragment(ip *IPv4Header, opts, payload []byte, fragOffset uint16, mf bool) *IPv4Header {
+	frag := *ip
+
+	frag.IHL = 0
+	frag.TotalLength = 0
+	frag.Checksum = 0
+	frag.MF = mf
+	frag.FragmentOffset = fragOffset
+	frag.Options = opts
+	frag.Payload = payload
+
+	return &frag
+}
+
+// ipv4HeaderLen returns the size of an IPv4 header with options of the length
+// provided, once padded to the 32-bit boundary.
+func ipv4HeaderLen(optsLen int) int {
+	return (ipv4HeaderMinSize + optsLen + 3) &^ 3
+}
+
+// ipv4CopiedOptions returns the options which have the copied flag set, and so
+// must be included in every fragment. Anything following a malformed option is
+// ignored.
+func ipv4CopiedOptions(opts []byte) []byte {
+	var copied []byte
+
+	for i := 0; i < len(opts); {
+		switch opts[i] {
+		case 0: // End of Options List
+			return copied
+		case 1: // No Operation
+			i++
+			continue
+		}
+
+		if i+1 >= len(opts) {
+			return copied
+		}
+
+		length := int(opts[i+1])
+
+		if length < 2 || i+length > len(opts) {
+			return copied
+		}
+
+		if opts[i]&ipv4OptionCopiedBit != 0 {
+			copied = append(copied, opts[i:i+length]...)
+		}
+
+		i += length
+	}
+
+	return copied
+}
+
+// OverlapPolicy is the policy of the Reassembler for fragments which overlap
+// data already received for the same packet.
+type OverlapPolicy uint8
+
+// These are the policies for overlapping fragments supported by the Reassembler.
+const (
+	// OverlapDrop discards the whole packet if any of its fragments overlap, as
+	// overlapping fragments are almost always an attempt to evade inspection.
+	// Exact duplicates of a fragment that was already received are ignored.
+	OverlapDrop OverlapPolicy = iota
+
+	// OverlapFirst keeps the data which was received first.
+	OverlapFirst
+
+	// OverlapLast overwrites the data already received with the data of the
+	// fragment received last.
+	OverlapLast
+)
+
+// Reassembler is a struct to put IPv4 fragments back together in to the packet
+// they were fragmented from. Fragments are buffered by their source address,
+// destination address, protocol, and ID until all of the packet's fragments have
+// been received. The zero value is ready to use, and it's safe for concurrent use
+// by multiple goroutines.
+//
+// The Timeout is how long after its first fragment arrives a packet is discarded if
+// it's still incomplete. The MaxBytes is a limit on the payload data buffered
+// across all of the packets; when a fragment would exceed it, the packets which
+// arrived first are discarded to make room. Neither of these may be changed once
+// the Reassembler is in use.
+type Reassembler struct {
+	Timeout  time.Duration // if set to 0 this becomes 30 seconds
+	MaxBytes int           // if set to 0 this becomes 4 MiB
+	Overlap  OverlapPolicy
+
+	mu      sync.Mutex
+	packets map[fragmentKey]*fragmentBuffer
+	bytes   int
+}
+
+type fragmentKey struct {
+	source, destination netip.Addr
+	protocol            uint8
+	id                  uint16
+}
+
+type fragmentRange struct {
+	start, end int
+}
+
+type fragmentBuffer struct {
+	header  *IPv4Header // the header of the first fragment, once it's received
+	data    []byte
+	ranges  []fragmentRange // the ranges of data received, sorted by their start
+	length  int             // the length of the payload, or -1 until the last fragment is received
+	arrived time.Time
+}
+
+// Add is a method to add the fragment to its packet, using the current time for
+// the Timeout. It's the same as AddAt(ip, time.Now()).
+func (r *Reassembler) Add(ip *IPv4Header) (*IPv4Header, error) {
+	return r.AddAt(ip, time.Now())
+}
+
+// AddAt is a method to add the fragment to its packet, as if it arrived at the time
+// provided. If the IPv4Header isn't a fragment it's returned as-is. Otherwise, if
+// this fragment completes its packet, the reassembled packet is returned; its
+// Payload is the whole of the original payload, ready to be unmarshaled by a
+// function such as UnmarshalUDPHeader(). If the packet is still incomplete, nil
+// is returned.
+//
+// The reassembled header is a copy of the header of the first fragment, with the
+// MF and FragmentOffset fields cleared. The IHL, TotalLength, and Checksum fields
+// are zeroed so that they are calculated if it's marshaled.
+//
+// The error may be of the packetserr.IPv4FragmentInvalid, packetserr.IPv4FragmentOverlap,
+// or packetserr.ReassemblyBufferFull types. In each case, the packet the fragment
+// belongs to is discarded.
+func (r *Reassembler) AddAt(ip *IPv4Header, now time.Time) (*IPv4Header, error) {
+	if !ip.MF && ip.FragmentOffset == 0 {
+		return ip, nil
+	}
+
+	start := int(ip.FragmentOffset) * ipv4FragmentUnit
+	end := start + len(ip.Payload)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(now)
+
+	key := fragmentKey{
+		source:      ip.SourceAddress,
+		destination: ip.DestinationAddress,
+		protocol:    ip.Protocol,
+		id:          ip.ID,
+	}
+
+	buf := r.packets[key]
+
+	if !validFragment(buf, ip.MF, start, end) {
+		r.discard(key)
+		return nil, packetserr.IPv4FragmentInvalid
+	}
+
+	if buf == nil {
+		if r.packets == nil {
+			r.packets = make(map[fragmentKey]*fragmentBuffer)
+		}
+
+		buf = &fragmentBuffer{length: -1, arrived: now}
+		r.packets[key] = buf
+	}
+
+	gaps := buf.gaps(start, end)
+
+	overlaps := start < end && (len(gaps) != 1 || gaps[0] != fragmentRange{start, end})
+
+	// an exact duplicate of a previous fragment is most
+	// likely a retransmission, rather than an overlap
+	if overlaps && r.Overlap == OverlapDrop {
+		if buf.hasRange(start, end) {
+			return nil, nil
+		}
+
+		r.discard(key)
+		return nil, packetserr.IPv4FragmentOverlap{Offset: start}
+	}
+
+	if grow := end - len(buf.data); grow > 0 {
+		if err := r.reserve(key, len(buf.data)+grow); err != nil {
+			return nil, err
+		}
+
+		buf.data = append(buf.data, make([]byte, grow)...)
+		r.bytes += grow
+	}
+
+	if r.Overlap == OverlapLast {
+		copy(buf.data[start:end], ip.Payload)
+	} else {
+		for _, gap := range gaps {
+			copy(buf.data[gap.start:gap.end], ip.Payload[gap.start-start:gap.end-start])
+		}
+	}
+
+	if len(gaps) > 0 {
+		buf.addRange(start, end)
+	}
+
+	if !ip.MF {
+		buf.length = end
+	}
+
+	if start == 0 && (buf.header == nil || r.Overlap == OverlapLast) {
+		header := *ip
+		header.Options = copyBytes(ip.Options)
+		header.Payload = nil
+		buf.header = &header
+	}
+
+	if !buf.complete() {
+		return nil, nil
+	}
+
+	r.discard(key)
+
+	header := *buf.header
+
+	header.IHL = 0
+	header.TotalLength = 0
+	header.Checksum = 0
+	header.MF = false
+	header.FragmentOffset = 0
+	header.Payload = buf.data[:buf.length:buf.length]
+
+	return &header, nil
+}
+
+// Expire is a method to discard the incomplete packets whose first fragment
+// arrived more than the Timeout before the time provided, returning how many
+// were discarded. Expired packets are also discarded as fragments are added, so
+// this only needs to be called to release their memory when no more fragments
+// are arriving.
+func (r *Reassembler) Expire(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.expire(now)
+}
+
+// Len is a method to get the number of incomplete packets being buffered.
+func (r *Reassembler) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.packets)
+}
+
+func (r *Reassembler) expire(now time.Time) int {
+	timeout := r.Timeout
+
+	if timeout == 0 {
+		timeout = reassemblyDefaultTimeout
+	}
+
+	var n int
+
+	for key, buf := range r.packets {
+		if now.Sub(buf.arrived) > timeout {
+			r.discard(key)
+			n++
+		}
+	}
+
+	return n
+}
+
+// reserve makes room for the packet to buffer size bytes, discarding the other
+// packets which arrived first if needed. If there isn't enough room even then,
+// the packet itself is discarded.
+func (r *Reassembler) reserve(key fragmentKey, size int) error {
+	maxBytes := r.MaxBytes
+
+	if maxBytes == 0 {
+		maxBytes = reassemblyDefaultMaxBytes
+	}
+
+	if size > maxBytes {
+		r.discard(key)
+		return packetserr.ReassemblyBufferFull{MaxBytes: maxBytes, Len: size}
+	}
+
+	buf := r.packets[key]
+
+	for r.bytes-len(buf.data)+size > maxBytes {
+		var oldest fragmentKey
+		var oldestBuf *fragmentBuffer
+
+		for k, b := range r.packets {
+			if k != key && (oldestBuf == nil || b.arrived.Before(oldestBuf.arrived)) {
+				oldest, oldestBuf = k, b
+			}
+		}
+
+		if oldestBuf == nil {
+			break
+		}
+
+		r.discard(oldest)
+	}
+
+	return nil
+}
+
+func (r *Reassembler) discard(key fragmentKey) {
+	if buf, ok := r.packets[key]; ok {
+		r.bytes -= len(buf.data)
+		delete(r.packets, key)
+	}
+}
+
+// validFragment returns whether the fragment is consistent with the fragments of
+// the packet already received, if any. Every fragment but the last must be a
+// multiple of 8 bytes, and none of them may go past the end of the packet.
+func validFragment(buf *fragmentBuffer, mf bool, start, end int) bool {
+	if end > maxUint16-ipv4HeaderMinSize {
+		return false
+	}
+
+	if mf && (end == start || (end-start)%ipv4FragmentUnit != 0) {
+		return false
+	}
+
+	if buf == nil {
+		return true
+	}
+
+	if !mf {
+		return (buf.length < 0 || buf.length == end) && len(buf.data) <= end
+	}
+
+	return buf.length < 0 || end <= buf.length
+}
+
+// gaps returns the parts of the range which haven't been received yet.
+func (b *fragmentBuffer) gaps(start, end int) []fragmentRange {
+	var gaps []fragmentRange
+
+	for _, rng := range b.ranges {
+		if rng.end <= start {
+			continue
+		}
+
+		if rng.start >= end {
+			break
+		}
+
+		if rng.start > start {
+			gaps = append(gaps, fragmentRange{start, rng.start})
+		}
+
+		if rng.end > start {
+			start = rng.end
+		}
+	}
+
+	if start < end {
+		gaps = append(gaps, fragmentRange{start, end})
+	}
+
+	return gaps
+}
+
+func (b *fragmentBuffer) hasRange(start, end int) bool {
+	for _, rng := range b.ranges {
+		if rng.start == start && rng.end == end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addRange inserts the range, keeping the ranges sorted by their start. They
+// aren't merged, so that duplicate fragments can be recognized.
+func (b *fragmentBuffer) addRange(start, end int) {
+	i := sort.Search(len(b.ranges), func(i int) bool { return b.ranges[i].start > start })
+
+	b.ranges = append(b.ranges, fragmentRange{})
+	copy(b.ranges[i+1:], b.ranges[i:])
+	b.ranges[i] = fragmentRange{start, end}
+}
+
+func (b *fragmentBuffer) complete() bool {
+	if b.length < 0 {
+		return false
+	}
+
+	var covered int
+
+	for _, rng := range b.ranges {
+		if rng.start > covered {
+			return false
+		}
+
+		if rng.end > covered {
+			covered = rng.end
+		}
+	}
+
+	return covered >= b.length
+}
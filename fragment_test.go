@@ -0,0 +1,399 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+// largeUDPDatagram returns a marshaled UDP datagram with a payload of the size
+// provided.
+func largeUDPDatagram(c *C, size int) []byte {
+	payload := make([]byte, size)
+
+	for i := range payload {
+		payload[i] = uint8(i)
+	}
+
+	udp := &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53, Payload: payload}
+
+	data, err := udp.Marshal()
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func (t *TestSuite) TestFragment(c *C) {
+	datagram := largeUDPDatagram(c, 3000)
+
+	t.ip4.DF = false
+	t.ip4.Checksum = 0xbeef // zeroed in the fragments
+
+	frags, err := packets.Fragment(t.ip4, datagram, 1500)
+	c.Assert(err, IsNil)
+	c.Assert(len(frags), Equals, 3)
+
+	expected := []struct {
+		offset uint16
+		mf     bool
+		len    int
+	}{
+		{0, true, 1480},
+		{185, true, 1480},
+		{370, false, 48},
+	}
+
+	var reassembled []byte
+
+	for i, frag := range frags {
+		c.Check(frag.ID, Equals, uint16(4242))
+		c.Check(frag.FragmentOffset, Equals, expected[i].offset)
+		c.Check(frag.MF, Equals, expected[i].mf)
+		c.Check(len(frag.Payload), Equals, expected[i].len)
+		c.Check(frag.Checksum, Equals, uint16(0))
+
+		data, err := frag.Marshal()
+		c.Assert(err, IsNil)
+		c.Check(len(data) <= 1500, Equals, true)
+
+		reassembled = append(reassembled, frag.Payload...)
+	}
+
+	c.Check(reassembled, DeepEquals, datagram)
+
+	// the header provided isn't modified
+	c.Check(t.ip4.MF, Equals, false)
+	c.Check(t.ip4.Checksum, Equals, uint16(0xbeef))
+
+	//
+	// TEST A PACKET THAT FITS IN THE MTU
+	//
+	frags, err = packets.Fragment(t.ip4, datagram, 9000)
+	c.Assert(err, IsNil)
+	c.Assert(len(frags), Equals, 1)
+	c.Check(frags[0].MF, Equals, false)
+	c.Check(frags[0].FragmentOffset, Equals, uint16(0))
+	c.Check(frags[0].Payload, DeepEquals, datagram)
+
+	//
+	// TEST FRAGMENTING A FRAGMENT
+	//
+	frags, err = packets.Fragment(frags[0], datagram[:1480], 576)
+	c.Assert(err, IsNil)
+	c.Assert(len(frags), Equals, 3)
+
+	frag, err := packets.Fragment(frags[1], frags[1].Payload, 68)
+	c.Assert(err, IsNil)
+	c.Assert(len(frag), Equals, 12)
+	c.Check(frag[0].FragmentOffset, Equals, uint16(69))
+	c.Check(frag[11].MF, Equals, true)
+
+	//
+	// TEST OPTIONS ONLY BEING COPIED WHEN FLAGGED
+	//
+	t.ip4.Options = []byte{
+		0x07, 0x07, 0x04, 0x00, 0x00, 0x00, 0x00, // Record Route
+		0x94, 0x04, 0x00, 0x00, // Router Alert
+		0x00,
+	}
+
+	frags, err = packets.Fragment(t.ip4, datagram, 1500)
+	c.Assert(err, IsNil)
+	c.Assert(len(frags), Equals, 3)
+	c.Check(frags[0].Options, DeepEquals, t.ip4.Options)
+	c.Check(len(frags[0].Payload), Equals, 1464)
+	c.Check(frags[1].Options, DeepEquals, []byte{0x94, 0x04, 0x00, 0x00})
+	c.Check(frags[1].FragmentOffset, Equals, uint16(183))
+	c.Check(len(frags[1].Payload), Equals, 1472)
+	c.Check(len(frags[2].Payload), Equals, 3008-1464-1472)
+
+	//
+	// TEST packetserr.IPv4FragmentationProhibited
+	//
+	t.ip4.DF = true
+
+	frags, err = packets.Fragment(t.ip4, datagram, 1500)
+	c.Assert(err, Not(IsNil))
+	c.Check(frags, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentationProhibited)
+
+	//
+	// TEST packetserr.IPv4MTUTooSmall
+	//
+	t.ip4.DF = false
+
+	frags, err = packets.Fragment(t.ip4, datagram, 39)
+	c.Assert(err, Not(IsNil))
+	c.Check(frags, IsNil)
+	c.Check(err, Equals, packetserr.IPv4MTUTooSmall{MTU: 39, MinMTU: 40})
+
+	//
+	// TEST packetserr.IPv4PayloadTooLarge
+	//
+	frags, err = packets.Fragment(t.ip4, make([]byte, 65504), 1500)
+	c.Assert(err, Not(IsNil))
+	c.Check(frags, IsNil)
+	c.Check(err, Equals, packetserr.IPv4PayloadTooLarge{MaxSize: 65503, Len: 65504})
+}
+
+func (t *TestSuite) TestReassembler(c *C) {
+	datagram := largeUDPDatagram(c, 4000)
+
+	t.ip4.DF = false
+
+	frags, err := packets.Fragment(t.ip4, datagram, 1500)
+	c.Assert(err, IsNil)
+	c.Assert(len(frags), Equals, 3)
+
+	// the fragments are unmarshaled, as they would be when received
+	var received []*packets.IPv4Header
+
+	for _, frag := range frags {
+		data, err := frag.Marshal()
+		c.Assert(err, IsNil)
+
+		ip, err := packets.UnmarshalIPv4Header(data)
+		c.Assert(err, IsNil)
+
+		received = append(received, ip)
+	}
+
+	r := &packets.Reassembler{}
+
+	//
+	// TEST FRAGMENTS ARRIVING OUT OF ORDER
+	//
+	ip, err := r.Add(received[2])
+	c.Assert(err, IsNil)
+	c.Check(ip, IsNil)
+
+	ip, err = r.Add(received[0])
+	c.Assert(err, IsNil)
+	c.Check(ip, IsNil)
+
+	// a retransmitted fragment is ignored
+	ip, err = r.Add(received[0])
+	c.Assert(err, IsNil)
+	c.Check(ip, IsNil)
+	c.Check(r.Len(), Equals, 1)
+
+	ip, err = r.Add(received[1])
+	c.Assert(err, IsNil)
+	c.Assert(ip, Not(IsNil))
+	c.Check(r.Len(), Equals, 0)
+
+	c.Check(ip.MF, Equals, false)
+	c.Check(ip.FragmentOffset, Equals, uint16(0))
+	c.Check(ip.TotalLength, Equals, uint16(0))
+	c.Check(ip.ID, Equals, uint16(4242))
+	c.Check(ip.SourceAddress, Equals, t.ip4.SourceAddress)
+	c.Check(ip.Payload, DeepEquals, datagram)
+
+	udp, err := packets.UnmarshalUDPHeader(ip.Payload)
+	c.Assert(err, IsNil)
+	c.Check(udp.DestinationPort, Equals, uint16(53))
+	c.Check(len(udp.Payload), Equals, 4000)
+
+	//
+	// TEST A PACKET THAT ISN'T A FRAGMENT
+	//
+	ip, err = r.Add(t.ip4)
+	c.Assert(err, IsNil)
+	c.Check(ip, Equals, t.ip4)
+
+	//
+	// TEST FRAGMENTS OF DIFFERENT PACKETS
+	//
+	other := *received[0]
+	other.ID = 1
+
+	_, err = r.Add(&other)
+	c.Assert(err, IsNil)
+
+	_, err = r.Add(received[0])
+	c.Assert(err, IsNil)
+	c.Check(r.Len(), Equals, 2)
+}
+
+func (t *TestSuite) TestReassembler_Overlap(c *C) {
+	first := &packets.IPv4Header{
+		ID:       1,
+		Protocol: packets.IPProtocolUDP,
+		MF:       true,
+		Payload:  bytes.Repeat([]byte{'a'}, 16),
+	}
+
+	overlap := *first
+	overlap.FragmentOffset = 1
+	overlap.Payload = bytes.Repeat([]byte{'b'}, 16)
+
+	last := *first
+	last.MF = false
+	last.FragmentOffset = 3
+	last.Payload = []byte{'c'}
+
+	//
+	// TEST OverlapDrop
+	//
+	r := &packets.Reassembler{}
+
+	_, err := r.Add(first)
+	c.Assert(err, IsNil)
+
+	ip, err := r.Add(&overlap)
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentOverlap{Offset: 8})
+	c.Check(r.Len(), Equals, 0)
+
+	//
+	// TEST OverlapFirst
+	//
+	r = &packets.Reassembler{Overlap: packets.OverlapFirst}
+
+	for _, frag := range []*packets.IPv4Header{first, &overlap} {
+		_, err = r.Add(frag)
+		c.Assert(err, IsNil)
+	}
+
+	ip, err = r.Add(&last)
+	c.Assert(err, IsNil)
+	c.Assert(ip, Not(IsNil))
+	c.Check(string(ip.Payload), Equals, "aaaaaaaaaaaaaaaabbbbbbbbc")
+
+	//
+	// TEST OverlapLast
+	//
+	r = &packets.Reassembler{Overlap: packets.OverlapLast}
+
+	for _, frag := range []*packets.IPv4Header{first, &overlap} {
+		_, err = r.Add(frag)
+		c.Assert(err, IsNil)
+	}
+
+	ip, err = r.Add(&last)
+	c.Assert(err, IsNil)
+	c.Assert(ip, Not(IsNil))
+	c.Check(string(ip.Payload), Equals, "aaaaaaaabbbbbbbbbbbbbbbbc")
+}
+
+func (t *TestSuite) TestReassembler_Invalid(c *C) {
+	r := &packets.Reassembler{}
+
+	frag := &packets.IPv4Header{ID: 1, MF: true, Payload: make([]byte, 12)}
+
+	//
+	// TEST packetserr.IPv4FragmentInvalid
+	//
+
+	// all but the last fragment must be a multiple of 8 bytes
+	ip, err := r.Add(frag)
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentInvalid)
+
+	// the fragment must fit in the largest possible packet
+	frag = &packets.IPv4Header{ID: 1, FragmentOffset: 8189, Payload: make([]byte, 8)}
+
+	ip, err = r.Add(frag)
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentInvalid)
+
+	// the fragments must agree on where the packet ends
+	frag = &packets.IPv4Header{ID: 1, FragmentOffset: 2, Payload: make([]byte, 8)}
+
+	_, err = r.Add(frag)
+	c.Assert(err, IsNil)
+
+	frag = &packets.IPv4Header{ID: 1, MF: true, FragmentOffset: 3, Payload: make([]byte, 8)}
+
+	ip, err = r.Add(frag)
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentInvalid)
+
+	// the packet is discarded along with the invalid fragment
+	c.Check(r.Len(), Equals, 0)
+
+	frag = &packets.IPv4Header{ID: 1, MF: true, FragmentOffset: 4, Payload: make([]byte, 8)}
+
+	_, err = r.Add(frag)
+	c.Assert(err, IsNil)
+
+	frag = &packets.IPv4Header{ID: 1, FragmentOffset: 3, Payload: make([]byte, 4)}
+
+	ip, err = r.Add(frag)
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FragmentInvalid)
+}
+
+func (t *TestSuite) TestReassembler_Limits(c *C) {
+	now := time.Unix(1445644800, 0)
+
+	r := &packets.Reassembler{Timeout: 10 * time.Second, MaxBytes: 64}
+
+	frag := func(id uint16, size int) *packets.IPv4Header {
+		return &packets.IPv4Header{ID: id, MF: true, Payload: make([]byte, size)}
+	}
+
+	//
+	// TEST THE TIMEOUT
+	//
+	_, err := r.AddAt(frag(1, 16), now)
+	c.Assert(err, IsNil)
+
+	_, err = r.AddAt(frag(2, 16), now.Add(5*time.Second))
+	c.Assert(err, IsNil)
+
+	c.Check(r.Expire(now.Add(10*time.Second)), Equals, 0)
+	c.Check(r.Len(), Equals, 2)
+
+	c.Check(r.Expire(now.Add(11*time.Second)), Equals, 1)
+	c.Check(r.Len(), Equals, 1)
+
+	// expired packets are discarded as fragments are added
+	_, err = r.AddAt(frag(3, 16), now.Add(20*time.Second))
+	c.Assert(err, IsNil)
+	c.Check(r.Len(), Equals, 1)
+
+	//
+	// TEST THE MEMORY LIMIT
+	//
+	now = now.Add(20 * time.Second)
+
+	_, err = r.AddAt(frag(4, 24), now.Add(time.Second))
+	c.Assert(err, IsNil)
+
+	_, err = r.AddAt(frag(5, 24), now.Add(2*time.Second))
+	c.Assert(err, IsNil)
+	c.Check(r.Len(), Equals, 3)
+
+	// the packet that arrived first is discarded to make room
+	_, err = r.AddAt(frag(6, 16), now.Add(3*time.Second))
+	c.Assert(err, IsNil)
+	c.Check(r.Len(), Equals, 3)
+
+	// packet 3 would have been completed by its last fragment
+	ip, err := r.AddAt(&packets.IPv4Header{ID: 3, FragmentOffset: 2, Payload: make([]byte, 4)}, now.Add(4*time.Second))
+	c.Assert(err, IsNil)
+	c.Check(ip, IsNil)
+	c.Check(r.Len(), Equals, 3)
+
+	//
+	// TEST packetserr.ReassemblyBufferFull
+	//
+	ip, err = r.AddAt(frag(7, 72), now.Add(5*time.Second))
+	c.Assert(err, Not(IsNil))
+	c.Check(ip, IsNil)
+	c.Check(err, Equals, packetserr.ReassemblyBufferFull{MaxBytes: 64, Len: 72})
+	c.Check(r.Len(), Equals, 3)
+}
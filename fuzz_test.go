@@ -0,0 +1,232 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/theckman/packets"
+)
+
+// These fuzz targets make sure the decoders never panic, regardless of the
+// data they're given. Run them with:
+//
+//	go test -run='^$' -fuzz=FuzzUnmarshalTCPHeader
+
+func FuzzUnmarshalTCPOptionSlice(f *testing.F) {
+	f.Add([]byte{2, 4, 5, 180, 4, 2, 8, 10, 0, 0, 0, 100, 0, 0, 0, 0, 1, 3, 3, 7})
+	f.Add([]byte{1, 1, 2, 0})
+	f.Add([]byte{8, 255, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opts, err := packets.UnmarshalTCPOptionSlice(data)
+		if err != nil {
+			return
+		}
+
+		for _, opt := range opts {
+			if int(opt.Length) != len(opt.Data)+2 {
+				t.Fatalf("option Length %d doesn't match %d bytes of Data", opt.Length, len(opt.Data))
+			}
+		}
+
+		opts.Marshal()
+	})
+}
+
+func FuzzUnmarshalTCPHeader(f *testing.F) {
+	for _, p := range checksumCorpus {
+		if p.kind == "tcp" {
+			f.Add(p.data[20:])
+		}
+	}
+
+	f.Add(make([]byte, 20))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := packets.UnmarshalTCPHeader(data)
+		if err != nil {
+			return
+		}
+
+		if int(header.DataOffset)*4+len(header.Payload) != len(data) {
+			t.Fatalf("DataOffset %d and %d bytes of Payload don't add up to %d bytes", header.DataOffset, len(header.Payload), len(data))
+		}
+
+		var decoded packets.TCPHeader
+
+		if err := decoded.DecodeFromBytes(data); err != nil {
+			t.Fatalf("DecodeFromBytes failed where UnmarshalTCPHeader didn't: %s", err)
+		}
+
+		if !reflect.DeepEqual(&decoded, header) {
+			t.Fatalf("DecodeFromBytes result %#v doesn't match %#v", decoded, *header)
+		}
+
+		header.Marshal()
+		header.Validate()
+	})
+}
+
+func FuzzUnmarshalUDPHeader(f *testing.F) {
+	for _, p := range checksumCorpus {
+		if p.kind == "udp" {
+			f.Add(p.data[20:])
+		}
+	}
+
+	f.Add([]byte{0, 53, 0, 53, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := packets.UnmarshalUDPHeader(data)
+		if err != nil {
+			return
+		}
+
+		if int(header.Length) != len(header.Payload)+8 {
+			t.Fatalf("Length %d doesn't match %d bytes of Payload", header.Length, len(header.Payload))
+		}
+
+		var decoded packets.UDPHeader
+
+		if err := decoded.DecodeFromBytes(data); err != nil {
+			t.Fatalf("DecodeFromBytes failed where UnmarshalUDPHeader didn't: %s", err)
+		}
+
+		if !reflect.DeepEqual(&decoded, header) {
+			t.Fatalf("DecodeFromBytes result %#v doesn't match %#v", decoded, *header)
+		}
+
+		header.Marshal()
+	})
+}
+
+func FuzzUnmarshalIPv4Header(f *testing.F) {
+	for _, p := range checksumCorpus {
+		f.Add(p.data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := packets.UnmarshalIPv4Header(data)
+		if err != nil {
+			return
+		}
+
+		header.Marshal()
+	})
+}
+
+func FuzzUnmarshalIPv6Header(f *testing.F) {
+	f.Add(make([]byte, 40))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := packets.UnmarshalIPv6Header(data)
+		if err != nil {
+			return
+		}
+
+		header.Marshal()
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, p := range checksumCorpus {
+		f.Add(ethernetFrame(packets.EtherTypeIPv4, p.data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := packets.Decode(data, packets.LayerTypeEthernet)
+		if packet == nil {
+			t.Fatalf("Decode returned a nil *Packet with error %v", err)
+		}
+	})
+}
+
+func FuzzUnmarshalQuotedPacket(f *testing.F) {
+	f.Add(icmpUnreachableFrame[42:])
+
+	for _, p := range checksumCorpus {
+		f.Add(p.data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		q, err := packets.UnmarshalQuotedPacket(data)
+		if err != nil {
+			return
+		}
+
+		if q.TCP == nil && q.UDP == nil && q.Fields != 0 {
+			t.Fatalf("Fields is %#x without a TCP or UDP header", q.Fields)
+		}
+	})
+}
+
+func FuzzReassembler(f *testing.F) {
+	f.Add([]byte{0, 0, 2, 1, 0, 2, 2, 1, 0, 1, 2, 1}, uint8(packets.OverlapDrop))
+	f.Add([]byte{0, 0, 3, 1, 0, 1, 3, 1, 0, 3, 1, 0}, uint8(packets.OverlapFirst))
+
+	f.Fuzz(func(t *testing.T, data []byte, overlap uint8) {
+		r := &packets.Reassembler{MaxBytes: 256, Overlap: packets.OverlapPolicy(overlap % 3)}
+
+		// each fragment is described by its offset, its
+		// length in units of 8 bytes, and the MF field
+		for i := 0; i+4 <= len(data); i += 4 {
+			frag := &packets.IPv4Header{
+				ID:             uint16(data[i] % 2),
+				FragmentOffset: uint16(data[i+1]),
+				MF:             data[i+3]&1 != 0,
+				Payload:        make([]byte, int(data[i+2])*8),
+			}
+
+			ip, err := r.Add(frag)
+			if err == nil && ip != nil && ip.MF {
+				t.Fatal("reassembled packet has the MF field set")
+			}
+		}
+	})
+}
+
+func FuzzUnmarshalIPv6ExtensionHeaders(f *testing.F) {
+	f.Add(packets.IPProtocolIPv6HopByHop, ipv6ExtensionChain)
+	f.Add(packets.IPProtocolIPv6Routing, []byte{0x11, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00})
+	f.Add(packets.IPProtocolIPv6DestinationOptions, []byte{0x3b, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, nextHeader uint8, data []byte) {
+		hdrs, protocol, offset, err := packets.UnmarshalIPv6ExtensionHeaders(nextHeader, data)
+		if err != nil {
+			return
+		}
+
+		walked, walkedOffset, err := packets.WalkIPv6ExtensionHeaders(nextHeader, data)
+		if err != nil {
+			t.Fatalf("failed to walk headers that unmarshaled: %v", err)
+		}
+
+		if walked != protocol || walkedOffset != offset {
+			t.Fatalf("walk returned %d at %d, unmarshal returned %d at %d", walked, walkedOffset, protocol, offset)
+		}
+
+		// the decoded padding is kept, so the headers round-trip
+		// unless the reserved fields of a Fragment header were set
+		for _, header := range hdrs {
+			if header.HeaderType() == packets.IPProtocolIPv6Fragment {
+				return
+			}
+		}
+
+		if len(hdrs) > 0 {
+			out, err := hdrs.Marshal(protocol)
+			if err != nil {
+				t.Fatalf("failed to marshal unmarshaled headers: %v", err)
+			}
+
+			if !bytes.Equal(out, data[:offset]) {
+				t.Fatalf("round trip mismatch:\n got %x\nwant %x", out, data[:offset])
+			}
+		}
+	})
+}
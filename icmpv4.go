@@ -0,0 +1,161 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the Type values of the ICMPv4 messages with a body decoded by this
+// package. See RFC 792.
+const (
+	ICMPv4TypeEchoReply              uint8 = 0
+	ICMPv4TypeDestinationUnreachable uint8 = 3
+	ICMPv4TypeRedirect               uint8 = 5
+	ICMPv4TypeEchoRequest            uint8 = 8
+	ICMPv4TypeTimeExceeded           uint8 = 11
+	ICMPv4TypeParameterProblem       uint8 = 12
+)
+
+// These are the Code values of the Destination Unreachable and Time Exceeded
+// ICMPv4 messages. See RFC 792 and RFC 1812.
+const (
+	ICMPv4CodeNetUnreachable          uint8 = 0
+	ICMPv4CodeHostUnreachable         uint8 = 1
+	ICMPv4CodeProtocolUnreachable     uint8 = 2
+	ICMPv4CodePortUnreachable         uint8 = 3
+	ICMPv4CodeFragmentationNeeded     uint8 = 4
+	ICMPv4CodeCommunicationProhibited uint8 = 13
+	ICMPv4CodeTTLExceeded             uint8 = 0
+	ICMPv4CodeReassemblyTimeExceeded  uint8 = 1
+
+	icmpHeaderLen int = 8
+)
+
+// ICMPv4Message is a struct representing an ICMPv4 message. The fields following
+// the Checksum are only used by some types of message, and are otherwise ignored:
+//
+//	Identifier and SequenceNumber: Echo Request and Echo Reply
+//	NextHopMTU: Destination Unreachable, with the Fragmentation Needed code
+//	Gateway: Redirect
+//	Pointer: Parameter Problem
+//	RestOfHeader: any other type of message
+//
+// The Data is the echo data of Echo Request and Echo Reply messages, or the
+// datagram which caused an error for the other messages.
+type ICMPv4Message struct {
+	Type           uint8
+	Code           uint8
+	Checksum       uint16 // always calculated when marshaling
+	Identifier     uint16
+	SequenceNumber uint16
+	NextHopMTU     uint16
+	Gateway        netip.Addr
+	Pointer        uint8
+	RestOfHeader   uint32 // the four bytes following the Checksum
+	Data           []byte
+}
+
+// UnmarshalICMPv4Message is a function that takes a byte slice and parses it in
+// to an instance of *ICMPv4Message. The four bytes following the Checksum are
+// decoded in to the fields used by the Type of message, and the Data is everything
+// following them.
+//
+// The error is a packetserr.DecodeError wrapping the packetserr.ICMPMessageTruncated
+// type if there is less data than the size of the ICMP header.
+func UnmarshalICMPv4Message(data []byte) (*ICMPv4Message, error) {
+	return unmarshalICMPv4Message(data)
+}
+
+// Marshal is a function to marshal the *ICMPv4Message instance to a byte slice,
+// including the calculation of the Checksum field. Because ICMPv4 doesn't use a
+// pseudo-header, the checksum only covers the message itself. The *ICMPv4Message
+// instance is not modified.
+//
+// The error will be of the packetserr.IPv4AddressInvalid type if the message is
+// a Redirect and the Gateway isn't an IPv4 address.
+func (icmp *ICMPv4Message) Marshal() ([]byte, error) {
+	return icmp.marshalICMPv4Message()
+}
+
+// icmpFields are the fields of the ICMPv4 and ICMPv6 headers, for describing
+// where decoding failed. The fields following the Checksum depend on the Type of
+// message, so they're described as the rest of the header.
+var icmpFields = []headerField{
+	{0, "Type"}, {1, "Code"}, {2, "Checksum"}, {4, "RestOfHeader"},
+}
+
+func unmarshalICMPv4Message(data []byte) (*ICMPv4Message, error) {
+	if len(data) < icmpHeaderLen {
+		err := packetserr.ICMPMessageTruncated{ExpectedSize: icmpHeaderLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeICMPv4, icmpFields, len(data), err)
+	}
+
+	icmp := &ICMPv4Message{
+		Type:     data[0],
+		Code:     data[1],
+		Checksum: binary.BigEndian.Uint16(data[2:4]),
+		Data:     copyBytes(data[icmpHeaderLen:]),
+	}
+
+	rest := data[4:icmpHeaderLen]
+
+	switch icmp.Type {
+	case ICMPv4TypeEchoReply, ICMPv4TypeEchoRequest:
+		icmp.Identifier = binary.BigEndian.Uint16(rest[0:2])
+		icmp.SequenceNumber = binary.BigEndian.Uint16(rest[2:4])
+	case ICMPv4TypeDestinationUnreachable:
+		icmp.NextHopMTU = binary.BigEndian.Uint16(rest[2:4])
+	case ICMPv4TypeRedirect:
+		icmp.Gateway = netip.AddrFrom4([4]byte(rest))
+	case ICMPv4TypeParameterProblem:
+		icmp.Pointer = rest[0]
+	case ICMPv4TypeTimeExceeded:
+		// the rest of the header is unused
+	default:
+		icmp.RestOfHeader = binary.BigEndian.Uint32(rest)
+	}
+
+	return icmp, nil
+}
+
+func (icmp *ICMPv4Message) marshalICMPv4Message() ([]byte, error) {
+	data := make([]byte, icmpHeaderLen, icmpHeaderLen+len(icmp.Data))
+
+	data[0] = icmp.Type
+	data[1] = icmp.Code
+
+	rest := data[4:icmpHeaderLen]
+
+	switch icmp.Type {
+	case ICMPv4TypeEchoReply, ICMPv4TypeEchoRequest:
+		binary.BigEndian.PutUint16(rest[0:], icmp.Identifier)
+		binary.BigEndian.PutUint16(rest[2:], icmp.SequenceNumber)
+	case ICMPv4TypeDestinationUnreachable:
+		binary.BigEndian.PutUint16(rest[2:], icmp.NextHopMTU)
+	case ICMPv4TypeRedirect:
+		gateway, ok := ipv4AddrAs4(icmp.Gateway)
+		if !ok {
+			return nil, packetserr.IPv4AddressInvalid{Address: icmp.Gateway.String()}
+		}
+
+		copy(rest, gateway[:])
+	case ICMPv4TypeParameterProblem:
+		rest[0] = icmp.Pointer
+	case ICMPv4TypeTimeExceeded:
+		// the rest of the header is unused
+	default:
+		binary.BigEndian.PutUint32(rest, icmp.RestOfHeader)
+	}
+
+	data = append(data, icmp.Data...)
+
+	binary.BigEndian.PutUint16(data[2:], InternetChecksum(data))
+
+	return data, nil
+}
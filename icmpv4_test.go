@@ -0,0 +1,182 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net/netip"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+// icmpUnreachableFrame is the Ethernet frame of the captured packet:
+//
+//	15:49:15.773265 IP 72.14.222.226 > 172.29.20.15: ICMP host 10.66.73.201 unreachable - admin prohibited filter, length 36
+var icmpUnreachableFrame = []byte{
+	0x24, 0xbe, 0x05, 0x27, 0x0b, 0x17, 0x00, 0x1f, 0xca, 0xb3, 0x75, 0xc0, 0x08, 0x00, 0x45, 0x00,
+	0x00, 0x38, 0x00, 0x00, 0x00, 0x00, 0xfc, 0x01, 0xd7, 0xa7, 0x48, 0x0e, 0xde, 0xe2, 0xac, 0x1d,
+	0x14, 0x0f, 0x03, 0x0d, 0x94, 0x6e, 0x00, 0x00, 0x00, 0x00, 0x45, 0x20, 0x00, 0x4d, 0x00, 0x00,
+	0x40, 0x00, 0x3e, 0x11, 0x28, 0x49, 0xac, 0x1d, 0x14, 0x0f, 0x0a, 0x42, 0x49, 0xc9, 0x8e, 0xcc,
+	0x62, 0xe1, 0x00, 0x39, 0x76, 0x9d,
+}
+
+func (t *TestSuite) TestUnmarshalICMPv4Message(c *C) {
+	data := icmpUnreachableFrame[34:]
+
+	icmp, err := packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+
+	c.Check(icmp.Type, Equals, packets.ICMPv4TypeDestinationUnreachable)
+	c.Check(icmp.Code, Equals, packets.ICMPv4CodeCommunicationProhibited)
+	c.Check(icmp.Checksum, Equals, uint16(0x946e))
+	c.Check(icmp.NextHopMTU, Equals, uint16(0))
+	c.Check(icmp.Data, DeepEquals, data[8:])
+
+	// remarshaling results in the same data, including the checksum
+	icmp.Checksum = 0
+
+	marshaled, err := icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(marshaled, DeepEquals, data)
+
+	//
+	// TEST packetserr.ICMPMessageTruncated
+	//
+	icmp, err = packets.UnmarshalICMPv4Message(data[:7])
+	c.Assert(err, Not(IsNil))
+	c.Check(icmp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv4",
+		Field:  "RestOfHeader",
+		Offset: 4,
+		Err:    packetserr.ICMPMessageTruncated{ExpectedSize: 8, Len: 7},
+	})
+}
+
+func (t *TestSuite) TestICMPv4Message_Marshal(c *C) {
+	//
+	// TEST ECHO REQUEST
+	//
+	icmp := &packets.ICMPv4Message{
+		Type:           packets.ICMPv4TypeEchoRequest,
+		Identifier:     0x1234,
+		SequenceNumber: 1,
+		Data:           []byte("ping"),
+	}
+
+	data, err := icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{8, 0, 0x06, 0xfa, 0x12, 0x34, 0x00, 0x01, 'p', 'i', 'n', 'g'})
+	c.Check(packets.InternetChecksum(data), Equals, uint16(0))
+
+	// the Checksum is calculated on the marshaled data only, and
+	// any value in the Checksum field is ignored
+	c.Check(icmp.Checksum, Equals, uint16(0))
+
+	icmp.Checksum = 0xbeef
+
+	data2, err := icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data2, DeepEquals, data)
+
+	decoded, err := packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Identifier, Equals, uint16(0x1234))
+	c.Check(decoded.SequenceNumber, Equals, uint16(1))
+	c.Check(decoded.Checksum, Equals, uint16(0x06fa))
+	c.Check(string(decoded.Data), Equals, "ping")
+
+	//
+	// TEST DESTINATION UNREACHABLE WITH A NEXT-HOP MTU
+	//
+	icmp = &packets.ICMPv4Message{
+		Type:       packets.ICMPv4TypeDestinationUnreachable,
+		Code:       packets.ICMPv4CodeFragmentationNeeded,
+		NextHopMTU: 1400,
+		Identifier: 42, // ignored, as it's not an echo message
+		Data:       icmpUnreachableFrame[42:],
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[4:8], DeepEquals, []byte{0, 0, 0x05, 0x78})
+	c.Check(packets.InternetChecksum(data), Equals, uint16(0))
+
+	decoded, err = packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.NextHopMTU, Equals, uint16(1400))
+	c.Check(decoded.Identifier, Equals, uint16(0))
+
+	//
+	// TEST TIME EXCEEDED
+	//
+	icmp = &packets.ICMPv4Message{
+		Type:         packets.ICMPv4TypeTimeExceeded,
+		Code:         packets.ICMPv4CodeTTLExceeded,
+		RestOfHeader: 0xffffffff, // ignored, as the rest of the header is unused
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{11, 0, 0xf4, 0xff, 0, 0, 0, 0})
+
+	//
+	// TEST REDIRECT
+	//
+	icmp = &packets.ICMPv4Message{
+		Type:    packets.ICMPv4TypeRedirect,
+		Code:    1,
+		Gateway: netip.MustParseAddr("10.0.0.1"),
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{5, 1, 0xf0, 0xfd, 10, 0, 0, 1})
+
+	decoded, err = packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Gateway, Equals, netip.MustParseAddr("10.0.0.1"))
+
+	icmp.Gateway = netip.MustParseAddr("fe80::1")
+
+	data, err = icmp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "fe80::1"})
+
+	//
+	// TEST PARAMETER PROBLEM
+	//
+	icmp = &packets.ICMPv4Message{
+		Type:    packets.ICMPv4TypeParameterProblem,
+		Pointer: 9,
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[4:8], DeepEquals, []byte{9, 0, 0, 0})
+
+	decoded, err = packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Pointer, Equals, uint8(9))
+
+	//
+	// TEST OTHER TYPES
+	//
+	icmp = &packets.ICMPv4Message{
+		Type:         13, // Timestamp
+		RestOfHeader: 0x00010002,
+		Data:         make([]byte, 12),
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[4:8], DeepEquals, []byte{0, 1, 0, 2})
+
+	decoded, err = packets.UnmarshalICMPv4Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.RestOfHeader, Equals, uint32(0x00010002))
+}
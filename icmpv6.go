@@ -0,0 +1,309 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the Type values of the ICMPv6 messages with a body decoded by this
+// package. See RFC 4443 and RFC 4861.
+const (
+	ICMPv6TypeDestinationUnreachable uint8 = 1
+	ICMPv6TypePacketTooBig           uint8 = 2
+	ICMPv6TypeTimeExceeded           uint8 = 3
+	ICMPv6TypeParameterProblem       uint8 = 4
+	ICMPv6TypeEchoRequest            uint8 = 128
+	ICMPv6TypeEchoReply              uint8 = 129
+	ICMPv6TypeRouterSolicitation     uint8 = 133
+	ICMPv6TypeRouterAdvertisement    uint8 = 134
+	ICMPv6TypeNeighborSolicitation   uint8 = 135
+	ICMPv6TypeNeighborAdvertisement  uint8 = 136
+	ICMPv6TypeRedirect               uint8 = 137
+)
+
+// These are the sizes of the Neighbor Discovery messages before any options, and
+// the bits of their flags fields.
+const (
+	icmpv6RouterAdvertisementLen int   = 16
+	icmpv6NeighborMessageLen     int   = 24
+	icmpv6RedirectLen            int   = 40
+	icmpv6ManagedBit             uint8 = 0x80
+	icmpv6OtherConfigBit         uint8 = 0x40
+	icmpv6RouterBit              uint8 = 0x80
+	icmpv6SolicitedBit           uint8 = 0x40
+	icmpv6OverrideBit            uint8 = 0x20
+)
+
+// ICMPv6Message is a struct representing an ICMPv6 message, including the Neighbor
+// Discovery messages. The fields following the Checksum are only used by some
+// types of message, and are otherwise ignored:
+//
+//	Identifier and SequenceNumber: Echo Request and Echo Reply
+//	MTU: Packet Too Big
+//	Pointer: Parameter Problem
+//	CurHopLimit, Managed, OtherConfig, RouterLifetime, ReachableTime,
+//	  and RetransTimer: Router Advertisement
+//	Router, Solicited, and Override: Neighbor Advertisement
+//	TargetAddress: Neighbor Solicitation, Neighbor Advertisement, and Redirect
+//	DestinationAddress: Redirect
+//	Options: all of the Neighbor Discovery messages
+//	RestOfHeader: any other type of message, besides Destination Unreachable
+//	  and Time Exceeded where the rest of the header is unused
+//
+// The Data is the echo data of Echo Request and Echo Reply messages, or the
+// packet which caused an error for the error messages. It isn't used by the
+// Neighbor Discovery messages.
+type ICMPv6Message struct {
+	Type               uint8
+	Code               uint8
+	Checksum           uint16 // suggest using MarshalWithChecksum() to calculate this
+	Identifier         uint16
+	SequenceNumber     uint16
+	MTU                uint32
+	Pointer            uint32
+	CurHopLimit        uint8
+	Managed            bool
+	OtherConfig        bool
+	RouterLifetime     uint16
+	ReachableTime      uint32
+	RetransTimer       uint32
+	Router             bool
+	Solicited          bool
+	Override           bool
+	TargetAddress      netip.Addr
+	DestinationAddress netip.Addr
+	RestOfHeader       uint32 // the four bytes following the Checksum
+	Options            NDPOptionSlice
+	Data               []byte
+}
+
+// UnmarshalICMPv6Message is a function that takes a byte slice and parses it in
+// to an instance of *ICMPv6Message. The body of the message is decoded in to the
+// fields used by the Type of message, including the options of Neighbor Discovery
+// messages.
+//
+// The error is a packetserr.DecodeError wrapping the packetserr.ICMPMessageTruncated
+// type if there is less data than the size of the message, or any of the errors
+// returned by UnmarshalNDPOptionSlice with the Offset counted from the start of
+// the message.
+func UnmarshalICMPv6Message(data []byte) (*ICMPv6Message, error) {
+	return unmarshalICMPv6Message(data)
+}
+
+// Marshal is a function to marshal the *ICMPv6Message instance to a byte slice
+// without calculating the checksum. If the Checksum field is set, it will be
+// included in the marshaled data.
+//
+// The error may be of the packetserr.IPv6AddressInvalid type if the TargetAddress
+// or DestinationAddress used by the Type of message isn't an IPv6 address, or
+// any of the errors returned by NDPOptionSlice.Marshal().
+func (icmp *ICMPv6Message) Marshal() ([]byte, error) {
+	return icmp.marshalICMPv6Message()
+}
+
+// MarshalWithChecksum is a function to marshal the *ICMPv6Message instance to a
+// byte slice including the calculation of the Checksum field. Unlike ICMPv4, the
+// ICMPv6 checksum covers the IPv6 pseudo-header so the local and remote IPv6
+// addresses must be provided. The *ICMPv6Message instance is not modified.
+//
+// If either address can't be parsed the error will be of the
+// packetserr.IPv6AddressInvalid type.
+func (icmp *ICMPv6Message) MarshalWithChecksum(laddr, raddr string) ([]byte, error) {
+	src, err := parseIPv6Addr(laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseIPv6Addr(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return icmp.MarshalWithChecksumAddr(src, dst)
+}
+
+// MarshalWithChecksumAddr is a function to marshal the *ICMPv6Message instance to
+// a byte slice including the calculation of the Checksum field. It's the same as
+// MarshalWithChecksum() except that the local and remote addresses are provided
+// as netip.Addr values.
+func (icmp *ICMPv6Message) MarshalWithChecksumAddr(laddr, raddr netip.Addr) ([]byte, error) {
+	data, err := icmp.marshalICMPv6Message()
+	if err != nil {
+		return nil, err
+	}
+
+	// the checksum is calculated with the Checksum field zeroed
+	binary.BigEndian.PutUint16(data[2:], 0)
+
+	csum, err := ChecksumIPv6Addr(data, "icmpv6", laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	binary.BigEndian.PutUint16(data[2:], csum)
+
+	return data, nil
+}
+
+// icmpv6MessageLen returns the size of the message, before any options or data,
+// for the type of message.
+func icmpv6MessageLen(typ uint8) int {
+	switch typ {
+	case ICMPv6TypeRouterAdvertisement:
+		return icmpv6RouterAdvertisementLen
+	case ICMPv6TypeNeighborSolicitation, ICMPv6TypeNeighborAdvertisement:
+		return icmpv6NeighborMessageLen
+	case ICMPv6TypeRedirect:
+		return icmpv6RedirectLen
+	default:
+		return icmpHeaderLen
+	}
+}
+
+// isNDPMessage returns whether the type of message is one of the Neighbor
+// Discovery messages, which carry options instead of data.
+func isNDPMessage(typ uint8) bool {
+	return typ >= ICMPv6TypeRouterSolicitation && typ <= ICMPv6TypeRedirect
+}
+
+func unmarshalICMPv6Message(data []byte) (*ICMPv6Message, error) {
+	if len(data) < icmpHeaderLen {
+		err := packetserr.ICMPMessageTruncated{ExpectedSize: icmpHeaderLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeICMPv6, icmpFields, len(data), err)
+	}
+
+	icmp := &ICMPv6Message{
+		Type:     data[0],
+		Code:     data[1],
+		Checksum: binary.BigEndian.Uint16(data[2:4]),
+	}
+
+	msgLen := icmpv6MessageLen(icmp.Type)
+
+	if len(data) < msgLen {
+		err := packetserr.ICMPMessageTruncated{ExpectedSize: msgLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeICMPv6, icmpFields, len(data), err)
+	}
+
+	body := data[4:msgLen]
+
+	switch icmp.Type {
+	case ICMPv6TypeDestinationUnreachable, ICMPv6TypeTimeExceeded:
+		// the rest of the header is unused
+	case ICMPv6TypePacketTooBig:
+		icmp.MTU = binary.BigEndian.Uint32(body)
+	case ICMPv6TypeParameterProblem:
+		icmp.Pointer = binary.BigEndian.Uint32(body)
+	case ICMPv6TypeEchoRequest, ICMPv6TypeEchoReply:
+		icmp.Identifier = binary.BigEndian.Uint16(body[0:2])
+		icmp.SequenceNumber = binary.BigEndian.Uint16(body[2:4])
+	case ICMPv6TypeRouterSolicitation:
+		// the rest of the header is reserved
+	case ICMPv6TypeRouterAdvertisement:
+		icmp.CurHopLimit = body[0]
+		icmp.Managed = body[1]&icmpv6ManagedBit != 0
+		icmp.OtherConfig = body[1]&icmpv6OtherConfigBit != 0
+		icmp.RouterLifetime = binary.BigEndian.Uint16(body[2:4])
+		icmp.ReachableTime = binary.BigEndian.Uint32(body[4:8])
+		icmp.RetransTimer = binary.BigEndian.Uint32(body[8:12])
+	case ICMPv6TypeNeighborSolicitation, ICMPv6TypeNeighborAdvertisement:
+		if icmp.Type == ICMPv6TypeNeighborAdvertisement {
+			icmp.Router = body[0]&icmpv6RouterBit != 0
+			icmp.Solicited = body[0]&icmpv6SolicitedBit != 0
+			icmp.Override = body[0]&icmpv6OverrideBit != 0
+		}
+
+		icmp.TargetAddress = netip.AddrFrom16([16]byte(body[4:20]))
+	case ICMPv6TypeRedirect:
+		icmp.TargetAddress = netip.AddrFrom16([16]byte(body[4:20]))
+		icmp.DestinationAddress = netip.AddrFrom16([16]byte(body[20:36]))
+	default:
+		icmp.RestOfHeader = binary.BigEndian.Uint32(body)
+	}
+
+	if !isNDPMessage(icmp.Type) {
+		icmp.Data = copyBytes(data[msgLen:])
+		return icmp, nil
+	}
+
+	opts, err := UnmarshalNDPOptionSlice(data[msgLen:])
+	if err != nil {
+		return nil, shiftDecodeError(err, msgLen)
+	}
+
+	icmp.Options = opts
+
+	return icmp, nil
+}
+
+func (icmp *ICMPv6Message) marshalICMPv6Message() ([]byte, error) {
+	msgLen := icmpv6MessageLen(icmp.Type)
+
+	data := make([]byte, msgLen, msgLen+len(icmp.Data))
+
+	data[0] = icmp.Type
+	data[1] = icmp.Code
+	binary.BigEndian.PutUint16(data[2:], icmp.Checksum)
+
+	body := data[4:msgLen]
+
+	switch icmp.Type {
+	case ICMPv6TypeDestinationUnreachable, ICMPv6TypeTimeExceeded:
+		// the rest of the header is unused
+	case ICMPv6TypePacketTooBig:
+		binary.BigEndian.PutUint32(body, icmp.MTU)
+	case ICMPv6TypeParameterProblem:
+		binary.BigEndian.PutUint32(body, icmp.Pointer)
+	case ICMPv6TypeEchoRequest, ICMPv6TypeEchoReply:
+		binary.BigEndian.PutUint16(body[0:], icmp.Identifier)
+		binary.BigEndian.PutUint16(body[2:], icmp.SequenceNumber)
+	case ICMPv6TypeRouterSolicitation:
+		// the rest of the header is reserved
+	case ICMPv6TypeRouterAdvertisement:
+		body[0] = icmp.CurHopLimit
+		body[1] = ctrlBitSet(icmp.Managed, icmpv6ManagedBit) | ctrlBitSet(icmp.OtherConfig, icmpv6OtherConfigBit)
+		binary.BigEndian.PutUint16(body[2:], icmp.RouterLifetime)
+		binary.BigEndian.PutUint32(body[4:], icmp.ReachableTime)
+		binary.BigEndian.PutUint32(body[8:], icmp.RetransTimer)
+	case ICMPv6TypeNeighborSolicitation, ICMPv6TypeNeighborAdvertisement:
+		if icmp.Type == ICMPv6TypeNeighborAdvertisement {
+			body[0] = ctrlBitSet(icmp.Router, icmpv6RouterBit) |
+				ctrlBitSet(icmp.Solicited, icmpv6SolicitedBit) |
+				ctrlBitSet(icmp.Override, icmpv6OverrideBit)
+		}
+
+		target, ok := ipv6AddrAs16(icmp.TargetAddress)
+		if !ok {
+			return nil, packetserr.IPv6AddressInvalid{Address: icmp.TargetAddress.String()}
+		}
+
+		copy(body[4:], target[:])
+	case ICMPv6TypeRedirect:
+		target, ok := ipv6AddrAs16(icmp.TargetAddress)
+		if !ok {
+			return nil, packetserr.IPv6AddressInvalid{Address: icmp.TargetAddress.String()}
+		}
+
+		dst, ok := ipv6AddrAs16(icmp.DestinationAddress)
+		if !ok {
+			return nil, packetserr.IPv6AddressInvalid{Address: icmp.DestinationAddress.String()}
+		}
+
+		copy(body[4:], target[:])
+		copy(body[20:], dst[:])
+	default:
+		binary.BigEndian.PutUint32(body, icmp.RestOfHeader)
+	}
+
+	if !isNDPMessage(icmp.Type) {
+		return append(data, icmp.Data...), nil
+	}
+
+	return icmp.Options.appendNDPOptions(data)
+}
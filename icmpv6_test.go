@@ -0,0 +1,336 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+// icmpv6RouterAdvertisementFrame is the Ethernet frame of the captured packet:
+//
+//	23:34:40.014307 IP6 fe80::c000:54ff:fef5:0 > ip6-allnodes: ICMP6, router advertisement, length 64
+var icmpv6RouterAdvertisementFrame = []byte{
+	0x33, 0x33, 0x00, 0x00, 0x00, 0x01, 0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00, 0x86, 0xdd, 0x6e, 0x00,
+	0x00, 0x00, 0x00, 0x40, 0x3a, 0xff, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00,
+	0x54, 0xff, 0xfe, 0xf5, 0x00, 0x00, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x86, 0x00, 0xc4, 0xfe, 0x40, 0x00, 0x07, 0x08, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00, 0x05, 0x01,
+	0x00, 0x00, 0x00, 0x00, 0x05, 0xdc, 0x03, 0x04, 0x40, 0xc0, 0x00, 0x27, 0x8d, 0x00, 0x00, 0x09,
+	0x3a, 0x80, 0x00, 0x00, 0x00, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// icmpv6NeighborAdvertisement is the ICMPv6 message of the captured packet:
+//
+//	10:48:30.088384 IP6 2620:0:1005:0:26be:5ff:fe27:b17 > fe80::21f:caff:feb3:7640: ICMP6, neighbor advertisement, tgt is 2620:0:1005:0:26be:5ff:fe27:b17, length 24
+var icmpv6NeighborAdvertisement = []byte{
+	0x88, 0x00, 0x1e, 0xd6, 0x40, 0x00, 0x00, 0x00, 0x26, 0x20, 0x00, 0x00, 0x10, 0x05, 0x00, 0x00,
+	0x26, 0xbe, 0x05, 0xff, 0xfe, 0x27, 0x0b, 0x17,
+}
+
+func (t *TestSuite) TestUnmarshalICMPv6Message(c *C) {
+	//
+	// TEST ROUTER ADVERTISEMENT
+	//
+	data := icmpv6RouterAdvertisementFrame[54:]
+
+	icmp, err := packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+
+	c.Check(icmp.Type, Equals, packets.ICMPv6TypeRouterAdvertisement)
+	c.Check(icmp.Code, Equals, uint8(0))
+	c.Check(icmp.Checksum, Equals, uint16(0xc4fe))
+	c.Check(icmp.CurHopLimit, Equals, uint8(64))
+	c.Check(icmp.Managed, Equals, false)
+	c.Check(icmp.OtherConfig, Equals, false)
+	c.Check(icmp.RouterLifetime, Equals, uint16(1800))
+	c.Check(icmp.ReachableTime, Equals, uint32(0))
+	c.Check(icmp.RetransTimer, Equals, uint32(0))
+	c.Check(icmp.Data, IsNil)
+	c.Assert(len(icmp.Options), Equals, 3)
+
+	addr, ok := icmp.Options.SourceLinkLayerAddress()
+	c.Check(ok, Equals, true)
+	c.Check(addr, DeepEquals, net.HardwareAddr{0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00})
+
+	mtu, ok := icmp.Options.MTU()
+	c.Check(ok, Equals, true)
+	c.Check(mtu, Equals, uint32(1500))
+
+	infos, ok := icmp.Options.PrefixInformation()
+	c.Check(ok, Equals, true)
+	c.Check(infos, DeepEquals, []packets.PrefixInformation{{
+		Prefix:            netip.MustParsePrefix("2001:db8:0:1::/64"),
+		OnLink:            true,
+		Autonomous:        true,
+		ValidLifetime:     2592000,
+		PreferredLifetime: 604800,
+	}})
+
+	// remarshaling results in the same data, including the checksum
+	icmp.Checksum = 0
+
+	marshaled, err := icmp.MarshalWithChecksum("fe80::c000:54ff:fef5:0", "ff02::1")
+	c.Assert(err, IsNil)
+	c.Check(marshaled, DeepEquals, data)
+	c.Check(icmp.Checksum, Equals, uint16(0))
+
+	//
+	// TEST NEIGHBOR ADVERTISEMENT
+	//
+	icmp, err = packets.UnmarshalICMPv6Message(icmpv6NeighborAdvertisement)
+	c.Assert(err, IsNil)
+
+	c.Check(icmp.Type, Equals, packets.ICMPv6TypeNeighborAdvertisement)
+	c.Check(icmp.Router, Equals, false)
+	c.Check(icmp.Solicited, Equals, true)
+	c.Check(icmp.Override, Equals, false)
+	c.Check(icmp.TargetAddress, Equals, netip.MustParseAddr("2620:0:1005:0:26be:5ff:fe27:b17"))
+	c.Check(len(icmp.Options), Equals, 0)
+
+	marshaled, err = icmp.MarshalWithChecksumAddr(
+		netip.MustParseAddr("2620:0:1005:0:26be:5ff:fe27:b17"),
+		netip.MustParseAddr("fe80::21f:caff:feb3:7640"),
+	)
+	c.Assert(err, IsNil)
+	c.Check(marshaled, DeepEquals, icmpv6NeighborAdvertisement)
+
+	//
+	// TEST packetserr.ICMPMessageTruncated
+	//
+	icmp, err = packets.UnmarshalICMPv6Message(data[:7])
+	c.Assert(err, Not(IsNil))
+	c.Check(icmp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "RestOfHeader",
+		Offset: 4,
+		Err:    packetserr.ICMPMessageTruncated{ExpectedSize: 8, Len: 7},
+	})
+
+	icmp, err = packets.UnmarshalICMPv6Message(icmpv6NeighborAdvertisement[:20])
+	c.Assert(err, Not(IsNil))
+	c.Check(icmp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "RestOfHeader",
+		Offset: 4,
+		Err:    packetserr.ICMPMessageTruncated{ExpectedSize: 24, Len: 20},
+	})
+
+	//
+	// TEST MALFORMED OPTIONS
+	//
+	icmp, err = packets.UnmarshalICMPv6Message(data[:len(data)-4])
+	c.Assert(err, Not(IsNil))
+	c.Check(icmp, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "Options",
+		Offset: 32,
+		Err:    packetserr.NDPOptionTruncated{Offset: 16},
+	})
+}
+
+func (t *TestSuite) TestICMPv6Message_Marshal(c *C) {
+	//
+	// TEST ECHO REQUEST
+	//
+	icmp := &packets.ICMPv6Message{
+		Type:           packets.ICMPv6TypeEchoRequest,
+		Identifier:     0x1234,
+		SequenceNumber: 1,
+		Data:           []byte("ping"),
+	}
+
+	data, err := icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{128, 0, 0, 0, 0x12, 0x34, 0x00, 0x01, 'p', 'i', 'n', 'g'})
+
+	// the Checksum field is marshaled as-is
+	icmp.Checksum = 0xbeef
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[2:4], DeepEquals, []byte{0xbe, 0xef})
+
+	// the Checksum field is ignored when calculating the checksum
+	data, err = icmp.MarshalWithChecksum("fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Check(icmp.Checksum, Equals, uint16(0xbeef))
+
+	// the checksum of data including a valid checksum is zero
+	csum, err := packets.ChecksumIPv6(data, "icmpv6", "fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, uint16(0))
+
+	decoded, err := packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Identifier, Equals, uint16(0x1234))
+	c.Check(decoded.SequenceNumber, Equals, uint16(1))
+	c.Check(string(decoded.Data), Equals, "ping")
+
+	data, err = icmp.MarshalWithChecksum("fe80::1", "127.0.0.1")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "127.0.0.1"})
+
+	//
+	// TEST PACKET TOO BIG
+	//
+	icmp = &packets.ICMPv6Message{
+		Type: packets.ICMPv6TypePacketTooBig,
+		MTU:  1280,
+		Data: []byte{0x60, 0, 0, 0},
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{2, 0, 0, 0, 0, 0, 0x05, 0x00, 0x60, 0, 0, 0})
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.MTU, Equals, uint32(1280))
+	c.Check(decoded.Data, DeepEquals, []byte{0x60, 0, 0, 0})
+
+	//
+	// TEST PARAMETER PROBLEM
+	//
+	icmp = &packets.ICMPv6Message{
+		Type:    packets.ICMPv6TypeParameterProblem,
+		Pointer: 40,
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{4, 0, 0, 0, 0, 0, 0, 40})
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Pointer, Equals, uint32(40))
+
+	//
+	// TEST ROUTER ADVERTISEMENT FLAGS
+	//
+	icmp = &packets.ICMPv6Message{
+		Type:        packets.ICMPv6TypeRouterAdvertisement,
+		CurHopLimit: 64,
+		Managed:     true,
+		OtherConfig: true,
+		Options:     packets.NDPOptionSlice{packets.NewMTUOption(9000)},
+		Data:        []byte{1, 2, 3}, // ignored, as it's a Neighbor Discovery message
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 24)
+	c.Check(data[4:6], DeepEquals, []byte{64, 0xc0})
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Managed, Equals, true)
+	c.Check(decoded.OtherConfig, Equals, true)
+	c.Check(decoded.Data, IsNil)
+
+	mtu, ok := decoded.Options.MTU()
+	c.Check(ok, Equals, true)
+	c.Check(mtu, Equals, uint32(9000))
+
+	//
+	// TEST NEIGHBOR SOLICITATION
+	//
+	mac := net.HardwareAddr{0x00, 0x0c, 0x29, 0x0e, 0x4c, 0x67}
+
+	lladdr, err := packets.NewSourceLinkLayerAddressOption(mac)
+	c.Assert(err, IsNil)
+
+	icmp = &packets.ICMPv6Message{
+		Type:          packets.ICMPv6TypeNeighborSolicitation,
+		TargetAddress: netip.MustParseAddr("fe80::20c:29ff:fe0e:4c67"),
+		Options:       packets.NDPOptionSlice{lladdr},
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 32)
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.TargetAddress, Equals, icmp.TargetAddress)
+
+	addr, ok := decoded.Options.SourceLinkLayerAddress()
+	c.Check(ok, Equals, true)
+	c.Check(addr, DeepEquals, mac)
+
+	icmp.TargetAddress = netip.MustParseAddr("10.0.0.1")
+
+	data, err = icmp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "10.0.0.1"})
+
+	//
+	// TEST NEIGHBOR ADVERTISEMENT FLAGS
+	//
+	icmp = &packets.ICMPv6Message{
+		Type:          packets.ICMPv6TypeNeighborAdvertisement,
+		Router:        true,
+		Override:      true,
+		TargetAddress: netip.MustParseAddr("fe80::1"),
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[4], Equals, uint8(0xa0))
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Router, Equals, true)
+	c.Check(decoded.Solicited, Equals, false)
+	c.Check(decoded.Override, Equals, true)
+
+	//
+	// TEST REDIRECT
+	//
+	icmp = &packets.ICMPv6Message{
+		Type:               packets.ICMPv6TypeRedirect,
+		TargetAddress:      netip.MustParseAddr("fe80::1"),
+		DestinationAddress: netip.MustParseAddr("2001:db8::1"),
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 40)
+
+	decoded, err = packets.UnmarshalICMPv6Message(data)
+	c.Assert(err, IsNil)
+	c.Check(decoded.TargetAddress, Equals, icmp.TargetAddress)
+	c.Check(decoded.DestinationAddress, Equals, icmp.DestinationAddress)
+
+	icmp.DestinationAddress = netip.Addr{}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "invalid IP"})
+
+	//
+	// TEST MALFORMED OPTIONS
+	//
+	icmp = &packets.ICMPv6Message{
+		Type:    packets.ICMPv6TypeRouterSolicitation,
+		Options: packets.NDPOptionSlice{{Type: packets.NDPOptionTypeMTU, Data: []byte{1}}},
+	}
+
+	data, err = icmp.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.NDPOptionDataInvalid{Index: 0})
+}
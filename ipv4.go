@@ -0,0 +1,264 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the flag bits of the IPv4 header, as they sit within the
+// 16-bit Flags and Fragment Offset field.
+const (
+	ipv4ReservedBit uint16 = 0x8000 // Reserved (evil bit)
+	ipv4DFBit       uint16 = 0x4000 // DF
+	ipv4MFBit       uint16 = 0x2000 // MF
+
+	ipv4HeaderMinSize int = 20
+	ipv4OptsMaxSize   int = 40
+
+	ipv4MaxDSCP           uint8  = 63
+	ipv4MaxECN            uint8  = 3
+	ipv4MaxFragmentOffset uint16 = 8191
+)
+
+// IPv4Header is a struct representing an IPv4 header and the payload it carries.
+// It's primarily meant for use with raw IP sockets that have IP_HDRINCL set, where
+// the IP header must be provided along with the TCP or UDP data.
+//
+// Much like the TCPHeader, the flags are represented as boolean fields instead of
+// forcing users of this package to do their own bitshifting. The Options field is
+// the raw bytes of the IPv4 options, and is padded with zeros to the nearest 32-bit
+// boundary at the time of marshaling.
+type IPv4Header struct {
+	Version            uint8  // if set to 0 this becomes 4
+	IHL                uint8  // should be either 0 or >= 5 and <= 15; if 0 will be auto-set
+	DSCP               uint8  // must be no more than 63
+	ECN                uint8  // must be no more than 3
+	TotalLength        uint16 // if set to 0 it will be automatically set
+	ID                 uint16
+	Reserved           bool // this should always be false
+	DF                 bool
+	MF                 bool
+	FragmentOffset     uint16 // in units of 8 bytes; must be no more than 8191
+	TTL                uint8
+	Protocol           uint8
+	Checksum           uint16 // if set to 0 it will be calculated at the time of marshaling
+	SourceAddress      netip.Addr
+	DestinationAddress netip.Addr
+	Options            []byte // optional raw IPv4 options; must be no more than 40 bytes
+	Payload            []byte
+}
+
+// UnmarshalIPv4Header is a function that takes a byte slice and parses it in to an
+// instance of *IPv4Header. The Payload is the data following the header, up to the
+// length specified in the TotalLength field.
+//
+// The error is a packetserr.DecodeError, wrapping packetserr.IPv4IHLInvalid or
+// packetserr.IPv4TotalLengthInvalid if the header contains values that can't be
+// correct, or the packetserr.IPv4PacketTruncated type if there is less data than
+// the header or the TotalLength field specifies.
+func UnmarshalIPv4Header(data []byte) (*IPv4Header, error) {
+	return unmarshalIPv4Header(data)
+}
+
+// Marshal is a function to marshal the *IPv4Header instance to a byte slice,
+// including the payload. If the IHL, TotalLength, or Checksum fields are zero they
+// are calculated from the data being marshaled; the *IPv4Header instance is not
+// modified.
+//
+// The error field may be of packetserr.IPv4IHLInvalid, packetserr.IPv4IHLTooSmall,
+// packetserr.IPv4OptionsOverflow, packetserr.IPv4PayloadTooLarge,
+// packetserr.IPv4FieldTooLarge, or packetserr.IPv4AddressInvalid types. See
+// their documentation for more information.
+func (ip *IPv4Header) Marshal() ([]byte, error) {
+	return ip.marshalIPv4Header()
+}
+
+func (ip *IPv4Header) marshalIPv4Header() ([]byte, error) {
+	if len(ip.Options) > ipv4OptsMaxSize {
+		return nil, packetserr.IPv4OptionsOverflow{MaxSize: ipv4OptsMaxSize}
+	}
+
+	switch {
+	case ip.DSCP > ipv4MaxDSCP:
+		return nil, packetserr.IPv4FieldTooLarge{Field: "DSCP", MaxValue: int(ipv4MaxDSCP)}
+	case ip.ECN > ipv4MaxECN:
+		return nil, packetserr.IPv4FieldTooLarge{Field: "ECN", MaxValue: int(ipv4MaxECN)}
+	case ip.FragmentOffset > ipv4MaxFragmentOffset:
+		return nil, packetserr.IPv4FieldTooLarge{Field: "FragmentOffset", MaxValue: int(ipv4MaxFragmentOffset)}
+	case ip.Version > 15:
+		return nil, packetserr.IPv4FieldTooLarge{Field: "Version", MaxValue: 15}
+	}
+
+	src, ok := ipv4AddrAs4(ip.SourceAddress)
+	if !ok {
+		return nil, packetserr.IPv4AddressInvalid{Address: ip.SourceAddress.String()}
+	}
+
+	dst, ok := ipv4AddrAs4(ip.DestinationAddress)
+	if !ok {
+		return nil, packetserr.IPv4AddressInvalid{Address: ip.DestinationAddress.String()}
+	}
+
+	// determine how large the IHL field should be by dividing the length
+	// of the whole header by 4 (4 bytes [32-bits]), rounding up
+	ihlSize := uint8((ipv4HeaderMinSize + len(ip.Options) + 3) / 4)
+
+	ihl := ip.IHL
+
+	if ihl == 0 {
+		ihl = ihlSize
+	}
+
+	if ihl > 15 || ihl < 5 {
+		return nil, packetserr.IPv4IHLInvalid
+	}
+
+	if ihl < ihlSize {
+		return nil, packetserr.IPv4IHLTooSmall{ExpectedSize: ihlSize}
+	}
+
+	headerLen := int(ihl) * 4
+	packetSize := headerLen + len(ip.Payload)
+
+	if packetSize > maxUint16 {
+		return nil, packetserr.IPv4PayloadTooLarge{
+			MaxSize: maxUint16 - headerLen,
+			Len:     len(ip.Payload),
+		}
+	}
+
+	totalLength := ip.TotalLength
+
+	if totalLength == 0 {
+		totalLength = uint16(packetSize)
+	}
+
+	version := ip.Version
+
+	if version == 0 {
+		version = 4
+	}
+
+	flagsFrag := ctrlBitSet(ip.Reserved, ipv4ReservedBit) |
+		ctrlBitSet(ip.DF, ipv4DFBit) |
+		ctrlBitSet(ip.MF, ipv4MFBit) |
+		ip.FragmentOffset
+
+	// the header is padded with null bytes (End of Options List) to the
+	// boundary specified by the IHL, which the slice is already zeroed to
+	data := make([]byte, headerLen, packetSize)
+
+	data[0] = version<<4 | ihl
+	data[1] = ip.DSCP<<2 | ip.ECN
+	binary.BigEndian.PutUint16(data[2:], totalLength)
+	binary.BigEndian.PutUint16(data[4:], ip.ID)
+	binary.BigEndian.PutUint16(data[6:], flagsFrag)
+	data[8] = ip.TTL
+	data[9] = ip.Protocol
+	binary.BigEndian.PutUint16(data[10:], ip.Checksum)
+	copy(data[12:16], src[:])
+	copy(data[16:20], dst[:])
+	copy(data[ipv4HeaderMinSize:], ip.Options)
+
+	// the header checksum only covers the header itself, so it can be
+	// calculated before the payload is added
+	if ip.Checksum == 0 {
+		binary.BigEndian.PutUint16(data[10:], InternetChecksum(data))
+	}
+
+	return append(data, ip.Payload...), nil
+}
+
+func unmarshalIPv4Header(data []byte) (*IPv4Header, error) {
+	return decodeIPv4Header(data, false)
+}
+
+// ipv4Fields are the fields of the IPv4 header, for describing where decoding
+// failed.
+var ipv4Fields = []headerField{
+	{0, "Version"}, {1, "DSCP"}, {2, "TotalLength"}, {4, "ID"}, {6, "FragmentOffset"},
+	{8, "TTL"}, {9, "Protocol"}, {10, "Checksum"}, {12, "SourceAddress"},
+	{16, "DestinationAddress"}, {20, "Options"},
+}
+
+// decodeIPv4Header parses the header, and the payload up to the TotalLength. If
+// partial is true the payload may be shorter than the TotalLength, as it is when
+// the packet is quoted by an ICMP error message.
+func decodeIPv4Header(data []byte, partial bool) (*IPv4Header, error) {
+	if len(data) < ipv4HeaderMinSize {
+		err := packetserr.IPv4PacketTruncated{ExpectedSize: ipv4HeaderMinSize, Len: len(data)}
+		return nil, truncatedError(LayerTypeIPv4, ipv4Fields, len(data), err)
+	}
+
+	flagsFrag := binary.BigEndian.Uint16(data[6:8])
+
+	header := &IPv4Header{
+		Version:            data[0] >> 4,
+		IHL:                data[0] & 0x0f,
+		DSCP:               data[1] >> 2,
+		ECN:                data[1] & 3,
+		TotalLength:        binary.BigEndian.Uint16(data[2:4]),
+		ID:                 binary.BigEndian.Uint16(data[4:6]),
+		Reserved:           flagsFrag&ipv4ReservedBit != 0,
+		DF:                 flagsFrag&ipv4DFBit != 0,
+		MF:                 flagsFrag&ipv4MFBit != 0,
+		FragmentOffset:     flagsFrag & ipv4MaxFragmentOffset,
+		TTL:                data[8],
+		Protocol:           data[9],
+		Checksum:           binary.BigEndian.Uint16(data[10:12]),
+		SourceAddress:      netip.AddrFrom4([4]byte(data[12:16])),
+		DestinationAddress: netip.AddrFrom4([4]byte(data[16:20])),
+	}
+
+	if header.IHL < 5 {
+		return nil, decodeError(LayerTypeIPv4, "IHL", 0, packetserr.IPv4IHLInvalid)
+	}
+
+	headerLen := int(header.IHL) * 4
+
+	if int(header.TotalLength) < headerLen {
+		return nil, decodeError(LayerTypeIPv4, "TotalLength", 2, packetserr.IPv4TotalLengthInvalid)
+	}
+
+	if len(data) < headerLen {
+		err := packetserr.IPv4PacketTruncated{ExpectedSize: headerLen, Len: len(data)}
+		return nil, decodeError(LayerTypeIPv4, "Options", ipv4HeaderMinSize, err)
+	}
+
+	if headerLen > ipv4HeaderMinSize {
+		header.Options = copyBytes(data[ipv4HeaderMinSize:headerLen])
+	}
+
+	end := int(header.TotalLength)
+
+	if len(data) < end {
+		if !partial {
+			err := packetserr.IPv4PacketTruncated{ExpectedSize: end, Len: len(data)}
+			return nil, decodeError(LayerTypeIPv4, "Payload", headerLen, err)
+		}
+
+		end = len(data)
+	}
+
+	header.Payload = copyBytes(data[headerLen:end])
+
+	return header, nil
+}
+
+// ipv4AddrAs4 returns the four bytes of an IPv4 address. IPv4-mapped IPv6
+// addresses are accepted, any other addresses are not.
+func ipv4AddrAs4(addr netip.Addr) ([4]byte, bool) {
+	addr = addr.Unmap()
+
+	if !addr.Is4() {
+		return [4]byte{}, false
+	}
+
+	return addr.As4(), true
+}
@@ -0,0 +1,307 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestIPv4Header_Marshal(c *C) {
+	var data []byte
+	var err error
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 24)
+
+	var u16 uint16
+	var u8 uint8
+
+	r := bytes.NewReader(data)
+
+	// Version and IHL
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8>>4, Equals, uint8(4))
+	c.Check(u8&0x0f, Equals, uint8(5))
+	// DSCP and ECN
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8, Equals, uint8(0))
+	// TotalLength
+	c.Assert(binary.Read(r, Te, &u16), IsNil)
+	c.Check(u16, Equals, uint16(24))
+	// ID
+	c.Assert(binary.Read(r, Te, &u16), IsNil)
+	c.Check(u16, Equals, uint16(4242))
+	// Flags and FragmentOffset
+	c.Assert(binary.Read(r, Te, &u16), IsNil)
+	c.Check(u16>>15&1, Equals, uint16(0)) // Reserved
+	c.Check(u16>>14&1, Equals, uint16(1)) // DF
+	c.Check(u16>>13&1, Equals, uint16(0)) // MF
+	c.Check(u16&0x1fff, Equals, uint16(0))
+	// TTL
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8, Equals, uint8(64))
+	// Protocol
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8, Equals, uint8(17))
+	// Checksum
+	c.Assert(binary.Read(r, Te, &u16), IsNil)
+	c.Check(u16, Not(Equals), uint16(0))
+
+	// Addresses
+	c.Check(data[12:16], DeepEquals, []byte{127, 0, 0, 1})
+	c.Check(data[16:20], DeepEquals, []byte{127, 0, 0, 2})
+
+	// Payload
+	c.Check(data[20:], DeepEquals, []byte{42, 128, 0, 0})
+
+	// the auto-calculated fields should not be written back
+	c.Check(t.ip4.IHL, Equals, uint8(0))
+	c.Check(t.ip4.TotalLength, Equals, uint16(0))
+	c.Check(t.ip4.Checksum, Equals, uint16(0))
+
+	//
+	// TEST OPTIONS ARE PADDED AND IHL IS SET
+	//
+	t.SetUpTest(c)
+
+	t.ip4.Options = []byte{7, 3, 4}
+	t.ip4.Checksum = 42
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 28)
+
+	c.Check(data[0]&0x0f, Equals, uint8(6))
+	c.Check(Te.Uint16(data[2:4]), Equals, uint16(28))
+	c.Check(Te.Uint16(data[10:12]), Equals, uint16(42))
+	c.Check(data[20:24], DeepEquals, []byte{7, 3, 4, 0})
+
+	//
+	// TEST packetserr.IPv4IHLTooSmall
+	//
+	t.ip4.IHL = 5
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+
+	switch err.(type) {
+	case packetserr.IPv4IHLTooSmall:
+		c.Check(err.(packetserr.IPv4IHLTooSmall).ExpectedSize, Equals, uint8(6))
+	default:
+		c.Fatalf("error type should be packetserr.IPv4IHLTooSmall was %s", reflect.TypeOf(err).String())
+	}
+
+	//
+	// TEST packetserr.IPv4IHLInvalid
+	//
+	t.ip4.IHL = 16
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4IHLInvalid)
+
+	//
+	// TEST packetserr.IPv4OptionsOverflow
+	//
+	t.SetUpTest(c)
+
+	t.ip4.Options = make([]byte, 41)
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+
+	switch err.(type) {
+	case packetserr.IPv4OptionsOverflow:
+		c.Check(err.(packetserr.IPv4OptionsOverflow).MaxSize, Equals, 40)
+	default:
+		c.Fatalf("error type should be packetserr.IPv4OptionsOverflow was %s", reflect.TypeOf(err).String())
+	}
+
+	//
+	// TEST packetserr.IPv4PayloadTooLarge
+	//
+	t.SetUpTest(c)
+
+	t.ip4.Payload = make([]byte, 65516)
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+
+	switch err.(type) {
+	case packetserr.IPv4PayloadTooLarge:
+		e := err.(packetserr.IPv4PayloadTooLarge)
+		c.Check(e.MaxSize, Equals, 65515)
+		c.Check(e.Len, Equals, 65516)
+	default:
+		c.Fatalf("error type should be packetserr.IPv4PayloadTooLarge was %s", reflect.TypeOf(err).String())
+	}
+
+	//
+	// TEST packetserr.IPv4FieldTooLarge
+	//
+	t.SetUpTest(c)
+
+	t.ip4.DSCP = 64
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4FieldTooLarge{Field: "DSCP", MaxValue: 63})
+
+	//
+	// TEST packetserr.IPv4AddressInvalid
+	//
+	t.SetUpTest(c)
+
+	t.ip4.DestinationAddress = netip.MustParseAddr("::1")
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "::1"})
+}
+
+func (t *TestSuite) TestUnmarshalIPv4Header(c *C) {
+	var header *packets.IPv4Header
+	var err error
+
+	buf := new(bytes.Buffer)
+
+	// Version and IHL
+	binary.Write(buf, Te, uint8(4<<4|6))
+	// DSCP and ECN
+	binary.Write(buf, Te, uint8(46<<2|1))
+	// TotalLength
+	binary.Write(buf, Te, uint16(30))
+	// ID
+	binary.Write(buf, Te, uint16(4242))
+	// Flags and FragmentOffset
+	binary.Write(buf, Te, uint16(0x2000|185))
+	// TTL
+	binary.Write(buf, Te, uint8(64))
+	// Protocol
+	binary.Write(buf, Te, uint8(6))
+	// Checksum
+	binary.Write(buf, Te, uint16(42332))
+	// SourceAddress
+	binary.Write(buf, Te, []byte{10, 0, 0, 1})
+	// DestinationAddress
+	binary.Write(buf, Te, []byte{10, 0, 0, 2})
+	// Options
+	binary.Write(buf, Te, []byte{1, 1, 1, 0})
+	// Payload
+	binary.Write(buf, Te, []byte{42, 128, 0, 0, 1, 2})
+	// trailing data not covered by TotalLength
+	binary.Write(buf, Te, []byte{0, 0})
+
+	header, err = packets.UnmarshalIPv4Header(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(header, Not(IsNil))
+
+	c.Check(header.Version, Equals, uint8(4))
+	c.Check(header.IHL, Equals, uint8(6))
+	c.Check(header.DSCP, Equals, uint8(46))
+	c.Check(header.ECN, Equals, uint8(1))
+	c.Check(header.TotalLength, Equals, uint16(30))
+	c.Check(header.ID, Equals, uint16(4242))
+	c.Check(header.Reserved, Equals, false)
+	c.Check(header.DF, Equals, false)
+	c.Check(header.MF, Equals, true)
+	c.Check(header.FragmentOffset, Equals, uint16(185))
+	c.Check(header.TTL, Equals, uint8(64))
+	c.Check(header.Protocol, Equals, uint8(6))
+	c.Check(header.Checksum, Equals, uint16(42332))
+	c.Check(header.SourceAddress, Equals, netip.MustParseAddr("10.0.0.1"))
+	c.Check(header.DestinationAddress, Equals, netip.MustParseAddr("10.0.0.2"))
+	c.Check(header.Options, DeepEquals, []byte{1, 1, 1, 0})
+	c.Check(header.Payload, DeepEquals, []byte{42, 128, 0, 0, 1, 2})
+
+	//
+	// TEST ROUND TRIP THROUGH Marshal
+	//
+	data, err := t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	header, err = packets.UnmarshalIPv4Header(data)
+	c.Assert(err, IsNil)
+
+	c.Check(header.IHL, Equals, uint8(5))
+	c.Check(header.TotalLength, Equals, uint16(24))
+	c.Check(header.DF, Equals, true)
+	c.Check(header.SourceAddress, Equals, t.ip4.SourceAddress)
+	c.Check(header.DestinationAddress, Equals, t.ip4.DestinationAddress)
+	c.Check(header.Payload, DeepEquals, t.ip4.Payload)
+
+	//
+	// TEST packetserr.IPv4PacketTruncated
+	//
+	header, err = packets.UnmarshalIPv4Header(buf.Bytes()[:10])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "Checksum",
+		Offset: 10,
+		Err:    packetserr.IPv4PacketTruncated{ExpectedSize: 20, Len: 10},
+	})
+
+	header, err = packets.UnmarshalIPv4Header(buf.Bytes()[:22])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "Options",
+		Offset: 20,
+		Err:    packetserr.IPv4PacketTruncated{ExpectedSize: 24, Len: 22},
+	})
+
+	header, err = packets.UnmarshalIPv4Header(buf.Bytes()[:28])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "Payload",
+		Offset: 24,
+		Err:    packetserr.IPv4PacketTruncated{ExpectedSize: 30, Len: 28},
+	})
+
+	//
+	// TEST packetserr.IPv4IHLInvalid
+	//
+	data[0] = 4<<4 | 4
+
+	header, err = packets.UnmarshalIPv4Header(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "IPv4", Field: "IHL", Offset: 0, Err: packetserr.IPv4IHLInvalid})
+
+	//
+	// TEST packetserr.IPv4TotalLengthInvalid
+	//
+	data[0] = 4<<4 | 5
+	Te.PutUint16(data[2:4], 19)
+
+	header, err = packets.UnmarshalIPv4Header(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "TotalLength",
+		Offset: 2,
+		Err:    packetserr.IPv4TotalLengthInvalid,
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+const (
+	ipv6HeaderLen int = 40
+
+	ipv6MaxFlowLabel uint32 = 0xfffff
+)
+
+// IPv6Header is a struct representing an IPv6 header and the payload it carries.
+// Extension headers, if any, are considered part of the payload with the NextHeader
+// field identifying the first of them.
+type IPv6Header struct {
+	Version            uint8 // if set to 0 this becomes 6
+	TrafficClass       uint8
+	FlowLabel          uint32 // must be no more than 0xfffff (20 bits)
+	PayloadLength      uint16 // if set to 0 it will be automatically set
+	NextHeader         uint8
+	HopLimit           uint8
+	SourceAddress      netip.Addr
+	DestinationAddress netip.Addr
+	Payload            []byte
+}
+
+// UnmarshalIPv6Header is a function that takes a byte slice and parses it in to an
+// instance of *IPv6Header. The Payload is the data following the header, up to the
+// length specified in the PayloadLength field.
+//
+// The error is a packetserr.DecodeError, wrapping the packetserr.IPv6PacketTruncated
+// type if there is less data than the header or the PayloadLength field specifies.
+func UnmarshalIPv6Header(data []byte) (*IPv6Header, error) {
+	return unmarshalIPv6Header(data)
+}
+
+// Marshal is a function to marshal the *IPv6Header instance to a byte slice,
+// including the payload. If the PayloadLength field is zero it's calculated from
+// the length of the Payload; the *IPv6Header instance is not modified.
+//
+// The error field may be of packetserr.IPv6PayloadTooLarge,
+// packetserr.IPv6FieldTooLarge, or packetserr.IPv6AddressInvalid types. See
+// their documentation for more information.
+func (ip *IPv6Header) Marshal() ([]byte, error) {
+	return ip.marshalIPv6Header()
+}
+
+func (ip *IPv6Header) marshalIPv6Header() ([]byte, error) {
+	switch {
+	case ip.FlowLabel > ipv6MaxFlowLabel:
+		return nil, packetserr.IPv6FieldTooLarge{Field: "FlowLabel", MaxValue: int(ipv6MaxFlowLabel)}
+	case ip.Version > 15:
+		return nil, packetserr.IPv6FieldTooLarge{Field: "Version", MaxValue: 15}
+	}
+
+	if len(ip.Payload) > maxUint16 {
+		return nil, packetserr.IPv6PayloadTooLarge{
+			MaxSize: maxUint16,
+			Len:     len(ip.Payload),
+		}
+	}
+
+	src, ok := ipv6AddrAs16(ip.SourceAddress)
+	if !ok {
+		return nil, packetserr.IPv6AddressInvalid{Address: ip.SourceAddress.String()}
+	}
+
+	dst, ok := ipv6AddrAs16(ip.DestinationAddress)
+	if !ok {
+		return nil, packetserr.IPv6AddressInvalid{Address: ip.DestinationAddress.String()}
+	}
+
+	payloadLength := ip.PayloadLength
+
+	if payloadLength == 0 {
+		payloadLength = uint16(len(ip.Payload))
+	}
+
+	version := ip.Version
+
+	if version == 0 {
+		version = 6
+	}
+
+	// build the Version, Traffic Class, and Flow Label data
+	vtf := uint32(version)<<28 |
+		uint32(ip.TrafficClass)<<20 |
+		ip.FlowLabel
+
+	data := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(ip.Payload))
+
+	binary.BigEndian.PutUint32(data[0:], vtf)
+	binary.BigEndian.PutUint16(data[4:], payloadLength)
+	data[6] = ip.NextHeader
+	data[7] = ip.HopLimit
+	copy(data[8:24], src[:])
+	copy(data[24:40], dst[:])
+
+	return append(data, ip.Payload...), nil
+}
+
+func unmarshalIPv6Header(data []byte) (*IPv6Header, error) {
+	return decodeIPv6Header(data, false)
+}
+
+// ipv6Fields are the fields of the IPv6 header, for describing where decoding
+// failed.
+var ipv6Fields = []headerField{
+	{0, "Version"}, {1, "TrafficClass"}, {2, "FlowLabel"}, {4, "PayloadLength"},
+	{6, "NextHeader"}, {7, "HopLimit"}, {8, "SourceAddress"}, {24, "DestinationAddress"},
+}
+
+// decodeIPv6Header parses the header, and the payload up to the PayloadLength. If
+// partial is true the payload may be shorter than the PayloadLength, as it is when
+// the packet is quoted by an ICMP error message.
+func decodeIPv6Header(data []byte, partial bool) (*IPv6Header, error) {
+	if len(data) < ipv6HeaderLen {
+		err := packetserr.IPv6PacketTruncated{ExpectedSize: ipv6HeaderLen, Len: len(data)}
+		return nil, truncatedError(LayerTypeIPv6, ipv6Fields, len(data), err)
+	}
+
+	vtf := binary.BigEndian.Uint32(data[0:4])
+
+	header := &IPv6Header{
+		Version:            uint8(vtf >> 28),
+		TrafficClass:       uint8(vtf >> 20),
+		FlowLabel:          vtf & ipv6MaxFlowLabel,
+		PayloadLength:      binary.BigEndian.Uint16(data[4:6]),
+		NextHeader:         data[6],
+		HopLimit:           data[7],
+		SourceAddress:      netip.AddrFrom16([16]byte(data[8:24])),
+		DestinationAddress: netip.AddrFrom16([16]byte(data[24:40])),
+	}
+
+	end := ipv6HeaderLen + int(header.PayloadLength)
+
+	if len(data) < end {
+		if !partial {
+			err := packetserr.IPv6PacketTruncated{ExpectedSize: end, Len: len(data)}
+			return nil, decodeError(LayerTypeIPv6, "Payload", ipv6HeaderLen, err)
+		}
+
+		end = len(data)
+	}
+
+	header.Payload = copyBytes(data[ipv6HeaderLen:end])
+
+	return header, nil
+}
+
+// ipv6AddrAs16 returns the sixteen bytes of an IPv6 address.
+func ipv6AddrAs16(addr netip.Addr) ([16]byte, bool) {
+	if !addr.Is6() {
+		return [16]byte{}, false
+	}
+
+	return addr.As16(), true
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestIPv6Header_Marshal(c *C) {
+	var data []byte
+	var err error
+
+	data, err = t.ip6.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 44)
+
+	var u32 uint32
+	var u16 uint16
+	var u8 uint8
+
+	r := bytes.NewReader(data)
+
+	// Version, TrafficClass, and FlowLabel
+	c.Assert(binary.Read(r, Te, &u32), IsNil)
+	c.Check(u32>>28, Equals, uint32(6))
+	c.Check(u32>>20&0xff, Equals, uint32(184))
+	c.Check(u32&0xfffff, Equals, uint32(0xbeef))
+	// PayloadLength
+	c.Assert(binary.Read(r, Te, &u16), IsNil)
+	c.Check(u16, Equals, uint16(4))
+	// NextHeader
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8, Equals, uint8(17))
+	// HopLimit
+	c.Assert(binary.Read(r, Te, &u8), IsNil)
+	c.Check(u8, Equals, uint8(64))
+
+	// Addresses
+	src := netip.MustParseAddr("fe80::1").As16()
+	dst := netip.MustParseAddr("fe80::2").As16()
+
+	c.Check(data[8:24], DeepEquals, src[:])
+	c.Check(data[24:40], DeepEquals, dst[:])
+
+	// Payload
+	c.Check(data[40:], DeepEquals, []byte{42, 128, 0, 0})
+
+	// the auto-calculated field should not be written back
+	c.Check(t.ip6.PayloadLength, Equals, uint16(0))
+
+	//
+	// TEST packetserr.IPv6FieldTooLarge
+	//
+	t.ip6.FlowLabel = 0x100000
+
+	data, err = t.ip6.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6FieldTooLarge{Field: "FlowLabel", MaxValue: 0xfffff})
+
+	//
+	// TEST packetserr.IPv6PayloadTooLarge
+	//
+	t.SetUpTest(c)
+
+	t.ip6.Payload = make([]byte, 65536)
+
+	data, err = t.ip6.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+
+	switch err.(type) {
+	case packetserr.IPv6PayloadTooLarge:
+		e := err.(packetserr.IPv6PayloadTooLarge)
+		c.Check(e.MaxSize, Equals, 65535)
+		c.Check(e.Len, Equals, 65536)
+	default:
+		c.Fatalf("error type should be packetserr.IPv6PayloadTooLarge was %s", reflect.TypeOf(err).String())
+	}
+
+	//
+	// TEST packetserr.IPv6AddressInvalid
+	//
+	t.SetUpTest(c)
+
+	t.ip6.SourceAddress = netip.MustParseAddr("127.0.0.1")
+
+	data, err = t.ip6.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "127.0.0.1"})
+}
+
+func (t *TestSuite) TestUnmarshalIPv6Header(c *C) {
+	var header *packets.IPv6Header
+	var err error
+
+	data, err := t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	// trailing data not covered by PayloadLength
+	data = append(data, 0, 0)
+
+	header, err = packets.UnmarshalIPv6Header(data)
+	c.Assert(err, IsNil)
+	c.Assert(header, Not(IsNil))
+
+	c.Check(header.Version, Equals, uint8(6))
+	c.Check(header.TrafficClass, Equals, uint8(184))
+	c.Check(header.FlowLabel, Equals, uint32(0xbeef))
+	c.Check(header.PayloadLength, Equals, uint16(4))
+	c.Check(header.NextHeader, Equals, uint8(17))
+	c.Check(header.HopLimit, Equals, uint8(64))
+	c.Check(header.SourceAddress, Equals, netip.MustParseAddr("fe80::1"))
+	c.Check(header.DestinationAddress, Equals, netip.MustParseAddr("fe80::2"))
+	c.Check(header.Payload, DeepEquals, []byte{42, 128, 0, 0})
+
+	//
+	// TEST packetserr.IPv6PacketTruncated
+	//
+	header, err = packets.UnmarshalIPv6Header(data[:42])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6",
+		Field:  "Payload",
+		Offset: 40,
+		Err:    packetserr.IPv6PacketTruncated{ExpectedSize: 44, Len: 42},
+	})
+
+	header, err = packets.UnmarshalIPv6Header(data[:30])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6",
+		Field:  "DestinationAddress",
+		Offset: 24,
+		Err:    packetserr.IPv6PacketTruncated{ExpectedSize: 40, Len: 30},
+	})
+}
@@ -0,0 +1,563 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the Type values of the IPv6 options carried by the Hop-by-Hop Options
+// and Destination Options headers. See RFC 8200 and RFC 2711.
+const (
+	IPv6OptionTypePad1        uint8 = 0
+	IPv6OptionTypePadN        uint8 = 1
+	IPv6OptionTypeRouterAlert uint8 = 5
+
+	ipv6ExtUnit           int    = 8 // the extension header lengths are in units of 8 bytes
+	ipv6ExtMaxSize        int    = 256 * ipv6ExtUnit
+	ipv6FragmentLen       int    = 8
+	ipv6RoutingMinLen     int    = 4 // the Routing header, less the type-specific data
+	ipv6MaxFragmentOffset uint16 = 8191
+)
+
+// IPv6ExtensionHeader is the interface implemented by each of the IPv6 extension
+// header types. The HeaderType is the IP protocol number that identifies the type
+// of extension header, in the NextHeader field of the header before it.
+type IPv6ExtensionHeader interface {
+	Layer
+	HeaderType() uint8
+	Marshal() ([]byte, error)
+
+	appendIPv6ExtensionHeader(b []byte, nextHeader uint8) ([]byte, error)
+	nextHeader() uint8
+}
+
+// IPv6ExtensionHeaders is a chain of IPv6 extension headers, in the order they
+// appear in the packet.
+type IPv6ExtensionHeaders []IPv6ExtensionHeader
+
+// IPv6Option is a struct to hold the data of an option carried by the Hop-by-Hop
+// Options or Destination Options headers. The Pad1 option has no length, so its
+// Data must be empty.
+type IPv6Option struct {
+	Type uint8
+	Data []byte
+}
+
+// IPv6HopByHopHeader is a struct representing the Hop-by-Hop Options extension
+// header, which is examined by every router along the path of the packet. When
+// marshaling, the options are padded to the 8 byte boundary with the Pad1 or PadN
+// options.
+type IPv6HopByHopHeader struct {
+	NextHeader uint8
+	Options    []*IPv6Option
+}
+
+// IPv6DestinationOptionsHeader is a struct representing the Destination Options
+// extension header, which is only examined by the destination of the packet. When
+// marshaling, the options are padded to the 8 byte boundary with the Pad1 or PadN
+// options.
+type IPv6DestinationOptionsHeader struct {
+	NextHeader uint8
+	Options    []*IPv6Option
+}
+
+// IPv6RoutingHeader is a struct representing the Routing extension header. The
+// Data is the type-specific data following the SegmentsLeft field, including any
+// reserved fields, and its length plus 4 must be a multiple of 8 bytes.
+type IPv6RoutingHeader struct {
+	NextHeader   uint8
+	RoutingType  uint8
+	SegmentsLeft uint8
+	Data         []byte
+}
+
+// IPv6FragmentHeader is a struct representing the Fragment extension header. The
+// M field is set on all of the fragments but the last, like the MF field of the
+// IPv4Header.
+type IPv6FragmentHeader struct {
+	NextHeader     uint8
+	FragmentOffset uint16 // in units of 8 bytes; must be no more than 8191
+	M              bool
+	Identification uint32
+}
+
+// HeaderType returns IPProtocolIPv6HopByHop.
+func (h *IPv6HopByHopHeader) HeaderType() uint8 { return IPProtocolIPv6HopByHop }
+
+// HeaderType returns IPProtocolIPv6DestinationOptions.
+func (h *IPv6DestinationOptionsHeader) HeaderType() uint8 { return IPProtocolIPv6DestinationOptions }
+
+// HeaderType returns IPProtocolIPv6Routing.
+func (h *IPv6RoutingHeader) HeaderType() uint8 { return IPProtocolIPv6Routing }
+
+// HeaderType returns IPProtocolIPv6Fragment.
+func (h *IPv6FragmentHeader) HeaderType() uint8 { return IPProtocolIPv6Fragment }
+
+// isIPv6ExtensionHeader returns whether the protocol number is one of the IPv6
+// extension headers understood by this package.
+func isIPv6ExtensionHeader(protocol uint8) bool {
+	switch protocol {
+	case IPProtocolIPv6HopByHop, IPProtocolIPv6Routing, IPProtocolIPv6Fragment, IPProtocolIPv6DestinationOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// ipv6ExtensionHeaderLen returns the length of the extension header at the start
+// of the data, which must be at least 2 bytes.
+func ipv6ExtensionHeaderLen(protocol uint8, data []byte) int {
+	if protocol == IPProtocolIPv6Fragment {
+		return ipv6FragmentLen
+	}
+
+	return (int(data[1]) + 1) * ipv6ExtUnit
+}
+
+// ipv6ExtensionTruncatedError wraps the error for an extension header of the type
+// provided that ends after n bytes, in the same way as truncatedError().
+func ipv6ExtensionTruncatedError(protocol uint8, n int, err error) error {
+	var fields []headerField
+
+	switch protocol {
+	case IPProtocolIPv6Routing:
+		fields = []headerField{{0, "NextHeader"}, {1, "HdrExtLen"}, {2, "RoutingType"}, {3, "SegmentsLeft"}, {4, "Data"}}
+	case IPProtocolIPv6Fragment:
+		fields = []headerField{{0, "NextHeader"}, {1, "Reserved"}, {2, "FragmentOffset"}, {4, "Identification"}}
+	default:
+		fields = []headerField{{0, "NextHeader"}, {1, "HdrExtLen"}, {2, "Options"}}
+	}
+
+	return truncatedError(ipv6NextHeaderLayerType(protocol, nil), fields, n, err)
+}
+
+// WalkIPv6ExtensionHeaders is a function to walk the chain of IPv6 extension
+// headers at the start of the data, returning the upper-layer protocol and the
+// offset of its header within the data. The nextHeader is the NextHeader field of
+// the IPv6Header, and the data is its Payload. If there are no extension headers,
+// the nextHeader and an offset of 0 are returned.
+//
+// If the packet is a fragment other than the first, the walk stops at the Fragment
+// header; the rest of the chain and the upper-layer header are in the first
+// fragment. In that case IPProtocolIPv6Fragment and the offset of the Fragment
+// header are returned.
+//
+// The error is a packetserr.DecodeError wrapping the
+// packetserr.IPv6ExtensionHeaderTruncated type if the data ends within the chain.
+// The type and offset of the truncated header are returned along with the error.
+func WalkIPv6ExtensionHeaders(nextHeader uint8, data []byte) (uint8, int, error) {
+	var offset int
+
+	for isIPv6ExtensionHeader(nextHeader) {
+		if len(data)-offset < 2 {
+			err := packetserr.IPv6ExtensionHeaderTruncated{Type: nextHeader, ExpectedSize: 2, Len: len(data) - offset}
+			return nextHeader, offset, shiftDecodeError(ipv6ExtensionTruncatedError(nextHeader, len(data)-offset, err), offset)
+		}
+
+		headerLen := ipv6ExtensionHeaderLen(nextHeader, data[offset:])
+
+		if len(data)-offset < headerLen {
+			err := packetserr.IPv6ExtensionHeaderTruncated{Type: nextHeader, ExpectedSize: headerLen, Len: len(data) - offset}
+			return nextHeader, offset, shiftDecodeError(ipv6ExtensionTruncatedError(nextHeader, len(data)-offset, err), offset)
+		}
+
+		// the headers following the Fragment header of
+		// a later fragment aren't part of this fragment
+		if nextHeader == IPProtocolIPv6Fragment && binary.BigEndian.Uint16(data[offset+2:])>>3 != 0 {
+			return nextHeader, offset, nil
+		}
+
+		nextHeader = data[offset]
+		offset += headerLen
+	}
+
+	return nextHeader, offset, nil
+}
+
+// UpperLayerProtocol is a method to walk the chain of extension headers at the
+// start of the Payload, returning the upper-layer protocol and the offset of its
+// header within the Payload. It's the same as calling WalkIPv6ExtensionHeaders()
+// with the NextHeader and Payload fields.
+func (ip *IPv6Header) UpperLayerProtocol() (uint8, int, error) {
+	return WalkIPv6ExtensionHeaders(ip.NextHeader, ip.Payload)
+}
+
+// UnmarshalIPv6ExtensionHeaders is a function to parse the chain of IPv6 extension
+// headers at the start of the data, in the same way as WalkIPv6ExtensionHeaders(),
+// returning the headers along with the upper-layer protocol and the offset of its
+// header within the data.
+//
+// The error may be any of the errors returned by the Unmarshal function of each
+// type of extension header, with the Offset of the packetserr.DecodeError counted
+// from the start of the data.
+func UnmarshalIPv6ExtensionHeaders(nextHeader uint8, data []byte) (IPv6ExtensionHeaders, uint8, int, error) {
+	var headers IPv6ExtensionHeaders
+	var offset int
+
+	for isIPv6ExtensionHeader(nextHeader) {
+		header, headerLen, err := unmarshalIPv6ExtensionHeader(nextHeader, data[offset:])
+		if err != nil {
+			return nil, nextHeader, offset, shiftDecodeError(err, offset)
+		}
+
+		headers = append(headers, header)
+
+		if frag, ok := header.(*IPv6FragmentHeader); ok && frag.FragmentOffset != 0 {
+			break
+		}
+
+		nextHeader = header.nextHeader()
+		offset += headerLen
+	}
+
+	return headers, nextHeader, offset, nil
+}
+
+func unmarshalIPv6ExtensionHeader(protocol uint8, data []byte) (IPv6ExtensionHeader, int, error) {
+	switch protocol {
+	case IPProtocolIPv6HopByHop:
+		h := &IPv6HopByHopHeader{}
+		n, err := h.unmarshal(data)
+		return h, n, err
+	case IPProtocolIPv6DestinationOptions:
+		h := &IPv6DestinationOptionsHeader{}
+		n, err := h.unmarshal(data)
+		return h, n, err
+	case IPProtocolIPv6Routing:
+		h := &IPv6RoutingHeader{}
+		n, err := h.unmarshal(data)
+		return h, n, err
+	default:
+		h := &IPv6FragmentHeader{}
+		n, err := h.unmarshal(data)
+		return h, n, err
+	}
+}
+
+// NextHeader is a method to get the value of the NextHeader field of the IPv6Header
+// for the chain. This is the HeaderType of the first extension header, or the
+// upper-layer protocol provided if there are none.
+func (hdrs IPv6ExtensionHeaders) NextHeader(protocol uint8) uint8 {
+	if len(hdrs) == 0 {
+		return protocol
+	}
+
+	return hdrs[0].HeaderType()
+}
+
+// Marshal is a method to marshal the chain of extension headers, for use at the
+// start of the IPv6Header Payload. The NextHeader field of each header is ignored,
+// and is instead set to the HeaderType of the header following it, or to the
+// upper-layer protocol provided for the last header. Use NextHeader() to get the
+// value for the NextHeader field of the IPv6Header itself. The headers are not
+// modified.
+//
+// The error may be any of the errors returned by the Marshal method of each type
+// of extension header.
+func (hdrs IPv6ExtensionHeaders) Marshal(protocol uint8) ([]byte, error) {
+	var data []byte
+	var err error
+
+	for i, header := range hdrs {
+		next := protocol
+
+		if i < len(hdrs)-1 {
+			next = hdrs[i+1].HeaderType()
+		}
+
+		if data, err = header.appendIPv6ExtensionHeader(data, next); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// UnmarshalIPv6HopByHopHeader is a function that takes a byte slice and parses it
+// in to an instance of *IPv6HopByHopHeader. Any data following the header is
+// ignored.
+//
+// The error is a packetserr.DecodeError wrapping the
+// packetserr.IPv6ExtensionHeaderTruncated or packetserr.IPv6OptionTruncated types.
+func UnmarshalIPv6HopByHopHeader(data []byte) (*IPv6HopByHopHeader, error) {
+	h := &IPv6HopByHopHeader{}
+
+	if _, err := h.unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Marshal is a function to marshal the *IPv6HopByHopHeader instance to a byte
+// slice. The *IPv6HopByHopHeader instance is not modified.
+//
+// The error will be of the packetserr.IPv6ExtensionHeaderLengthInvalid type if the
+// options are too large to fit in the header.
+func (h *IPv6HopByHopHeader) Marshal() ([]byte, error) {
+	return h.appendIPv6ExtensionHeader(nil, h.NextHeader)
+}
+
+func (h *IPv6HopByHopHeader) unmarshal(data []byte) (int, error) {
+	var n int
+	var err error
+
+	h.NextHeader, h.Options, n, err = unmarshalIPv6OptionsHeader(IPProtocolIPv6HopByHop, data)
+
+	return n, err
+}
+
+func (h *IPv6HopByHopHeader) appendIPv6ExtensionHeader(b []byte, nextHeader uint8) ([]byte, error) {
+	return appendIPv6OptionsHeader(b, IPProtocolIPv6HopByHop, nextHeader, h.Options)
+}
+
+func (h *IPv6HopByHopHeader) nextHeader() uint8 { return h.NextHeader }
+
+// UnmarshalIPv6DestinationOptionsHeader is a function that takes a byte slice and
+// parses it in to an instance of *IPv6DestinationOptionsHeader. Any data following
+// the header is ignored.
+//
+// The error is a packetserr.DecodeError wrapping the
+// packetserr.IPv6ExtensionHeaderTruncated or packetserr.IPv6OptionTruncated types.
+func UnmarshalIPv6DestinationOptionsHeader(data []byte) (*IPv6DestinationOptionsHeader, error) {
+	h := &IPv6DestinationOptionsHeader{}
+
+	if _, err := h.unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Marshal is a function to marshal the *IPv6DestinationOptionsHeader instance to a
+// byte slice. The *IPv6DestinationOptionsHeader instance is not modified.
+//
+// The error will be of the packetserr.IPv6ExtensionHeaderLengthInvalid type if the
+// options are too large to fit in the header.
+func (h *IPv6DestinationOptionsHeader) Marshal() ([]byte, error) {
+	return h.appendIPv6ExtensionHeader(nil, h.NextHeader)
+}
+
+func (h *IPv6DestinationOptionsHeader) unmarshal(data []byte) (int, error) {
+	var n int
+	var err error
+
+	h.NextHeader, h.Options, n, err = unmarshalIPv6OptionsHeader(IPProtocolIPv6DestinationOptions, data)
+
+	return n, err
+}
+
+func (h *IPv6DestinationOptionsHeader) appendIPv6ExtensionHeader(b []byte, nextHeader uint8) ([]byte, error) {
+	return appendIPv6OptionsHeader(b, IPProtocolIPv6DestinationOptions, nextHeader, h.Options)
+}
+
+func (h *IPv6DestinationOptionsHeader) nextHeader() uint8 { return h.NextHeader }
+
+func unmarshalIPv6OptionsHeader(protocol uint8, data []byte) (uint8, []*IPv6Option, int, error) {
+	if len(data) < 2 {
+		err := packetserr.IPv6ExtensionHeaderTruncated{Type: protocol, ExpectedSize: 2, Len: len(data)}
+		return 0, nil, 0, ipv6ExtensionTruncatedError(protocol, len(data), err)
+	}
+
+	headerLen := ipv6ExtensionHeaderLen(protocol, data)
+
+	if len(data) < headerLen {
+		err := packetserr.IPv6ExtensionHeaderTruncated{Type: protocol, ExpectedSize: headerLen, Len: len(data)}
+		return 0, nil, 0, ipv6ExtensionTruncatedError(protocol, len(data), err)
+	}
+
+	var opts []*IPv6Option
+
+	for i := 2; i < headerLen; {
+		if data[i] == IPv6OptionTypePad1 {
+			opts = append(opts, &IPv6Option{Type: IPv6OptionTypePad1})
+			i++
+
+			continue
+		}
+
+		if i+2 > headerLen || i+2+int(data[i+1]) > headerLen {
+			lt := ipv6NextHeaderLayerType(protocol, nil)
+			return 0, nil, 0, decodeError(lt, "Options", i, packetserr.IPv6OptionTruncated{Offset: i})
+		}
+
+		end := i + 2 + int(data[i+1])
+
+		opts = append(opts, &IPv6Option{Type: data[i], Data: copyBytes(data[i+2 : end])})
+		i = end
+	}
+
+	return data[0], opts, headerLen, nil
+}
+
+func appendIPv6OptionsHeader(b []byte, protocol, nextHeader uint8, opts []*IPv6Option) ([]byte, error) {
+	start := len(b)
+
+	b = append(b, nextHeader, 0)
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if opt.Type == IPv6OptionTypePad1 {
+			b = append(b, IPv6OptionTypePad1)
+			continue
+		}
+
+		if len(opt.Data) > 255 {
+			return nil, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: protocol, Len: len(b) - start + 2 + len(opt.Data)}
+		}
+
+		b = append(b, opt.Type, uint8(len(opt.Data)))
+		b = append(b, opt.Data...)
+	}
+
+	// pad to the 8 byte boundary with a single
+	// Pad1 option, or a PadN option otherwise
+	switch pad := (ipv6ExtUnit - (len(b)-start)%ipv6ExtUnit) % ipv6ExtUnit; pad {
+	case 0:
+	case 1:
+		b = append(b, IPv6OptionTypePad1)
+	default:
+		b = append(b, IPv6OptionTypePadN, uint8(pad-2))
+		b = append(b, make([]byte, pad-2)...)
+	}
+
+	headerLen := len(b) - start
+
+	if headerLen > ipv6ExtMaxSize {
+		return nil, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: protocol, Len: headerLen}
+	}
+
+	b[start+1] = uint8(headerLen/ipv6ExtUnit - 1)
+
+	return b, nil
+}
+
+// UnmarshalIPv6RoutingHeader is a function that takes a byte slice and parses it
+// in to an instance of *IPv6RoutingHeader. Any data following the header is
+// ignored.
+//
+// The error is a packetserr.DecodeError wrapping the
+// packetserr.IPv6ExtensionHeaderTruncated type if there is less data than the size
+// of the header.
+func UnmarshalIPv6RoutingHeader(data []byte) (*IPv6RoutingHeader, error) {
+	h := &IPv6RoutingHeader{}
+
+	if _, err := h.unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Marshal is a function to marshal the *IPv6RoutingHeader instance to a byte
+// slice. The *IPv6RoutingHeader instance is not modified.
+//
+// The error will be of the packetserr.IPv6ExtensionHeaderLengthInvalid type if the
+// Data doesn't result in a header that's a multiple of 8 bytes, or is too large.
+func (h *IPv6RoutingHeader) Marshal() ([]byte, error) {
+	return h.appendIPv6ExtensionHeader(nil, h.NextHeader)
+}
+
+func (h *IPv6RoutingHeader) unmarshal(data []byte) (int, error) {
+	if len(data) < 2 {
+		err := packetserr.IPv6ExtensionHeaderTruncated{Type: IPProtocolIPv6Routing, ExpectedSize: 2, Len: len(data)}
+		return 0, ipv6ExtensionTruncatedError(IPProtocolIPv6Routing, len(data), err)
+	}
+
+	headerLen := ipv6ExtensionHeaderLen(IPProtocolIPv6Routing, data)
+
+	if len(data) < headerLen {
+		err := packetserr.IPv6ExtensionHeaderTruncated{Type: IPProtocolIPv6Routing, ExpectedSize: headerLen, Len: len(data)}
+		return 0, ipv6ExtensionTruncatedError(IPProtocolIPv6Routing, len(data), err)
+	}
+
+	h.NextHeader = data[0]
+	h.RoutingType = data[2]
+	h.SegmentsLeft = data[3]
+	h.Data = copyBytes(data[ipv6RoutingMinLen:headerLen])
+
+	return headerLen, nil
+}
+
+func (h *IPv6RoutingHeader) appendIPv6ExtensionHeader(b []byte, nextHeader uint8) ([]byte, error) {
+	headerLen := ipv6RoutingMinLen + len(h.Data)
+
+	if headerLen%ipv6ExtUnit != 0 || headerLen > ipv6ExtMaxSize {
+		return nil, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: IPProtocolIPv6Routing, Len: headerLen}
+	}
+
+	b = append(b, nextHeader, uint8(headerLen/ipv6ExtUnit-1), h.RoutingType, h.SegmentsLeft)
+
+	return append(b, h.Data...), nil
+}
+
+func (h *IPv6RoutingHeader) nextHeader() uint8 { return h.NextHeader }
+
+// UnmarshalIPv6FragmentHeader is a function that takes a byte slice and parses it
+// in to an instance of *IPv6FragmentHeader. Any data following the header is
+// ignored.
+//
+// The error is a packetserr.DecodeError wrapping the
+// packetserr.IPv6ExtensionHeaderTruncated type if there is less data than the size
+// of the header.
+func UnmarshalIPv6FragmentHeader(data []byte) (*IPv6FragmentHeader, error) {
+	h := &IPv6FragmentHeader{}
+
+	if _, err := h.unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Marshal is a function to marshal the *IPv6FragmentHeader instance to a byte
+// slice. The *IPv6FragmentHeader instance is not modified.
+//
+// The error will be of the packetserr.IPv6FieldTooLarge type if the FragmentOffset
+// is more than 8191.
+func (h *IPv6FragmentHeader) Marshal() ([]byte, error) {
+	return h.appendIPv6ExtensionHeader(nil, h.NextHeader)
+}
+
+func (h *IPv6FragmentHeader) unmarshal(data []byte) (int, error) {
+	if len(data) < ipv6FragmentLen {
+		err := packetserr.IPv6ExtensionHeaderTruncated{Type: IPProtocolIPv6Fragment, ExpectedSize: ipv6FragmentLen, Len: len(data)}
+		return 0, ipv6ExtensionTruncatedError(IPProtocolIPv6Fragment, len(data), err)
+	}
+
+	offsetM := binary.BigEndian.Uint16(data[2:4])
+
+	h.NextHeader = data[0]
+	h.FragmentOffset = offsetM >> 3
+	h.M = offsetM&1 != 0
+	h.Identification = binary.BigEndian.Uint32(data[4:8])
+
+	return ipv6FragmentLen, nil
+}
+
+func (h *IPv6FragmentHeader) appendIPv6ExtensionHeader(b []byte, nextHeader uint8) ([]byte, error) {
+	if h.FragmentOffset > ipv6MaxFragmentOffset {
+		return nil, packetserr.IPv6FieldTooLarge{Field: "FragmentOffset", MaxValue: int(ipv6MaxFragmentOffset)}
+	}
+
+	offsetM := h.FragmentOffset << 3
+
+	if h.M {
+		offsetM |= 1
+	}
+
+	b = append(b, nextHeader, 0)
+	b = binary.BigEndian.AppendUint16(b, offsetM)
+
+	return binary.BigEndian.AppendUint32(b, h.Identification), nil
+}
+
+func (h *IPv6FragmentHeader) nextHeader() uint8 { return h.NextHeader }
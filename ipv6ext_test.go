@@ -0,0 +1,382 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+// ipv6ExtensionChain is a Hop-by-Hop Options header with a Router Alert option,
+// followed by a Fragment header for the first fragment, and then a UDP header.
+var ipv6ExtensionChain = []byte{
+	0x2c, 0x00, 0x05, 0x02, 0x00, 0x00, 0x01, 0x00, // Hop-by-Hop Options
+	0x11, 0x00, 0x00, 0x01, 0xde, 0xad, 0xbe, 0xef, // Fragment
+}
+
+func (t *TestSuite) TestIPv6HopByHopHeader_Marshal(c *C) {
+	h := &packets.IPv6HopByHopHeader{
+		NextHeader: packets.IPProtocolIPv6Fragment,
+		Options: []*packets.IPv6Option{
+			{Type: packets.IPv6OptionTypeRouterAlert, Data: []byte{0x00, 0x00}},
+		},
+	}
+
+	data, err := h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, ipv6ExtensionChain[:8])
+
+	// the options aren't padded
+	c.Check(len(h.Options), Equals, 1)
+
+	h, err = packets.UnmarshalIPv6HopByHopHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(h.NextHeader, Equals, packets.IPProtocolIPv6Fragment)
+	c.Assert(len(h.Options), Equals, 2)
+	c.Check(h.Options[0].Type, Equals, packets.IPv6OptionTypeRouterAlert)
+	c.Check(h.Options[0].Data, DeepEquals, []byte{0x00, 0x00})
+	c.Check(h.Options[1].Type, Equals, packets.IPv6OptionTypePadN)
+	c.Check(len(h.Options[1].Data), Equals, 0)
+
+	// the decoded padding round-trips
+	again, err := h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(again, DeepEquals, data)
+
+	//
+	// TEST PADDING WITH THE Pad1 OPTION
+	//
+	h.Options = []*packets.IPv6Option{{Type: 0x1e, Data: []byte{1, 2, 3}}}
+
+	data, err = h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{0x2c, 0x00, 0x1e, 0x03, 0x01, 0x02, 0x03, 0x00})
+
+	h.Options = nil
+
+	data, err = h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{0x2c, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00})
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderLengthInvalid
+	//
+	h.Options = []*packets.IPv6Option{{Type: 0x1e, Data: make([]byte, 256)}}
+
+	data, err = h.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: packets.IPProtocolIPv6HopByHop, Len: 260})
+}
+
+func (t *TestSuite) TestUnmarshalIPv6DestinationOptionsHeader(c *C) {
+	data := []byte{0x06, 0x00, 0xc9, 0x02, 0xab, 0xcd, 0x00, 0x00}
+
+	h, err := packets.UnmarshalIPv6DestinationOptionsHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(h.NextHeader, Equals, packets.IPProtocolTCP)
+	c.Check(h.HeaderType(), Equals, packets.IPProtocolIPv6DestinationOptions)
+	c.Assert(len(h.Options), Equals, 3)
+	c.Check(h.Options[0].Type, Equals, uint8(0xc9))
+	c.Check(h.Options[0].Data, DeepEquals, []byte{0xab, 0xcd})
+	c.Check(h.Options[1].Type, Equals, packets.IPv6OptionTypePad1)
+	c.Check(h.Options[2].Type, Equals, packets.IPv6OptionTypePad1)
+
+	again, err := h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(again, DeepEquals, data)
+
+	//
+	// TEST packetserr.IPv6OptionTruncated
+	//
+	h, err = packets.UnmarshalIPv6DestinationOptionsHeader([]byte{0x06, 0x00, 0xc9, 0x05, 0xab, 0xcd, 0x00, 0x00})
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6DestinationOptions",
+		Field:  "Options",
+		Offset: 2,
+		Err:    packetserr.IPv6OptionTruncated{Offset: 2},
+	})
+
+	h, err = packets.UnmarshalIPv6DestinationOptionsHeader([]byte{0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc9})
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6DestinationOptions",
+		Field:  "Options",
+		Offset: 7,
+		Err:    packetserr.IPv6OptionTruncated{Offset: 7},
+	})
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderTruncated
+	//
+	h, err = packets.UnmarshalIPv6DestinationOptionsHeader([]byte{0x06})
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6DestinationOptions",
+		Field:  "HdrExtLen",
+		Offset: 1,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6DestinationOptions, ExpectedSize: 2, Len: 1},
+	})
+
+	h, err = packets.UnmarshalIPv6DestinationOptionsHeader(append([]byte{0x06, 0x01}, make([]byte, 12)...))
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6DestinationOptions",
+		Field:  "Options",
+		Offset: 2,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6DestinationOptions, ExpectedSize: 16, Len: 14},
+	})
+}
+
+func (t *TestSuite) TestIPv6RoutingHeader_Marshal(c *C) {
+	h := &packets.IPv6RoutingHeader{
+		NextHeader:   packets.IPProtocolUDP,
+		RoutingType:  4,
+		SegmentsLeft: 1,
+		Data:         make([]byte, 20),
+	}
+
+	h.Data[19] = 0x01
+
+	data, err := h.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 24)
+	c.Check(data[:4], DeepEquals, []byte{0x11, 0x02, 0x04, 0x01})
+
+	h, err = packets.UnmarshalIPv6RoutingHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(h.NextHeader, Equals, packets.IPProtocolUDP)
+	c.Check(h.RoutingType, Equals, uint8(4))
+	c.Check(h.SegmentsLeft, Equals, uint8(1))
+	c.Check(len(h.Data), Equals, 20)
+	c.Check(h.Data[19], Equals, uint8(0x01))
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderLengthInvalid
+	//
+	h.Data = make([]byte, 8)
+
+	data, err = h.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: packets.IPProtocolIPv6Routing, Len: 12})
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderTruncated
+	//
+	h, err = packets.UnmarshalIPv6RoutingHeader(data[:0])
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6Routing",
+		Field:  "NextHeader",
+		Offset: 0,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6Routing, ExpectedSize: 2, Len: 0},
+	})
+}
+
+func (t *TestSuite) TestIPv6FragmentHeader_Marshal(c *C) {
+	h := &packets.IPv6FragmentHeader{
+		NextHeader:     packets.IPProtocolUDP,
+		M:              true,
+		Identification: 0xdeadbeef,
+	}
+
+	data, err := h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, ipv6ExtensionChain[8:])
+
+	h.FragmentOffset = 8191
+	h.M = false
+
+	data, err = h.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data[2:4], DeepEquals, []byte{0xff, 0xf8})
+
+	h, err = packets.UnmarshalIPv6FragmentHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(h.NextHeader, Equals, packets.IPProtocolUDP)
+	c.Check(h.FragmentOffset, Equals, uint16(8191))
+	c.Check(h.M, Equals, false)
+	c.Check(h.Identification, Equals, uint32(0xdeadbeef))
+
+	//
+	// TEST packetserr.IPv6FieldTooLarge
+	//
+	h.FragmentOffset = 8192
+
+	data, err = h.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6FieldTooLarge{Field: "FragmentOffset", MaxValue: 8191})
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderTruncated
+	//
+	h, err = packets.UnmarshalIPv6FragmentHeader(ipv6ExtensionChain[8:15])
+	c.Assert(err, Not(IsNil))
+	c.Check(h, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6Fragment",
+		Field:  "Identification",
+		Offset: 4,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6Fragment, ExpectedSize: 8, Len: 7},
+	})
+}
+
+func (t *TestSuite) TestIPv6ExtensionHeaders_Marshal(c *C) {
+	// the NextHeader fields are set when the chain is marshaled
+	hdrs := packets.IPv6ExtensionHeaders{
+		&packets.IPv6HopByHopHeader{
+			Options: []*packets.IPv6Option{
+				{Type: packets.IPv6OptionTypeRouterAlert, Data: []byte{0x00, 0x00}},
+			},
+		},
+		&packets.IPv6FragmentHeader{M: true, Identification: 0xdeadbeef},
+	}
+
+	c.Check(hdrs.NextHeader(packets.IPProtocolUDP), Equals, packets.IPProtocolIPv6HopByHop)
+	c.Check(packets.IPv6ExtensionHeaders(nil).NextHeader(packets.IPProtocolUDP), Equals, packets.IPProtocolUDP)
+
+	data, err := hdrs.Marshal(packets.IPProtocolUDP)
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, ipv6ExtensionChain)
+
+	// the headers provided aren't modified
+	c.Check(hdrs[1].(*packets.IPv6FragmentHeader).NextHeader, Equals, uint8(0))
+
+	data, err = packets.IPv6ExtensionHeaders(nil).Marshal(packets.IPProtocolUDP)
+	c.Assert(err, IsNil)
+	c.Check(len(data), Equals, 0)
+
+	//
+	// TEST ERRORS FROM THE HEADERS
+	//
+	hdrs = append(hdrs, &packets.IPv6RoutingHeader{})
+
+	data, err = hdrs.Marshal(packets.IPProtocolUDP)
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6ExtensionHeaderLengthInvalid{Type: packets.IPProtocolIPv6Routing, Len: 4})
+}
+
+func (t *TestSuite) TestUnmarshalIPv6ExtensionHeaders(c *C) {
+	udp, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	data := append(append([]byte{}, ipv6ExtensionChain...), udp...)
+
+	hdrs, protocol, offset, err := packets.UnmarshalIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, data)
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolUDP)
+	c.Check(offset, Equals, 16)
+	c.Assert(len(hdrs), Equals, 2)
+	c.Check(hdrs[0].LayerType(), Equals, packets.LayerTypeIPv6HopByHop)
+	c.Check(hdrs[1].LayerType(), Equals, packets.LayerTypeIPv6Fragment)
+	c.Check(hdrs[1].(*packets.IPv6FragmentHeader).Identification, Equals, uint32(0xdeadbeef))
+
+	again, err := hdrs.Marshal(protocol)
+	c.Assert(err, IsNil)
+	c.Check(again, DeepEquals, ipv6ExtensionChain)
+
+	// no extension headers
+	hdrs, protocol, offset, err = packets.UnmarshalIPv6ExtensionHeaders(packets.IPProtocolUDP, udp)
+	c.Assert(err, IsNil)
+	c.Check(hdrs, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolUDP)
+	c.Check(offset, Equals, 0)
+
+	//
+	// TEST ERRORS FROM THE HEADERS
+	//
+	hdrs, protocol, offset, err = packets.UnmarshalIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, data[:12])
+	c.Assert(err, Not(IsNil))
+	c.Check(hdrs, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolIPv6Fragment)
+	c.Check(offset, Equals, 8)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6Fragment",
+		Field:  "Identification",
+		Offset: 12,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6Fragment, ExpectedSize: 8, Len: 4},
+	})
+}
+
+func (t *TestSuite) TestWalkIPv6ExtensionHeaders(c *C) {
+	protocol, offset, err := packets.WalkIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, ipv6ExtensionChain)
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolUDP)
+	c.Check(offset, Equals, 16)
+
+	protocol, offset, err = packets.WalkIPv6ExtensionHeaders(packets.IPProtocolTCP, nil)
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolTCP)
+	c.Check(offset, Equals, 0)
+
+	// the upper-layer protocol may be No Next Header
+	protocol, offset, err = packets.WalkIPv6ExtensionHeaders(packets.IPProtocolIPv6DestinationOptions, []byte{0x3b, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00})
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolIPv6NoNextHeader)
+	c.Check(offset, Equals, 8)
+
+	//
+	// TEST A LATER FRAGMENT
+	//
+	later := append([]byte{}, ipv6ExtensionChain...)
+	later[10], later[11] = 0x00, 0xb8 // offset 23, no more fragments
+
+	protocol, offset, err = packets.WalkIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, later)
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolIPv6Fragment)
+	c.Check(offset, Equals, 8)
+
+	hdrs, protocol, offset, err := packets.UnmarshalIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, later)
+	c.Assert(err, IsNil)
+	c.Check(len(hdrs), Equals, 2)
+	c.Check(protocol, Equals, packets.IPProtocolIPv6Fragment)
+	c.Check(offset, Equals, 8)
+
+	//
+	// TEST THE IPv6Header
+	//
+	t.ip6.NextHeader = packets.IPProtocolIPv6HopByHop
+	t.ip6.Payload = ipv6ExtensionChain
+
+	protocol, offset, err = t.ip6.UpperLayerProtocol()
+	c.Assert(err, IsNil)
+	c.Check(protocol, Equals, packets.IPProtocolUDP)
+	c.Check(offset, Equals, 16)
+
+	//
+	// TEST packetserr.IPv6ExtensionHeaderTruncated
+	//
+	protocol, offset, err = packets.WalkIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, ipv6ExtensionChain[:9])
+	c.Assert(err, Not(IsNil))
+	c.Check(protocol, Equals, packets.IPProtocolIPv6Fragment)
+	c.Check(offset, Equals, 8)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6Fragment",
+		Field:  "Reserved",
+		Offset: 9,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6Fragment, ExpectedSize: 2, Len: 1},
+	})
+
+	protocol, offset, err = packets.WalkIPv6ExtensionHeaders(packets.IPProtocolIPv6HopByHop, ipv6ExtensionChain[:6])
+	c.Assert(err, Not(IsNil))
+	c.Check(protocol, Equals, packets.IPProtocolIPv6HopByHop)
+	c.Check(offset, Equals, 0)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6HopByHop",
+		Field:  "Options",
+		Offset: 2,
+		Err:    packetserr.IPv6ExtensionHeaderTruncated{Type: packets.IPProtocolIPv6HopByHop, ExpectedSize: 8, Len: 6},
+	})
+}
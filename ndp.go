@@ -0,0 +1,352 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the Type values of the Neighbor Discovery options. See RFC 4861.
+const (
+	NDPOptionTypeSourceLinkLayerAddress uint8 = 1
+	NDPOptionTypeTargetLinkLayerAddress uint8 = 2
+	NDPOptionTypePrefixInformation      uint8 = 3
+	NDPOptionTypeRedirectedHeader       uint8 = 4
+	NDPOptionTypeMTU                    uint8 = 5
+
+	ndpOptionUnit          int   = 8  // the Length field is in units of 8 bytes
+	ndpPrefixInfoDataLen   int   = 30 // the Prefix Information option, less the Type and Length
+	ndpMTUDataLen          int   = 6  // the MTU option, less the Type and Length
+	ndpPrefixOnLinkBit     uint8 = 0x80
+	ndpPrefixAutonomousBit uint8 = 0x40
+)
+
+// NDPOption is a struct to hold the data of a Neighbor Discovery option, carried
+// by some of the ICMPv6 messages. The Length field is the length of the whole
+// option, including the Type and Length fields, in units of 8 bytes. This means
+// len(Data) + 2 must always be a multiple of 8.
+//
+// As a convenience, if the Length is set to zero it will be calculated at the
+// time of marshaling.
+type NDPOption struct {
+	Type   uint8
+	Length uint8
+	Data   []byte
+}
+
+// NDPOptionSlice is a slice of NDPOptions for use in the ICMPv6Message Options
+// field.
+type NDPOptionSlice []*NDPOption
+
+// PrefixInformation is a struct representing the contents of the Prefix
+// Information NDP option. The lifetimes are in seconds, with 0xffffffff meaning
+// infinity.
+type PrefixInformation struct {
+	Prefix            netip.Prefix
+	OnLink            bool
+	Autonomous        bool
+	ValidLifetime     uint32
+	PreferredLifetime uint32
+}
+
+// NewSourceLinkLayerAddressOption is a function that returns a Source Link-Layer
+// Address NDPOption. The address is padded with zeroes to the 8 byte boundary.
+//
+// The error will be of the packetserr.NDPOptionDataTooLarge type if the address
+// is too long for the Length field, which allows for no more than 2038 bytes.
+func NewSourceLinkLayerAddressOption(addr net.HardwareAddr) (*NDPOption, error) {
+	return newLinkLayerAddressOption(NDPOptionTypeSourceLinkLayerAddress, addr)
+}
+
+// NewTargetLinkLayerAddressOption is a function that returns a Target Link-Layer
+// Address NDPOption. It's the same as NewSourceLinkLayerAddressOption() except
+// for the Type of the option.
+func NewTargetLinkLayerAddressOption(addr net.HardwareAddr) (*NDPOption, error) {
+	return newLinkLayerAddressOption(NDPOptionTypeTargetLinkLayerAddress, addr)
+}
+
+func newLinkLayerAddressOption(typ uint8, addr net.HardwareAddr) (*NDPOption, error) {
+	// the Length field counts the Type and Length fields, in units of 8 bytes
+	if maxSize := 255*ndpOptionUnit - 2; len(addr) > maxSize {
+		return nil, packetserr.NDPOptionDataTooLarge{MaxSize: maxSize, Len: len(addr)}
+	}
+
+	units := (len(addr) + 2 + ndpOptionUnit - 1) / ndpOptionUnit
+
+	data := make([]byte, units*ndpOptionUnit-2)
+	copy(data, addr)
+
+	return &NDPOption{Type: typ, Length: uint8(units), Data: data}, nil
+}
+
+// NewPrefixInformationOption is a function that returns a Prefix Information
+// NDPOption. The prefix is masked, so that none of the bits following the prefix
+// length are set.
+//
+// The error will be of the packetserr.IPv6AddressInvalid type if the prefix isn't
+// an IPv6 prefix.
+func NewPrefixInformationOption(info PrefixInformation) (*NDPOption, error) {
+	if !info.Prefix.IsValid() || !info.Prefix.Addr().Is6() {
+		return nil, packetserr.IPv6AddressInvalid{Address: info.Prefix.String()}
+	}
+
+	prefix := info.Prefix.Masked()
+	data := make([]byte, ndpPrefixInfoDataLen)
+
+	data[0] = uint8(prefix.Bits())
+
+	if info.OnLink {
+		data[1] |= ndpPrefixOnLinkBit
+	}
+
+	if info.Autonomous {
+		data[1] |= ndpPrefixAutonomousBit
+	}
+
+	binary.BigEndian.PutUint32(data[2:], info.ValidLifetime)
+	binary.BigEndian.PutUint32(data[6:], info.PreferredLifetime)
+
+	// the four bytes following the lifetimes are reserved
+	addr := prefix.Addr().As16()
+	copy(data[14:], addr[:])
+
+	return &NDPOption{Type: NDPOptionTypePrefixInformation, Length: 4, Data: data}, nil
+}
+
+// NewMTUOption is a function that returns an MTU NDPOption.
+func NewMTUOption(mtu uint32) *NDPOption {
+	data := make([]byte, ndpMTUDataLen)
+	binary.BigEndian.PutUint32(data[2:], mtu)
+
+	return &NDPOption{Type: NDPOptionTypeMTU, Length: 1, Data: data}
+}
+
+// LinkLayerAddress is a method to decode the address of a Source Link-Layer
+// Address or Target Link-Layer Address NDPOption. The padding of the option
+// can't be told apart from the address itself, so the whole of the Data is
+// returned. For Ethernet this is exactly the 6 byte address.
+//
+// The error will be of the packetserr.NDPOptionTypeMismatch type if the option
+// isn't a link-layer address option, or packetserr.NDPOptionLengthInvalid if its
+// Length doesn't agree with its Data.
+func (opt *NDPOption) LinkLayerAddress() (net.HardwareAddr, error) {
+	typ := NDPOptionTypeSourceLinkLayerAddress
+
+	if opt.Type == NDPOptionTypeTargetLinkLayerAddress {
+		typ = NDPOptionTypeTargetLinkLayerAddress
+	}
+
+	data, err := opt.typedData(typ, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.HardwareAddr(data), nil
+}
+
+// PrefixInformation is a method to decode the contents of a Prefix Information
+// NDPOption.
+//
+// The error will be of the packetserr.NDPOptionTypeMismatch type if the option
+// isn't a Prefix Information option, or packetserr.NDPOptionLengthInvalid if its
+// length is not the 32 bytes required.
+func (opt *NDPOption) PrefixInformation() (PrefixInformation, error) {
+	data, err := opt.typedData(NDPOptionTypePrefixInformation, ndpPrefixInfoDataLen)
+	if err != nil {
+		return PrefixInformation{}, err
+	}
+
+	bits := int(data[0])
+
+	// a prefix length that's too long results in an invalid netip.Prefix
+	prefix := netip.PrefixFrom(netip.AddrFrom16([16]byte(data[14:30])), bits)
+
+	info := PrefixInformation{
+		Prefix:            prefix,
+		OnLink:            data[1]&ndpPrefixOnLinkBit != 0,
+		Autonomous:        data[1]&ndpPrefixAutonomousBit != 0,
+		ValidLifetime:     binary.BigEndian.Uint32(data[2:6]),
+		PreferredLifetime: binary.BigEndian.Uint32(data[6:10]),
+	}
+
+	return info, nil
+}
+
+// MTU is a method to decode the value of an MTU NDPOption.
+//
+// The error will be of the packetserr.NDPOptionTypeMismatch type if the option
+// isn't an MTU option, or packetserr.NDPOptionLengthInvalid if its length is not
+// the 8 bytes required.
+func (opt *NDPOption) MTU() (uint32, error) {
+	data, err := opt.typedData(NDPOptionTypeMTU, ndpMTUDataLen)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(data[2:]), nil
+}
+
+// typedData validates the Type and Length of the option, returning its Data. If
+// dataLen is negative the length of the Data is not validated. A Length of zero
+// is treated the same as it is when marshaling.
+func (opt *NDPOption) typedData(typ uint8, dataLen int) ([]byte, error) {
+	if opt.Type != typ {
+		return nil, packetserr.NDPOptionTypeMismatch{Expected: typ, Type: opt.Type}
+	}
+
+	if (len(opt.Data)+2)%ndpOptionUnit != 0 || (opt.Length != 0 && int(opt.Length)*ndpOptionUnit != len(opt.Data)+2) {
+		return nil, packetserr.NDPOptionLengthInvalid{Type: opt.Type, Length: opt.Length}
+	}
+
+	if dataLen >= 0 && len(opt.Data) != dataLen {
+		return nil, packetserr.NDPOptionLengthInvalid{Type: opt.Type, Length: opt.Length}
+	}
+
+	return opt.Data, nil
+}
+
+// Option is a method to find the first option of the type provided. If there
+// isn't one, nil is returned.
+func (ndpos NDPOptionSlice) Option(typ uint8) *NDPOption {
+	for _, opt := range ndpos {
+		if opt != nil && opt.Type == typ {
+			return opt
+		}
+	}
+
+	return nil
+}
+
+// SourceLinkLayerAddress is a method to get the address of the Source Link-Layer
+// Address option. The boolean is false if there is no such option, or if it's
+// malformed.
+func (ndpos NDPOptionSlice) SourceLinkLayerAddress() (net.HardwareAddr, bool) {
+	return ndpos.linkLayerAddress(NDPOptionTypeSourceLinkLayerAddress)
+}
+
+// TargetLinkLayerAddress is a method to get the address of the Target Link-Layer
+// Address option. The boolean is false if there is no such option, or if it's
+// malformed.
+func (ndpos NDPOptionSlice) TargetLinkLayerAddress() (net.HardwareAddr, bool) {
+	return ndpos.linkLayerAddress(NDPOptionTypeTargetLinkLayerAddress)
+}
+
+func (ndpos NDPOptionSlice) linkLayerAddress(typ uint8) (net.HardwareAddr, bool) {
+	opt := ndpos.Option(typ)
+	if opt == nil {
+		return nil, false
+	}
+
+	addr, err := opt.LinkLayerAddress()
+
+	return addr, err == nil
+}
+
+// PrefixInformation is a method to get the contents of all of the well-formed
+// Prefix Information options, as a Router Advertisement may carry more than one
+// of them. The boolean is false if there are none.
+func (ndpos NDPOptionSlice) PrefixInformation() ([]PrefixInformation, bool) {
+	var infos []PrefixInformation
+
+	for _, opt := range ndpos {
+		if opt == nil || opt.Type != NDPOptionTypePrefixInformation {
+			continue
+		}
+
+		if info, err := opt.PrefixInformation(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+
+	return infos, len(infos) > 0
+}
+
+// MTU is a method to get the value of the MTU option. The boolean is false if
+// there is no MTU option, or if it's malformed.
+func (ndpos NDPOptionSlice) MTU() (uint32, bool) {
+	opt := ndpos.Option(NDPOptionTypeMTU)
+	if opt == nil {
+		return 0, false
+	}
+
+	mtu, err := opt.MTU()
+
+	return mtu, err == nil
+}
+
+// UnmarshalNDPOptionSlice is a function that takes a byte slice and converts it
+// in to an NDPOptionSlice.
+//
+// The Length of every option is validated against the data remaining, so this
+// is safe to use on data from untrusted sources. The error is a
+// packetserr.DecodeError wrapping the packetserr.NDPOptionTruncated or
+// packetserr.NDPOptionLengthInvalid types, with the Offset of the option within
+// the data.
+func UnmarshalNDPOptionSlice(data []byte) (NDPOptionSlice, error) {
+	opts := make(NDPOptionSlice, 0)
+
+	for i := 0; i < len(data); {
+		if i+2 > len(data) {
+			return nil, decodeError(LayerTypeICMPv6, "Options", i, packetserr.NDPOptionTruncated{Offset: i})
+		}
+
+		typ, units := data[i], data[i+1]
+
+		// a Length of zero is invalid, and would
+		// otherwise never get to the end of the data
+		if units == 0 {
+			return nil, decodeError(LayerTypeICMPv6, "Options", i+1, packetserr.NDPOptionLengthInvalid{Type: typ, Length: units})
+		}
+
+		length := int(units) * ndpOptionUnit
+
+		if i+length > len(data) {
+			return nil, decodeError(LayerTypeICMPv6, "Options", i, packetserr.NDPOptionTruncated{Offset: i})
+		}
+
+		opts = append(opts, &NDPOption{
+			Type:   typ,
+			Length: units,
+			Data:   copyBytes(data[i+2 : i+length]),
+		})
+
+		i += length
+	}
+
+	return opts, nil
+}
+
+// Marshal is a method to marshal the NDPOptionSlice to the raw bytes for use in
+// the ICMPv6Message.Marshal() method. The NDPOptionSlice is not modified.
+//
+// The error will be of the packetserr.NDPOptionDataInvalid type if the Data of
+// an option isn't the right size for the 8 byte units of its Length.
+func (ndpos NDPOptionSlice) Marshal() ([]byte, error) {
+	return ndpos.appendNDPOptions(nil)
+}
+
+func (ndpos NDPOptionSlice) appendNDPOptions(b []byte) ([]byte, error) {
+	for index, opt := range ndpos {
+		if opt == nil {
+			continue
+		}
+
+		length := len(opt.Data) + 2
+		units := length / ndpOptionUnit
+
+		if length%ndpOptionUnit != 0 || units > 255 || (opt.Length != 0 && int(opt.Length) != units) {
+			return nil, packetserr.NDPOptionDataInvalid{Index: index}
+		}
+
+		b = append(b, opt.Type, uint8(units))
+		b = append(b, opt.Data...)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestNDPOption_Constructors(c *C) {
+	mac := net.HardwareAddr{0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00}
+
+	//
+	// TEST LINK-LAYER ADDRESS OPTIONS
+	//
+	opt, err := packets.NewSourceLinkLayerAddressOption(mac)
+	c.Assert(err, IsNil)
+	c.Check(opt.Type, Equals, packets.NDPOptionTypeSourceLinkLayerAddress)
+	c.Check(opt.Length, Equals, uint8(1))
+	c.Check(opt.Data, DeepEquals, []byte(mac))
+
+	addr, err := opt.LinkLayerAddress()
+	c.Assert(err, IsNil)
+	c.Check(addr, DeepEquals, mac)
+
+	opt, err = packets.NewTargetLinkLayerAddressOption(mac)
+	c.Assert(err, IsNil)
+	c.Check(opt.Type, Equals, packets.NDPOptionTypeTargetLinkLayerAddress)
+
+	addr, err = opt.LinkLayerAddress()
+	c.Assert(err, IsNil)
+	c.Check(addr, DeepEquals, mac)
+
+	// an address that doesn't fit in a single unit is padded
+	opt, err = packets.NewSourceLinkLayerAddressOption(make(net.HardwareAddr, 8))
+	c.Assert(err, IsNil)
+	c.Check(opt.Length, Equals, uint8(2))
+	c.Check(len(opt.Data), Equals, 14)
+
+	// the largest address the Length field allows
+	opt, err = packets.NewSourceLinkLayerAddressOption(make(net.HardwareAddr, 2038))
+	c.Assert(err, IsNil)
+	c.Check(opt.Length, Equals, uint8(255))
+
+	// TEST packetserr.NDPOptionDataTooLarge
+	opt, err = packets.NewTargetLinkLayerAddressOption(make(net.HardwareAddr, 2039))
+	c.Assert(err, Not(IsNil))
+	c.Check(opt, IsNil)
+	c.Check(err, Equals, packetserr.NDPOptionDataTooLarge{MaxSize: 2038, Len: 2039})
+
+	//
+	// TEST PREFIX INFORMATION OPTION
+	//
+	info := packets.PrefixInformation{
+		Prefix:            netip.MustParsePrefix("2001:db8:0:1::1/64"),
+		OnLink:            true,
+		Autonomous:        true,
+		ValidLifetime:     2592000,
+		PreferredLifetime: 604800,
+	}
+
+	opt, err = packets.NewPrefixInformationOption(info)
+	c.Assert(err, IsNil)
+	c.Check(opt.Type, Equals, packets.NDPOptionTypePrefixInformation)
+	c.Check(opt.Length, Equals, uint8(4))
+	c.Check(opt.Data, DeepEquals, []byte{
+		0x40, 0xc0, 0x00, 0x27, 0x8d, 0x00, 0x00, 0x09, 0x3a, 0x80, 0x00, 0x00,
+		0x00, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	})
+
+	decoded, err := opt.PrefixInformation()
+	c.Assert(err, IsNil)
+
+	// the prefix is masked
+	info.Prefix = netip.MustParsePrefix("2001:db8:0:1::/64")
+	c.Check(decoded, DeepEquals, info)
+
+	opt, err = packets.NewPrefixInformationOption(packets.PrefixInformation{Prefix: netip.MustParsePrefix("10.0.0.0/8")})
+	c.Assert(err, Not(IsNil))
+	c.Check(opt, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "10.0.0.0/8"})
+
+	//
+	// TEST MTU OPTION
+	//
+	opt = packets.NewMTUOption(1500)
+	c.Check(opt.Type, Equals, packets.NDPOptionTypeMTU)
+	c.Check(opt.Length, Equals, uint8(1))
+	c.Check(opt.Data, DeepEquals, []byte{0, 0, 0, 0, 0x05, 0xdc})
+
+	mtu, err := opt.MTU()
+	c.Assert(err, IsNil)
+	c.Check(mtu, Equals, uint32(1500))
+
+	//
+	// TEST packetserr.NDPOptionTypeMismatch
+	//
+	_, err = opt.PrefixInformation()
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.NDPOptionTypeMismatch{Expected: packets.NDPOptionTypePrefixInformation, Type: packets.NDPOptionTypeMTU})
+
+	_, err = opt.LinkLayerAddress()
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.NDPOptionTypeMismatch{Expected: packets.NDPOptionTypeSourceLinkLayerAddress, Type: packets.NDPOptionTypeMTU})
+
+	//
+	// TEST packetserr.NDPOptionLengthInvalid
+	//
+	opt = &packets.NDPOption{Type: packets.NDPOptionTypeMTU, Length: 2, Data: make([]byte, 6)}
+
+	_, err = opt.MTU()
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.NDPOptionLengthInvalid{Type: packets.NDPOptionTypeMTU, Length: 2})
+
+	opt = &packets.NDPOption{Type: packets.NDPOptionTypeMTU, Length: 2, Data: make([]byte, 14)}
+
+	_, err = opt.MTU()
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.NDPOptionLengthInvalid{Type: packets.NDPOptionTypeMTU, Length: 2})
+}
+
+func (t *TestSuite) TestNDPOptionSlice_Accessors(c *C) {
+	mac := net.HardwareAddr{0x00, 0x0c, 0x29, 0x0e, 0x4c, 0x67}
+
+	lladdr, err := packets.NewSourceLinkLayerAddressOption(mac)
+	c.Assert(err, IsNil)
+
+	first, err := packets.NewPrefixInformationOption(packets.PrefixInformation{Prefix: netip.MustParsePrefix("2001:db8::/64")})
+	c.Assert(err, IsNil)
+
+	second, err := packets.NewPrefixInformationOption(packets.PrefixInformation{Prefix: netip.MustParsePrefix("2001:db8:1::/48")})
+	c.Assert(err, IsNil)
+
+	opts := packets.NDPOptionSlice{
+		lladdr,
+		first,
+		nil,
+		{Type: packets.NDPOptionTypePrefixInformation, Length: 1, Data: make([]byte, 6)}, // malformed
+		second,
+		packets.NewMTUOption(1280),
+	}
+
+	c.Check(opts.Option(packets.NDPOptionTypeMTU), Equals, opts[5])
+	c.Check(opts.Option(packets.NDPOptionTypeRedirectedHeader), IsNil)
+
+	addr, ok := opts.SourceLinkLayerAddress()
+	c.Check(ok, Equals, true)
+	c.Check(addr, DeepEquals, mac)
+
+	addr, ok = opts.TargetLinkLayerAddress()
+	c.Check(ok, Equals, false)
+	c.Check(addr, IsNil)
+
+	infos, ok := opts.PrefixInformation()
+	c.Check(ok, Equals, true)
+	c.Assert(len(infos), Equals, 2)
+	c.Check(infos[0].Prefix, Equals, netip.MustParsePrefix("2001:db8::/64"))
+	c.Check(infos[1].Prefix, Equals, netip.MustParsePrefix("2001:db8:1::/48"))
+
+	mtu, ok := opts.MTU()
+	c.Check(ok, Equals, true)
+	c.Check(mtu, Equals, uint32(1280))
+
+	opts = packets.NDPOptionSlice{}
+
+	_, ok = opts.PrefixInformation()
+	c.Check(ok, Equals, false)
+
+	_, ok = opts.MTU()
+	c.Check(ok, Equals, false)
+}
+
+func (t *TestSuite) TestUnmarshalNDPOptionSlice(c *C) {
+	data := []byte{
+		0x01, 0x01, 0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00,
+		0x05, 0x01, 0x00, 0x00, 0x00, 0x00, 0x05, 0xdc,
+	}
+
+	opts, err := packets.UnmarshalNDPOptionSlice(data)
+	c.Assert(err, IsNil)
+	c.Assert(len(opts), Equals, 2)
+
+	c.Check(opts[0].Type, Equals, packets.NDPOptionTypeSourceLinkLayerAddress)
+	c.Check(opts[0].Length, Equals, uint8(1))
+	c.Check(opts[0].Data, DeepEquals, data[2:8])
+	c.Check(opts[1].Type, Equals, packets.NDPOptionTypeMTU)
+
+	// the options don't share the data they were unmarshaled from
+	data[2] = 0xff
+	c.Check(opts[0].Data[0], Equals, uint8(0xc2))
+	data[2] = 0xc2
+
+	marshaled, err := opts.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(marshaled, DeepEquals, data)
+
+	opts, err = packets.UnmarshalNDPOptionSlice(nil)
+	c.Assert(err, IsNil)
+	c.Check(len(opts), Equals, 0)
+
+	//
+	// TEST packetserr.NDPOptionTruncated
+	//
+	opts, err = packets.UnmarshalNDPOptionSlice(data[:9])
+	c.Assert(err, Not(IsNil))
+	c.Check(opts, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "Options",
+		Offset: 8,
+		Err:    packetserr.NDPOptionTruncated{Offset: 8},
+	})
+
+	opts, err = packets.UnmarshalNDPOptionSlice(data[:12])
+	c.Assert(err, Not(IsNil))
+	c.Check(opts, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "Options",
+		Offset: 8,
+		Err:    packetserr.NDPOptionTruncated{Offset: 8},
+	})
+
+	//
+	// TEST packetserr.NDPOptionLengthInvalid
+	//
+	opts, err = packets.UnmarshalNDPOptionSlice([]byte{0x03, 0x00, 0, 0, 0, 0, 0, 0})
+	c.Assert(err, Not(IsNil))
+	c.Check(opts, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "ICMPv6",
+		Field:  "Options",
+		Offset: 1,
+		Err:    packetserr.NDPOptionLengthInvalid{Type: 3, Length: 0},
+	})
+}
+
+func (t *TestSuite) TestNDPOptionSlice_Marshal(c *C) {
+	opts := packets.NDPOptionSlice{
+		{Type: packets.NDPOptionTypeMTU, Data: []byte{0, 0, 0, 0, 0x05, 0x00}},
+		nil,
+	}
+
+	// a zero Length is calculated, without modifying the option
+	data, err := opts.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, []byte{0x05, 0x01, 0, 0, 0, 0, 0x05, 0x00})
+	c.Check(opts[0].Length, Equals, uint8(0))
+
+	//
+	// TEST packetserr.NDPOptionDataInvalid
+	//
+	opts = packets.NDPOptionSlice{
+		packets.NewMTUOption(1500),
+		{Type: packets.NDPOptionTypeMTU, Data: []byte{0, 0, 0, 0, 0x05}},
+	}
+
+	data, err = opts.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.NDPOptionDataInvalid{Index: 1})
+
+	opts = packets.NDPOptionSlice{{Type: packets.NDPOptionTypeMTU, Length: 2, Data: make([]byte, 6)}}
+
+	data, err = opts.Marshal()
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.NDPOptionDataInvalid{Index: 0})
+}
@@ -1,8 +1,9 @@
 package packets
 
 import (
-	"bytes"
 	"encoding/binary"
+	"net/netip"
+	"strings"
 
 	"github.com/theckman/packets/err"
 )
@@ -11,56 +12,187 @@ import (
 // field is either 'tcp' or 'udp' and returns an error if invalid input is given.
 //
 // The returned error type may be packetserr.ChecksumInvalidKind if an invalid
-// kind field is provided.
+// kind field is provided, or packetserr.IPv4AddressInvalid if either of the
+// addresses can't be parsed as an IPv4 address.
 func ChecksumIPv4(data []byte, kind, laddr, raddr string) (uint16, error) {
-	// convert the IP address strings to their byte equivalents
-	srcBytes, dstBytes := ipv4AddrToBytes(laddr), ipv4AddrToBytes(raddr)
+	// convert the IP address strings to their typed equivalents
+	src, err := parseIPv4Addr(laddr)
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := parseIPv4Addr(raddr)
+	if err != nil {
+		return 0, err
+	}
+
+	return ChecksumIPv4Addr(data, kind, src, dst)
+}
+
+// ChecksumIPv4Addr is a function for computing the TCP or UDP checksum of an IPv4
+// packet, the same as ChecksumIPv4 but with the addresses already parsed.
+// IPv4-mapped IPv6 addresses are treated as the IPv4 addresses they contain. The
+// kind field is either 'tcp' or 'udp', and 'icmpv6' is rejected as ICMPv6 is only
+// carried by IPv6.
+//
+// The returned error type may be packetserr.ChecksumInvalidKind if an invalid
+// kind field is provided, or packetserr.IPv4AddressInvalid if either of the
+// addresses isn't an IPv4 address.
+func ChecksumIPv4Addr(data []byte, kind string, laddr, raddr netip.Addr) (uint16, error) {
+	protocol, err := checksumProtocol(kind)
+	if err != nil {
+		return 0, err
+	}
+
+	// ICMPv4 doesn't use a pseudo-header, and
+	// ICMPv6 is only ever carried by IPv6
+	if protocol == IPProtocolICMPv6 {
+		return 0, packetserr.ChecksumInvalidKind
+	}
+
+	srcBytes, ok := ipv4AddrAs4(laddr)
+	if !ok {
+		return 0, packetserr.IPv4AddressInvalid{Address: laddr.String()}
+	}
+
+	dstBytes, ok := ipv4AddrAs4(raddr)
+	if !ok {
+		return 0, packetserr.IPv4AddressInvalid{Address: raddr.String()}
+	}
+
+	// create a pseudo header for the packet checksumming, the zero byte
+	// preceding the protocol is left as it is
+	pHeader := make([]byte, 12, 12+len(data))
+
+	copy(pHeader[0:4], srcBytes[:])
+	copy(pHeader[4:8], dstBytes[:])
+	pHeader[9] = protocol
+	binary.BigEndian.PutUint16(pHeader[10:], uint16(len(data)))
+
+	return InternetChecksum(append(pHeader, data...)), nil
+}
+
+// ChecksumIPv6 is a function for computing the TCP, UDP, or ICMPv6 checksum of an IPv6
+// packet, using the pseudo-header defined in RFC 8200. The kind field is either 'tcp',
+// 'udp', or 'icmpv6' and returns an error if invalid input is given.
+//
+// The returned error type may be packetserr.ChecksumInvalidKind if an invalid
+// kind field is provided, or packetserr.IPv6AddressInvalid if either of the
+// addresses can't be parsed as an IPv6 address.
+func ChecksumIPv6(data []byte, kind, laddr, raddr string) (uint16, error) {
+	// convert the IP address strings to their typed equivalents
+	src, err := parseIPv6Addr(laddr)
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := parseIPv6Addr(raddr)
+	if err != nil {
+		return 0, err
+	}
 
-	var protocol uint8
+	return ChecksumIPv6Addr(data, kind, src, dst)
+}
+
+// ChecksumIPv6Addr is a function for computing the TCP, UDP, or ICMPv6 checksum of an
+// IPv6 packet, the same as ChecksumIPv6 but with the addresses already parsed.
+//
+// The returned error type may be packetserr.ChecksumInvalidKind if an invalid
+// kind field is provided, or packetserr.IPv6AddressInvalid if either of the
+// addresses isn't an IPv6 address.
+func ChecksumIPv6Addr(data []byte, kind string, laddr, raddr netip.Addr) (uint16, error) {
+	protocol, err := checksumProtocol(kind)
+	if err != nil {
+		return 0, err
+	}
+
+	srcBytes, ok := ipv6AddrAs16(laddr)
+	if !ok {
+		return 0, packetserr.IPv6AddressInvalid{Address: laddr.String()}
+	}
+
+	dstBytes, ok := ipv6AddrAs16(raddr)
+	if !ok {
+		return 0, packetserr.IPv6AddressInvalid{Address: raddr.String()}
+	}
+
+	// create a pseudo header for the packet checksumming, the three zero
+	// bytes preceding the next header value are left as they are
+	pHeader := make([]byte, 40, 40+len(data))
+
+	copy(pHeader[0:16], srcBytes[:])
+	copy(pHeader[16:32], dstBytes[:])
+	binary.BigEndian.PutUint32(pHeader[32:], uint32(len(data)))
+	pHeader[39] = protocol
+
+	return InternetChecksum(append(pHeader, data...)), nil
+}
 
+// checksumIPAddr computes the checksum using either the IPv4 or the IPv6
+// pseudo-header, depending on the address family of the addresses provided.
+// IPv4-mapped IPv6 addresses are unmapped first, the same as ChecksumIPv4Addr
+// does, so they use the IPv4 pseudo-header.
+func checksumIPAddr(data []byte, kind string, laddr, raddr netip.Addr) (uint16, error) {
+	laddr, raddr = laddr.Unmap(), raddr.Unmap()
+
+	switch {
+	case laddr.Is6() != raddr.Is6():
+		return 0, packetserr.ChecksumAddressFamilyMismatch
+	case laddr.Is6():
+		return ChecksumIPv6Addr(data, kind, laddr, raddr)
+	default:
+		return ChecksumIPv4Addr(data, kind, laddr, raddr)
+	}
+}
+
+// checksumProtocol converts the kind of checksum to the IP protocol number
+// used within the pseudo-header.
+func checksumProtocol(kind string) (uint8, error) {
 	switch kind {
 	case "tcp", "TCP":
-		protocol = 6
+		return 6, nil
 	case "udp", "UDP":
-		protocol = 17
+		return 17, nil
+	case "icmpv6", "ICMPv6":
+		return IPProtocolICMPv6, nil
 	default:
 		return 0, packetserr.ChecksumInvalidKind
 	}
-
-	// create a pseudo header for the packet checksumming
-	pHeader := new(bytes.Buffer)
-
-	binary.Write(pHeader, binary.BigEndian, srcBytes[0])
-	binary.Write(pHeader, binary.BigEndian, srcBytes[1])
-	binary.Write(pHeader, binary.BigEndian, srcBytes[2])
-	binary.Write(pHeader, binary.BigEndian, srcBytes[3])
-	binary.Write(pHeader, binary.BigEndian, dstBytes[0])
-	binary.Write(pHeader, binary.BigEndian, dstBytes[1])
-	binary.Write(pHeader, binary.BigEndian, dstBytes[2])
-	binary.Write(pHeader, binary.BigEndian, dstBytes[3])
-	binary.Write(pHeader, binary.BigEndian, uint8(0))
-	binary.Write(pHeader, binary.BigEndian, protocol)
-	binary.Write(pHeader, binary.BigEndian, uint16(len(data)))
-	pHeader.Write(data)
-
-	return checksum(pHeader.Bytes()), nil
 }
 
-func checksum(data []byte) uint16 {
-	dataSize := len(data) - 1
+// parseIPv4Addr parses an IPv4 address in dotted decimal form, returning a
+// packetserr.IPv4AddressInvalid error if it's not valid.
+func parseIPv4Addr(addr string) (netip.Addr, error) {
+	a, err := netip.ParseAddr(addr)
+	if err != nil || !a.Is4() {
+		return netip.Addr{}, packetserr.IPv4AddressInvalid{Address: addr}
+	}
 
-	var sum uint32
+	return a, nil
+}
 
-	for i := 0; i+1 < dataSize; i += 2 {
-		sum += uint32(data[i+1])<<8 | uint32(data[i])
+// parseIPv6Addr parses an IPv6 address, returning a packetserr.IPv6AddressInvalid
+// error if it's not valid.
+func parseIPv6Addr(addr string) (netip.Addr, error) {
+	a, err := netip.ParseAddr(addr)
+	if err != nil || !a.Is6() {
+		return netip.Addr{}, packetserr.IPv6AddressInvalid{Address: addr}
 	}
 
-	if dataSize&1 == 1 {
-		sum += uint32(data[dataSize])
+	return a, nil
+}
+
+// parseIPAddr parses either an IPv4 or an IPv6 address, returning the error for
+// the address family the string looks to be if it's not valid.
+func parseIPAddr(addr string) (netip.Addr, error) {
+	if isIPv6AddrString(addr) {
+		return parseIPv6Addr(addr)
 	}
 
-	sum = sum>>16 + sum&0xffff
-	sum = sum + sum>>16
+	return parseIPv4Addr(addr)
+}
 
-	return ^uint16(sum)
+// isIPv6AddrString returns whether the address string looks to be an IPv6 address
+func isIPv6AddrString(addr string) bool {
+	return strings.Contains(addr, ":")
 }
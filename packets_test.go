@@ -7,6 +7,7 @@ package packets_test
 import (
 	"bytes"
 	"encoding/binary"
+	"net/netip"
 	"testing"
 
 	"github.com/theckman/packets"
@@ -17,8 +18,10 @@ import (
 var Te = binary.BigEndian
 
 type TestSuite struct {
-	t *packets.TCPHeader
-	u *packets.UDPHeader
+	t   *packets.TCPHeader
+	u   *packets.UDPHeader
+	ip4 *packets.IPv4Header
+	ip6 *packets.IPv6Header
 }
 
 var _ = Suite(&TestSuite{})
@@ -60,6 +63,26 @@ func (t *TestSuite) SetUpTest(c *C) {
 		Checksum:        0,
 		Payload:         udpPayload,
 	}
+
+	t.ip4 = &packets.IPv4Header{
+		ID:                 4242,
+		DF:                 true,
+		TTL:                64,
+		Protocol:           17,
+		SourceAddress:      netip.MustParseAddr("127.0.0.1"),
+		DestinationAddress: netip.MustParseAddr("127.0.0.2"),
+		Payload:            []byte{42, 128, 0, 0},
+	}
+
+	t.ip6 = &packets.IPv6Header{
+		TrafficClass:       184,
+		FlowLabel:          0xbeef,
+		NextHeader:         17,
+		HopLimit:           64,
+		SourceAddress:      netip.MustParseAddr("fe80::1"),
+		DestinationAddress: netip.MustParseAddr("fe80::2"),
+		Payload:            []byte{42, 128, 0, 0},
+	}
 }
 
 func (t *TestSuite) TestChecksumIPv4(c *C) {
@@ -96,7 +119,7 @@ func (t *TestSuite) TestChecksumIPv4(c *C) {
 
 	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "tcp", "127.0.0.1", "127.0.0.2")
 	c.Assert(err, IsNil)
-	c.Check(csum, Equals, uint16(0xfb59))
+	c.Check(csum, Equals, uint16(0x59fb))
 
 	//
 	// TEST KIND UDP
@@ -125,10 +148,105 @@ func (t *TestSuite) TestChecksumIPv4(c *C) {
 
 	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "udp", "127.0.0.1", "127.0.0.2")
 	c.Assert(err, IsNil)
-	c.Check(csum, Equals, uint16(0xf059))
+	c.Check(csum, Equals, uint16(0x59f0))
 
 	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "invalid", "127.0.0.1", "127.0.0.2")
 	c.Assert(err, Not(IsNil))
 	c.Check(csum, Equals, uint16(0))
 	c.Check(err, Equals, packetserr.ChecksumInvalidKind)
+
+	// ICMPv6 is only carried by IPv6
+	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "icmpv6", "127.0.0.1", "127.0.0.2")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.ChecksumInvalidKind)
+
+	//
+	// TEST INVALID ADDRESSES
+	//
+	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "udp", "10.0.0", "127.0.0.2")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "10.0.0"})
+
+	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "udp", "127.0.0.1", "300.1.1.1")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "300.1.1.1"})
+
+	csum, err = packets.ChecksumIPv4(rawBytes.Bytes(), "udp", "127.0.0.1", "::1")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "::1"})
+}
+
+func (t *TestSuite) TestChecksumIPv4Addr(c *C) {
+	data, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+
+	src, dst := netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2")
+
+	expected, err := packets.ChecksumIPv4(data, "tcp", "127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	csum, err := packets.ChecksumIPv4Addr(data, "tcp", src, dst)
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, expected)
+
+	// IPv4-mapped IPv6 addresses are unmapped
+	csum, err = packets.ChecksumIPv4Addr(data, "tcp", netip.MustParseAddr("::ffff:127.0.0.1"), dst)
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, expected)
+
+	csum, err = packets.ChecksumIPv4Addr(data, "tcp", src, netip.Addr{})
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "invalid IP"})
+}
+
+func (t *TestSuite) TestChecksumIPv6(c *C) {
+	var csum uint16
+	var err error
+
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	csum, err = packets.ChecksumIPv6(data, "udp", "fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, uint16(0xc78a))
+
+	csum, err = packets.ChecksumIPv6(data, "tcp", "fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, uint16(0xc795))
+
+	csum, err = packets.ChecksumIPv6(data, "icmpv6", "fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, uint16(0xc761))
+
+	csum, err = packets.ChecksumIPv6(data, "invalid", "fe80::1", "fe80::2")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.ChecksumInvalidKind)
+
+	csum, err = packets.ChecksumIPv6(data, "udp", "fe80::1", "127.0.0.1")
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "127.0.0.1"})
+}
+
+func (t *TestSuite) TestChecksumIPv6Addr(c *C) {
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	expected, err := packets.ChecksumIPv6(data, "udp", "fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+
+	csum, err := packets.ChecksumIPv6Addr(data, "udp", netip.MustParseAddr("fe80::1"), netip.MustParseAddr("fe80::2"))
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, expected)
+
+	csum, err = packets.ChecksumIPv6Addr(data, "udp", netip.MustParseAddr("fe80::1"), netip.MustParseAddr("127.0.0.1"))
+	c.Assert(err, Not(IsNil))
+	c.Check(csum, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "127.0.0.1"})
 }
@@ -0,0 +1,56 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/theckman/packets/pcap"
+)
+
+func FuzzReader(f *testing.F) {
+	f.Add(bigEndianFile)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := pcap.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		for {
+			rec, err := r.ReadRecord()
+			if err != nil {
+				return
+			}
+
+			if len(rec.Data) > int(pcap.DefaultSnapLen) && len(rec.Data) > int(r.Header().SnapLen) {
+				t.Fatalf("record of %d bytes is larger than the snapshot length", len(rec.Data))
+			}
+		}
+	})
+}
+
+func FuzzNgReader(f *testing.F) {
+	f.Add(pcapngFile)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := pcap.NewNgReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		for {
+			rec, err := r.ReadRecord()
+			if err != nil {
+				return
+			}
+
+			if rec.Interface >= len(r.Interfaces()) {
+				t.Fatalf("record from interface %d, but only %d were described", rec.Interface, len(r.Interfaces()))
+			}
+		}
+	})
+}
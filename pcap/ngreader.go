@@ -0,0 +1,336 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/theckman/packets/err"
+)
+
+// NgReader is a struct for reading the packets of a pcapng file from an
+// io.Reader. The file may hold several sections, each with its own byte order and
+// interfaces, and blocks of types other than those describing the sections,
+// interfaces, and packets are skipped. An NgReader isn't safe for concurrent use.
+type NgReader struct {
+	r          io.Reader
+	section    NgSectionHeader
+	interfaces []NgInterface
+	units      []uint64
+	buf        [ngBlockHeaderLen]byte
+}
+
+// NewNgReader is a function that reads the Section Header Block at the start of
+// the io.Reader, returning an *NgReader to read the blocks following it.
+//
+// The error may be of the packetserr.PcapMagicInvalid type if the data doesn't
+// start with a Section Header Block, or any of the errors returned by
+// ReadRecord() while reading the block.
+func NewNgReader(r io.Reader) (*NgReader, error) {
+	ng := &NgReader{r: r}
+
+	_, body, err := ng.readBlock(binary.LittleEndian, true)
+	if err != nil {
+		return nil, fileTruncated(err, "block")
+	}
+
+	if err := ng.readSectionHeader(body); err != nil {
+		return nil, err
+	}
+
+	return ng, nil
+}
+
+// Section is a method to get the header of the section currently being read.
+func (ng *NgReader) Section() NgSectionHeader {
+	return ng.section
+}
+
+// Interfaces is a method to get the interfaces described so far in the section
+// currently being read. The Interface of each record is an index in to this
+// slice.
+func (ng *NgReader) Interfaces() []NgInterface {
+	return ng.interfaces
+}
+
+// ReadRecord is a method to read the next packet of the file, from either an
+// Enhanced Packet Block or a Simple Packet Block. Any section headers and
+// interface descriptions before it are read along the way. At the end of the
+// file, io.EOF is returned.
+//
+// The error may be of the packetserr.PcapngBlockLengthInvalid type if a block
+// isn't the right size for its contents, packetserr.PcapngBlockTooLarge if it's
+// larger than 16 MiB, packetserr.PcapngInterfaceInvalid if a packet refers to an
+// interface that wasn't described, or packetserr.PcapngResolutionInvalid if an
+// interface has a timestamp resolution that can't be represented. A new section
+// may also return the errors of NewNgReader(), and packetserr.PcapFileTruncated
+// is returned if the file ends part way through a block. Otherwise, it will be
+// from the io.Reader.
+func (ng *NgReader) ReadRecord() (*NgRecord, error) {
+	for {
+		blockType, body, err := ng.readBlock(ng.section.ByteOrder, false)
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case ngBlockTypeSectionHeader:
+			err = ng.readSectionHeader(body)
+		case ngBlockTypeInterfaceDescription:
+			err = ng.readInterfaceDescription(body)
+		case ngBlockTypeEnhancedPacket:
+			return ng.readEnhancedPacket(body)
+		case ngBlockTypeSimplePacket:
+			return ng.readSimplePacket(body)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readBlock reads the next block, returning its type and the body between the
+// lengths. The byte order of a Section Header Block is determined from its body,
+// so the order provided isn't used for it. If the section is set, the block must
+// be a Section Header Block.
+func (ng *NgReader) readBlock(order binary.ByteOrder, section bool) (uint32, []byte, error) {
+	if _, err := io.ReadFull(ng.r, ng.buf[:]); err != nil {
+		// the file may only end between blocks
+		if err != io.EOF {
+			err = fileTruncated(err, "block")
+		}
+
+		return 0, nil, err
+	}
+
+	// the block type of the Section Header Block
+	// reads the same in either byte order
+	blockType := order.Uint32(ng.buf[0:4])
+
+	if section && blockType != ngBlockTypeSectionHeader {
+		return 0, nil, packetserr.PcapMagicInvalid{Magic: binary.BigEndian.Uint32(ng.buf[0:4])}
+	}
+
+	if blockType == ngBlockTypeSectionHeader {
+		// the length of a Section Header Block is written
+		// in the order given by the magic in its body
+		var magic [4]byte
+
+		if _, err := io.ReadFull(ng.r, magic[:]); err != nil {
+			return 0, nil, fileTruncated(err, "block")
+		}
+
+		switch binary.LittleEndian.Uint32(magic[:]) {
+		case ngByteOrderMagic:
+			order = binary.LittleEndian
+		case swapUint32(ngByteOrderMagic):
+			order = binary.BigEndian
+		default:
+			return 0, nil, packetserr.PcapMagicInvalid{Magic: binary.BigEndian.Uint32(magic[:])}
+		}
+
+		ng.section = NgSectionHeader{ByteOrder: order}
+
+		return ng.readBlockBody(order, blockType, magic[:])
+	}
+
+	return ng.readBlockBody(order, blockType, nil)
+}
+
+// readBlockBody reads the rest of the block following its header, and any part of
+// the body that's already been read.
+func (ng *NgReader) readBlockBody(order binary.ByteOrder, blockType uint32, read []byte) (uint32, []byte, error) {
+	blockLen := int(order.Uint32(ng.buf[4:8]))
+
+	if blockLen < ngBlockHeaderLen+ngBlockTrailerLen+len(read) || blockLen%4 != 0 {
+		return 0, nil, packetserr.PcapngBlockLengthInvalid{Type: blockType, Len: blockLen}
+	}
+
+	if blockLen > ngMaxBlockLen {
+		return 0, nil, packetserr.PcapngBlockTooLarge{Type: blockType, MaxSize: ngMaxBlockLen, Len: blockLen}
+	}
+
+	data := make([]byte, blockLen-ngBlockHeaderLen)
+	copy(data, read)
+
+	if _, err := io.ReadFull(ng.r, data[len(read):]); err != nil {
+		return 0, nil, fileTruncated(err, "block")
+	}
+
+	body := data[:len(data)-ngBlockTrailerLen]
+
+	if int(order.Uint32(data[len(body):])) != blockLen {
+		return 0, nil, packetserr.PcapngBlockLengthInvalid{Type: blockType, Len: blockLen}
+	}
+
+	return blockType, body, nil
+}
+
+func (ng *NgReader) readSectionHeader(body []byte) error {
+	if len(body) < ngSectionHeaderLen {
+		return ngBlockLengthInvalid(ngBlockTypeSectionHeader, body)
+	}
+
+	order := ng.section.ByteOrder
+
+	major := order.Uint16(body[4:6])
+	minor := order.Uint16(body[6:8])
+
+	if major != ngVersionMajor {
+		return packetserr.PcapVersionUnsupported{Major: major, Minor: minor}
+	}
+
+	opts, ok := parseNgOptions(order, body[ngSectionHeaderLen:])
+	if !ok {
+		return ngBlockLengthInvalid(ngBlockTypeSectionHeader, body)
+	}
+
+	for _, opt := range opts {
+		switch opt.code {
+		case ngOptionComment:
+			ng.section.Comments = append(ng.section.Comments, ngString(opt.value))
+		case ngOptionHardware:
+			ng.section.Hardware = ngString(opt.value)
+		case ngOptionOS:
+			ng.section.OS = ngString(opt.value)
+		case ngOptionApplication:
+			ng.section.Application = ngString(opt.value)
+		}
+	}
+
+	// the interfaces are only described within a section
+	ng.interfaces, ng.units = nil, nil
+
+	return nil
+}
+
+func (ng *NgReader) readInterfaceDescription(body []byte) error {
+	if len(body) < ngInterfaceDescriptionLen {
+		return ngBlockLengthInvalid(ngBlockTypeInterfaceDescription, body)
+	}
+
+	order := ng.section.ByteOrder
+
+	iface := NgInterface{
+		LinkType:     uint32(order.Uint16(body[0:2])),
+		SnapLen:      order.Uint32(body[4:8]),
+		TSResolution: NgResolutionMicrosecond,
+	}
+
+	opts, ok := parseNgOptions(order, body[ngInterfaceDescriptionLen:])
+	if !ok {
+		return ngBlockLengthInvalid(ngBlockTypeInterfaceDescription, body)
+	}
+
+	for _, opt := range opts {
+		switch opt.code {
+		case ngOptionName:
+			iface.Name = ngString(opt.value)
+		case ngOptionDescription:
+			iface.Description = ngString(opt.value)
+		case ngOptionResolution:
+			if len(opt.value) > 0 {
+				iface.TSResolution = opt.value[0]
+			}
+		}
+	}
+
+	units, err := ngResolutionUnits(iface.TSResolution)
+	if err != nil {
+		return err
+	}
+
+	ng.interfaces = append(ng.interfaces, iface)
+	ng.units = append(ng.units, units)
+
+	return nil
+}
+
+func (ng *NgReader) readEnhancedPacket(body []byte) (*NgRecord, error) {
+	if len(body) < ngEnhancedPacketLen {
+		return nil, ngBlockLengthInvalid(ngBlockTypeEnhancedPacket, body)
+	}
+
+	order := ng.section.ByteOrder
+
+	// the fields are compared before being converted to an int,
+	// which may not be large enough for them on 32-bit platforms
+	index32 := order.Uint32(body[0:4])
+
+	if uint64(index32) >= uint64(len(ng.interfaces)) {
+		return nil, packetserr.PcapngInterfaceInvalid{Index: int(index32)}
+	}
+
+	ts := uint64(order.Uint32(body[4:8]))<<32 | uint64(order.Uint32(body[8:12]))
+	capLen32 := order.Uint32(body[12:16])
+
+	if uint64(capLen32) > uint64(len(body)-ngEnhancedPacketLen) {
+		return nil, ngBlockLengthInvalid(ngBlockTypeEnhancedPacket, body)
+	}
+
+	index, capLen := int(index32), int(capLen32)
+
+	rec := &NgRecord{
+		Record: Record{
+			Timestamp:      ngTimestamp(ts, ng.units[index]),
+			OriginalLength: int(order.Uint32(body[16:20])),
+			Data:           body[ngEnhancedPacketLen : ngEnhancedPacketLen+capLen : ngEnhancedPacketLen+capLen],
+		},
+		Interface: index,
+	}
+
+	// the options follow the padding of the data
+	optsStart := ngEnhancedPacketLen + ngPad(capLen)
+
+	if optsStart > len(body) {
+		optsStart = len(body)
+	}
+
+	opts, ok := parseNgOptions(order, body[optsStart:])
+	if !ok {
+		return nil, ngBlockLengthInvalid(ngBlockTypeEnhancedPacket, body)
+	}
+
+	for _, opt := range opts {
+		if opt.code == ngOptionComment {
+			rec.Comments = append(rec.Comments, ngString(opt.value))
+		}
+	}
+
+	return rec, nil
+}
+
+func (ng *NgReader) readSimplePacket(body []byte) (*NgRecord, error) {
+	if len(ng.interfaces) == 0 {
+		return nil, packetserr.PcapngInterfaceInvalid{Index: 0}
+	}
+
+	if len(body) < ngSimplePacketLen {
+		return nil, ngBlockLengthInvalid(ngBlockTypeSimplePacket, body)
+	}
+
+	origLen := int(ng.section.ByteOrder.Uint32(body[0:4]))
+
+	// the captured length is the smallest of the original
+	// length, the snapshot length, and the block itself
+	capLen := len(body) - ngSimplePacketLen
+
+	if origLen < capLen {
+		capLen = origLen
+	}
+
+	if snapLen := int(ng.interfaces[0].SnapLen); snapLen > 0 && snapLen < capLen {
+		capLen = snapLen
+	}
+
+	return &NgRecord{
+		Record: Record{
+			OriginalLength: origLen,
+			Data:           body[ngSimplePacketLen : ngSimplePacketLen+capLen : ngSimplePacketLen+capLen],
+		},
+	}, nil
+}
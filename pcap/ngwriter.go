@@ -0,0 +1,224 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/theckman/packets/err"
+)
+
+// NgWriter is a struct for writing a section of a pcapng file to an io.Writer.
+// The interfaces must be added before any packets captured on them are written.
+// The writes aren't buffered, so wrapping the io.Writer in a *bufio.Writer is
+// recommended when writing many packets. An NgWriter isn't safe for concurrent
+// use.
+type NgWriter struct {
+	w          io.Writer
+	section    NgSectionHeader
+	interfaces []NgInterface
+	units      []uint64
+}
+
+// NewNgWriter is a function that writes the Section Header Block to the
+// io.Writer, returning an *NgWriter to write the blocks following it. If the
+// ByteOrder of the section is nil, it's written in little endian.
+//
+// The error will be from the io.Writer if the block couldn't be written.
+func NewNgWriter(w io.Writer, section NgSectionHeader) (*NgWriter, error) {
+	if section.ByteOrder == nil {
+		section.ByteOrder = binary.LittleEndian
+	}
+
+	order := section.ByteOrder
+
+	body := ngAppendUint32(nil, order, ngByteOrderMagic)
+	body = ngAppendUint16(body, order, ngVersionMajor)
+	body = ngAppendUint16(body, order, ngVersionMinor)
+	// the length of the section isn't known
+	body = ngAppendUint64(body, order, 0xffffffffffffffff)
+
+	var opts []ngOption
+
+	for _, comment := range section.Comments {
+		opts = ngStringOption(opts, ngOptionComment, comment)
+	}
+
+	opts = ngStringOption(opts, ngOptionHardware, section.Hardware)
+	opts = ngStringOption(opts, ngOptionOS, section.OS)
+	opts = ngStringOption(opts, ngOptionApplication, section.Application)
+
+	ng := &NgWriter{w: w, section: section}
+
+	if err := ng.writeBlock(ngBlockTypeSectionHeader, appendNgOptions(body, order, opts)); err != nil {
+		return nil, err
+	}
+
+	return ng, nil
+}
+
+// Section is a method to get the header the section was written with, including
+// the default ByteOrder.
+func (ng *NgWriter) Section() NgSectionHeader {
+	return ng.section
+}
+
+// Interfaces is a method to get the interfaces added to the section, including
+// any defaults.
+func (ng *NgWriter) Interfaces() []NgInterface {
+	return ng.interfaces
+}
+
+// AddInterface is a method to write the Interface Description Block of an
+// interface, returning its index for the Interface of the records captured on
+// it. Only the lower 16 bits of the LinkType are written.
+//
+// The error may be of the packetserr.PcapngResolutionInvalid type if the
+// TSResolution is too fine for the timestamps to fit in 64 bits. Otherwise, it
+// will be from the io.Writer.
+func (ng *NgWriter) AddInterface(iface NgInterface) (int, error) {
+	if iface.TSResolution == 0 {
+		iface.TSResolution = NgResolutionMicrosecond
+	}
+
+	units, err := ngResolutionUnits(iface.TSResolution)
+	if err != nil {
+		return 0, err
+	}
+
+	order := ng.section.ByteOrder
+
+	body := ngAppendUint16(nil, order, uint16(iface.LinkType))
+	body = ngAppendUint16(body, order, 0)
+	body = ngAppendUint32(body, order, iface.SnapLen)
+
+	var opts []ngOption
+
+	opts = ngStringOption(opts, ngOptionName, iface.Name)
+	opts = ngStringOption(opts, ngOptionDescription, iface.Description)
+
+	// the resolution is only written when it isn't the default
+	if iface.TSResolution != NgResolutionMicrosecond {
+		opts = append(opts, ngOption{code: ngOptionResolution, value: []byte{iface.TSResolution}})
+	}
+
+	if err := ng.writeBlock(ngBlockTypeInterfaceDescription, appendNgOptions(body, order, opts)); err != nil {
+		return 0, err
+	}
+
+	ng.interfaces = append(ng.interfaces, iface)
+	ng.units = append(ng.units, units)
+
+	return len(ng.interfaces) - 1, nil
+}
+
+// WriteRecord is a method to write a packet as an Enhanced Packet Block. If the
+// Data is larger than the snapshot length of the interface it's truncated, and the
+// Timestamp is truncated to the resolution of the interface. The *NgRecord
+// instance is not modified.
+//
+// The error may be of the packetserr.PcapngInterfaceInvalid type if the Interface
+// hasn't been added, packetserr.PcapTimestampInvalid if the Timestamp is before
+// 1970 or too far in the future for the resolution of the interface, or
+// packetserr.PcapngBlockTooLarge if the block would be larger than 16 MiB.
+// Otherwise, it will be from the io.Writer.
+func (ng *NgWriter) WriteRecord(r *NgRecord) error {
+	if r.Interface < 0 || r.Interface >= len(ng.interfaces) {
+		return packetserr.PcapngInterfaceInvalid{Index: r.Interface}
+	}
+
+	ts, err := ngUnits(r.Timestamp, ng.units[r.Interface])
+	if err != nil {
+		return err
+	}
+
+	data, origLen := ng.truncate(r.Interface, &r.Record)
+
+	order := ng.section.ByteOrder
+
+	body := ngAppendUint32(nil, order, uint32(r.Interface))
+	body = ngAppendUint32(body, order, uint32(ts>>32))
+	body = ngAppendUint32(body, order, uint32(ts))
+	body = ngAppendUint32(body, order, uint32(len(data)))
+	body = ngAppendUint32(body, order, uint32(origLen))
+	body = append(body, data...)
+	body = append(body, make([]byte, ngPad(len(data))-len(data))...)
+
+	var opts []ngOption
+
+	for _, comment := range r.Comments {
+		opts = ngStringOption(opts, ngOptionComment, comment)
+	}
+
+	return ng.writeBlock(ngBlockTypeEnhancedPacket, appendNgOptions(body, order, opts))
+}
+
+// WritePacket is a method to write the data of a packet captured on the interface
+// at the time provided, in the same way as WriteRecord().
+func (ng *NgWriter) WritePacket(iface int, ts time.Time, data []byte) error {
+	return ng.WriteRecord(&NgRecord{Record: Record{Timestamp: ts, Data: data}, Interface: iface})
+}
+
+// WriteSimplePacket is a method to write the data of a packet captured on the
+// first interface as a Simple Packet Block, which has no timestamp. If the data is
+// larger than the snapshot length of the interface it's truncated.
+//
+// The error may be of the packetserr.PcapngInterfaceInvalid type if no interfaces
+// have been added, or packetserr.PcapngBlockTooLarge if the block would be larger
+// than 16 MiB. Otherwise, it will be from the io.Writer.
+func (ng *NgWriter) WriteSimplePacket(data []byte) error {
+	if len(ng.interfaces) == 0 {
+		return packetserr.PcapngInterfaceInvalid{Index: 0}
+	}
+
+	data, origLen := ng.truncate(0, &Record{Data: data})
+
+	body := ngAppendUint32(nil, ng.section.ByteOrder, uint32(origLen))
+	body = append(body, data...)
+	body = append(body, make([]byte, ngPad(len(data))-len(data))...)
+
+	return ng.writeBlock(ngBlockTypeSimplePacket, body)
+}
+
+// truncate returns the data of the record truncated to the snapshot length of
+// the interface, and the original length of the packet.
+func (ng *NgWriter) truncate(iface int, r *Record) ([]byte, int) {
+	data := r.Data
+
+	if snapLen := int(ng.interfaces[iface].SnapLen); snapLen > 0 && len(data) > snapLen {
+		data = data[:snapLen]
+	}
+
+	origLen := r.OriginalLength
+
+	if origLen < len(r.Data) {
+		origLen = len(r.Data)
+	}
+
+	return data, origLen
+}
+
+// writeBlock writes a block with the body provided, which must be a multiple of
+// 4 bytes. Blocks larger than the NgReader accepts aren't written.
+func (ng *NgWriter) writeBlock(blockType uint32, body []byte) error {
+	order := ng.section.ByteOrder
+	blockLen := ngBlockHeaderLen + len(body) + ngBlockTrailerLen
+
+	if blockLen > ngMaxBlockLen {
+		return packetserr.PcapngBlockTooLarge{Type: blockType, MaxSize: ngMaxBlockLen, Len: blockLen}
+	}
+
+	b := make([]byte, 0, blockLen)
+	b = ngAppendUint32(b, order, blockType)
+	b = ngAppendUint32(b, order, uint32(blockLen))
+	b = append(b, body...)
+	b = ngAppendUint32(b, order, uint32(blockLen))
+
+	_, err := ng.w.Write(b)
+
+	return err
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+// Package pcap is for reading and writing capture files in the libpcap and pcapng
+// formats, which can be opened by tools like tcpdump and Wireshark. This allows
+// packets built with the packets package to be inspected, and captured packets to
+// be used as test fixtures. The Reader and Writer types handle the libpcap format,
+// and the NgReader and NgWriter types handle the pcapng format.
+//
+// The errors returned by this package, other than those of the io.Reader and
+// io.Writer provided, are from the packetserr package.
+package pcap
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/theckman/packets"
+)
+
+// These are the link types of the packets in a capture file, which determine the
+// first layer of each packet. See https://www.tcpdump.org/linktypes.html for the
+// full list.
+const (
+	LinkTypeNull     uint32 = 0
+	LinkTypeEthernet uint32 = 1
+	LinkTypeRaw      uint32 = 101
+	LinkTypeLinuxSLL uint32 = 113
+	LinkTypeIPv4     uint32 = 228
+	LinkTypeIPv6     uint32 = 229
+)
+
+// DefaultSnapLen is the snapshot length used by the Writer when one isn't
+// provided. It's the same as the default of tcpdump, which captures the whole of
+// any packet.
+const DefaultSnapLen uint32 = 262144
+
+const (
+	magicMicroseconds uint32 = 0xa1b2c3d4
+	magicNanoseconds  uint32 = 0xa1b23c4d
+
+	versionMajor uint16 = 2
+	versionMinor uint16 = 4
+
+	fileHeaderLen   int = 24
+	recordHeaderLen int = 16
+)
+
+// Precision is the resolution of the timestamps of the records in a capture file.
+type Precision uint8
+
+// These are the resolutions that the timestamps can have. Microsecond is the zero
+// value, as it's the resolution of the original format.
+const (
+	Microsecond Precision = iota
+	Nanosecond
+)
+
+// FileHeader is a struct representing the header at the start of a capture file.
+// The ByteOrder is the order the file was written in; when writing, nil means
+// little endian. The SnapLen is the largest amount of data captured from each
+// packet; when writing, 0 means DefaultSnapLen.
+type FileHeader struct {
+	SnapLen   uint32
+	LinkType  uint32
+	Precision Precision
+	ByteOrder binary.ByteOrder
+}
+
+// Record is a struct representing a single packet in a capture file. If the packet
+// was larger than the snapshot length, the Data is truncated and OriginalLength is
+// the length of the packet on the wire. When writing, an OriginalLength smaller
+// than the Data means the length of the Data.
+type Record struct {
+	Timestamp      time.Time
+	OriginalLength int
+	Data           []byte
+}
+
+// LayerType is a function to get the type of the first layer of a packet with the
+// link type provided, for use with packets.Decode(). The data is used to tell
+// IPv4 and IPv6 packets apart for LinkTypeRaw. If the link type isn't one that
+// can be decoded, packets.LayerTypeUnknownPayload is returned.
+func LayerType(linkType uint32, data []byte) packets.LayerType {
+	switch linkType {
+	case LinkTypeEthernet:
+		return packets.LayerTypeEthernet
+	case LinkTypeIPv4:
+		return packets.LayerTypeIPv4
+	case LinkTypeIPv6:
+		return packets.LayerTypeIPv6
+	case LinkTypeRaw:
+		if len(data) > 0 && data[0]>>4 == 6 {
+			return packets.LayerTypeIPv6
+		}
+
+		return packets.LayerTypeIPv4
+	default:
+		return packets.LayerTypeUnknownPayload
+	}
+}
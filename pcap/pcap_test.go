@@ -0,0 +1,279 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	"github.com/theckman/packets/pcap"
+	. "gopkg.in/check.v1"
+)
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func Test(t *testing.T) { TestingT(t) }
+
+// bigEndianFile is a big endian capture file with microsecond timestamps and a
+// snapshot length of 64, holding one raw IP packet that was truncated.
+var bigEndianFile = []byte{
+	0xa1, 0xb2, 0xc3, 0xd4, // magic
+	0x00, 0x02, 0x00, 0x04, // version 2.4
+	0x00, 0x00, 0x00, 0x00, // timezone offset
+	0x00, 0x00, 0x00, 0x00, // timestamp accuracy
+	0x00, 0x00, 0x00, 0x40, // snapshot length
+	0x00, 0x00, 0x00, 0x65, // LinkTypeRaw
+
+	0x56, 0x2a, 0xca, 0x00, // 2015-10-24 00:00:00 UTC
+	0x00, 0x07, 0xa1, 0x20, // 500000 microseconds
+	0x00, 0x00, 0x00, 0x04, // captured length
+	0x00, 0x00, 0x05, 0xdc, // original length
+	0x45, 0x00, 0x05, 0xdc,
+}
+
+var testTimestamp = time.Date(2015, time.October, 24, 0, 0, 0, 123456789, time.UTC)
+
+func (t *TestSuite) TestNewReader(c *C) {
+	r, err := pcap.NewReader(bytes.NewReader(bigEndianFile))
+	c.Assert(err, IsNil)
+
+	header := r.Header()
+	c.Check(header.ByteOrder, Equals, binary.BigEndian)
+	c.Check(header.Precision, Equals, pcap.Microsecond)
+	c.Check(header.SnapLen, Equals, uint32(64))
+	c.Check(header.LinkType, Equals, pcap.LinkTypeRaw)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.Timestamp.Equal(time.Date(2015, time.October, 24, 0, 0, 0, 500000000, time.UTC)), Equals, true)
+	c.Check(rec.OriginalLength, Equals, 1500)
+	c.Check(rec.Data, DeepEquals, []byte{0x45, 0x00, 0x05, 0xdc})
+
+	rec, err = r.ReadRecord()
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, io.EOF)
+
+	//
+	// TEST packetserr.PcapMagicInvalid
+	//
+	r, err = pcap.NewReader(bytes.NewReader([]byte{0x0a, 0x0d, 0x0d, 0x0a, 0x1c, 0x00, 0x00, 0x00, 0x4d, 0x3c, 0x2b, 0x1a, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapMagicInvalid{Magic: 0x0a0d0d0a})
+
+	//
+	// TEST packetserr.PcapVersionUnsupported
+	//
+	data := append([]byte{}, bigEndianFile...)
+	data[5] = 0x01
+
+	r, err = pcap.NewReader(bytes.NewReader(data))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapVersionUnsupported{Major: 1, Minor: 4})
+
+	//
+	// TEST packetserr.PcapFileTruncated
+	//
+	r, err = pcap.NewReader(bytes.NewReader(bigEndianFile[:20]))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapFileTruncated{Part: "file header"})
+	c.Check(errors.Is(err, io.ErrUnexpectedEOF), Equals, true)
+
+	r, err = pcap.NewReader(bytes.NewReader(nil))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapFileTruncated{Part: "file header"})
+}
+
+func (t *TestSuite) TestReader_ReadRecord_Errors(c *C) {
+	//
+	// TEST packetserr.PcapFileTruncated
+	//
+	for _, n := range []int{30, 40, 42} {
+		r, err := pcap.NewReader(bytes.NewReader(bigEndianFile[:n]))
+		c.Assert(err, IsNil)
+
+		rec, err := r.ReadRecord()
+		c.Assert(err, Not(IsNil))
+		c.Check(rec, IsNil)
+		c.Check(err, Equals, packetserr.PcapFileTruncated{Part: "record"})
+	}
+
+	//
+	// TEST packetserr.PcapRecordTooLarge
+	//
+	data := append([]byte{}, bigEndianFile...)
+	data[33] = 0x04 // 262148 bytes captured
+
+	r, err := pcap.NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapRecordTooLarge{MaxSize: 262144, Len: 262148})
+
+	// a captured length too large for an int on 32-bit platforms
+	binary.BigEndian.PutUint32(data[32:36], 0xffffffff)
+
+	r, err = pcap.NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, FitsTypeOf, packetserr.PcapRecordTooLarge{})
+
+	//
+	// TEST MICROSECONDS OUT OF RANGE
+	//
+	data = append([]byte{}, bigEndianFile...)
+	binary.BigEndian.PutUint32(data[28:32], 0xffffffff)
+
+	r, err = pcap.NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	// the fraction doesn't overflow when converted to nanoseconds
+	rec, err = r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.Timestamp, Equals, time.Unix(1445644800, 0xffffffff*1000).UTC())
+}
+
+func (t *TestSuite) TestNewWriter(c *C) {
+	buf := &bytes.Buffer{}
+
+	w, err := pcap.NewWriter(buf, pcap.FileHeader{LinkType: pcap.LinkTypeEthernet})
+	c.Assert(err, IsNil)
+
+	header := w.Header()
+	c.Check(header.SnapLen, Equals, pcap.DefaultSnapLen)
+	c.Check(header.ByteOrder, Equals, binary.LittleEndian)
+	c.Check(header.Precision, Equals, pcap.Microsecond)
+
+	c.Check(buf.Bytes(), DeepEquals, []byte{
+		0xd4, 0xc3, 0xb2, 0xa1,
+		0x02, 0x00, 0x04, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x04, 0x00,
+		0x01, 0x00, 0x00, 0x00,
+	})
+
+	// the microsecond file is written the same way it was read
+	buf.Reset()
+
+	w, err = pcap.NewWriter(buf, pcap.FileHeader{SnapLen: 64, LinkType: pcap.LinkTypeRaw, ByteOrder: binary.BigEndian})
+	c.Assert(err, IsNil)
+
+	err = w.WriteRecord(&pcap.Record{
+		Timestamp:      time.Date(2015, time.October, 24, 0, 0, 0, 500000999, time.UTC),
+		OriginalLength: 1500,
+		Data:           []byte{0x45, 0x00, 0x05, 0xdc},
+	})
+	c.Assert(err, IsNil)
+	c.Check(buf.Bytes(), DeepEquals, bigEndianFile)
+}
+
+func (t *TestSuite) TestWriter_WriteRecord(c *C) {
+	udp := &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53, Payload: []byte("Test")}
+
+	data, err := udp.Marshal()
+	c.Assert(err, IsNil)
+
+	ip := &packets.IPv4Header{
+		IHL:                5,
+		TTL:                64,
+		Protocol:           packets.IPProtocolUDP,
+		SourceAddress:      netip.MustParseAddr("127.0.0.1"),
+		DestinationAddress: netip.MustParseAddr("127.0.0.2"),
+		Payload:            data,
+	}
+
+	data, err = ip.Marshal()
+	c.Assert(err, IsNil)
+
+	// a packet small enough to be captured whole
+	udp = &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53}
+
+	ip.Payload, err = udp.Marshal()
+	c.Assert(err, IsNil)
+
+	small, err := ip.Marshal()
+	c.Assert(err, IsNil)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, precision := range []pcap.Precision{pcap.Microsecond, pcap.Nanosecond} {
+			buf := &bytes.Buffer{}
+
+			w, err := pcap.NewWriter(buf, pcap.FileHeader{
+				SnapLen:   30,
+				LinkType:  pcap.LinkTypeIPv4,
+				Precision: precision,
+				ByteOrder: order,
+			})
+			c.Assert(err, IsNil)
+
+			c.Assert(w.WritePacket(testTimestamp, data), IsNil)
+			c.Assert(w.WritePacket(testTimestamp.Add(time.Second), small), IsNil)
+
+			r, err := pcap.NewReader(buf)
+			c.Assert(err, IsNil)
+			c.Check(r.Header(), DeepEquals, w.Header())
+
+			//
+			// TEST THE TRUNCATED RECORD
+			//
+			rec, err := r.ReadRecord()
+			c.Assert(err, IsNil)
+			c.Check(rec.OriginalLength, Equals, 32)
+			c.Check(rec.Data, DeepEquals, data[:30])
+
+			// the timestamps are truncated to the precision of the file
+			if precision == pcap.Nanosecond {
+				c.Check(rec.Timestamp.Equal(testTimestamp), Equals, true)
+			} else {
+				c.Check(rec.Timestamp.Equal(testTimestamp.Truncate(time.Microsecond)), Equals, true)
+			}
+
+			//
+			// TEST THE WHOLE RECORD
+			//
+			rec, err = r.ReadRecord()
+			c.Assert(err, IsNil)
+			c.Check(rec.OriginalLength, Equals, 28)
+			c.Check(rec.Data, DeepEquals, small)
+
+			packet, err := packets.Decode(rec.Data, packets.LayerTypeIPv4)
+			c.Assert(err, IsNil)
+			c.Check(packet.UDP().SourcePort, Equals, uint16(4242))
+
+			_, err = r.ReadRecord()
+			c.Check(err, Equals, io.EOF)
+		}
+	}
+
+	//
+	// TEST packetserr.PcapTimestampInvalid
+	//
+	w, err := pcap.NewWriter(io.Discard, pcap.FileHeader{})
+	c.Assert(err, IsNil)
+
+	err = w.WritePacket(time.Date(1969, time.December, 31, 23, 59, 59, 0, time.UTC), data)
+	c.Check(err, Equals, packetserr.PcapTimestampInvalid)
+
+	err = w.WritePacket(time.Date(2106, time.February, 8, 0, 0, 0, 0, time.UTC), data)
+	c.Check(err, Equals, packetserr.PcapTimestampInvalid)
+}
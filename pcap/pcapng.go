@@ -0,0 +1,255 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the timestamp resolutions of the interfaces of a pcapng file that are
+// most often used. A resolution is the if_tsresol option of the interface: when
+// the top bit is clear it's a negative power of 10 seconds, otherwise it's a
+// negative power of 2 seconds.
+const (
+	NgResolutionMicrosecond uint8 = 6
+	NgResolutionNanosecond  uint8 = 9
+)
+
+const (
+	ngBlockTypeSectionHeader        uint32 = 0x0a0d0d0a
+	ngBlockTypeInterfaceDescription uint32 = 0x00000001
+	ngBlockTypeSimplePacket         uint32 = 0x00000003
+	ngBlockTypeEnhancedPacket       uint32 = 0x00000006
+
+	ngByteOrderMagic uint32 = 0x1a2b3c4d
+
+	ngVersionMajor uint16 = 1
+	ngVersionMinor uint16 = 0
+
+	ngOptionEndOfOpt    uint16 = 0
+	ngOptionComment     uint16 = 1
+	ngOptionHardware    uint16 = 2 // shb_hardware
+	ngOptionOS          uint16 = 3 // shb_os
+	ngOptionApplication uint16 = 4 // shb_userappl
+	ngOptionName        uint16 = 2 // if_name
+	ngOptionDescription uint16 = 3 // if_description
+	ngOptionResolution  uint16 = 9 // if_tsresol
+
+	ngBlockHeaderLen          int = 8
+	ngBlockTrailerLen         int = 4
+	ngSectionHeaderLen        int = 16 // the fixed fields of the Section Header Block body
+	ngInterfaceDescriptionLen int = 8
+	ngEnhancedPacketLen       int = 20
+	ngSimplePacketLen         int = 4
+	ngMaxBlockLen             int = 16 << 20 // the largest block that's read or written
+)
+
+// NgSectionHeader is a struct representing the Section Header Block that starts
+// each section of a pcapng file. The ByteOrder is the order the section was
+// written in; when writing, nil means little endian. The string fields are the
+// optional descriptions of the hardware, operating system, and application that
+// wrote the section, and are empty if they weren't provided.
+type NgSectionHeader struct {
+	ByteOrder   binary.ByteOrder
+	Hardware    string
+	OS          string
+	Application string
+	Comments    []string
+}
+
+// NgInterface is a struct representing the Interface Description Block of an
+// interface that packets were captured on. A SnapLen of 0 means there was no
+// limit on the amount of data captured from each packet. The TSResolution is the
+// resolution of the timestamps of the interface's packets; when writing, 0 means
+// NgResolutionMicrosecond, which is the default of the format.
+type NgInterface struct {
+	LinkType     uint32
+	SnapLen      uint32
+	Name         string
+	Description  string
+	TSResolution uint8
+}
+
+// NgRecord is a struct representing a packet in a pcapng file, read from an
+// Enhanced Packet Block or Simple Packet Block. The Interface is the index of the
+// interface the packet was captured on, in the order they were described in the
+// section. Simple Packet Blocks are always from the first interface, and have no
+// timestamp or comments.
+type NgRecord struct {
+	Record
+	Interface int
+	Comments  []string
+}
+
+// ngResolutionUnits returns the number of units per second of the resolution.
+func ngResolutionUnits(resolution uint8) (uint64, error) {
+	if resolution&0x80 != 0 {
+		if resolution&0x7f > 63 {
+			return 0, packetserr.PcapngResolutionInvalid{Resolution: resolution}
+		}
+
+		return 1 << (resolution & 0x7f), nil
+	}
+
+	// 10^19 is the largest power of 10 that fits in 64 bits
+	if resolution > 19 {
+		return 0, packetserr.PcapngResolutionInvalid{Resolution: resolution}
+	}
+
+	units := uint64(1)
+
+	for i := uint8(0); i < resolution; i++ {
+		units *= 10
+	}
+
+	return units, nil
+}
+
+// ngTimestamp converts the timestamp of a packet to a time.Time.
+func ngTimestamp(ts, units uint64) time.Time {
+	secs, frac := ts/units, ts%units
+
+	// frac is less than units, so the quotient fits in 64 bits
+	hi, lo := bits.Mul64(frac, uint64(time.Second))
+	nsecs, _ := bits.Div64(hi, lo, units)
+
+	return time.Unix(int64(secs), int64(nsecs)).UTC()
+}
+
+// ngUnits converts a time.Time to the timestamp of a packet.
+func ngUnits(t time.Time, units uint64) (uint64, error) {
+	if t.Unix() < 0 {
+		return 0, packetserr.PcapTimestampInvalid
+	}
+
+	hi, secs := bits.Mul64(uint64(t.Unix()), units)
+
+	fhi, flo := bits.Mul64(uint64(t.Nanosecond()), units)
+	frac, _ := bits.Div64(fhi, flo, uint64(time.Second))
+
+	ts, carry := bits.Add64(secs, frac, 0)
+
+	if hi != 0 || carry != 0 {
+		return 0, packetserr.PcapTimestampInvalid
+	}
+
+	return ts, nil
+}
+
+// ngOption is a single option of a block. The options of each block type have
+// their own meanings for the codes.
+type ngOption struct {
+	code  uint16
+	value []byte
+}
+
+// parseNgOptions parses the options at the end of a block body. The options end
+// at the opt_endofopt option, or the end of the data. If an option runs past the
+// end of the data, false is returned.
+func parseNgOptions(order binary.ByteOrder, data []byte) ([]ngOption, bool) {
+	var opts []ngOption
+
+	for len(data) >= 4 {
+		code := order.Uint16(data[0:2])
+		valueLen := int(order.Uint16(data[2:4]))
+
+		if code == ngOptionEndOfOpt {
+			break
+		}
+
+		paddedLen := ngPad(valueLen)
+
+		if len(data)-4 < paddedLen {
+			// the padding of the last option is sometimes left out
+			if len(data)-4 < valueLen {
+				return nil, false
+			}
+
+			paddedLen = valueLen
+		}
+
+		opts = append(opts, ngOption{code: code, value: data[4 : 4+valueLen]})
+		data = data[4+paddedLen:]
+	}
+
+	return opts, true
+}
+
+// ngBlockLengthInvalid returns the error for a block whose length is too small
+// for its contents.
+func ngBlockLengthInvalid(blockType uint32, body []byte) error {
+	return packetserr.PcapngBlockLengthInvalid{Type: blockType, Len: ngBlockHeaderLen + len(body) + ngBlockTrailerLen}
+}
+
+// appendNgOptions appends the options, followed by the opt_endofopt option if
+// there were any.
+func appendNgOptions(b []byte, order binary.ByteOrder, opts []ngOption) []byte {
+	if len(opts) == 0 {
+		return b
+	}
+
+	for _, opt := range opts {
+		b = ngAppendUint16(b, order, opt.code)
+		b = ngAppendUint16(b, order, uint16(len(opt.value)))
+		b = append(b, opt.value...)
+		b = append(b, make([]byte, ngPad(len(opt.value))-len(opt.value))...)
+	}
+
+	return append(b, 0, 0, 0, 0)
+}
+
+// ngStringOption returns an option holding the string, if it isn't empty and
+// fits in an option.
+func ngStringOption(opts []ngOption, code uint16, s string) []ngOption {
+	if len(s) == 0 {
+		return opts
+	}
+
+	if len(s) > 0xffff {
+		s = s[:0xffff]
+	}
+
+	return append(opts, ngOption{code: code, value: []byte(s)})
+}
+
+// ngString returns the string value of an option, which some tools terminate
+// with a NUL.
+func ngString(value []byte) string {
+	return strings.TrimRight(string(value), "\x00")
+}
+
+// ngAppendUint16 appends the value in the byte order provided.
+func ngAppendUint16(b []byte, order binary.ByteOrder, v uint16) []byte {
+	var buf [2]byte
+	order.PutUint16(buf[:], v)
+
+	return append(b, buf[:]...)
+}
+
+// ngAppendUint32 appends the value in the byte order provided.
+func ngAppendUint32(b []byte, order binary.ByteOrder, v uint32) []byte {
+	var buf [4]byte
+	order.PutUint32(buf[:], v)
+
+	return append(b, buf[:]...)
+}
+
+// ngAppendUint64 appends the value in the byte order provided.
+func ngAppendUint64(b []byte, order binary.ByteOrder, v uint64) []byte {
+	var buf [8]byte
+	order.PutUint64(buf[:], v)
+
+	return append(b, buf[:]...)
+}
+
+// ngPad rounds the length up to a multiple of 4 bytes.
+func ngPad(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,511 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	"github.com/theckman/packets/pcap"
+	. "gopkg.in/check.v1"
+)
+
+// pcapngFile is a little endian pcapng file with an Ethernet interface that has
+// nanosecond timestamps, and one packet with a comment.
+var pcapngFile = []byte{
+	// Section Header Block
+	0x0a, 0x0d, 0x0d, 0x0a, 0x28, 0x00, 0x00, 0x00,
+	0x4d, 0x3c, 0x2b, 0x1a, 0x01, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0x01, 0x00, 0x02, 0x00, 'h', 'i', 0x00, 0x00, // opt_comment
+	0x00, 0x00, 0x00, 0x00,
+	0x28, 0x00, 0x00, 0x00,
+
+	// Interface Description Block
+	0x01, 0x00, 0x00, 0x00, 0x28, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x02, 0x00, 0x04, 0x00, 'e', 't', 'h', '0', // if_name
+	0x09, 0x00, 0x01, 0x00, 0x09, 0x00, 0x00, 0x00, // if_tsresol
+	0x00, 0x00, 0x00, 0x00,
+	0x28, 0x00, 0x00, 0x00,
+
+	// Enhanced Packet Block
+	0x06, 0x00, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+	0x49, 0xf6, 0x0f, 0x14, 0x15, 0xcd, 0xbf, 0x4e, // 1445644800.123456789
+	0x03, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00,
+	0xaa, 0xbb, 0xcc, 0x00,
+	0x01, 0x00, 0x03, 0x00, 'a', 'c', 'k', 0x00, // opt_comment
+	0x00, 0x00, 0x00, 0x00,
+	0x30, 0x00, 0x00, 0x00,
+}
+
+func (t *TestSuite) TestNewNgReader(c *C) {
+	r, err := pcap.NewNgReader(bytes.NewReader(pcapngFile))
+	c.Assert(err, IsNil)
+
+	section := r.Section()
+	c.Check(section.ByteOrder, Equals, binary.LittleEndian)
+	c.Check(section.Comments, DeepEquals, []string{"hi"})
+	c.Check(section.Application, Equals, "")
+	c.Check(len(r.Interfaces()), Equals, 0)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.Interface, Equals, 0)
+	c.Check(rec.Timestamp.Equal(testTimestamp), Equals, true)
+	c.Check(rec.OriginalLength, Equals, 64)
+	c.Check(rec.Data, DeepEquals, []byte{0xaa, 0xbb, 0xcc})
+	c.Check(rec.Comments, DeepEquals, []string{"ack"})
+
+	c.Check(r.Interfaces(), DeepEquals, []pcap.NgInterface{{
+		LinkType:     pcap.LinkTypeEthernet,
+		Name:         "eth0",
+		TSResolution: pcap.NgResolutionNanosecond,
+	}})
+
+	rec, err = r.ReadRecord()
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, io.EOF)
+
+	//
+	// TEST packetserr.PcapMagicInvalid
+	//
+	r, err = pcap.NewNgReader(bytes.NewReader(bigEndianFile))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapMagicInvalid{Magic: 0xa1b2c3d4})
+
+	data := append([]byte{}, pcapngFile...)
+	data[8] = 0x4e
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapMagicInvalid{Magic: 0x4e3c2b1a})
+
+	//
+	// TEST packetserr.PcapVersionUnsupported
+	//
+	data = append([]byte{}, pcapngFile...)
+	data[12] = 0x02
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapVersionUnsupported{Major: 2, Minor: 0})
+
+	//
+	// TEST packetserr.PcapngBlockLengthInvalid
+	//
+	data = append([]byte{}, pcapngFile...)
+	data[4] = 0x22
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockLengthInvalid{Type: 0x0a0d0d0a, Len: 34})
+
+	// the lengths at each end of the block must agree
+	data = append([]byte{}, pcapngFile...)
+	data[36] = 0x20
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, Not(IsNil))
+	c.Check(r, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockLengthInvalid{Type: 0x0a0d0d0a, Len: 40})
+
+	//
+	// TEST packetserr.PcapFileTruncated
+	//
+	for _, n := range []int{0, 6, 10, 30} {
+		r, err = pcap.NewNgReader(bytes.NewReader(pcapngFile[:n]))
+		c.Assert(err, Not(IsNil))
+		c.Check(r, IsNil)
+		c.Check(err, Equals, packetserr.PcapFileTruncated{Part: "block"})
+		c.Check(errors.Is(err, io.ErrUnexpectedEOF), Equals, true)
+	}
+}
+
+func (t *TestSuite) TestNgReader_ReadRecord_Errors(c *C) {
+	//
+	// TEST packetserr.PcapFileTruncated
+	//
+	for _, n := range []int{44, 84, 120} {
+		r, err := pcap.NewNgReader(bytes.NewReader(pcapngFile[:n]))
+		c.Assert(err, IsNil)
+
+		rec, err := r.ReadRecord()
+		c.Assert(err, Not(IsNil))
+		c.Check(rec, IsNil)
+		c.Check(err, Equals, packetserr.PcapFileTruncated{Part: "block"})
+	}
+
+	//
+	// TEST packetserr.PcapngInterfaceInvalid
+	//
+	data := append([]byte{}, pcapngFile...)
+	data[88] = 0x01
+
+	r, err := pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngInterfaceInvalid{Index: 1})
+
+	//
+	// TEST packetserr.PcapngResolutionInvalid
+	//
+	data = append([]byte{}, pcapngFile...)
+	data[68] = 0x14
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngResolutionInvalid{Resolution: 0x14})
+
+	//
+	// TEST packetserr.PcapngBlockLengthInvalid
+	//
+
+	// the captured length runs past the end of the block
+	data = append([]byte{}, pcapngFile...)
+	data[100] = 0x20
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockLengthInvalid{Type: 6, Len: 48})
+
+	// a captured length too large for an int on 32-bit platforms
+	data = append([]byte{}, pcapngFile...)
+	binary.LittleEndian.PutUint32(data[100:104], 0xffffffff)
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockLengthInvalid{Type: 6, Len: 48})
+
+	// an option runs past the end of the block
+	data = append([]byte{}, pcapngFile...)
+	data[114] = 0x09
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockLengthInvalid{Type: 6, Len: 48})
+
+	//
+	// TEST packetserr.PcapngBlockTooLarge
+	//
+	data = append([]byte{}, pcapngFile...)
+	binary.LittleEndian.PutUint32(data[84:88], 16<<20+4)
+
+	r, err = pcap.NewNgReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, Not(IsNil))
+	c.Check(rec, IsNil)
+	c.Check(err, Equals, packetserr.PcapngBlockTooLarge{Type: 6, MaxSize: 16 << 20, Len: 16<<20 + 4})
+}
+
+func (t *TestSuite) TestNewNgWriter(c *C) {
+	buf := &bytes.Buffer{}
+
+	w, err := pcap.NewNgWriter(buf, pcap.NgSectionHeader{Comments: []string{"hi"}})
+	c.Assert(err, IsNil)
+	c.Check(w.Section().ByteOrder, Equals, binary.LittleEndian)
+
+	iface, err := w.AddInterface(pcap.NgInterface{
+		LinkType:     pcap.LinkTypeEthernet,
+		Name:         "eth0",
+		TSResolution: pcap.NgResolutionNanosecond,
+	})
+	c.Assert(err, IsNil)
+	c.Check(iface, Equals, 0)
+
+	err = w.WriteRecord(&pcap.NgRecord{
+		Record: pcap.Record{
+			Timestamp:      testTimestamp,
+			OriginalLength: 64,
+			Data:           []byte{0xaa, 0xbb, 0xcc},
+		},
+		Comments: []string{"ack"},
+	})
+	c.Assert(err, IsNil)
+	c.Check(buf.Bytes(), DeepEquals, pcapngFile)
+
+	//
+	// TEST packetserr.PcapngInterfaceInvalid
+	//
+	err = w.WritePacket(1, testTimestamp, []byte{0xaa})
+	c.Check(err, Equals, packetserr.PcapngInterfaceInvalid{Index: 1})
+
+	w, err = pcap.NewNgWriter(io.Discard, pcap.NgSectionHeader{})
+	c.Assert(err, IsNil)
+
+	err = w.WriteSimplePacket([]byte{0xaa})
+	c.Check(err, Equals, packetserr.PcapngInterfaceInvalid{Index: 0})
+
+	//
+	// TEST packetserr.PcapngResolutionInvalid
+	//
+	iface, err = w.AddInterface(pcap.NgInterface{TSResolution: 0xc0})
+	c.Check(err, Equals, packetserr.PcapngResolutionInvalid{Resolution: 0xc0})
+	c.Check(len(w.Interfaces()), Equals, 0)
+
+	//
+	// TEST packetserr.PcapTimestampInvalid
+	//
+	_, err = w.AddInterface(pcap.NgInterface{TSResolution: pcap.NgResolutionNanosecond})
+	c.Assert(err, IsNil)
+
+	err = w.WritePacket(0, time.Unix(-1, 0), []byte{0xaa})
+	c.Check(err, Equals, packetserr.PcapTimestampInvalid)
+
+	// nanoseconds run out in 2554
+	err = w.WritePacket(0, time.Date(2600, time.January, 1, 0, 0, 0, 0, time.UTC), []byte{0xaa})
+	c.Check(err, Equals, packetserr.PcapTimestampInvalid)
+}
+
+func (t *TestSuite) TestNgWriter_WriteRecord(c *C) {
+	udp := &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53, Payload: []byte("Test")}
+
+	frame, err := udp.Marshal()
+	c.Assert(err, IsNil)
+
+	ip := &packets.IPv4Header{
+		IHL:                5,
+		TTL:                64,
+		Protocol:           packets.IPProtocolUDP,
+		SourceAddress:      netip.MustParseAddr("127.0.0.1"),
+		DestinationAddress: netip.MustParseAddr("127.0.0.2"),
+		Payload:            frame,
+	}
+
+	frame, err = ip.Marshal()
+	c.Assert(err, IsNil)
+
+	eth := &packets.EthernetHeader{
+		DestinationAddress: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		SourceAddress:      []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb},
+		EtherType:          packets.EtherTypeIPv4,
+		Payload:            frame,
+	}
+
+	frame, err = eth.Marshal()
+	c.Assert(err, IsNil)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		buf := &bytes.Buffer{}
+
+		w, err := pcap.NewNgWriter(buf, pcap.NgSectionHeader{
+			ByteOrder:   order,
+			Hardware:    "x86_64",
+			OS:          "Linux",
+			Application: "packets",
+		})
+		c.Assert(err, IsNil)
+
+		// an interface for each kind of timestamp resolution
+		ifaces := []pcap.NgInterface{
+			{LinkType: pcap.LinkTypeEthernet, SnapLen: 16, Description: "truncated"},
+			{LinkType: pcap.LinkTypeRaw, TSResolution: pcap.NgResolutionNanosecond},
+			{LinkType: pcap.LinkTypeEthernet, TSResolution: 0x80 | 10},
+		}
+
+		for i, iface := range ifaces {
+			index, err := w.AddInterface(iface)
+			c.Assert(err, IsNil)
+			c.Check(index, Equals, i)
+		}
+
+		c.Assert(w.WritePacket(0, testTimestamp, frame), IsNil)
+		c.Assert(w.WritePacket(1, testTimestamp, frame[14:]), IsNil)
+		c.Assert(w.WritePacket(2, testTimestamp, frame), IsNil)
+		c.Assert(w.WriteSimplePacket(frame), IsNil)
+
+		r, err := pcap.NewNgReader(buf)
+		c.Assert(err, IsNil)
+		c.Check(r.Section(), DeepEquals, w.Section())
+
+		//
+		// TEST THE MICROSECOND INTERFACE
+		//
+		rec, err := r.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Check(rec.Interface, Equals, 0)
+		c.Check(rec.OriginalLength, Equals, len(frame))
+		c.Check(rec.Data, DeepEquals, frame[:16])
+		c.Check(rec.Timestamp.Equal(testTimestamp.Truncate(time.Microsecond)), Equals, true)
+		c.Check(rec.Comments, IsNil)
+
+		// the defaults are filled in when writing and reading
+		c.Check(r.Interfaces(), DeepEquals, w.Interfaces())
+		c.Check(r.Interfaces()[0].TSResolution, Equals, pcap.NgResolutionMicrosecond)
+
+		//
+		// TEST THE NANOSECOND INTERFACE
+		//
+		rec, err = r.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Check(rec.Interface, Equals, 1)
+		c.Check(rec.Timestamp.Equal(testTimestamp), Equals, true)
+
+		lt := pcap.LayerType(r.Interfaces()[rec.Interface].LinkType, rec.Data)
+		c.Check(lt, Equals, packets.LayerTypeIPv4)
+
+		packet, err := packets.Decode(rec.Data, lt)
+		c.Assert(err, IsNil)
+		c.Check(packet.UDP().SourcePort, Equals, uint16(4242))
+		c.Check(string(packet.UDP().Payload), Equals, "Test")
+
+		//
+		// TEST THE BINARY RESOLUTION INTERFACE
+		//
+		rec, err = r.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Check(rec.Interface, Equals, 2)
+
+		// 1/1024 of a second is 976562.5 nanoseconds
+		c.Check(rec.Timestamp.Sub(testTimestamp) <= 0, Equals, true)
+		c.Check(rec.Timestamp.Sub(testTimestamp) > -976563*time.Nanosecond, Equals, true)
+
+		packet, err = packets.Decode(rec.Data, pcap.LayerType(pcap.LinkTypeEthernet, rec.Data))
+		c.Assert(err, IsNil)
+		c.Check(packet.Ethernet().EtherType, Equals, packets.EtherTypeIPv4)
+
+		//
+		// TEST THE SIMPLE PACKET
+		//
+		rec, err = r.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Check(rec.Interface, Equals, 0)
+		c.Check(rec.Timestamp.IsZero(), Equals, true)
+		c.Check(rec.OriginalLength, Equals, len(frame))
+		c.Check(rec.Data, DeepEquals, frame[:16])
+
+		_, err = r.ReadRecord()
+		c.Check(err, Equals, io.EOF)
+	}
+}
+
+func (t *TestSuite) TestNgWriter_WriteRecord_TooLarge(c *C) {
+	buf := &bytes.Buffer{}
+
+	w, err := pcap.NewNgWriter(buf, pcap.NgSectionHeader{})
+	c.Assert(err, IsNil)
+
+	_, err = w.AddInterface(pcap.NgInterface{LinkType: pcap.LinkTypeRaw})
+	c.Assert(err, IsNil)
+
+	// the largest packet that fits in an Enhanced Packet Block without
+	// options, and the largest block the NgReader accepts
+	data := make([]byte, 16<<20-32)
+	data[len(data)-1] = 0x42
+
+	c.Assert(w.WritePacket(0, testTimestamp, data), IsNil)
+
+	//
+	// TEST packetserr.PcapngBlockTooLarge
+	//
+	n := buf.Len()
+
+	err = w.WritePacket(0, testTimestamp, append(data, 0x00))
+	c.Check(err, Equals, packetserr.PcapngBlockTooLarge{Type: 6, MaxSize: 16 << 20, Len: 16<<20 + 4})
+
+	err = w.WriteSimplePacket(make([]byte, 16<<20-15))
+	c.Check(err, Equals, packetserr.PcapngBlockTooLarge{Type: 3, MaxSize: 16 << 20, Len: 16<<20 + 4})
+
+	// nothing was written for the blocks that are too large
+	c.Check(buf.Len(), Equals, n)
+
+	//
+	// TEST READING THE LARGEST BLOCK BACK
+	//
+	r, err := pcap.NewNgReader(buf)
+	c.Assert(err, IsNil)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.OriginalLength, Equals, len(data))
+	c.Check(bytes.Equal(rec.Data, data), Equals, true)
+
+	_, err = r.ReadRecord()
+	c.Check(err, Equals, io.EOF)
+}
+
+func (t *TestSuite) TestNgReader_Sections(c *C) {
+	buf := &bytes.Buffer{}
+
+	w, err := pcap.NewNgWriter(buf, pcap.NgSectionHeader{})
+	c.Assert(err, IsNil)
+
+	_, err = w.AddInterface(pcap.NgInterface{LinkType: pcap.LinkTypeEthernet})
+	c.Assert(err, IsNil)
+	c.Assert(w.WritePacket(0, testTimestamp, []byte{1}), IsNil)
+
+	// a second section with a different byte order, and a
+	// block of a type that isn't understood between packets
+	w, err = pcap.NewNgWriter(buf, pcap.NgSectionHeader{ByteOrder: binary.BigEndian, Comments: []string{"second"}})
+	c.Assert(err, IsNil)
+
+	_, err = w.AddInterface(pcap.NgInterface{LinkType: pcap.LinkTypeIPv6})
+	c.Assert(err, IsNil)
+
+	buf.Write([]byte{0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x10, 0xde, 0xad, 0xbe, 0xef, 0x00, 0x00, 0x00, 0x10})
+
+	c.Assert(w.WriteSimplePacket([]byte{2}), IsNil)
+
+	r, err := pcap.NewNgReader(buf)
+	c.Assert(err, IsNil)
+
+	rec, err := r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.Data, DeepEquals, []byte{1})
+	c.Check(r.Section().ByteOrder, Equals, binary.LittleEndian)
+	c.Check(r.Interfaces()[0].LinkType, Equals, pcap.LinkTypeEthernet)
+
+	rec, err = r.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Check(rec.Data, DeepEquals, []byte{2})
+	c.Check(r.Section().ByteOrder, Equals, binary.BigEndian)
+	c.Check(r.Section().Comments, DeepEquals, []string{"second"})
+	c.Assert(len(r.Interfaces()), Equals, 1)
+	c.Check(r.Interfaces()[0].LinkType, Equals, pcap.LinkTypeIPv6)
+
+	_, err = r.ReadRecord()
+	c.Check(err, Equals, io.EOF)
+}
+
+func (t *TestSuite) TestLayerType(c *C) {
+	c.Check(pcap.LayerType(pcap.LinkTypeEthernet, nil), Equals, packets.LayerTypeEthernet)
+	c.Check(pcap.LayerType(pcap.LinkTypeIPv4, nil), Equals, packets.LayerTypeIPv4)
+	c.Check(pcap.LayerType(pcap.LinkTypeIPv6, nil), Equals, packets.LayerTypeIPv6)
+	c.Check(pcap.LayerType(pcap.LinkTypeRaw, []byte{0x45}), Equals, packets.LayerTypeIPv4)
+	c.Check(pcap.LayerType(pcap.LinkTypeRaw, []byte{0x60}), Equals, packets.LayerTypeIPv6)
+	c.Check(pcap.LayerType(pcap.LinkTypeLinuxSLL, nil), Equals, packets.LayerTypeUnknownPayload)
+}
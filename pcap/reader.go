@@ -0,0 +1,139 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/theckman/packets/err"
+)
+
+// Reader is a struct for reading the records of a capture file from an io.Reader.
+// Files written in either byte order, and with either timestamp precision, can be
+// read. A Reader isn't safe for concurrent use.
+type Reader struct {
+	r       io.Reader
+	header  FileHeader
+	maxSize int
+	buf     [recordHeaderLen]byte
+}
+
+// NewReader is a function that reads the file header from the io.Reader, returning
+// a *Reader to read the records following it.
+//
+// The error may be of the packetserr.PcapMagicInvalid or
+// packetserr.PcapVersionUnsupported types if the file header isn't valid, or
+// packetserr.PcapFileTruncated if there is less data than the size of the file
+// header. Otherwise, it will be from the io.Reader.
+func NewReader(r io.Reader) (*Reader, error) {
+	buf := make([]byte, fileHeaderLen)
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fileTruncated(err, "file header")
+	}
+
+	var header FileHeader
+
+	switch magic := binary.LittleEndian.Uint32(buf[0:4]); magic {
+	case magicMicroseconds:
+		header.ByteOrder = binary.LittleEndian
+	case magicNanoseconds:
+		header.ByteOrder, header.Precision = binary.LittleEndian, Nanosecond
+	case swapUint32(magicMicroseconds):
+		header.ByteOrder = binary.BigEndian
+	case swapUint32(magicNanoseconds):
+		header.ByteOrder, header.Precision = binary.BigEndian, Nanosecond
+	default:
+		return nil, packetserr.PcapMagicInvalid{Magic: binary.BigEndian.Uint32(buf[0:4])}
+	}
+
+	major := header.ByteOrder.Uint16(buf[4:6])
+	minor := header.ByteOrder.Uint16(buf[6:8])
+
+	if major != versionMajor {
+		return nil, packetserr.PcapVersionUnsupported{Major: major, Minor: minor}
+	}
+
+	header.SnapLen = header.ByteOrder.Uint32(buf[16:20])
+	header.LinkType = header.ByteOrder.Uint32(buf[20:24])
+
+	// some tools write records larger than the snapshot
+	// length, so allow any record that tcpdump would
+	maxSize := int(DefaultSnapLen)
+
+	if int(header.SnapLen) > maxSize {
+		maxSize = int(header.SnapLen)
+	}
+
+	return &Reader{r: r, header: header, maxSize: maxSize}, nil
+}
+
+// Header is a method to get the header the file was written with.
+func (r *Reader) Header() FileHeader {
+	return r.header
+}
+
+// ReadRecord is a method to read the next record of the file. At the end of the
+// file, io.EOF is returned.
+//
+// The error may be of the packetserr.PcapRecordTooLarge type if the record is
+// larger than the snapshot length, or packetserr.PcapFileTruncated if the file
+// ends part way through the record. Otherwise, it will be from the io.Reader.
+func (r *Reader) ReadRecord() (*Record, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		// the file may only end between records
+		if err != io.EOF {
+			err = fileTruncated(err, "record")
+		}
+
+		return nil, err
+	}
+
+	order := r.header.ByteOrder
+
+	secs := order.Uint32(r.buf[0:4])
+	frac := int64(order.Uint32(r.buf[4:8]))
+	capLen := order.Uint32(r.buf[8:12])
+	origLen := int(order.Uint32(r.buf[12:16]))
+
+	// the captured length is compared before being converted to an
+	// int, which may not be large enough for it on 32-bit platforms
+	if uint64(capLen) > uint64(r.maxSize) {
+		return nil, packetserr.PcapRecordTooLarge{MaxSize: r.maxSize, Len: int(capLen)}
+	}
+
+	if r.header.Precision != Nanosecond {
+		frac *= 1000
+	}
+
+	rec := &Record{
+		Timestamp:      time.Unix(int64(secs), frac).UTC(),
+		OriginalLength: origLen,
+		Data:           make([]byte, capLen),
+	}
+
+	if _, err := io.ReadFull(r.r, rec.Data); err != nil {
+		return nil, fileTruncated(err, "record")
+	}
+
+	return rec, nil
+}
+
+// fileTruncated converts io.EOF and io.ErrUnexpectedEOF to the
+// packetserr.PcapFileTruncated type, for errors that occur after part of the
+// file header, a record, or a block has been read.
+func fileTruncated(err error, part string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return packetserr.PcapFileTruncated{Part: part}
+	}
+
+	return err
+}
+
+func swapUint32(v uint32) uint32 {
+	return v>>24 | v>>8&0xff00 | v<<8&0xff0000 | v<<24
+}
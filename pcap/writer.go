@@ -0,0 +1,115 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/theckman/packets/err"
+)
+
+// Writer is a struct for writing the records of a capture file to an io.Writer.
+// The writes aren't buffered, so wrapping the io.Writer in a *bufio.Writer is
+// recommended when writing many records. A Writer isn't safe for concurrent use.
+type Writer struct {
+	w      io.Writer
+	header FileHeader
+	buf    [recordHeaderLen]byte
+}
+
+// NewWriter is a function that writes the file header to the io.Writer, returning
+// a *Writer to write the records following it. Any zero values of the header are
+// replaced with their defaults.
+//
+// The error will be from the io.Writer if the file header couldn't be written.
+func NewWriter(w io.Writer, header FileHeader) (*Writer, error) {
+	if header.SnapLen == 0 {
+		header.SnapLen = DefaultSnapLen
+	}
+
+	if header.ByteOrder == nil {
+		header.ByteOrder = binary.LittleEndian
+	}
+
+	magic := magicMicroseconds
+
+	if header.Precision == Nanosecond {
+		magic = magicNanoseconds
+	}
+
+	buf := make([]byte, fileHeaderLen)
+
+	header.ByteOrder.PutUint32(buf[0:4], magic)
+	header.ByteOrder.PutUint16(buf[4:6], versionMajor)
+	header.ByteOrder.PutUint16(buf[6:8], versionMinor)
+	// the timezone offset and timestamp accuracy are always zero
+	header.ByteOrder.PutUint32(buf[16:20], header.SnapLen)
+	header.ByteOrder.PutUint32(buf[20:24], header.LinkType)
+
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, header: header}, nil
+}
+
+// Header is a method to get the header the file was written with, including any
+// defaults.
+func (w *Writer) Header() FileHeader {
+	return w.header
+}
+
+// WriteRecord is a method to write a record to the file. If the Data is larger
+// than the snapshot length it's truncated. The *Record instance is not modified.
+//
+// The error will be packetserr.PcapTimestampInvalid if the Timestamp is before
+// 1970 or after early 2106, otherwise it will be from the io.Writer.
+func (w *Writer) WriteRecord(r *Record) error {
+	secs := r.Timestamp.Unix()
+
+	if secs < 0 || secs > math.MaxUint32 {
+		return packetserr.PcapTimestampInvalid
+	}
+
+	frac := uint32(r.Timestamp.Nanosecond())
+
+	if w.header.Precision != Nanosecond {
+		frac /= 1000
+	}
+
+	data := r.Data
+
+	if len(data) > int(w.header.SnapLen) {
+		data = data[:w.header.SnapLen]
+	}
+
+	origLen := r.OriginalLength
+
+	if origLen < len(r.Data) {
+		origLen = len(r.Data)
+	}
+
+	w.header.ByteOrder.PutUint32(w.buf[0:4], uint32(secs))
+	w.header.ByteOrder.PutUint32(w.buf[4:8], frac)
+	w.header.ByteOrder.PutUint32(w.buf[8:12], uint32(len(data)))
+	w.header.ByteOrder.PutUint32(w.buf[12:16], uint32(origLen))
+
+	if _, err := w.w.Write(w.buf[:]); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(data)
+
+	return err
+}
+
+// WritePacket is a method to write the data of a packet captured at the time
+// provided, in the same way as WriteRecord().
+func (w *Writer) WritePacket(ts time.Time, data []byte) error {
+	return w.WriteRecord(&Record{Timestamp: ts, Data: data})
+}
@@ -0,0 +1,291 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+
+	"github.com/theckman/packets/err"
+)
+
+// QuotedField is a bitmask of the fields of the TCP or UDP header which were
+// present in the data quoted by an ICMP error message. ICMPv4 routers are only
+// required to quote the first 8 bytes following the IP header, which is enough
+// for the ports and the TCP SeqNum, so the remaining fields are often missing.
+type QuotedField uint16
+
+// These are the fields, or groups of fields, of the TCP and UDP headers that
+// may be present in a QuotedPacket.
+const (
+	QuotedPorts         QuotedField = 1 << iota // SourcePort and DestinationPort
+	QuotedSeqNum                                // TCP SeqNum
+	QuotedAckNum                                // TCP AckNum
+	QuotedControl                               // TCP DataOffset, Reserved, and the control flags
+	QuotedWindowSize                            // TCP WindowSize
+	QuotedChecksum                              // TCP or UDP Checksum
+	QuotedUrgentPointer                         // TCP UrgentPointer
+	QuotedOptions                               // TCP Options
+	QuotedLength                                // UDP Length
+	QuotedPayload                               // TCP or UDP Payload; this may be truncated
+)
+
+// QuotedPacket is a struct representing the packet quoted by an ICMP error
+// message, which is the packet that caused the error. Only one of the IPv4 and
+// IPv6 fields is set, depending on the version of the quoted IP header, and its
+// Payload is the part of the original payload that was quoted.
+//
+// If the quoted packet is a TCP segment or UDP datagram, as much of its header as
+// was quoted is decoded in to the TCP or UDP field. The Fields bitmask says which
+// of their fields were present; any others are left as zero values. Otherwise,
+// such as when the quoted packet is a later fragment, the TCP and UDP fields are
+// both nil.
+type QuotedPacket struct {
+	IPv4   *IPv4Header
+	IPv6   *IPv6Header
+	TCP    *TCPHeader
+	UDP    *UDPHeader
+	Fields QuotedField
+}
+
+// UnmarshalQuotedPacket is a function that takes the data of an ICMPv4 or ICMPv6
+// error message and parses it in to an instance of *QuotedPacket. The quoted IP
+// header must be complete, but the data following it may be truncated at any
+// point.
+//
+// The error is a packetserr.DecodeError wrapping the packetserr.QuotedPacketTruncated
+// type if there is less data than the size of the IP header, or
+// packetserr.QuotedPacketVersionInvalid if it's neither an IPv4 nor IPv6 header. If
+// the version isn't known, the Layer of the packetserr.DecodeError is "IP".
+func UnmarshalQuotedPacket(data []byte) (*QuotedPacket, error) {
+	return unmarshalQuotedPacket(data)
+}
+
+// QuotedPacket is a method to parse the packet quoted by the Data of the message,
+// in the same way as UnmarshalQuotedPacket(). The message must be a Destination
+// Unreachable, Redirect, Time Exceeded, or Parameter Problem message.
+//
+// The error may be of the packetserr.ICMPMessageNotError type if the message is of
+// any other type, or any of the errors returned by UnmarshalQuotedPacket().
+func (icmp *ICMPv4Message) QuotedPacket() (*QuotedPacket, error) {
+	switch icmp.Type {
+	case ICMPv4TypeDestinationUnreachable, ICMPv4TypeRedirect, ICMPv4TypeTimeExceeded, ICMPv4TypeParameterProblem:
+		return unmarshalQuotedPacket(icmp.Data)
+	default:
+		return nil, packetserr.ICMPMessageNotError{Type: icmp.Type}
+	}
+}
+
+// QuotedPacket is a method to parse the packet quoted by the Data of the message,
+// in the same way as UnmarshalQuotedPacket(). The message must be a Destination
+// Unreachable, Packet Too Big, Time Exceeded, or Parameter Problem message.
+//
+// The error may be of the packetserr.ICMPMessageNotError type if the message is of
+// any other type, or any of the errors returned by UnmarshalQuotedPacket().
+func (icmp *ICMPv6Message) QuotedPacket() (*QuotedPacket, error) {
+	switch icmp.Type {
+	case ICMPv6TypeDestinationUnreachable, ICMPv6TypePacketTooBig, ICMPv6TypeTimeExceeded, ICMPv6TypeParameterProblem:
+		return unmarshalQuotedPacket(icmp.Data)
+	default:
+		return nil, packetserr.ICMPMessageNotError{Type: icmp.Type}
+	}
+}
+
+// Has is a method to determine whether all of the fields provided were present
+// in the quoted TCP or UDP header.
+func (q *QuotedPacket) Has(fields QuotedField) bool {
+	return q.Fields&fields == fields
+}
+
+// Protocol is a method to get the IP protocol number of the quoted packet, from
+// the Protocol field of the IPv4 header or the upper-layer protocol following the
+// extension headers of the IPv6 header. If the extension headers weren't quoted in
+// full, the type of the first one that's truncated is returned.
+func (q *QuotedPacket) Protocol() uint8 {
+	if q.IPv6 != nil {
+		protocol, _, _ := q.IPv6.UpperLayerProtocol()
+		return protocol
+	}
+
+	return q.IPv4.Protocol
+}
+
+func unmarshalQuotedPacket(data []byte) (*QuotedPacket, error) {
+	if len(data) == 0 {
+		err := packetserr.QuotedPacketTruncated{ExpectedSize: ipv4HeaderMinSize, Len: len(data)}
+		return nil, packetserr.DecodeError{Layer: "IP", Field: "Version", Err: err}
+	}
+
+	q := &QuotedPacket{}
+
+	var err error
+	var payload []byte
+
+	switch version := data[0] >> 4; version {
+	case 4:
+		headerLen := int(data[0]&0x0f) * 4
+
+		if headerLen < ipv4HeaderMinSize {
+			headerLen = ipv4HeaderMinSize
+		}
+
+		if len(data) < headerLen {
+			err := packetserr.QuotedPacketTruncated{ExpectedSize: headerLen, Len: len(data)}
+			return nil, truncatedError(LayerTypeIPv4, ipv4Fields, len(data), err)
+		}
+
+		if q.IPv4, err = decodeIPv4Header(data, true); err != nil {
+			return nil, err
+		}
+
+		payload = q.IPv4.Payload
+	case 6:
+		if len(data) < ipv6HeaderLen {
+			err := packetserr.QuotedPacketTruncated{ExpectedSize: ipv6HeaderLen, Len: len(data)}
+			return nil, truncatedError(LayerTypeIPv6, ipv6Fields, len(data), err)
+		}
+
+		if q.IPv6, err = decodeIPv6Header(data, true); err != nil {
+			return nil, err
+		}
+
+		// the TCP or UDP header follows any extension headers
+		_, offset, _ := q.IPv6.UpperLayerProtocol()
+		payload = q.IPv6.Payload[offset:]
+	default:
+		err := packetserr.QuotedPacketVersionInvalid{Version: version}
+		return nil, packetserr.DecodeError{Layer: "IP", Field: "Version", Err: err}
+	}
+
+	// only the first fragment of a packet starts with the TCP or UDP header
+	if q.IPv4 != nil && q.IPv4.FragmentOffset != 0 {
+		return q, nil
+	}
+
+	switch q.Protocol() {
+	case IPProtocolTCP:
+		q.TCP, q.Fields = decodeQuotedTCPHeader(payload)
+	case IPProtocolUDP:
+		q.UDP, q.Fields = decodeQuotedUDPHeader(payload)
+	}
+
+	return q, nil
+}
+
+// decodeQuotedTCPHeader decodes as much of the TCP header as is present in the
+// data. The data is already a copy, so the header may reference it. If not even
+// the ports are present, nil is returned.
+func decodeQuotedTCPHeader(data []byte) (*TCPHeader, QuotedField) {
+	if len(data) < 4 {
+		return nil, 0
+	}
+
+	// if the whole header was quoted it can be decoded
+	// as usual, and whatever follows it is the payload
+	var tcp TCPHeader
+
+	if err := tcp.DecodeFromBytes(data); err == nil {
+		fields := QuotedPorts | QuotedSeqNum | QuotedAckNum | QuotedControl |
+			QuotedWindowSize | QuotedChecksum | QuotedUrgentPointer | QuotedOptions
+
+		if len(tcp.Payload) > 0 {
+			fields |= QuotedPayload
+		}
+
+		return &tcp, fields
+	}
+
+	tcp = TCPHeader{
+		SourcePort:      binary.BigEndian.Uint16(data[0:2]),
+		DestinationPort: binary.BigEndian.Uint16(data[2:4]),
+	}
+
+	fields := QuotedPorts
+
+	if len(data) >= 8 {
+		tcp.SeqNum = binary.BigEndian.Uint32(data[4:8])
+		fields |= QuotedSeqNum
+	}
+
+	if len(data) >= 12 {
+		tcp.AckNum = binary.BigEndian.Uint32(data[8:12])
+		fields |= QuotedAckNum
+	}
+
+	if len(data) >= 14 {
+		ctrl := binary.BigEndian.Uint16(data[12:14])
+
+		tcp.DataOffset = uint8(ctrl >> 12)
+		tcp.Reserved = uint8(ctrl >> 9 & 7)
+		tcp.NS = ctrlBitValue(ctrl, nsBit)
+		tcp.CWR = ctrlBitValue(ctrl, cwrBit)
+		tcp.ECE = ctrlBitValue(ctrl, eceBit)
+		tcp.URG = ctrlBitValue(ctrl, urgBit)
+		tcp.ACK = ctrlBitValue(ctrl, ackBit)
+		tcp.PSH = ctrlBitValue(ctrl, pshBit)
+		tcp.RST = ctrlBitValue(ctrl, rstBit)
+		tcp.SYN = ctrlBitValue(ctrl, synBit)
+		tcp.FIN = ctrlBitValue(ctrl, finBit)
+		fields |= QuotedControl
+	}
+
+	if len(data) >= 16 {
+		tcp.WindowSize = binary.BigEndian.Uint16(data[14:16])
+		tcp.ZeroWindow = tcp.WindowSize == 0
+		fields |= QuotedWindowSize
+	}
+
+	if len(data) >= 18 {
+		tcp.Checksum = binary.BigEndian.Uint16(data[16:18])
+		fields |= QuotedChecksum
+	}
+
+	if len(data) >= 20 {
+		tcp.UrgentPointer = binary.BigEndian.Uint16(data[18:20])
+		fields |= QuotedUrgentPointer
+	}
+
+	return &tcp, fields
+}
+
+// decodeQuotedUDPHeader decodes as much of the UDP header as is present in the
+// data. The data is already a copy, so the header may reference it. If not even
+// the ports are present, nil is returned.
+func decodeQuotedUDPHeader(data []byte) (*UDPHeader, QuotedField) {
+	if len(data) < 4 {
+		return nil, 0
+	}
+
+	udp := &UDPHeader{
+		SourcePort:      binary.BigEndian.Uint16(data[0:2]),
+		DestinationPort: binary.BigEndian.Uint16(data[2:4]),
+	}
+
+	fields := QuotedPorts
+
+	if len(data) >= 6 {
+		udp.Length = binary.BigEndian.Uint16(data[4:6])
+		fields |= QuotedLength
+	}
+
+	if len(data) >= udpHeaderLen {
+		udp.Checksum = binary.BigEndian.Uint16(data[6:8])
+		fields |= QuotedChecksum
+
+		// the payload is cut short by either the
+		// Length field or the end of the quote
+		end := len(data)
+
+		if int(udp.Length) >= udpHeaderLen && int(udp.Length) < end {
+			end = int(udp.Length)
+		}
+
+		if end > udpHeaderLen {
+			udp.Payload = data[udpHeaderLen:end:end]
+			fields |= QuotedPayload
+		}
+	}
+
+	return udp, fields
+}
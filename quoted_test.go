@@ -0,0 +1,272 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"net/netip"
+
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestICMPv4Message_QuotedPacket(c *C) {
+	icmp, err := packets.UnmarshalICMPv4Message(icmpUnreachableFrame[34:])
+	c.Assert(err, IsNil)
+
+	q, err := icmp.QuotedPacket()
+	c.Assert(err, IsNil)
+
+	c.Assert(q.IPv4, Not(IsNil))
+	c.Check(q.IPv6, IsNil)
+	c.Check(q.Protocol(), Equals, packets.IPProtocolUDP)
+	c.Check(q.IPv4.TotalLength, Equals, uint16(77))
+	c.Check(q.IPv4.SourceAddress, Equals, netip.MustParseAddr("172.29.20.15"))
+	c.Check(q.IPv4.DestinationAddress, Equals, netip.MustParseAddr("10.66.73.201"))
+	c.Check(len(q.IPv4.Payload), Equals, 8)
+
+	// only the UDP header was quoted
+	c.Check(q.TCP, IsNil)
+	c.Assert(q.UDP, Not(IsNil))
+	c.Check(q.UDP.SourcePort, Equals, uint16(36556))
+	c.Check(q.UDP.DestinationPort, Equals, uint16(25313))
+	c.Check(q.UDP.Length, Equals, uint16(57))
+	c.Check(q.UDP.Checksum, Equals, uint16(0x769d))
+	c.Check(q.UDP.Payload, IsNil)
+
+	c.Check(q.Fields, Equals, packets.QuotedPorts|packets.QuotedLength|packets.QuotedChecksum)
+	c.Check(q.Has(packets.QuotedPorts|packets.QuotedChecksum), Equals, true)
+	c.Check(q.Has(packets.QuotedPorts|packets.QuotedPayload), Equals, false)
+
+	// the quote may be truncated in the UDP header
+	q, err = packets.UnmarshalQuotedPacket(icmp.Data[:26])
+	c.Assert(err, IsNil)
+	c.Check(q.Fields, Equals, packets.QuotedPorts|packets.QuotedLength)
+	c.Check(q.UDP.Length, Equals, uint16(57))
+	c.Check(q.UDP.Checksum, Equals, uint16(0))
+
+	q, err = packets.UnmarshalQuotedPacket(icmp.Data[:22])
+	c.Assert(err, IsNil)
+	c.Check(q.Fields, Equals, packets.QuotedField(0))
+	c.Check(q.UDP, IsNil)
+
+	//
+	// TEST packetserr.ICMPMessageNotError
+	//
+	icmp = &packets.ICMPv4Message{Type: packets.ICMPv4TypeEchoReply, Data: icmp.Data}
+
+	q, err = icmp.QuotedPacket()
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.ICMPMessageNotError{Type: packets.ICMPv4TypeEchoReply})
+}
+
+func (t *TestSuite) TestUnmarshalQuotedPacket_TCP(c *C) {
+	t.t.Options = packets.TCPOptionSlice{{Kind: 2, Length: 4, Data: []byte{0x05, 0xb4}}}
+	t.t.Payload = []byte("Test")
+
+	tcp, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+
+	t.ip4.Protocol = packets.IPProtocolTCP
+	t.ip4.Payload = tcp
+
+	data, err := t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	//
+	// TEST THE WHOLE PACKET BEING QUOTED
+	//
+	q, err := packets.UnmarshalQuotedPacket(data)
+	c.Assert(err, IsNil)
+	c.Check(q.UDP, IsNil)
+	c.Assert(q.TCP, Not(IsNil))
+
+	c.Check(q.Has(packets.QuotedOptions|packets.QuotedPayload|packets.QuotedUrgentPointer), Equals, true)
+	c.Check(q.Has(packets.QuotedLength), Equals, false)
+	c.Check(q.TCP.SourcePort, Equals, uint16(44273))
+	c.Check(q.TCP.SYN, Equals, true)
+	c.Check(q.TCP.WindowSize, Equals, uint16(43690))
+	c.Check(len(q.TCP.Options), Equals, 1)
+	c.Check(string(q.TCP.Payload), Equals, "Test")
+
+	//
+	// TEST THE FIRST 8 BYTES BEING QUOTED
+	//
+	q, err = packets.UnmarshalQuotedPacket(data[:28])
+	c.Assert(err, IsNil)
+	c.Check(q.Fields, Equals, packets.QuotedPorts|packets.QuotedSeqNum)
+	c.Check(q.TCP.SourcePort, Equals, uint16(44273))
+	c.Check(q.TCP.DestinationPort, Equals, uint16(22))
+	c.Check(q.TCP.SeqNum, Equals, uint32(42))
+	c.Check(q.TCP.SYN, Equals, false)
+
+	//
+	// TEST PART OF THE HEADER BEING QUOTED
+	//
+	q, err = packets.UnmarshalQuotedPacket(data[:34])
+	c.Assert(err, IsNil)
+	c.Check(q.Fields, Equals, packets.QuotedPorts|packets.QuotedSeqNum|packets.QuotedAckNum|packets.QuotedControl)
+	c.Check(q.TCP.DataOffset, Equals, uint8(6))
+	c.Check(q.TCP.SYN, Equals, true)
+	c.Check(q.TCP.PSH, Equals, true)
+	c.Check(q.TCP.WindowSize, Equals, uint16(0))
+
+	// the fixed header is present, but the options are not
+	q, err = packets.UnmarshalQuotedPacket(data[:42])
+	c.Assert(err, IsNil)
+	c.Check(q.Has(packets.QuotedUrgentPointer), Equals, true)
+	c.Check(q.Has(packets.QuotedOptions), Equals, false)
+	c.Check(q.TCP.Options, IsNil)
+
+	//
+	// TEST A LATER FRAGMENT BEING QUOTED
+	//
+	t.ip4.FragmentOffset = 185
+
+	data, err = t.ip4.Marshal()
+	c.Assert(err, IsNil)
+
+	q, err = packets.UnmarshalQuotedPacket(data[:28])
+	c.Assert(err, IsNil)
+	c.Check(q.IPv4.FragmentOffset, Equals, uint16(185))
+	c.Check(q.TCP, IsNil)
+	c.Check(q.Fields, Equals, packets.QuotedField(0))
+}
+
+func (t *TestSuite) TestICMPv6Message_QuotedPacket(c *C) {
+	udp, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	t.ip6.Payload = udp
+
+	ip, err := t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	icmp := &packets.ICMPv6Message{
+		Type: packets.ICMPv6TypePacketTooBig,
+		MTU:  1280,
+		Data: ip,
+	}
+
+	q, err := icmp.QuotedPacket()
+	c.Assert(err, IsNil)
+	c.Check(q.IPv4, IsNil)
+	c.Assert(q.IPv6, Not(IsNil))
+	c.Check(q.Protocol(), Equals, packets.IPProtocolUDP)
+	c.Check(q.IPv6.SourceAddress, Equals, netip.MustParseAddr("fe80::1"))
+
+	c.Check(q.Has(packets.QuotedPorts|packets.QuotedLength|packets.QuotedChecksum|packets.QuotedPayload), Equals, true)
+	c.Check(q.UDP.SourcePort, Equals, uint16(4242))
+	c.Check(q.UDP.DestinationPort, Equals, uint16(53))
+	c.Check(q.UDP.Payload, DeepEquals, []byte{42, 128, 0, 0})
+
+	// the payload is cut short by the end of the quote
+	q, err = packets.UnmarshalQuotedPacket(ip[:50])
+	c.Assert(err, IsNil)
+	c.Check(q.IPv6.PayloadLength, Equals, uint16(12))
+	c.Check(q.UDP.Length, Equals, uint16(12))
+	c.Check(q.UDP.Payload, DeepEquals, []byte{42, 128})
+
+	//
+	// TEST EXTENSION HEADERS BEFORE THE UDP HEADER
+	//
+	t.ip6.NextHeader = packets.IPProtocolIPv6HopByHop
+	t.ip6.Payload = append(append([]byte{}, ipv6ExtensionChain...), udp...)
+
+	ip, err = t.ip6.Marshal()
+	c.Assert(err, IsNil)
+
+	q, err = packets.UnmarshalQuotedPacket(ip)
+	c.Assert(err, IsNil)
+	c.Check(q.Protocol(), Equals, packets.IPProtocolUDP)
+	c.Assert(q.UDP, Not(IsNil))
+	c.Check(q.UDP.DestinationPort, Equals, uint16(53))
+
+	// the quote ends within the extension headers
+	q, err = packets.UnmarshalQuotedPacket(ip[:52])
+	c.Assert(err, IsNil)
+	c.Check(q.Protocol(), Equals, packets.IPProtocolIPv6Fragment)
+	c.Check(q.UDP, IsNil)
+
+	//
+	// TEST packetserr.ICMPMessageNotError
+	//
+	icmp.Type = packets.ICMPv6TypeEchoRequest
+
+	q, err = icmp.QuotedPacket()
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.ICMPMessageNotError{Type: packets.ICMPv6TypeEchoRequest})
+}
+
+func (t *TestSuite) TestUnmarshalQuotedPacket_Errors(c *C) {
+	//
+	// TEST packetserr.QuotedPacketTruncated
+	//
+	q, err := packets.UnmarshalQuotedPacket(nil)
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IP",
+		Field:  "Version",
+		Offset: 0,
+		Err:    packetserr.QuotedPacketTruncated{ExpectedSize: 20, Len: 0},
+	})
+
+	q, err = packets.UnmarshalQuotedPacket(icmpUnreachableFrame[42:60])
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "DestinationAddress",
+		Offset: 16,
+		Err:    packetserr.QuotedPacketTruncated{ExpectedSize: 20, Len: 18},
+	})
+
+	// the IPv4 options must be quoted in full
+	data := append([]byte{0x46}, make([]byte, 22)...)
+
+	q, err = packets.UnmarshalQuotedPacket(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv4",
+		Field:  "Options",
+		Offset: 20,
+		Err:    packetserr.QuotedPacketTruncated{ExpectedSize: 24, Len: 23},
+	})
+
+	q, err = packets.UnmarshalQuotedPacket(append([]byte{0x60}, make([]byte, 38)...))
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IPv6",
+		Field:  "DestinationAddress",
+		Offset: 24,
+		Err:    packetserr.QuotedPacketTruncated{ExpectedSize: 40, Len: 39},
+	})
+
+	//
+	// TEST packetserr.QuotedPacketVersionInvalid
+	//
+	q, err = packets.UnmarshalQuotedPacket(append([]byte{0x55}, make([]byte, 39)...))
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "IP",
+		Field:  "Version",
+		Offset: 0,
+		Err:    packetserr.QuotedPacketVersionInvalid{Version: 5},
+	})
+
+	//
+	// TEST packetserr.IPv4IHLInvalid
+	//
+	q, err = packets.UnmarshalQuotedPacket(append([]byte{0x44}, make([]byte, 27)...))
+	c.Assert(err, Not(IsNil))
+	c.Check(q, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "IPv4", Field: "IHL", Offset: 0, Err: packetserr.IPv4IHLInvalid})
+}
@@ -5,11 +5,8 @@
 package packets
 
 import (
-	"bytes"
 	"encoding/binary"
-	"math"
-	"strconv"
-	"strings"
+	"net/netip"
 
 	"github.com/theckman/packets/err"
 )
@@ -27,10 +24,14 @@ const (
 	synBit uint16 = 2   // SYN
 	finBit uint16 = 1   // FIN
 
-	tcpHeaderMinSize int = 20
-	tcpOptsMaxSize   int = 40
+	tcpHeaderMinSize  int = 20
+	tcpOptsMaxSize    int = 40
+	tcpChecksumOffset int = 16
 )
 
+// zeroes is used to pad the marshaled headers without allocating
+var zeroes [tcpHeaderMinSize + tcpOptsMaxSize]byte
+
 // TCPOption is a struct to hold the data for the various options available for the TCP
 // header. See this Wikipedia article for more information:
 //
@@ -42,7 +43,7 @@ const (
 // one byte).
 //
 //As a convenience, if the Length is set to zero it will be automatically
-// calculated and set at the time of marshaling.
+// calculated at the time of marshaling. The *TCPOption instance is not modified.
 type TCPOption struct {
 	Kind   uint8
 	Length uint8
@@ -53,12 +54,16 @@ type TCPOption struct {
 // Options field.
 type TCPOptionSlice []*TCPOption
 
-// TCPHeader is a struct representing a TCP header. The options portion
-// of the TCP header is not implemented in this struct.
+// TCPHeader is a struct representing a TCP header, along with the data
+// carried by the segment in the Payload field.
 //
 // This struct is a simplified representation of a TCP header. This includes
 // making the control (CTRL) bits boolean fields, instead of forcing users of
 // this package to do their own bitshifting.
+//
+// Marshaling never modifies the *TCPHeader instance, so it's safe to marshal the
+// same header from multiple goroutines at once, such as a template that segments
+// are built from, as long as nothing modifies it at the same time.
 type TCPHeader struct {
 	SourcePort      uint16
 	DestinationPort uint16
@@ -75,14 +80,24 @@ type TCPHeader struct {
 	RST             bool
 	SYN             bool
 	FIN             bool
-	WindowSize      uint16 // if set to 0 this becomes 65535
+	WindowSize      uint16 // if set to 0 this becomes 65535, unless ZeroWindow is set
 	Checksum        uint16 // suggest setting this to 0 thus offloading to the kernel
 	UrgentPointer   uint16
 	Options         TCPOptionSlice // optional TCP options; see TCPOption comment for more info
+	Payload         []byte         // the data following the header, if any
+	ZeroWindow      bool           // marshal a WindowSize of 0 as is, for a zero-window segment
+	RawOptions      []byte         // the options as they were decoded, if set; see VerifyChecksum()
 }
 
 // UnmarshalTCPHeader is a function that takes a byte slice and parses it in to an
-// instance of *TCPHeader. This also assumes the packet is properly formatted.
+// instance of *TCPHeader. The DataOffset field is used to split the options from
+// the Payload, which is everything following the header.
+//
+// The data is validated before being parsed, so this is safe to use on data from
+// untrusted sources. The error is a packetserr.DecodeError wrapping the
+// packetserr.TCPHeaderTruncated type if there is less data than the DataOffset
+// specifies, packetserr.TCPDataOffsetInvalid, or any of the errors returned by
+// UnmarshalTCPOptionSlice. Its Offset is counted from the start of the header.
 func UnmarshalTCPHeader(data []byte) (*TCPHeader, error) {
 	return unmarshalTCPHeader(data)
 }
@@ -91,11 +106,15 @@ func UnmarshalTCPHeader(data []byte) (*TCPHeader, error) {
 // without explicitly calculating the checksum for the data. Because there is no
 // checksumming of the data, the local and remote addresses are not required.
 //
+// The Payload, if any, is included in the marshaled data after the header.
+//
 // To note, if the checksum is not provided (i.e. 0) the kernel SHOULD automatically
 // calculate this for you.
 //
 // However, if the *TCPHeader instance has the Checksum field set, it will be
-// included in the marshaled data.
+// included in the marshaled data. If the DataOffset or WindowSize fields are zero
+// they're filled in within the marshaled data; the *TCPHeader instance is not
+// modified.
 //
 // The error field may be of packetserr.TCPDataOffsetInvalid,
 // packetserr.TCPDataOffsetTooSmall, packetserr.TCPOptionDataTooLong, or
@@ -106,15 +125,46 @@ func (tcp *TCPHeader) Marshal() ([]byte, error) {
 
 // MarshalWithChecksum is a function to marshal the TCPHeader to a byte slice.
 // This function is almost the same as Marshal() However, this calculates also
-// the TCP checksum and adds it to the header / marshaled data.
+// the TCP checksum and adds it to the marshaled data. The checksum covers the
+// whole segment, including the Payload. The *TCPHeader instance is not modified,
+// and the Checksum field is ignored.
 //
 // It's suggested that you use Marshal() instead and offload the
 // checksumming to your kernel (which should do it automatically if field is zero).
 //
+// The local and remote addresses may either be IPv4 or IPv6 addresses, and the
+// pseudo-header used for the checksum is chosen based on their address family.
+// Both addresses must be of the same family, otherwise the error will be
+// packetserr.ChecksumAddressFamilyMismatch.
+//
 // The error field may be of packetserr.TCPDataOffsetInvalid,
 // packetserr.TCPDataOffsetTooSmall, packetserr.TCPOptionDataTooLong, or
 // packetserr.TCPOptionDataInvalid types. See their documentation for more information.
+//
+// If either address can't be parsed the error will be of the
+// packetserr.IPv4AddressInvalid or packetserr.IPv6AddressInvalid types.
 func (tcp *TCPHeader) MarshalWithChecksum(laddr, raddr string) ([]byte, error) {
+	src, err := parseIPAddr(laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseIPAddr(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return tcp.MarshalWithChecksumAddr(src, dst)
+}
+
+// MarshalWithChecksumAddr is a function to marshal the TCPHeader to a byte slice,
+// including the calculation of the TCP checksum. It's the same as MarshalWithChecksum()
+// except that the local and remote addresses are provided as netip.Addr values.
+//
+// The pseudo-header used for the checksum is chosen based on the address family
+// of the addresses, which must match. IPv4-mapped IPv6 addresses are treated as
+// the IPv4 addresses they contain.
+func (tcp *TCPHeader) MarshalWithChecksumAddr(laddr, raddr netip.Addr) ([]byte, error) {
 	// marshal the header
 	data, err := tcp.marshalTCPHeader()
 
@@ -122,88 +172,227 @@ func (tcp *TCPHeader) MarshalWithChecksum(laddr, raddr string) ([]byte, error) {
 		return nil, err
 	}
 
-	// calculate the checksum using the data that was marshaled
-	csum, err := ChecksumIPv4(data, "tcp", laddr, raddr)
+	// the checksum is calculated with the Checksum field zeroed
+	binary.BigEndian.PutUint16(data[tcpChecksumOffset:], 0)
+
+	csum, err := checksumIPAddr(data, "tcp", laddr, raddr)
 	if err != nil {
 		return nil, err
 	}
 
-	tcp.Checksum = csum
+	binary.BigEndian.PutUint16(data[tcpChecksumOffset:], csum)
 
-	// remarshal again, with a proper Checksum this time
-	fullData, err := tcp.marshalTCPHeader()
+	return data, nil
+}
 
+// VerifyChecksum is a method to check the Checksum of a *TCPHeader, such as one
+// that was decoded, using the source and destination addresses of the IP header
+// that carried the segment. The checksum is computed over the header as it would
+// be marshaled, including the Payload, and compared against the Checksum field,
+// so any changes to the fields after it was decoded are considered.
+//
+// Marshaling drops No-Operation options and anything following an End of Option
+// List option, so if the RawOptions field is set it's used in place of the Options
+// field. DecodeFromBytes() sets it to the options exactly as they were decoded, so
+// that the checksum of a decoded segment is verified over its original bytes. Set
+// it to nil to verify the header as it would be marshaled.
+//
+// The error will be of the packetserr.ChecksumMismatch type if the Checksum isn't
+// correct. Otherwise, it may be any of the errors returned by MarshalWithChecksum().
+func (tcp *TCPHeader) VerifyChecksum(src, dst string) error {
+	srcAddr, err := parseIPAddr(src)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return fullData, nil
+	dstAddr, err := parseIPAddr(dst)
+	if err != nil {
+		return err
+	}
+
+	return tcp.VerifyChecksumAddr(srcAddr, dstAddr)
+}
+
+// VerifyChecksumAddr is a method to check the Checksum of a *TCPHeader. It's the
+// same as VerifyChecksum() except that the source and destination addresses are
+// provided as netip.Addr values.
+func (tcp *TCPHeader) VerifyChecksumAddr(src, dst netip.Addr) error {
+	header := *tcp
+
+	// leave out the options and the Payload, for the RawOptions to replace
+	// any padding the DataOffset left for the options
+	if tcp.RawOptions != nil {
+		header.Options, header.Payload = nil, nil
+	}
+
+	data, err := header.marshalTCPHeader()
+	if err != nil {
+		return err
+	}
+
+	if tcp.RawOptions != nil {
+		data = append(data[:tcpHeaderMinSize:tcpHeaderMinSize], tcp.RawOptions...)
+		data = append(data, tcp.Payload...)
+	}
+
+	return verifyChecksum(data, tcpChecksumOffset, "tcp", src, dst)
 }
 
 // UnmarshalTCPOptionSlice is a function that takes a byte slice and converts
-// it in to a TCPOptionSlice.
+// it in to a TCPOptionSlice. Parsing stops at the End of Option List option,
+// and No-Operation options are skipped.
+//
+// The Length of every option is validated against the data remaining, so this
+// is safe to use on data from untrusted sources. The error is a
+// packetserr.DecodeError wrapping the packetserr.TCPOptionTruncated or
+// packetserr.TCPOptionLengthInvalid types, with the Offset of the option within
+// the data.
 func UnmarshalTCPOptionSlice(data []byte) (TCPOptionSlice, error) {
-	var d uint8
-	opts := make(TCPOptionSlice, 0)
-	reader := bytes.NewReader(data)
+	opts, err := decodeTCPOptionSlice(make(TCPOptionSlice, 0), data)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < len(data); i += 0 {
-		var opt TCPOption
+	// copy the Option-Data fields so that the options
+	// don't share memory with the data provided
+	for _, opt := range opts {
+		opt.Data = copyBytes(opt.Data)
+	}
 
-		// read the Option-Kind field.
-		err := binary.Read(reader, binary.BigEndian, &d)
-		if err != nil {
-			return nil, err
-		}
+	return opts, nil
+}
 
-		switch d {
-		case 0:
-			// push the index over the loop conditional so we're free
-			i = len(data)
-			break
-		case 1:
-			// increment the counter by one
+// decodeTCPOptionSlice decodes the options in to opts, reusing its backing
+// array along with the *TCPOption values within it. The Data of each option
+// references the data provided, and isn't copied.
+func decodeTCPOptionSlice(opts TCPOptionSlice, data []byte) (TCPOptionSlice, error) {
+	opts = opts[:0]
+
+	for i := 0; i < len(data); {
+		kind := data[i]
+
+		switch kind {
+		case TCPOptionKindEOL:
+			return opts, nil
+		case TCPOptionKindNOP:
 			i++
 			continue
-		default:
-			// set the Kind field to the Option-Kind value
-			opt.Kind = d
+		}
 
-			// read off the Option-Length field and set it
-			err = binary.Read(reader, binary.BigEndian, &d)
-			if err != nil {
-				return nil, err
-			}
+		// every other option has an Option-Length field,
+		// which counts both itself and the Option-Kind field
+		if i+2 > len(data) {
+			return nil, decodeError(LayerTypeTCP, "Options", i, packetserr.TCPOptionTruncated{Offset: i})
+		}
+
+		length := int(data[i+1])
 
-			opt.Length = d
+		if length < 2 {
+			err := packetserr.TCPOptionLengthInvalid{Kind: kind, Length: uint8(length)}
+			return nil, decodeError(LayerTypeTCP, "Options", i+1, err)
+		}
 
-			// figure out how much data there is to read,
-			// allocate a byte slice for it, and read it
-			optionData := make([]byte, int(opt.Length-2))
+		if i+length > len(data) {
+			return nil, decodeError(LayerTypeTCP, "Options", i, packetserr.TCPOptionTruncated{Offset: i})
+		}
 
-			err = binary.Read(reader, binary.BigEndian, &optionData)
-			if err != nil {
-				return nil, err
-			}
+		// reuse the option from a previous decode, if there is one
+		var opt *TCPOption
 
-			// set the Data from the Option-Data field
-			// and append this option to the TCPOptionSlice
-			opt.Data = optionData
-			opts = append(opts, &opt)
+		if len(opts) < cap(opts) {
+			opt = opts[:len(opts)+1][len(opts)]
+		}
+
+		if opt == nil {
+			opt = new(TCPOption)
+		}
 
-			// increment the counter with the number of byte reads
-			i = int(uint8(i) + opt.Length)
+		// limit the capacity of the Option-Data field so that appending
+		// to it can't overwrite the data following the option
+		*opt = TCPOption{
+			Kind:   kind,
+			Length: uint8(length),
+			Data:   data[i+2 : i+length : i+length],
 		}
+
+		opts = append(opts, opt)
+
+		i += length
 	}
 
 	return opts, nil
 }
 
+// copyBytes returns a copy of the byte slice that doesn't share its memory.
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+
+	return c
+}
+
 // Marshal is a method to marshal the TCPOptionSlice to the raw bytes for use
 // in the TCPHeader.Marshal() method. It's exported mainly for convenience as
 // marsahling uses this function itself.
 func (tcpos TCPOptionSlice) Marshal() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return tcpos.AppendBinary(make([]byte, 0, tcpos.SerializedLen()))
+}
+
+// SerializedLen is a method to determine how many bytes the TCPOptionSlice
+// will be once marshaled, including the padding between options.
+func (tcpos TCPOptionSlice) SerializedLen() int {
+	var n int
+
+	for index, opt := range tcpos {
+		if opt == nil {
+			continue
+		}
+
+		switch opt.Kind {
+		case 0:
+			if n == 0 {
+				return 0
+			}
+			fallthrough
+		case 1:
+			n++
+		default:
+			n += len(opt.Data) + 2
+
+			if len(tcpos)-1 != index {
+				n += (4 - n%4) % 4
+			}
+		}
+	}
+
+	return n
+}
+
+// MarshalTo is a method to marshal the TCPOptionSlice in to the byte slice
+// provided, returning the number of bytes written. Nothing is allocated, so
+// b must be at least SerializedLen() bytes long.
+//
+// The error may be of the packetserr.BufferTooSmall type, or any of the errors
+// returned by Marshal().
+func (tcpos TCPOptionSlice) MarshalTo(b []byte) (int, error) {
+	n := tcpos.SerializedLen()
+
+	if len(b) < n {
+		return 0, packetserr.BufferTooSmall{ExpectedSize: n, Len: len(b)}
+	}
+
+	data, err := tcpos.AppendBinary(b[:0])
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// AppendBinary is a method to marshal the TCPOptionSlice, appending it to the
+// byte slice provided. If b has enough capacity nothing is allocated.
+func (tcpos TCPOptionSlice) AppendBinary(b []byte) ([]byte, error) {
+	start := len(b)
 
 	for index, opt := range tcpos {
 		// yeah, make sure this shit isn't nil
@@ -213,12 +402,12 @@ func (tcpos TCPOptionSlice) Marshal() ([]byte, error) {
 
 		switch opt.Kind {
 		case 0:
-			if buf.Len() == 0 {
-				return make([]byte, 0), nil
+			if len(b) == start {
+				return b, nil
 			}
 			fallthrough
 		case 1:
-			binary.Write(buf, binary.BigEndian, opt.Kind)
+			b = append(b, opt.Kind)
 		default:
 			// make sure we're not going to overflow the uint8 Length field
 			if len(opt.Data)+2 > 255 {
@@ -227,15 +416,14 @@ func (tcpos TCPOptionSlice) Marshal() ([]byte, error) {
 
 			// if the option's Length is zero: auto-calculate the value for that field
 			// otherwise: validate that the Length is len(opt.Data) + 2
-			if opt.Length == 0 {
-				opt.Length = uint8(len(opt.Data)) + 2
-			} else if uint8(len(opt.Data))+2 != opt.Length {
+			length := uint8(len(opt.Data)) + 2
+
+			if opt.Length != 0 && opt.Length != length {
 				return nil, packetserr.TCPOptionDataInvalid{Index: index}
 			}
 
-			binary.Write(buf, binary.BigEndian, opt.Kind)
-			binary.Write(buf, binary.BigEndian, opt.Length)
-			binary.Write(buf, binary.BigEndian, opt.Data)
+			b = append(b, opt.Kind, length)
+			b = append(b, opt.Data...)
 
 			// if there looks to be no more options just continue through
 			// to avoid erroneous padding of the data
@@ -245,100 +433,197 @@ func (tcpos TCPOptionSlice) Marshal() ([]byte, error) {
 
 			// if this isn't the last option, pad to the nearest
 			// 32-bit boundary using ones (1)
-			for i := 0; i < buf.Len()%4; i++ {
-				binary.Write(buf, binary.BigEndian, uint8(1))
+			for (len(b)-start)%4 != 0 {
+				b = append(b, 1)
 			}
 		}
 	}
 
-	return buf.Bytes(), nil
+	return b, nil
+}
+
+// MarshalRaw is a method to marshal the TCPOptionSlice exactly as it's set, for
+// building deliberately malformed options. The Length of each option is written
+// as is, even if it's zero or doesn't match the Data, and no padding is added
+// between the options. The EOL and NOP options are written as only their Kind,
+// and unlike Marshal() an EOL option doesn't end the options.
+func (tcpos TCPOptionSlice) MarshalRaw() []byte {
+	return tcpos.appendRaw(make([]byte, 0, tcpos.rawLen()))
 }
 
-// ipv4AddrToBytes converts an IPv4 address to its four individual pieces in bytes
-func ipv4AddrToBytes(addr string) []byte {
-	o := strings.Split(addr, ".")
+// rawLen returns the number of bytes the options will be once marshaled by
+// MarshalRaw().
+func (tcpos TCPOptionSlice) rawLen() int {
+	var n int
+
+	for _, opt := range tcpos {
+		switch {
+		case opt == nil:
+		case opt.Kind == TCPOptionKindEOL, opt.Kind == TCPOptionKindNOP:
+			n++
+		default:
+			n += len(opt.Data) + 2
+		}
+	}
+
+	return n
+}
 
-	o0, _ := strconv.Atoi(o[0])
-	o1, _ := strconv.Atoi(o[1])
-	o2, _ := strconv.Atoi(o[2])
-	o3, _ := strconv.Atoi(o[3])
+func (tcpos TCPOptionSlice) appendRaw(b []byte) []byte {
+	for _, opt := range tcpos {
+		switch {
+		case opt == nil:
+		case opt.Kind == TCPOptionKindEOL, opt.Kind == TCPOptionKindNOP:
+			b = append(b, opt.Kind)
+		default:
+			b = append(b, opt.Kind, opt.Length)
+			b = append(b, opt.Data...)
+		}
+	}
 
-	return []byte{byte(o0), byte(o1), byte(o2), byte(o3)}
+	return b
 }
 
-func ctrlBitSet(value bool, bit uint16) uint16 {
+// ctrlBitSet returns the bit if the value is true, for building flags fields
+// such as the TCP control bits, the IPv4 flags, and the ICMPv6 message flags.
+func ctrlBitSet[T uint8 | uint16](value bool, bit T) T {
 	// if the value is false, set it to zero
 	if !value {
 		return 0
 	}
 
-	// flip the bit in a uint16 so that we can bitwise OR it
-	// with our existing value
-	//
-	// figure out how many bits we need to shift to set what we want
-	shift := uint(math.Log2(float64(bit)))
-
-	return uint16(1) << shift
+	// each of the bits is already a single bit in a uint8 or uint16,
+	// so that we can bitwise OR it with our existing value
+	return bit
 }
 
 func ctrlBitValue(ctrl uint16, bit uint16) bool {
-	// figure out how many bits we need to shift to get what we want
-	shift := uint(math.Log2(float64(bit)))
+	return ctrl&bit != 0
+}
 
-	// if the bit is one, return true
-	if ctrl>>shift&1 == 1 {
-		return true
+// SerializedLen is a method to determine how many bytes the *TCPHeader will be
+// once marshaled, including the options and Payload. If the DataOffset field
+// is set, it's used to determine the size of the header.
+func (tcp *TCPHeader) SerializedLen() int {
+	if tcp.DataOffset != 0 {
+		return int(tcp.DataOffset)*4 + len(tcp.Payload)
 	}
 
-	// otherwise false
-	return false
+	return tcpDataOffsetSize(tcp.Options.SerializedLen())*4 + len(tcp.Payload)
 }
 
-func optionsLen(opts []TCPOption) (count int) {
-	for _, opt := range opts {
-		count += int(opt.Length)
+// MarshalTo is a method to marshal the *TCPHeader in to the byte slice provided,
+// returning the number of bytes written. Nothing is allocated, so b must be at
+// least SerializedLen() bytes long. This is otherwise the same as Marshal().
+//
+// The error may be of the packetserr.BufferTooSmall type, or any of the errors
+// returned by Marshal().
+func (tcp *TCPHeader) MarshalTo(b []byte) (int, error) {
+	n := tcp.SerializedLen()
+
+	if len(b) < n {
+		return 0, packetserr.BufferTooSmall{ExpectedSize: n, Len: len(b)}
 	}
-	return
+
+	data, err := tcp.AppendBinary(b[:0])
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// AppendBinary is a method to marshal the *TCPHeader, appending it to the byte
+// slice provided. If b has enough capacity nothing is allocated. This is
+// otherwise the same as Marshal().
+func (tcp *TCPHeader) AppendBinary(b []byte) ([]byte, error) {
+	return tcp.appendTCPHeader(b)
+}
+
+// tcpDataOffsetSize determines how large the DataOffset field should be by
+// dividing the length of the whole TCP header by 4 (4 bytes [32-bits]) and
+// getting the ceiling of that value
+func tcpDataOffsetSize(optsLen int) int {
+	return (tcpHeaderMinSize + optsLen + 3) / 4
 }
 
 func (tcp *TCPHeader) marshalTCPHeader() ([]byte, error) {
-	optBytes, err := tcp.Options.Marshal()
+	return tcp.appendTCPHeader(make([]byte, 0, tcp.SerializedLen()))
+}
 
+func (tcp *TCPHeader) appendTCPHeader(b []byte) ([]byte, error) {
+	start := len(b)
+
+	// leave room for the fixed portion of the header,
+	// which is filled in once the options are written
+	b = append(b, zeroes[:tcpHeaderMinSize]...)
+
+	b, err := tcp.Options.AppendBinary(b)
 	if err != nil {
 		return nil, err
 	}
 
+	optsLen := len(b) - start - tcpHeaderMinSize
+
 	// if the calculated length of the options is too large
 	// return an error
-	if len(optBytes) > tcpOptsMaxSize {
+	if optsLen > tcpOptsMaxSize {
 		return nil, packetserr.TCPOptionsOverflow{MaxSize: tcpOptsMaxSize}
 	}
 
-	// determine how large the tcp.DataOffset field should be by diving the length
-	// of the whole TCP header by 4 (4 bytes [32-bits]) and getting the ceiling of
-	// that value
-	dataOffsetSize := uint8(math.Ceil(float64(tcpHeaderMinSize+len(optBytes)) / 4))
+	dataOffsetSize := uint8(tcpDataOffsetSize(optsLen))
 
 	// if the field is the type's default, and an obviously invalid value
-	// then just set it to the bare minimum for the TCP header.
-	if tcp.DataOffset == 0 {
-		tcp.DataOffset = dataOffsetSize
+	// then just use the bare minimum for the TCP header.
+	dataOffset := tcp.DataOffset
+
+	if dataOffset == 0 {
+		dataOffset = dataOffsetSize
 	}
 
 	// if the offset is outside of the acceptable range
 	// fail with a DataOffsetInvalid error
-	if tcp.DataOffset > 15 || tcp.DataOffset < 5 {
+	if dataOffset > 15 || dataOffset < 5 {
 		return nil, packetserr.TCPDataOffsetInvalid
 	}
 
-	// if the WindowSize field is the default let's set it to something better
-	if tcp.WindowSize == 0 {
-		tcp.WindowSize = 65535
+	// if the WindowSize field is the default let's use something better,
+	// unless a zero window was asked for
+	windowSize := tcp.WindowSize
+
+	if windowSize == 0 && !tcp.ZeroWindow {
+		windowSize = 65535
 	}
 
+	// write all the fields in to the space left for them
+	h := b[start:]
+
+	tcp.putTCPHeader(h, dataOffset, windowSize)
+
+	// each offset is 4 bytes long so figure out how many bytes of padding
+	// we should have (based on the DataOffset size) to line up with the 32-bit
+	// boundary
+	totalPad := int(dataOffset)*4 - len(h)
+
+	// DataOffset is too small for the amount of data in the header
+	if totalPad < 0 {
+		return nil, packetserr.TCPDataOffsetTooSmall{ExpectedSize: dataOffsetSize}
+	}
+
+	// pad the end of the packet with null bytes to the 32-bit boundary
+	b = append(b, zeroes[:totalPad]...)
+	b = append(b, tcp.Payload...)
+
+	return b, nil
+}
+
+// putTCPHeader writes the fixed portion of the header in to h, with the
+// DataOffset and WindowSize provided. Only the lower 4 bits of the DataOffset,
+// and the lower 3 bits of the Reserved field, are written.
+func (tcp *TCPHeader) putTCPHeader(h []byte, dataOffset uint8, windowSize uint16) {
 	// build the DataOffset, Reserved, and Control Flags data
-	ctrl := uint16(tcp.DataOffset)<<12 |
-		uint16(tcp.Reserved)<<9 |
+	ctrl := uint16(dataOffset&0xf)<<12 |
+		uint16(tcp.Reserved&7)<<9 |
 		ctrlBitSet(tcp.NS, nsBit) |
 		ctrlBitSet(tcp.CWR, cwrBit) |
 		ctrlBitSet(tcp.ECE, eceBit) |
@@ -349,115 +634,126 @@ func (tcp *TCPHeader) marshalTCPHeader() ([]byte, error) {
 		ctrlBitSet(tcp.SYN, synBit) |
 		ctrlBitSet(tcp.FIN, finBit)
 
-	buf := new(bytes.Buffer)
-
-	// write all the data to the byte buffer
-	binary.Write(buf, binary.BigEndian, tcp.SourcePort)
-	binary.Write(buf, binary.BigEndian, tcp.DestinationPort)
-	binary.Write(buf, binary.BigEndian, tcp.SeqNum)
-	binary.Write(buf, binary.BigEndian, tcp.AckNum)
-	binary.Write(buf, binary.BigEndian, ctrl)
-	binary.Write(buf, binary.BigEndian, tcp.WindowSize)
-	binary.Write(buf, binary.BigEndian, tcp.Checksum)
-	binary.Write(buf, binary.BigEndian, tcp.UrgentPointer)
+	binary.BigEndian.PutUint16(h[0:], tcp.SourcePort)
+	binary.BigEndian.PutUint16(h[2:], tcp.DestinationPort)
+	binary.BigEndian.PutUint32(h[4:], tcp.SeqNum)
+	binary.BigEndian.PutUint32(h[8:], tcp.AckNum)
+	binary.BigEndian.PutUint16(h[12:], ctrl)
+	binary.BigEndian.PutUint16(h[14:], windowSize)
+	binary.BigEndian.PutUint16(h[16:], tcp.Checksum)
+	binary.BigEndian.PutUint16(h[18:], tcp.UrgentPointer)
+}
 
-	buf.Write(optBytes)
+// MarshalRaw is a method to marshal the *TCPHeader exactly as it's set, for
+// building deliberately malformed segments to test how they're handled. Nothing
+// is validated or filled in: the DataOffset, WindowSize, and Checksum fields are
+// written even if they're zero or wrong, and the options are written by
+// TCPOptionSlice.MarshalRaw() with no padding after them. Only the lower 4 bits
+// of the DataOffset, and the lower 3 bits of the Reserved field, are written.
+//
+// Use Marshal() for segments that are meant to be correct.
+func (tcp *TCPHeader) MarshalRaw() []byte {
+	b := make([]byte, tcpHeaderMinSize, tcpHeaderMinSize+tcp.Options.rawLen()+len(tcp.Payload))
 
-	// each offset is 4 bytes long so figure out how many bytes of padding
-	// we should have (based on the DataOffset size) to line up with the 32-bit
-	// boundary
-	totalPad := int(tcp.DataOffset*4) - buf.Len()
+	tcp.putTCPHeader(b, tcp.DataOffset, tcp.WindowSize)
 
-	// DataOffset is too small for the amount of data in the header
-	if totalPad < 0 {
-		return nil, packetserr.TCPDataOffsetTooSmall{ExpectedSize: dataOffsetSize}
-	}
+	b = tcp.Options.appendRaw(b)
+	b = append(b, tcp.Payload...)
 
-	// pad the end of the packet with null bytes to the 32-bit boundary
-	for i := 0; i < totalPad; i++ {
-		binary.Write(buf, binary.BigEndian, uint8(0))
-	}
+	return b
+}
 
-	return buf.Bytes(), nil
+// tcpFields are the fields of the TCP header, for describing where decoding
+// failed.
+var tcpFields = []headerField{
+	{0, "SourcePort"}, {2, "DestinationPort"}, {4, "SeqNum"}, {8, "AckNum"},
+	{12, "DataOffset"}, {14, "WindowSize"}, {16, "Checksum"}, {18, "UrgentPointer"},
+	{20, "Options"},
 }
 
-func unmarshalTCPHeader(data []byte) (*TCPHeader, error) {
-	var header TCPHeader
-	var ctrl uint16
+// DecodeFromBytes is a method to parse the byte slice in to the *TCPHeader,
+// overwriting all of its fields. It's the same as UnmarshalTCPHeader() except
+// that nothing is copied: the Payload, the RawOptions, and the Data of each
+// option reference the data provided.
+//
+// The backing array of the Options field is reused, and so is every *TCPOption
+// in it: each pointer in the Options of the receiver is overwritten in place by
+// the decoded options, even if it's held elsewhere. Copy any options that need
+// to outlive the next decode before calling this again.
+//
+// This makes it possible to decode many segments without allocating, as long as
+// the data isn't modified while the *TCPHeader is still in use. If an error is
+// returned the contents of the *TCPHeader are undefined.
+func (tcp *TCPHeader) DecodeFromBytes(data []byte) error {
+	tcp.RawOptions = nil
+
+	if len(data) < tcpHeaderMinSize {
+		err := packetserr.TCPHeaderTruncated{ExpectedSize: tcpHeaderMinSize, Len: len(data)}
+		return truncatedError(LayerTypeTCP, tcpFields, len(data), err)
+	}
 
-	reader := bytes.NewReader(data)
+	ctrl := binary.BigEndian.Uint16(data[12:14])
 
-	// pull all the fields from the data
-	err := binary.Read(reader, binary.BigEndian, &header.SourcePort)
-	if err != nil {
-		return nil, err
-	}
+	tcp.SourcePort = binary.BigEndian.Uint16(data[0:2])
+	tcp.DestinationPort = binary.BigEndian.Uint16(data[2:4])
+	tcp.SeqNum = binary.BigEndian.Uint32(data[4:8])
+	tcp.AckNum = binary.BigEndian.Uint32(data[8:12])
+	tcp.WindowSize = binary.BigEndian.Uint16(data[14:16])
+	tcp.Checksum = binary.BigEndian.Uint16(data[16:18])
+	tcp.UrgentPointer = binary.BigEndian.Uint16(data[18:20])
 
-	err = binary.Read(reader, binary.BigEndian, &header.DestinationPort)
-	if err != nil {
-		return nil, err
-	}
+	// keep a zero window as is, if the header is marshaled again
+	tcp.ZeroWindow = tcp.WindowSize == 0
 
-	err = binary.Read(reader, binary.BigEndian, &header.SeqNum)
-	if err != nil {
-		return nil, err
-	}
+	tcp.DataOffset = uint8(ctrl >> 12)
+	tcp.Reserved = uint8(ctrl >> 9 & 7)
 
-	err = binary.Read(reader, binary.BigEndian, &header.AckNum)
-	if err != nil {
-		return nil, err
+	// We need to convert the control flags to their boolean counterparts.
+	// Each control flag is one bit in size, so use a bitwise AND
+	// to see if it's enabled.
+	tcp.NS = ctrlBitValue(ctrl, nsBit)
+	tcp.CWR = ctrlBitValue(ctrl, cwrBit)
+	tcp.ECE = ctrlBitValue(ctrl, eceBit)
+	tcp.URG = ctrlBitValue(ctrl, urgBit)
+	tcp.ACK = ctrlBitValue(ctrl, ackBit)
+	tcp.PSH = ctrlBitValue(ctrl, pshBit)
+	tcp.RST = ctrlBitValue(ctrl, rstBit)
+	tcp.SYN = ctrlBitValue(ctrl, synBit)
+	tcp.FIN = ctrlBitValue(ctrl, finBit)
+
+	if tcp.DataOffset < 5 {
+		return decodeError(LayerTypeTCP, "DataOffset", 12, packetserr.TCPDataOffsetInvalid)
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &ctrl)
-	if err != nil {
-		return nil, err
-	}
+	headerLen := int(tcp.DataOffset) * 4
 
-	err = binary.Read(reader, binary.BigEndian, &header.WindowSize)
-	if err != nil {
-		return nil, err
+	if len(data) < headerLen {
+		err := packetserr.TCPHeaderTruncated{ExpectedSize: headerLen, Len: len(data)}
+		return decodeError(LayerTypeTCP, "Options", tcpHeaderMinSize, err)
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &header.Checksum)
+	opts, err := decodeTCPOptionSlice(tcp.Options, data[tcpHeaderMinSize:headerLen])
 	if err != nil {
-		return nil, err
+		return shiftDecodeError(err, tcpHeaderMinSize)
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &header.UrgentPointer)
-	if err != nil {
-		return nil, err
-	}
+	tcp.Options = opts
+	tcp.RawOptions = data[tcpHeaderMinSize:headerLen:headerLen]
 
-	header.DataOffset = uint8(ctrl >> 12)
-	header.Reserved = uint8(ctrl >> 9 & 7)
+	// everything after the header is the payload of the segment
+	tcp.Payload = data[headerLen:]
 
-	// We need to convert the control flags to their boolean counterparts.
-	// Each control flag is one bit in size, so shift that bit to the end
-	// and use a bitwise AND of 1 to see if it's enabled.
-	header.NS = ctrlBitValue(ctrl, nsBit)
-	header.CWR = ctrlBitValue(ctrl, cwrBit)
-	header.ECE = ctrlBitValue(ctrl, eceBit)
-	header.URG = ctrlBitValue(ctrl, urgBit)
-	header.ACK = ctrlBitValue(ctrl, ackBit)
-	header.PSH = ctrlBitValue(ctrl, pshBit)
-	header.RST = ctrlBitValue(ctrl, rstBit)
-	header.SYN = ctrlBitValue(ctrl, synBit)
-	header.FIN = ctrlBitValue(ctrl, finBit)
-
-	if header.DataOffset > 5 {
-		optsBytes := make([]byte, len(data)-tcpHeaderMinSize)
-
-		_, err = reader.Read(optsBytes)
-		if err != nil {
-			return nil, err
-		}
+	return nil
+}
 
-		opts, err := UnmarshalTCPOptionSlice(optsBytes)
-		if err != nil {
-			return nil, err
-		}
+func unmarshalTCPHeader(data []byte) (*TCPHeader, error) {
+	var header TCPHeader
 
-		header.Options = opts
+	// decode a copy of the data so that the header doesn't share memory
+	// with the data provided, while the options and the Payload share the
+	// one copy
+	if err := header.DecodeFromBytes(copyBytes(data)); err != nil {
+		return nil, err
 	}
 
 	return &header, nil
@@ -7,7 +7,10 @@ package packets_test
 import (
 	"bytes"
 	"encoding/binary"
+	"net/netip"
 	"reflect"
+	"sync"
+	"testing"
 
 	"github.com/theckman/packets"
 	"github.com/theckman/packets/err"
@@ -170,6 +173,51 @@ func (t *TestSuite) TestUnmarshalTCPOptionSlice(c *C) {
 	c.Assert(len(opt.Data), Equals, 0)
 }
 
+func (t *TestSuite) TestUnmarshalTCPOptionSlice_Invalid(c *C) {
+	var tcpos packets.TCPOptionSlice
+	var err error
+
+	// Option-Length fields that are too small to count themselves
+	for _, length := range []uint8{0, 1} {
+		tcpos, err = packets.UnmarshalTCPOptionSlice([]byte{1, 1, 2, length, 0, 0})
+		c.Assert(err, Not(IsNil))
+		c.Check(tcpos, IsNil)
+		c.Check(err, Equals, packetserr.DecodeError{
+			Layer:  "TCP",
+			Field:  "Options",
+			Offset: 3,
+			Err:    packetserr.TCPOptionLengthInvalid{Kind: 2, Length: length},
+		})
+	}
+
+	// the Option-Length field is missing
+	tcpos, err = packets.UnmarshalTCPOptionSlice([]byte{1, 1, 1, 8})
+	c.Assert(err, Not(IsNil))
+	c.Check(tcpos, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "TCP", Field: "Options", Offset: 3, Err: packetserr.TCPOptionTruncated{Offset: 3}})
+
+	// the Option-Length field claims more data than there is
+	tcpos, err = packets.UnmarshalTCPOptionSlice([]byte{2, 4, 5, 180, 8, 10, 0, 0})
+	c.Assert(err, Not(IsNil))
+	c.Check(tcpos, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "TCP", Field: "Options", Offset: 4, Err: packetserr.TCPOptionTruncated{Offset: 4}})
+
+	// an Option-Length which would wrap a uint8 counter
+	data := make([]byte, 40)
+	data[0], data[1] = 8, 255
+
+	tcpos, err = packets.UnmarshalTCPOptionSlice(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(tcpos, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "TCP", Field: "Options", Offset: 0, Err: packetserr.TCPOptionTruncated{Offset: 0}})
+
+	// anything after the End of Option List option is ignored
+	tcpos, err = packets.UnmarshalTCPOptionSlice([]byte{2, 4, 5, 180, 0, 8, 255})
+	c.Assert(err, IsNil)
+	c.Assert(len(tcpos), Equals, 1)
+	c.Check(tcpos[0].Kind, Equals, uint8(2))
+}
+
 func (t *TestSuite) TestUnmarshalTCPHeader(c *C) {
 	var header *packets.TCPHeader
 
@@ -261,6 +309,106 @@ func (t *TestSuite) TestUnmarshalTCPHeader(c *C) {
 	c.Check(header.Options[1].Kind, Equals, uint8(4))
 	c.Check(header.Options[1].Length, Equals, uint8(2))
 	c.Check(len(header.Options[1].Data), Equals, 0)
+
+	// no data after the header
+	c.Check(len(header.Payload), Equals, 0)
+
+	//
+	// TEST PAYLOAD IS SPLIT FROM OPTIONS USING DataOffset
+	//
+	binary.Write(rawBytes, Te, []byte("payload"))
+
+	header, err = packets.UnmarshalTCPHeader(rawBytes.Bytes())
+	c.Assert(err, IsNil)
+
+	c.Check(header.DataOffset, Equals, uint8(7))
+	c.Check(len(header.Options), Equals, 2)
+	c.Check(string(header.Payload), Equals, "payload")
+
+	// the payload shouldn't share memory with the data
+	header.Payload[0] = 'P'
+	c.Check(string(rawBytes.Bytes()[28:]), Equals, "payload")
+
+	//
+	// TEST DataOffset LARGER THAN THE DATA
+	//
+	header, err = packets.UnmarshalTCPHeader(rawBytes.Bytes()[:24])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "Options",
+		Offset: 20,
+		Err:    packetserr.TCPHeaderTruncated{ExpectedSize: 28, Len: 24},
+	})
+
+	//
+	// TEST DATA SHORTER THAN THE MINIMUM HEADER
+	//
+	header, err = packets.UnmarshalTCPHeader(rawBytes.Bytes()[:19])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "UrgentPointer",
+		Offset: 18,
+		Err:    packetserr.TCPHeaderTruncated{ExpectedSize: 20, Len: 19},
+	})
+
+	//
+	// TEST DataOffset TOO SMALL
+	//
+	data := rawBytes.Bytes()
+	data[12] = 4 << 4
+
+	header, err = packets.UnmarshalTCPHeader(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "TCP", Field: "DataOffset", Offset: 12, Err: packetserr.TCPDataOffsetInvalid})
+
+	//
+	// TEST A CAPTURED SEGMENT
+	//
+	header, err = packets.UnmarshalTCPHeader(checksumCorpus[0].data[20:])
+	c.Assert(err, IsNil)
+
+	c.Check(header.SourcePort, Equals, uint16(12345))
+	c.Check(header.DestinationPort, Equals, uint16(54321))
+	c.Check(header.SeqNum, Equals, uint32(3735928559))
+	c.Check(header.DataOffset, Equals, uint8(7))
+	c.Check(header.SYN, Equals, true)
+	c.Assert(len(header.Options), Equals, 1)
+	c.Check(header.Options[0].Kind, Equals, uint8(2))
+	c.Check(header.Options[0].Data, DeepEquals, []byte{0x20, 0x00})
+	c.Check(string(header.Payload), Equals, "Test")
+}
+
+func (t *TestSuite) TestTCPHeader_Marshal_Payload(c *C) {
+	t.t.Payload = []byte("SSH-2.0-")
+
+	data, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 28)
+
+	// the DataOffset only covers the header
+	c.Check(data[12]>>4, Equals, uint8(5))
+	c.Check(string(data[20:]), Equals, "SSH-2.0-")
+
+	//
+	// TEST THE CHECKSUM COVERS THE PAYLOAD
+	//
+	data, err = t.t.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 28)
+
+	// checksumming the segment, including its checksum, should result in zero
+	csum, err := packets.ChecksumIPv4(data, "tcp", "127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(csum, Equals, uint16(0))
+
+	header, err := packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(string(header.Payload), Equals, "SSH-2.0-")
 }
 
 func (t *TestSuite) TestTCPHeader_Marshal(c *C) {
@@ -625,6 +773,97 @@ func (t *TestSuite) TestTCPHeader_Marshal(c *C) {
 	}
 }
 
+func (t *TestSuite) TestTCPHeader_Marshal_NotModified(c *C) {
+	opt := &packets.TCPOption{Kind: packets.TCPOptionKindMSS, Data: []byte{0x05, 0xb4}}
+
+	tcp := &packets.TCPHeader{
+		SourcePort:      44273,
+		DestinationPort: 22,
+		SYN:             true,
+		Options:         packets.TCPOptionSlice{opt},
+	}
+
+	data, err := tcp.Marshal()
+	c.Assert(err, IsNil)
+
+	// the fields are filled in within the data
+	c.Check(data[12]>>4, Equals, uint8(6))
+	c.Check(Te.Uint16(data[14:16]), Equals, uint16(65535))
+	c.Check(data[21], Equals, uint8(4))
+
+	csumData, err := tcp.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(csumData[16:18]), Not(Equals), uint16(0))
+
+	// but not in the header
+	c.Check(tcp.DataOffset, Equals, uint8(0))
+	c.Check(tcp.WindowSize, Equals, uint16(0))
+	c.Check(tcp.Checksum, Equals, uint16(0))
+	c.Check(opt.Length, Equals, uint8(0))
+
+	// a Checksum that's already set doesn't change the one calculated
+	tcp.Checksum = 0xbeef
+
+	data, err = tcp.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, csumData)
+	c.Check(tcp.Checksum, Equals, uint16(0xbeef))
+
+	//
+	// TEST CONCURRENT MARSHALING
+	//
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				data, err := tcp.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+				c.Check(err, IsNil)
+				c.Check(data, DeepEquals, csumData)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (t *TestSuite) TestTCPHeader_Marshal_ZeroWindow(c *C) {
+	t.t.WindowSize = 0
+	t.t.ZeroWindow = true
+
+	data, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[14:16]), Equals, uint16(0))
+
+	// the flag only matters when the WindowSize is zero
+	t.t.WindowSize = 42
+
+	data, err = t.t.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[14:16]), Equals, uint16(42))
+
+	//
+	// TEST DECODED ZERO WINDOW
+	//
+	t.t.WindowSize = 0
+
+	data, err = t.t.Marshal()
+	c.Assert(err, IsNil)
+
+	header, err := packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.WindowSize, Equals, uint16(0))
+	c.Check(header.ZeroWindow, Equals, true)
+
+	remarshaled, err := header.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(remarshaled, DeepEquals, data)
+}
+
 func (t *TestSuite) TestTCPHeader_MarshalWithChecksum(c *C) {
 	var data []byte
 	var err error
@@ -675,7 +914,7 @@ func (t *TestSuite) TestTCPHeader_MarshalWithChecksum(c *C) {
 
 	// Checksum
 	c.Assert(binary.Read(r, e, &u16), IsNil)
-	c.Check(u16, Equals, uint16(64345))
+	c.Check(u16, Equals, uint16(23035))
 
 	// UrgentPointer
 	c.Assert(binary.Read(r, e, &u16), IsNil)
@@ -730,7 +969,7 @@ func (t *TestSuite) TestTCPHeader_MarshalWithChecksum(c *C) {
 
 	// Checksum
 	c.Assert(binary.Read(r, e, &u16), IsNil)
-	c.Check(u16, Equals, uint16(64345))
+	c.Check(u16, Equals, uint16(23035))
 
 	// UrgentPointer
 	c.Assert(binary.Read(r, e, &u16), IsNil)
@@ -797,9 +1036,531 @@ func (t *TestSuite) TestTCPHeader_MarshalWithChecksum(c *C) {
 
 	// Checksum
 	c.Assert(binary.Read(r, e, &u16), IsNil)
-	c.Check(u16, Equals, uint16(42500))
+	c.Check(u16, Equals, uint16(1190))
 
 	// UrgentPointer
 	c.Assert(binary.Read(r, e, &u16), IsNil)
 	c.Check(u16, Equals, uint16(0))
 }
+
+func (t *TestSuite) TestTCPHeader_MarshalWithChecksum_IPv6(c *C) {
+	data, err := t.t.MarshalWithChecksum("fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 20)
+
+	// Checksum
+	c.Check(Te.Uint16(data[16:18]), Equals, uint16(0x5afa))
+
+	//
+	// TEST MISMATCHED ADDRESS FAMILIES
+	//
+	t.SetUpTest(c)
+
+	data, err = t.t.MarshalWithChecksum("127.0.0.1", "fe80::2")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ChecksumAddressFamilyMismatch)
+}
+
+func (t *TestSuite) TestTCPHeader_VerifyChecksum(c *C) {
+	t.t.Payload = []byte("SSH-2.0-")
+
+	data, err := t.t.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	header, err := packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+	c.Check(header.VerifyChecksumAddr(netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2")), IsNil)
+
+	// the checksum is verified against the fields as they're
+	// set, so changing them after decoding is considered
+	header.SeqNum++
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	header.SeqNum--
+	header.Checksum++
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	header.Checksum--
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	// a header that wasn't decoded is verified the same way
+	c.Check(t.t.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	t.t.Checksum = Te.Uint16(data[16:18])
+	c.Check(t.t.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	//
+	// TEST CHECKSUM MISMATCHES
+	//
+	err = header.VerifyChecksum("127.0.0.1", "127.0.0.3")
+	c.Assert(err, Not(IsNil))
+
+	mismatch, ok := err.(packetserr.ChecksumMismatch)
+	c.Assert(ok, Equals, true)
+	c.Check(mismatch.Actual, Equals, t.t.Checksum)
+	c.Check(mismatch.Expected, Not(Equals), t.t.Checksum)
+
+	// the payload is covered by the checksum
+	data[len(data)-1] = '!'
+
+	header, err = packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+
+	err = header.VerifyChecksum("127.0.0.1", "127.0.0.2")
+	c.Check(err, FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	//
+	// TEST OPTIONS THAT AREN'T MARSHALED AS THEY WERE SENT
+	//
+	head, err := (&packets.TCPHeader{SourcePort: 44273, DestinationPort: 22, SYN: true}).Marshal()
+	c.Assert(err, IsNil)
+
+	for _, opts := range [][]byte{
+		// NOP, NOP, Timestamps
+		{0x01, 0x01, 0x08, 0x0a, 0x00, 0x01, 0xe2, 0x40, 0x00, 0x00, 0x00, 0x00},
+		// MSS, SACK Permitted, Timestamps, NOP, Window Scale, like a Linux SYN
+		{
+			0x02, 0x04, 0x05, 0xb4, 0x04, 0x02, 0x08, 0x0a, 0x00, 0x01, 0xe2, 0x40,
+			0x00, 0x00, 0x00, 0x00, 0x01, 0x03, 0x03, 0x07,
+		},
+	} {
+		data = append(append([]byte{}, head...), opts...)
+		data[12] = uint8(len(data)/4) << 4
+
+		csum, err := packets.ChecksumIPv4(data, "tcp", "127.0.0.1", "127.0.0.2")
+		c.Assert(err, IsNil)
+		Te.PutUint16(data[16:18], csum)
+
+		c.Assert(header.DecodeFromBytes(data), IsNil)
+		c.Check(header.RawOptions, DeepEquals, opts)
+		c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+	}
+
+	// without the RawOptions the header is verified as it'd be marshaled,
+	// which doesn't fit the options in to the DataOffset they were sent with
+	header.RawOptions = nil
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.TCPDataOffsetTooSmall{})
+
+	// a decode that fails doesn't leave the options of the previous segment
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+
+	data[12] = 4 << 4
+
+	c.Assert(header.DecodeFromBytes(data), Not(IsNil))
+	c.Check(header.RawOptions, IsNil)
+
+	//
+	// TEST IPV6
+	//
+	t.SetUpTest(c)
+
+	data, err = t.t.MarshalWithChecksum("fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(header.VerifyChecksum("fe80::1", "fe80::2"), IsNil)
+	c.Check(header.VerifyChecksum("fe80::2", "fe80::1"), IsNil)
+	c.Check(header.VerifyChecksum("fe80::1", "fe80::3"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	//
+	// TEST INVALID ADDRESSES
+	//
+	c.Check(header.VerifyChecksum("127.0.0.1", "fe80::2"), Equals, packetserr.ChecksumAddressFamilyMismatch)
+	c.Check(header.VerifyChecksum("300.1.1.1", "127.0.0.2"), Equals, packetserr.IPv4AddressInvalid{Address: "300.1.1.1"})
+}
+
+func (t *TestSuite) TestTCPHeader_MarshalWithChecksumAddr(c *C) {
+	expected, err := t.t.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	t.SetUpTest(c)
+
+	data, err := t.t.MarshalWithChecksumAddr(netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+
+	t.SetUpTest(c)
+
+	expected, err = t.t.MarshalWithChecksum("fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+
+	t.SetUpTest(c)
+
+	data, err = t.t.MarshalWithChecksumAddr(netip.MustParseAddr("fe80::1"), netip.MustParseAddr("fe80::2"))
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+
+	//
+	// TEST IPv4-MAPPED ADDRESSES
+	//
+	t.SetUpTest(c)
+
+	unchecked, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+
+	// the IPv4 pseudo-header is used, the same as with ChecksumIPv4Addr
+	csum, err := packets.ChecksumIPv4Addr(unchecked, "tcp", netip.MustParseAddr("::ffff:127.0.0.1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, IsNil)
+
+	expected, err = t.t.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(expected[16:18]), Equals, csum)
+
+	t.SetUpTest(c)
+
+	data, err = t.t.MarshalWithChecksumAddr(netip.MustParseAddr("::ffff:127.0.0.1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+
+	//
+	// TEST MISMATCHED ADDRESS FAMILIES
+	//
+	t.SetUpTest(c)
+
+	data, err = t.t.MarshalWithChecksumAddr(netip.MustParseAddr("fe80::1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ChecksumAddressFamilyMismatch)
+
+	//
+	// TEST INVALID ADDRESS STRINGS
+	//
+	data, err = t.t.MarshalWithChecksum("10.0.0", "127.0.0.2")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "10.0.0"})
+
+	data, err = t.t.MarshalWithChecksum("fe80::1", "fe80::1::2")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv6AddressInvalid{Address: "fe80::1::2"})
+}
+
+func (t *TestSuite) TestTCPOptionSlice_MarshalTo(c *C) {
+	opts := packets.TCPOptionSlice{
+		packets.NewMSSOption(1460),
+		nil,
+		packets.NewSACKPermittedOption(),
+		packets.NewTimestampOption(100, 0),
+	}
+
+	expected, err := opts.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(opts.SerializedLen(), Equals, len(expected))
+
+	buf := make([]byte, 64)
+
+	n, err := opts.MarshalTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, len(expected))
+	c.Check(buf[:n], DeepEquals, expected)
+
+	data, err := opts.AppendBinary([]byte{42})
+	c.Assert(err, IsNil)
+	c.Check(data[0], Equals, uint8(42))
+	c.Check(data[1:], DeepEquals, expected)
+
+	// an EOL as the first option results in no options
+	opts = packets.TCPOptionSlice{{Kind: 0}, packets.NewMSSOption(1460)}
+	c.Check(opts.SerializedLen(), Equals, 0)
+
+	//
+	// TEST packetserr.BufferTooSmall
+	//
+	opts = packets.TCPOptionSlice{packets.NewMSSOption(1460)}
+
+	n, err = opts.MarshalTo(buf[:3])
+	c.Assert(err, Not(IsNil))
+	c.Check(n, Equals, 0)
+	c.Check(err, Equals, packetserr.BufferTooSmall{ExpectedSize: 4, Len: 3})
+}
+
+func (t *TestSuite) TestTCPOptionSlice_MarshalRaw(c *C) {
+	opts := packets.TCPOptionSlice{
+		{Kind: packets.TCPOptionKindEOL},
+		nil,
+		{Kind: packets.TCPOptionKindMSS, Length: 9, Data: []byte{0x05, 0xb4}},
+		{Kind: packets.TCPOptionKindWindowScale, Data: []byte{7}},
+		{Kind: packets.TCPOptionKindNOP, Length: 42},
+	}
+
+	// the strict path stops at the EOL option, and rejects the lying Length
+	data, err := opts.Marshal()
+	c.Check(err, IsNil)
+	c.Check(data, HasLen, 0)
+
+	_, err = opts[1:].Marshal()
+	c.Check(err, Equals, packetserr.TCPOptionDataInvalid{Index: 1})
+
+	c.Check(opts.MarshalRaw(), DeepEquals, []byte{
+		0x00,
+		0x02, 0x09, 0x05, 0xb4,
+		0x03, 0x00, 0x07,
+		0x01,
+	})
+
+	c.Check(packets.TCPOptionSlice(nil).MarshalRaw(), DeepEquals, []byte{})
+}
+
+func (t *TestSuite) TestTCPHeader_MarshalRaw(c *C) {
+	tcp := &packets.TCPHeader{
+		SourcePort:      44273,
+		DestinationPort: 22,
+		SeqNum:          42,
+		DataOffset:      15,
+		Reserved:        7,
+		SYN:             true,
+		Checksum:        0xbeef,
+		Options: packets.TCPOptionSlice{
+			{Kind: packets.TCPOptionKindMSS, Length: 3, Data: []byte{0x05, 0xb4}},
+		},
+		Payload: []byte("hi"),
+	}
+
+	// the strict path rejects the DataOffset, as
+	// there's no room for it after the options
+	_, err := tcp.Marshal()
+	c.Check(err, Not(IsNil))
+
+	data := tcp.MarshalRaw()
+	c.Assert(len(data), Equals, 26)
+
+	// SourcePort
+	c.Check(Te.Uint16(data[0:2]), Equals, uint16(44273))
+	// DestinationPort
+	c.Check(Te.Uint16(data[2:4]), Equals, uint16(22))
+	// SeqNum
+	c.Check(Te.Uint32(data[4:8]), Equals, uint32(42))
+	// DataOffset, Reserved, and Control Flags
+	c.Check(Te.Uint16(data[12:14]), Equals, uint16(0xfe02))
+	// WindowSize is zero, as it was set
+	c.Check(Te.Uint16(data[14:16]), Equals, uint16(0))
+	// Checksum
+	c.Check(Te.Uint16(data[16:18]), Equals, uint16(0xbeef))
+	// Options, without any padding
+	c.Check(data[20:24], DeepEquals, []byte{0x02, 0x03, 0x05, 0xb4})
+	// Payload
+	c.Check(string(data[24:]), Equals, "hi")
+
+	// only the bits that fit in the fields are written
+	tcp.DataOffset = 0x12
+	tcp.Reserved = 0x0f
+
+	data = tcp.MarshalRaw()
+	c.Check(Te.Uint16(data[12:14]), Equals, uint16(0x2e02))
+}
+
+func (t *TestSuite) TestTCPHeader_MarshalTo(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	t.t.Options = packets.TCPOptionSlice{packets.NewMSSOption(1460), wscale}
+	t.t.Payload = []byte("SSH-2.0-")
+
+	// options of 7 bytes are padded to a DataOffset of 7
+	c.Check(t.t.SerializedLen(), Equals, 36)
+
+	expected, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(len(expected), Equals, t.t.SerializedLen())
+
+	buf := make([]byte, 64)
+
+	n, err := t.t.MarshalTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, len(expected))
+	c.Check(buf[:n], DeepEquals, expected)
+
+	data, err := t.t.AppendBinary([]byte{42})
+	c.Assert(err, IsNil)
+	c.Check(data[0], Equals, uint8(42))
+	c.Check(data[1:], DeepEquals, expected)
+
+	// an explicit DataOffset determines the size of the header
+	t.t.DataOffset = 10
+	c.Check(t.t.SerializedLen(), Equals, 48)
+
+	n, err = t.t.MarshalTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 48)
+	c.Check(buf[12]>>4, Equals, uint8(10))
+	c.Check(buf[20:40], DeepEquals, append(expected[20:28], make([]byte, 12)...))
+
+	//
+	// TEST packetserr.BufferTooSmall
+	//
+	n, err = t.t.MarshalTo(buf[:47])
+	c.Assert(err, Not(IsNil))
+	c.Check(n, Equals, 0)
+	c.Check(err, Equals, packetserr.BufferTooSmall{ExpectedSize: 48, Len: 47})
+
+	//
+	// TEST THE SAME ERRORS AS Marshal() ARE RETURNED
+	//
+	t.t.DataOffset = 16
+
+	n, err = t.t.MarshalTo(make([]byte, 128))
+	c.Assert(err, Not(IsNil))
+	c.Check(n, Equals, 0)
+	c.Check(err, Equals, packetserr.TCPDataOffsetInvalid)
+}
+
+func (t *TestSuite) TestTCPHeader_MarshalTo_Allocs(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	t.t.Options = packets.TCPOptionSlice{packets.NewMSSOption(1460), wscale}
+	t.t.Payload = []byte("SSH-2.0-")
+
+	buf := make([]byte, t.t.SerializedLen())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := t.t.MarshalTo(buf); err != nil {
+			c.Fatal(err)
+		}
+	})
+
+	c.Check(allocs, Equals, float64(0))
+
+	allocs = testing.AllocsPerRun(100, func() {
+		if _, err := t.t.AppendBinary(buf[:0]); err != nil {
+			c.Fatal(err)
+		}
+	})
+
+	c.Check(allocs, Equals, float64(0))
+}
+
+func (t *TestSuite) BenchmarkTCPHeader_Marshal(c *C) {
+	t.t.Options = packets.TCPOptionSlice{packets.NewMSSOption(1460)}
+	t.t.Payload = []byte("SSH-2.0-")
+
+	for i := 0; i < c.N; i++ {
+		t.t.Marshal()
+	}
+}
+
+func (t *TestSuite) BenchmarkTCPHeader_MarshalTo(c *C) {
+	t.t.Options = packets.TCPOptionSlice{packets.NewMSSOption(1460)}
+	t.t.Payload = []byte("SSH-2.0-")
+
+	buf := make([]byte, t.t.SerializedLen())
+
+	c.ResetTimer()
+
+	for i := 0; i < c.N; i++ {
+		t.t.MarshalTo(buf)
+	}
+}
+
+func (t *TestSuite) TestTCPHeader_DecodeFromBytes(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	t.t.Options = packets.TCPOptionSlice{packets.NewMSSOption(1460), wscale}
+	t.t.Payload = []byte("SSH-2.0-")
+
+	data, err := t.t.Marshal()
+	c.Assert(err, IsNil)
+
+	expected, err := packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+
+	var header packets.TCPHeader
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(&header, DeepEquals, expected)
+
+	// nothing is copied, so the header references the data
+	data[len(data)-1] = '!'
+	c.Check(string(header.Payload), Equals, "SSH-2.0!")
+
+	data[22] = 0x06
+	c.Check(header.Options[0].Data, DeepEquals, []byte{0x06, 0xb4})
+
+	//
+	// TEST THE OPTIONS ARE REUSED
+	//
+	opts := header.Options
+	mss := header.Options[0]
+
+	// the SYN from the checksum corpus only has an MSS option
+	c.Assert(header.DecodeFromBytes(checksumCorpus[0].data[20:]), IsNil)
+	c.Check(len(header.Options), Equals, 1)
+	c.Check(&header.Options[0], Equals, &opts[0])
+	c.Check(header.Options[0], Equals, mss)
+	c.Check(header.Options[0].Data, DeepEquals, []byte{0x20, 0x00})
+	c.Check(header.DataOffset, Equals, uint8(7))
+	c.Check(header.SeqNum, Equals, uint32(0xdeadbeef))
+	c.Check(string(header.Payload), Equals, "Test")
+
+	// decoding the original segment again uses the
+	// existing option as well as allocating a new one
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(len(header.Options), Equals, 2)
+	c.Check(header.Options[0], Equals, mss)
+	c.Check(header.Options[1].Kind, Equals, packets.TCPOptionKindWindowScale)
+
+	//
+	// TEST ERRORS
+	//
+	err = header.DecodeFromBytes(data[:19])
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "UrgentPointer",
+		Offset: 18,
+		Err:    packetserr.TCPHeaderTruncated{ExpectedSize: 20, Len: 19},
+	})
+
+	err = header.DecodeFromBytes(data[:27])
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "TCP",
+		Field:  "Options",
+		Offset: 20,
+		Err:    packetserr.TCPHeaderTruncated{ExpectedSize: 28, Len: 27},
+	})
+
+	data[12] = 4 << 4
+
+	err = header.DecodeFromBytes(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "TCP", Field: "DataOffset", Offset: 12, Err: packetserr.TCPDataOffsetInvalid})
+}
+
+func (t *TestSuite) TestTCPHeader_DecodeFromBytes_Allocs(c *C) {
+	data := checksumCorpus[0].data[20:]
+
+	var header packets.TCPHeader
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := header.DecodeFromBytes(data); err != nil {
+			c.Fatal(err)
+		}
+	})
+
+	c.Check(allocs, Equals, float64(0))
+}
+
+func (t *TestSuite) BenchmarkUnmarshalTCPHeader(c *C) {
+	data := checksumCorpus[0].data[20:]
+
+	for i := 0; i < c.N; i++ {
+		packets.UnmarshalTCPHeader(data)
+	}
+}
+
+func (t *TestSuite) BenchmarkTCPHeader_DecodeFromBytes(c *C) {
+	data := checksumCorpus[0].data[20:]
+
+	var header packets.TCPHeader
+
+	for i := 0; i < c.N; i++ {
+		header.DecodeFromBytes(data)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import (
+	"encoding/binary"
+
+	"github.com/theckman/packets/err"
+)
+
+// These are the Kind values of the commonly used TCP options. See RFC 793 (EOL,
+// NOP, and MSS), RFC 7323 (Window Scale and Timestamps), and RFC 2018 (SACK).
+const (
+	TCPOptionKindEOL           uint8 = 0
+	TCPOptionKindNOP           uint8 = 1
+	TCPOptionKindMSS           uint8 = 2
+	TCPOptionKindWindowScale   uint8 = 3
+	TCPOptionKindSACKPermitted uint8 = 4
+	TCPOptionKindSACK          uint8 = 5
+	TCPOptionKindTimestamps    uint8 = 8
+
+	tcpMaxWindowScale uint8 = 14
+	tcpMaxSACKBlocks  int   = 4
+	sackBlockLen      int   = 8
+)
+
+// SACKBlock is a struct representing one block of the TCP Selective Acknowledgment
+// (SACK) option. Left is the first sequence number of the block, and Right is the
+// sequence number immediately following the last one in the block.
+type SACKBlock struct {
+	Left  uint32
+	Right uint32
+}
+
+// NewMSSOption is a function that returns a Maximum Segment Size TCPOption.
+func NewMSSOption(mss uint16) *TCPOption {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, mss)
+
+	return &TCPOption{Kind: TCPOptionKindMSS, Length: 4, Data: data}
+}
+
+// NewWindowScaleOption is a function that returns a Window Scale TCPOption with
+// the shift count provided.
+//
+// The error will be of the packetserr.TCPOptionWindowScaleTooLarge type if the
+// shift count is more than 14, which is the largest allowed by RFC 7323.
+func NewWindowScaleOption(shift uint8) (*TCPOption, error) {
+	if shift > tcpMaxWindowScale {
+		return nil, packetserr.TCPOptionWindowScaleTooLarge{Shift: shift}
+	}
+
+	return &TCPOption{Kind: TCPOptionKindWindowScale, Length: 3, Data: []byte{shift}}, nil
+}
+
+// NewSACKPermittedOption is a function that returns a SACK-Permitted TCPOption.
+func NewSACKPermittedOption() *TCPOption {
+	return &TCPOption{Kind: TCPOptionKindSACKPermitted, Length: 2, Data: []byte{}}
+}
+
+// NewSACKOption is a function that returns a SACK TCPOption containing the
+// blocks provided.
+//
+// The error will be of the packetserr.TCPOptionSACKBlocksInvalid type if there
+// isn't at least one block, or if there are more than the four blocks that fit
+// within the TCP options.
+func NewSACKOption(blocks []SACKBlock) (*TCPOption, error) {
+	if len(blocks) == 0 || len(blocks) > tcpMaxSACKBlocks {
+		return nil, packetserr.TCPOptionSACKBlocksInvalid{Count: len(blocks)}
+	}
+
+	data := make([]byte, len(blocks)*sackBlockLen)
+
+	for i, block := range blocks {
+		binary.BigEndian.PutUint32(data[i*sackBlockLen:], block.Left)
+		binary.BigEndian.PutUint32(data[i*sackBlockLen+4:], block.Right)
+	}
+
+	return &TCPOption{Kind: TCPOptionKindSACK, Length: uint8(len(data) + 2), Data: data}, nil
+}
+
+// NewTimestampOption is a function that returns a Timestamps TCPOption with the
+// TSval and TSecr values provided.
+func NewTimestampOption(tsval, tsecr uint32) *TCPOption {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, tsval)
+	binary.BigEndian.PutUint32(data[4:], tsecr)
+
+	return &TCPOption{Kind: TCPOptionKindTimestamps, Length: 10, Data: data}
+}
+
+// MSS is a method to decode the value of a Maximum Segment Size TCPOption.
+//
+// The error will be of the packetserr.TCPOptionKindMismatch type if the option
+// isn't an MSS option, or packetserr.TCPOptionLengthInvalid if its length is
+// not the four bytes required.
+func (opt *TCPOption) MSS() (uint16, error) {
+	data, err := opt.typedData(TCPOptionKindMSS, 2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(data), nil
+}
+
+// WindowScale is a method to decode the shift count of a Window Scale TCPOption.
+// The value is returned as it was found in the option, even if it's larger than
+// the maximum of 14.
+//
+// The error will be of the packetserr.TCPOptionKindMismatch type if the option
+// isn't a Window Scale option, or packetserr.TCPOptionLengthInvalid if its length
+// is not the three bytes required.
+func (opt *TCPOption) WindowScale() (uint8, error) {
+	data, err := opt.typedData(TCPOptionKindWindowScale, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return data[0], nil
+}
+
+// SACKBlocks is a method to decode the blocks of a SACK TCPOption.
+//
+// The error will be of the packetserr.TCPOptionKindMismatch type if the option
+// isn't a SACK option, or packetserr.TCPOptionLengthInvalid if its length isn't
+// for between one and four blocks.
+func (opt *TCPOption) SACKBlocks() ([]SACKBlock, error) {
+	data, err := opt.typedData(TCPOptionKindSACK, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 || len(data)%sackBlockLen != 0 || len(data)/sackBlockLen > tcpMaxSACKBlocks {
+		return nil, packetserr.TCPOptionLengthInvalid{Kind: opt.Kind, Length: uint8(len(data) + 2)}
+	}
+
+	blocks := make([]SACKBlock, len(data)/sackBlockLen)
+
+	for i := range blocks {
+		blocks[i].Left = binary.BigEndian.Uint32(data[i*sackBlockLen:])
+		blocks[i].Right = binary.BigEndian.Uint32(data[i*sackBlockLen+4:])
+	}
+
+	return blocks, nil
+}
+
+// Timestamps is a method to decode the TSval and TSecr values of a Timestamps
+// TCPOption.
+//
+// The error will be of the packetserr.TCPOptionKindMismatch type if the option
+// isn't a Timestamps option, or packetserr.TCPOptionLengthInvalid if its length
+// is not the ten bytes required.
+func (opt *TCPOption) Timestamps() (tsval, tsecr uint32, err error) {
+	data, err := opt.typedData(TCPOptionKindTimestamps, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:]), nil
+}
+
+// Option is a method to find the first option of the kind provided. If there
+// isn't one, nil is returned.
+func (tcpos TCPOptionSlice) Option(kind uint8) *TCPOption {
+	for _, opt := range tcpos {
+		if opt != nil && opt.Kind == kind {
+			return opt
+		}
+	}
+
+	return nil
+}
+
+// MSS is a method to get the value of the Maximum Segment Size option. The
+// boolean is false if there is no MSS option, or if it's malformed.
+func (tcpos TCPOptionSlice) MSS() (uint16, bool) {
+	opt := tcpos.Option(TCPOptionKindMSS)
+	if opt == nil {
+		return 0, false
+	}
+
+	mss, err := opt.MSS()
+
+	return mss, err == nil
+}
+
+// WindowScale is a method to get the shift count of the Window Scale option.
+// The boolean is false if there is no Window Scale option, or if it's malformed.
+func (tcpos TCPOptionSlice) WindowScale() (uint8, bool) {
+	opt := tcpos.Option(TCPOptionKindWindowScale)
+	if opt == nil {
+		return 0, false
+	}
+
+	shift, err := opt.WindowScale()
+
+	return shift, err == nil
+}
+
+// SACKPermitted is a method to determine whether there is a well-formed
+// SACK-Permitted option.
+func (tcpos TCPOptionSlice) SACKPermitted() bool {
+	opt := tcpos.Option(TCPOptionKindSACKPermitted)
+	if opt == nil {
+		return false
+	}
+
+	_, err := opt.typedData(TCPOptionKindSACKPermitted, 0)
+
+	return err == nil
+}
+
+// SACKBlocks is a method to get the blocks of the SACK option. The boolean is
+// false if there is no SACK option, or if it's malformed.
+func (tcpos TCPOptionSlice) SACKBlocks() ([]SACKBlock, bool) {
+	opt := tcpos.Option(TCPOptionKindSACK)
+	if opt == nil {
+		return nil, false
+	}
+
+	blocks, err := opt.SACKBlocks()
+
+	return blocks, err == nil
+}
+
+// Timestamps is a method to get the TSval and TSecr values of the Timestamps
+// option. The boolean is false if there is no Timestamps option, or if it's
+// malformed.
+func (tcpos TCPOptionSlice) Timestamps() (tsval, tsecr uint32, ok bool) {
+	opt := tcpos.Option(TCPOptionKindTimestamps)
+	if opt == nil {
+		return 0, 0, false
+	}
+
+	tsval, tsecr, err := opt.Timestamps()
+
+	return tsval, tsecr, err == nil
+}
+
+// typedData validates the Kind and Length of the option, returning its Data. If
+// dataLen is negative the length of the Data is not validated. A Length of zero
+// is treated the same as it is when marshaling, as len(Data) + 2.
+func (opt *TCPOption) typedData(kind uint8, dataLen int) ([]byte, error) {
+	if opt.Kind != kind {
+		return nil, packetserr.TCPOptionKindMismatch{Expected: kind, Kind: opt.Kind}
+	}
+
+	if opt.Length != 0 && int(opt.Length) != len(opt.Data)+2 {
+		return nil, packetserr.TCPOptionLengthInvalid{Kind: opt.Kind, Length: opt.Length}
+	}
+
+	if dataLen >= 0 && len(opt.Data) != dataLen {
+		return nil, packetserr.TCPOptionLengthInvalid{Kind: opt.Kind, Length: uint8(len(opt.Data) + 2)}
+	}
+
+	return opt.Data, nil
+}
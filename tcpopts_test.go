@@ -0,0 +1,202 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"github.com/theckman/packets"
+	"github.com/theckman/packets/err"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestNewMSSOption(c *C) {
+	opt := packets.NewMSSOption(1460)
+
+	c.Check(opt.Kind, Equals, packets.TCPOptionKindMSS)
+	c.Check(opt.Length, Equals, uint8(4))
+	c.Check(opt.Data, DeepEquals, []byte{0x05, 0xb4})
+
+	mss, err := opt.MSS()
+	c.Assert(err, IsNil)
+	c.Check(mss, Equals, uint16(1460))
+}
+
+func (t *TestSuite) TestNewWindowScaleOption(c *C) {
+	opt, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	c.Check(opt.Kind, Equals, packets.TCPOptionKindWindowScale)
+	c.Check(opt.Length, Equals, uint8(3))
+	c.Check(opt.Data, DeepEquals, []byte{7})
+
+	shift, err := opt.WindowScale()
+	c.Assert(err, IsNil)
+	c.Check(shift, Equals, uint8(7))
+
+	opt, err = packets.NewWindowScaleOption(15)
+	c.Assert(err, Not(IsNil))
+	c.Check(opt, IsNil)
+	c.Check(err, Equals, packetserr.TCPOptionWindowScaleTooLarge{Shift: 15})
+}
+
+func (t *TestSuite) TestNewSACKOption(c *C) {
+	blocks := []packets.SACKBlock{
+		{Left: 1000, Right: 2000},
+		{Left: 3000, Right: 4000},
+	}
+
+	opt, err := packets.NewSACKOption(blocks)
+	c.Assert(err, IsNil)
+
+	c.Check(opt.Kind, Equals, packets.TCPOptionKindSACK)
+	c.Check(opt.Length, Equals, uint8(18))
+	c.Check(opt.Data, DeepEquals, []byte{
+		0x00, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x07, 0xd0,
+		0x00, 0x00, 0x0b, 0xb8, 0x00, 0x00, 0x0f, 0xa0,
+	})
+
+	decoded, err := opt.SACKBlocks()
+	c.Assert(err, IsNil)
+	c.Check(decoded, DeepEquals, blocks)
+
+	opt, err = packets.NewSACKOption(nil)
+	c.Assert(err, Not(IsNil))
+	c.Check(opt, IsNil)
+	c.Check(err, Equals, packetserr.TCPOptionSACKBlocksInvalid{Count: 0})
+
+	opt, err = packets.NewSACKOption(make([]packets.SACKBlock, 5))
+	c.Assert(err, Not(IsNil))
+	c.Check(opt, IsNil)
+	c.Check(err, Equals, packetserr.TCPOptionSACKBlocksInvalid{Count: 5})
+
+	//
+	// TEST DECODING A SACK OPTION WITH A PARTIAL BLOCK
+	//
+	opt = &packets.TCPOption{Kind: 5, Length: 6, Data: []byte{0, 0, 0, 1}}
+
+	decoded, err = opt.SACKBlocks()
+	c.Assert(err, Not(IsNil))
+	c.Check(decoded, IsNil)
+	c.Check(err, Equals, packetserr.TCPOptionLengthInvalid{Kind: 5, Length: 6})
+}
+
+func (t *TestSuite) TestNewTimestampOption(c *C) {
+	opt := packets.NewTimestampOption(0xdeadbeef, 42)
+
+	c.Check(opt.Kind, Equals, packets.TCPOptionKindTimestamps)
+	c.Check(opt.Length, Equals, uint8(10))
+	c.Check(opt.Data, DeepEquals, []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x00, 0x00, 0x2a})
+
+	tsval, tsecr, err := opt.Timestamps()
+	c.Assert(err, IsNil)
+	c.Check(tsval, Equals, uint32(0xdeadbeef))
+	c.Check(tsecr, Equals, uint32(42))
+}
+
+func (t *TestSuite) TestTCPOption_MSS(c *C) {
+	// a Length of zero is calculated from the Data
+	opt := &packets.TCPOption{Kind: 2, Data: []byte{0x20, 0x00}}
+
+	mss, err := opt.MSS()
+	c.Assert(err, IsNil)
+	c.Check(mss, Equals, uint16(8192))
+
+	//
+	// TEST packetserr.TCPOptionKindMismatch
+	//
+	opt = packets.NewTimestampOption(1, 2)
+
+	mss, err = opt.MSS()
+	c.Assert(err, Not(IsNil))
+	c.Check(mss, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.TCPOptionKindMismatch{Expected: 2, Kind: 8})
+
+	//
+	// TEST packetserr.TCPOptionLengthInvalid
+	//
+	opt = &packets.TCPOption{Kind: 2, Length: 3, Data: []byte{0x20}}
+
+	mss, err = opt.MSS()
+	c.Assert(err, Not(IsNil))
+	c.Check(mss, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.TCPOptionLengthInvalid{Kind: 2, Length: 3})
+
+	// the Length doesn't agree with the Data
+	opt = &packets.TCPOption{Kind: 2, Length: 4, Data: []byte{0x20}}
+
+	mss, err = opt.MSS()
+	c.Assert(err, Not(IsNil))
+	c.Check(mss, Equals, uint16(0))
+	c.Check(err, Equals, packetserr.TCPOptionLengthInvalid{Kind: 2, Length: 4})
+}
+
+func (t *TestSuite) TestTCPOptionSlice_Accessors(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	sack, err := packets.NewSACKOption([]packets.SACKBlock{{Left: 1, Right: 2}})
+	c.Assert(err, IsNil)
+
+	opts := packets.TCPOptionSlice{
+		packets.NewMSSOption(1460),
+		packets.NewSACKPermittedOption(),
+		packets.NewTimestampOption(100, 0),
+		nil,
+		wscale,
+		sack,
+	}
+
+	// make sure the options survive a round trip through marshaling
+	data, err := opts.Marshal()
+	c.Assert(err, IsNil)
+
+	opts, err = packets.UnmarshalTCPOptionSlice(data)
+	c.Assert(err, IsNil)
+
+	mss, ok := opts.MSS()
+	c.Check(ok, Equals, true)
+	c.Check(mss, Equals, uint16(1460))
+
+	c.Check(opts.SACKPermitted(), Equals, true)
+
+	tsval, tsecr, ok := opts.Timestamps()
+	c.Check(ok, Equals, true)
+	c.Check(tsval, Equals, uint32(100))
+	c.Check(tsecr, Equals, uint32(0))
+
+	shift, ok := opts.WindowScale()
+	c.Check(ok, Equals, true)
+	c.Check(shift, Equals, uint8(7))
+
+	blocks, ok := opts.SACKBlocks()
+	c.Check(ok, Equals, true)
+	c.Check(blocks, DeepEquals, []packets.SACKBlock{{Left: 1, Right: 2}})
+
+	c.Check(opts.Option(packets.TCPOptionKindMSS), Equals, opts[0])
+	c.Check(opts.Option(42), IsNil)
+
+	//
+	// TEST MISSING AND MALFORMED OPTIONS
+	//
+	opts = packets.TCPOptionSlice{
+		{Kind: 2, Length: 3, Data: []byte{1}},
+		{Kind: 4, Length: 3, Data: []byte{1}},
+	}
+
+	mss, ok = opts.MSS()
+	c.Check(ok, Equals, false)
+	c.Check(mss, Equals, uint16(0))
+
+	c.Check(opts.SACKPermitted(), Equals, false)
+
+	_, _, ok = opts.Timestamps()
+	c.Check(ok, Equals, false)
+
+	_, ok = opts.WindowScale()
+	c.Check(ok, Equals, false)
+
+	blocks, ok = opts.SACKBlocks()
+	c.Check(ok, Equals, false)
+	c.Check(blocks, IsNil)
+}
@@ -5,28 +5,40 @@
 package packets
 
 import (
-	"bytes"
 	"encoding/binary"
+	"net/netip"
 
 	"github.com/theckman/packets/err"
 )
 
 const (
-	udpHeaderLen int = 8
-	maxUint16    int = int(^uint16(0))
+	udpHeaderLen      int = 8
+	udpChecksumOffset int = 6
+	maxUint16         int = int(^uint16(0))
 )
 
 // UDPHeader is the struct representing a UDP header.
+//
+// Marshaling never modifies the *UDPHeader instance, so it's safe to marshal the
+// same header from multiple goroutines at once, as long as nothing modifies it at
+// the same time.
 type UDPHeader struct {
 	SourcePort      uint16
 	DestinationPort uint16
-	Length          uint16 // if set to zero it will be automatically set
+	Length          uint16 // if set to zero it will be automatically set, unless ZeroLength is set
 	Checksum        uint16
 	Payload         []byte
+	ZeroLength      bool // marshal a Length of 0 as is, rather than filling it in
+	RawLength       int  // the length of the data the header was decoded from, if set; see Validate()
 }
 
 // UnmarshalUDPHeader is a function that takes a byte slice anf formats it in to an
-// instance of *UDPHeader. This also assumes the packet is properly formatted.
+// instance of *UDPHeader. The Payload is the data following the header, up to the
+// length specified in the Length field.
+//
+// The data is validated before being parsed, so this is safe to use on data from
+// untrusted sources. The error is a packetserr.DecodeError wrapping the
+// packetserr.UDPHeaderTruncated or packetserr.UDPLengthInvalid types.
 func UnmarshalUDPHeader(data []byte) (*UDPHeader, error) {
 	return unmarshalUDPHeader(data)
 }
@@ -37,84 +49,231 @@ func UnmarshalUDPHeader(data []byte) (*UDPHeader, error) {
 // To note, if the checksum is not provided (i.e., 0) the kernel SHOULD automatically
 // calculate this for you.
 //
-// If the Checksum field is set, it will be included in the marshaled data.
+// If the Checksum field is set, it will be included in the marshaled data. If the
+// Length field is zero it's filled in within the marshaled data; the *UDPHeader
+// instance is not modified.
 func (udp *UDPHeader) Marshal() ([]byte, error) {
 	return udp.marshalUDPHeader()
 }
 
 // MarshalWithChecksum is a function to marshal the *UDPHeader instance to a byte
-// slice including the calculation of the Checksum field.
+// slice including the calculation of the Checksum field. The *UDPHeader instance
+// is not modified, and the Checksum field is ignored.
 //
 // It's suggested that you use Marshal() instead and offload the checksumming
 // to your kernel (which should do it automatically if field is zero)
 //
 // Because of the requirement to create a pseudoheader to do the checksumming the
-// local IPv4 address and remote IPv4 address must be provided in string form.
+// local address and remote address must be provided in string form. They may either
+// be IPv4 or IPv6 addresses, and the pseudoheader is chosen based on their address
+// family. Both addresses must be of the same family, otherwise the error will be
+// packetserr.ChecksumAddressFamilyMismatch.
+//
+// If either address can't be parsed the error will be of the
+// packetserr.IPv4AddressInvalid or packetserr.IPv6AddressInvalid types.
 func (udp *UDPHeader) MarshalWithChecksum(laddr, raddr string) ([]byte, error) {
-	// marshal the header
-	data, err := udp.marshalUDPHeader()
-
+	src, err := parseIPAddr(laddr)
 	if err != nil {
 		return nil, err
 	}
 
-	csum, err := ChecksumIPv4(data, "udp", laddr, raddr)
+	dst, err := parseIPAddr(raddr)
 	if err != nil {
 		return nil, err
 	}
 
-	udp.Checksum = csum
+	return udp.MarshalWithChecksumAddr(src, dst)
+}
 
-	// remarshal again, with proper Checksum this time
-	data, err = udp.marshalUDPHeader()
+// MarshalWithChecksumAddr is a function to marshal the *UDPHeader instance to a
+// byte slice including the calculation of the Checksum field. It's the same as
+// MarshalWithChecksum() except that the local and remote addresses are provided
+// as netip.Addr values.
+//
+// The pseudoheader used for the checksum is chosen based on the address family
+// of the addresses, which must match. IPv4-mapped IPv6 addresses are treated as
+// the IPv4 addresses they contain.
+func (udp *UDPHeader) MarshalWithChecksumAddr(laddr, raddr netip.Addr) ([]byte, error) {
+	// marshal the header
+	data, err := udp.marshalUDPHeader()
 
 	if err != nil {
 		return nil, err
 	}
 
-	return data, nil
-}
-
-func unmarshalUDPHeader(data []byte) (*UDPHeader, error) {
-	var header UDPHeader
-
-	reader := bytes.NewReader(data)
+	// the checksum is calculated with the Checksum field zeroed
+	binary.BigEndian.PutUint16(data[udpChecksumOffset:], 0)
 
-	err := binary.Read(reader, binary.BigEndian, &header.SourcePort)
+	csum, err := checksumIPAddr(data, "udp", laddr, raddr)
 	if err != nil {
 		return nil, err
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &header.DestinationPort)
-	if err != nil {
-		return nil, err
+	// a checksum of zero means there isn't one, so
+	// it's sent as its one's complement equivalent
+	if csum == 0 {
+		csum = 0xffff
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &header.Length)
+	binary.BigEndian.PutUint16(data[udpChecksumOffset:], csum)
+
+	return data, nil
+}
+
+// VerifyChecksum is a method to check the Checksum of a *UDPHeader, such as one
+// that was decoded, using the source and destination addresses of the IP header
+// that carried the datagram. The checksum is computed over the header as it would
+// be marshaled, including the Payload, and compared against the Checksum field,
+// so any changes to the fields after it was decoded are considered.
+//
+// Over IPv4 a Checksum of zero means the sender didn't compute one, so there's
+// nothing to verify and the error is nil. The checksum is mandatory over IPv6
+// (RFC 8200, section 8.1), so there a Checksum of zero is a mismatch. As when
+// marshaling, IPv4-mapped IPv6 addresses are treated as IPv4 addresses.
+//
+// The error will be of the packetserr.ChecksumMismatch type if the Checksum isn't
+// correct. Otherwise, it may be any of the errors returned by MarshalWithChecksum().
+func (udp *UDPHeader) VerifyChecksum(src, dst string) error {
+	srcAddr, err := parseIPAddr(src)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = binary.Read(reader, binary.BigEndian, &header.Checksum)
+	dstAddr, err := parseIPAddr(dst)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	bytesToRead := int(header.Length) - udpHeaderLen
+	return udp.VerifyChecksumAddr(srcAddr, dstAddr)
+}
 
-	payload := make([]byte, bytesToRead)
+// VerifyChecksumAddr is a method to check the Checksum of a *UDPHeader. It's the
+// same as VerifyChecksum() except that the source and destination addresses are
+// provided as netip.Addr values.
+func (udp *UDPHeader) VerifyChecksumAddr(src, dst netip.Addr) error {
+	if udp.Checksum == 0 && src.Unmap().Is4() {
+		return nil
+	}
 
-	err = binary.Read(reader, binary.BigEndian, &payload)
+	data, err := udp.marshalUDPHeader()
 	if err != nil {
+		return err
+	}
+
+	return verifyChecksum(data, udpChecksumOffset, "udp", src, dst)
+}
+
+// udpFields are the fields of the UDP header, for describing where decoding
+// failed.
+var udpFields = []headerField{
+	{0, "SourcePort"}, {2, "DestinationPort"}, {4, "Length"}, {6, "Checksum"},
+}
+
+// DecodeFromBytes is a method to parse the byte slice in to the *UDPHeader,
+// overwriting all of its fields. It's the same as UnmarshalUDPHeader() except
+// that the Payload isn't copied, and instead references the data provided.
+//
+// This makes it possible to decode many datagrams without allocating, as long
+// as the data isn't modified while the *UDPHeader is still in use. If an error
+// is returned the contents of the *UDPHeader are undefined.
+func (udp *UDPHeader) DecodeFromBytes(data []byte) error {
+	udp.RawLength = 0
+
+	if len(data) < udpHeaderLen {
+		return truncatedError(LayerTypeUDP, udpFields, len(data), packetserr.UDPHeaderTruncated{Len: len(data)})
+	}
+
+	udp.SourcePort = binary.BigEndian.Uint16(data[0:2])
+	udp.DestinationPort = binary.BigEndian.Uint16(data[2:4])
+	udp.Length = binary.BigEndian.Uint16(data[4:6])
+	udp.Checksum = binary.BigEndian.Uint16(data[6:8])
+
+	// a Length of zero is rejected below, so there's no zero Length to keep
+	udp.ZeroLength = false
+
+	// the Length field counts the header, and must not
+	// claim there is more data than what was provided
+	if int(udp.Length) < udpHeaderLen || int(udp.Length) > len(data) {
+		return decodeError(LayerTypeUDP, "Length", 4, packetserr.UDPLengthInvalid{Length: udp.Length, Len: len(data)})
+	}
+
+	udp.Payload = data[udpHeaderLen:udp.Length:udp.Length]
+	udp.RawLength = len(data)
+
+	return nil
+}
+
+func unmarshalUDPHeader(data []byte) (*UDPHeader, error) {
+	var header UDPHeader
+
+	if err := header.DecodeFromBytes(data); err != nil {
 		return nil, err
 	}
 
-	header.Payload = payload
+	// copy the Payload so the header doesn't
+	// share memory with the data provided
+	header.Payload = copyBytes(header.Payload)
 
 	return &header, nil
 }
 
+// SerializedLen is a method to determine how many bytes the *UDPHeader will be
+// once marshaled, including the Payload.
+func (udp *UDPHeader) SerializedLen() int {
+	return udpHeaderLen + len(udp.Payload)
+}
+
+// MarshalTo is a method to marshal the *UDPHeader in to the byte slice provided,
+// returning the number of bytes written. Nothing is allocated, so b must be at
+// least SerializedLen() bytes long. This is otherwise the same as Marshal().
+//
+// The error may be of the packetserr.BufferTooSmall or packetserr.UDPPayloadTooLarge
+// types.
+func (udp *UDPHeader) MarshalTo(b []byte) (int, error) {
+	n := udp.SerializedLen()
+
+	if len(b) < n {
+		return 0, packetserr.BufferTooSmall{ExpectedSize: n, Len: len(b)}
+	}
+
+	data, err := udp.AppendBinary(b[:0])
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// AppendBinary is a method to marshal the *UDPHeader, appending it to the byte
+// slice provided. If b has enough capacity nothing is allocated. This is
+// otherwise the same as Marshal().
+func (udp *UDPHeader) AppendBinary(b []byte) ([]byte, error) {
+	return udp.appendUDPHeader(b)
+}
+
+// MarshalRaw is a method to marshal the *UDPHeader exactly as it's set, for
+// building deliberately malformed datagrams to test how they're handled. Nothing
+// is validated or filled in: the Length and Checksum fields are written even if
+// they're zero or don't match the Payload, and the Payload is written even if
+// it's too large for the Length field.
+//
+// Use Marshal() for datagrams that are meant to be correct.
+func (udp *UDPHeader) MarshalRaw() []byte {
+	b := make([]byte, udpHeaderLen, udpHeaderLen+len(udp.Payload))
+
+	binary.BigEndian.PutUint16(b[0:], udp.SourcePort)
+	binary.BigEndian.PutUint16(b[2:], udp.DestinationPort)
+	binary.BigEndian.PutUint16(b[4:], udp.Length)
+	binary.BigEndian.PutUint16(b[6:], udp.Checksum)
+
+	return append(b, udp.Payload...)
+}
+
 func (udp *UDPHeader) marshalUDPHeader() ([]byte, error) {
+	return udp.appendUDPHeader(make([]byte, 0, udp.SerializedLen()))
+}
+
+func (udp *UDPHeader) appendUDPHeader(b []byte) ([]byte, error) {
 	packetSize := len(udp.Payload) + udpHeaderLen
 
 	if packetSize > maxUint16 {
@@ -124,36 +283,23 @@ func (udp *UDPHeader) marshalUDPHeader() ([]byte, error) {
 		}
 	}
 
-	if udp.Length == 0 {
-		udp.Length = uint16(packetSize)
-	}
+	length := udp.Length
 
-	buf := new(bytes.Buffer)
-
-	err := binary.Write(buf, binary.BigEndian, udp.SourcePort)
-	if err != nil {
-		return nil, err
+	if length == 0 && !udp.ZeroLength {
+		length = uint16(packetSize)
 	}
 
-	err = binary.Write(buf, binary.BigEndian, udp.DestinationPort)
-	if err != nil {
-		return nil, err
-	}
+	start := len(b)
+	b = append(b, zeroes[:udpHeaderLen]...)
 
-	err = binary.Write(buf, binary.BigEndian, udp.Length)
-	if err != nil {
-		return nil, err
-	}
+	h := b[start:]
 
-	err = binary.Write(buf, binary.BigEndian, udp.Checksum)
-	if err != nil {
-		return nil, err
-	}
+	binary.BigEndian.PutUint16(h[0:], udp.SourcePort)
+	binary.BigEndian.PutUint16(h[2:], udp.DestinationPort)
+	binary.BigEndian.PutUint16(h[4:], length)
+	binary.BigEndian.PutUint16(h[6:], udp.Checksum)
 
-	err = binary.Write(buf, binary.BigEndian, udp.Payload)
-	if err != nil {
-		return nil, err
-	}
+	b = append(b, udp.Payload...)
 
-	return buf.Bytes(), nil
+	return b, nil
 }
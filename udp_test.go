@@ -7,7 +7,10 @@ package packets_test
 import (
 	"bytes"
 	"encoding/binary"
+	"net/netip"
 	"reflect"
+	"sync"
+	"testing"
 
 	"github.com/theckman/packets"
 	"github.com/theckman/packets/err"
@@ -49,6 +52,39 @@ func (t *TestSuite) TestUnmarshalUDPHeader(c *C) {
 	c.Check(header.Payload[1], Equals, uint8(128))
 	c.Check(header.Payload[2], Equals, uint8(0))
 	c.Check(header.Payload[3], Equals, uint8(0))
+
+	data := buf.Bytes()
+
+	//
+	// TEST DATA SHORTER THAN THE HEADER
+	//
+	header, err = packets.UnmarshalUDPHeader(data[:7])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "UDP",
+		Field:  "Checksum",
+		Offset: 6,
+		Err:    packetserr.UDPHeaderTruncated{Len: 7},
+	})
+
+	//
+	// TEST Length LARGER THAN THE DATA
+	//
+	header, err = packets.UnmarshalUDPHeader(data[:10])
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "UDP", Field: "Length", Offset: 4, Err: packetserr.UDPLengthInvalid{Length: 12, Len: 10}})
+
+	//
+	// TEST Length SMALLER THAN THE HEADER
+	//
+	Te.PutUint16(data[4:6], 7)
+
+	header, err = packets.UnmarshalUDPHeader(data)
+	c.Assert(err, Not(IsNil))
+	c.Check(header, IsNil)
+	c.Check(err, Equals, packetserr.DecodeError{Layer: "UDP", Field: "Length", Offset: 4, Err: packetserr.UDPLengthInvalid{Length: 7, Len: 12}})
 }
 
 func (t *TestSuite) TestUDPHeader_Marshal(c *C) {
@@ -111,6 +147,67 @@ func (t *TestSuite) TestUDPHeader_Marshal(c *C) {
 	}
 }
 
+func (t *TestSuite) TestUDPHeader_Marshal_NotModified(c *C) {
+	t.u.Length = 0
+
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[4:6]), Equals, uint16(12))
+
+	csumData, err := t.u.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(csumData[6:8]), Equals, uint16(50827))
+
+	c.Check(t.u.Length, Equals, uint16(0))
+	c.Check(t.u.Checksum, Equals, uint16(0))
+
+	// a Checksum that's already set doesn't change the one calculated
+	t.u.Checksum = 0xbeef
+
+	data, err = t.u.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, csumData)
+	c.Check(t.u.Checksum, Equals, uint16(0xbeef))
+
+	//
+	// TEST CONCURRENT MARSHALING
+	//
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				data, err := t.u.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+				c.Check(err, IsNil)
+				c.Check(data, DeepEquals, csumData)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (t *TestSuite) TestUDPHeader_Marshal_ZeroLength(c *C) {
+	t.u.Length = 0
+	t.u.ZeroLength = true
+
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[4:6]), Equals, uint16(0))
+	c.Check(len(data), Equals, 12)
+
+	// the flag only matters when the Length is zero
+	t.u.Length = 42
+
+	data, err = t.u.Marshal()
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[4:6]), Equals, uint16(42))
+}
+
 func (t *TestSuite) TestUDPHeader_MarshalWithChecksum(c *C) {
 	var data []byte
 	var err error
@@ -135,7 +232,7 @@ func (t *TestSuite) TestUDPHeader_MarshalWithChecksum(c *C) {
 	c.Check(u16, Equals, uint16(12))
 	// Checksum
 	c.Assert(binary.Read(r, Te, &u16), IsNil)
-	c.Check(u16, Equals, uint16(35782))
+	c.Check(u16, Equals, uint16(50827))
 
 	// Payload
 	c.Assert(binary.Read(r, Te, &u8), IsNil)
@@ -147,3 +244,315 @@ func (t *TestSuite) TestUDPHeader_MarshalWithChecksum(c *C) {
 	c.Assert(binary.Read(r, Te, &u8), IsNil)
 	c.Check(u8, Equals, uint8(0))
 }
+
+func (t *TestSuite) TestUDPHeader_MarshalWithChecksum_IPv6(c *C) {
+	data, err := t.u.MarshalWithChecksum("fe80::1", "fe80::2")
+	c.Assert(err, IsNil)
+	c.Assert(len(data), Equals, 12)
+
+	// Checksum
+	c.Check(Te.Uint16(data[6:8]), Equals, uint16(0xc78a))
+
+	//
+	// TEST MISMATCHED ADDRESS FAMILIES
+	//
+	t.SetUpTest(c)
+
+	data, err = t.u.MarshalWithChecksum("fe80::1", "127.0.0.2")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ChecksumAddressFamilyMismatch)
+}
+
+func (t *TestSuite) TestUDPHeader_MarshalWithChecksumAddr(c *C) {
+	expected, err := t.u.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	t.SetUpTest(c)
+
+	data, err := t.u.MarshalWithChecksumAddr(netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+
+	//
+	// TEST IPv4-MAPPED ADDRESSES
+	//
+	t.SetUpTest(c)
+
+	unchecked, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	// the IPv4 pseudo-header is used, the same as with ChecksumIPv4Addr
+	csum, err := packets.ChecksumIPv4Addr(unchecked, "udp", netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::ffff:127.0.0.2"))
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(expected[6:8]), Equals, csum)
+
+	data, err = t.u.MarshalWithChecksumAddr(netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::ffff:127.0.0.2"))
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+
+	//
+	// TEST MISMATCHED ADDRESS FAMILIES
+	//
+	t.SetUpTest(c)
+
+	data, err = t.u.MarshalWithChecksumAddr(netip.MustParseAddr("fe80::1"), netip.MustParseAddr("127.0.0.2"))
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.ChecksumAddressFamilyMismatch)
+
+	//
+	// TEST INVALID ADDRESS STRINGS
+	//
+	data, err = t.u.MarshalWithChecksum("127.0.0.1", "300.1.1.1")
+	c.Assert(err, Not(IsNil))
+	c.Check(data, IsNil)
+	c.Check(err, Equals, packetserr.IPv4AddressInvalid{Address: "300.1.1.1"})
+}
+
+func (t *TestSuite) TestUDPHeader_VerifyChecksum(c *C) {
+	data, err := t.u.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	// anything following the Length isn't covered by the checksum
+	data = append(data, 0xff, 0xff)
+
+	header, err := packets.UnmarshalUDPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+	c.Check(header.VerifyChecksumAddr(netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2")), IsNil)
+
+	// the checksum is verified against the fields as they're
+	// set, so changing them after decoding is considered
+	header.DestinationPort++
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	header.DestinationPort--
+
+	payload := header.Payload
+	header.Payload, header.Length = make([]byte, 8), 16
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	header.Payload, header.Length = payload, 12
+	c.Check(header.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	// a header that wasn't decoded is verified the same way
+	t.u.Checksum = 50827
+	c.Check(t.u.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	t.u.Checksum = 50826
+	c.Check(t.u.VerifyChecksum("127.0.0.1", "127.0.0.2"), Equals, packetserr.ChecksumMismatch{Expected: 50827, Actual: 50826})
+
+	//
+	// TEST CHECKSUM MISMATCHES
+	//
+	err = header.VerifyChecksum("127.0.0.1", "127.0.0.3")
+	c.Assert(err, Not(IsNil))
+
+	mismatch, ok := err.(packetserr.ChecksumMismatch)
+	c.Assert(ok, Equals, true)
+	c.Check(mismatch.Actual, Equals, uint16(50827))
+	c.Check(mismatch.Expected, Not(Equals), uint16(50827))
+
+	// the payload is covered by the checksum
+	data[8]++
+
+	var decoded packets.UDPHeader
+
+	c.Assert(decoded.DecodeFromBytes(data), IsNil)
+	c.Check(decoded.VerifyChecksum("127.0.0.1", "127.0.0.2"), FitsTypeOf, packetserr.ChecksumMismatch{})
+
+	//
+	// TEST NO CHECKSUM
+	//
+	data[6], data[7] = 0, 0
+
+	c.Assert(decoded.DecodeFromBytes(data), IsNil)
+	c.Check(decoded.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	// IPv4-mapped IPv6 addresses are treated as IPv4 addresses
+	c.Check(decoded.VerifyChecksum("::ffff:127.0.0.1", "::ffff:127.0.0.2"), IsNil)
+	c.Check(decoded.VerifyChecksumAddr(netip.MustParseAddr("::ffff:127.0.0.1"), netip.MustParseAddr("127.0.0.2")), IsNil)
+
+	// the checksum is mandatory over IPv6
+	err = decoded.VerifyChecksum("fe80::1", "fe80::2")
+	c.Assert(err, Not(IsNil))
+
+	mismatch, ok = err.(packetserr.ChecksumMismatch)
+	c.Assert(ok, Equals, true)
+	c.Check(mismatch.Actual, Equals, uint16(0))
+	c.Check(mismatch.Expected, Not(Equals), uint16(0))
+
+	//
+	// TEST COMPUTED CHECKSUM OF ZERO
+	//
+	udp := &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53, Payload: []byte{0, 0}}
+
+	data, err = udp.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+
+	// adding the checksum to the data makes the
+	// checksum of the data zero, which is sent as 0xffff
+	udp = &packets.UDPHeader{SourcePort: 4242, DestinationPort: 53, Payload: data[6:8]}
+
+	data, err = udp.MarshalWithChecksum("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Check(Te.Uint16(data[6:8]), Equals, uint16(0xffff))
+
+	c.Assert(decoded.DecodeFromBytes(data), IsNil)
+	c.Check(decoded.VerifyChecksum("127.0.0.1", "127.0.0.2"), IsNil)
+
+	//
+	// TEST INVALID ADDRESSES
+	//
+	c.Check(header.VerifyChecksum("fe80::1", "127.0.0.2"), Equals, packetserr.ChecksumAddressFamilyMismatch)
+	c.Check(header.VerifyChecksum("127.0.0.1", "fe80::g"), Equals, packetserr.IPv6AddressInvalid{Address: "fe80::g"})
+}
+
+func (t *TestSuite) TestUDPHeader_MarshalTo(c *C) {
+	c.Check(t.u.SerializedLen(), Equals, 12)
+
+	expected, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	buf := make([]byte, 16)
+
+	n, err := t.u.MarshalTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 12)
+	c.Check(buf[:n], DeepEquals, expected)
+
+	data, err := t.u.AppendBinary([]byte{42})
+	c.Assert(err, IsNil)
+	c.Check(data[0], Equals, uint8(42))
+	c.Check(data[1:], DeepEquals, expected)
+
+	//
+	// TEST packetserr.BufferTooSmall
+	//
+	n, err = t.u.MarshalTo(buf[:11])
+	c.Assert(err, Not(IsNil))
+	c.Check(n, Equals, 0)
+	c.Check(err, Equals, packetserr.BufferTooSmall{ExpectedSize: 12, Len: 11})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := t.u.MarshalTo(buf); err != nil {
+			c.Fatal(err)
+		}
+	})
+
+	c.Check(allocs, Equals, float64(0))
+}
+
+func (t *TestSuite) BenchmarkUDPHeader_Marshal(c *C) {
+	for i := 0; i < c.N; i++ {
+		t.u.Marshal()
+	}
+}
+
+func (t *TestSuite) BenchmarkUDPHeader_MarshalTo(c *C) {
+	buf := make([]byte, t.u.SerializedLen())
+
+	c.ResetTimer()
+
+	for i := 0; i < c.N; i++ {
+		t.u.MarshalTo(buf)
+	}
+}
+
+func (t *TestSuite) TestUDPHeader_MarshalRaw(c *C) {
+	t.u.Length = 42
+	t.u.Checksum = 0xbeef
+
+	c.Check(t.u.MarshalRaw(), DeepEquals, []byte{
+		0x10, 0x92, 0x00, 0x35, 0x00, 0x2a, 0xbe, 0xef,
+		42, 128, 0, 0,
+	})
+
+	// a Length of zero is written as is
+	t.u.Length = 0
+
+	data := t.u.MarshalRaw()
+	c.Check(Te.Uint16(data[4:6]), Equals, uint16(0))
+
+	// as is a Payload too large for the Length field
+	t.u.Payload = make([]byte, 70000)
+
+	_, err := t.u.Marshal()
+	c.Check(err, FitsTypeOf, packetserr.UDPPayloadTooLarge{})
+	c.Check(len(t.u.MarshalRaw()), Equals, 70008)
+}
+
+func (t *TestSuite) TestUDPHeader_DecodeFromBytes(c *C) {
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	// anything following the Length is not part of the Payload
+	data = append(data, 0xff, 0xff)
+
+	expected, err := packets.UnmarshalUDPHeader(data)
+	c.Assert(err, IsNil)
+
+	var header packets.UDPHeader
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(&header, DeepEquals, expected)
+	c.Check(cap(header.Payload), Equals, 4)
+
+	// nothing is copied, so the header references the data
+	data[8] = 0
+	c.Check(header.Payload, DeepEquals, []byte{0, 128, 0, 0})
+
+	// every field is overwritten, including ZeroLength
+	header.ZeroLength = true
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(header.ZeroLength, Equals, false)
+
+	//
+	// TEST ERRORS
+	//
+	err = header.DecodeFromBytes(data[:7])
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "UDP",
+		Field:  "Checksum",
+		Offset: 6,
+		Err:    packetserr.UDPHeaderTruncated{Len: 7},
+	})
+
+	err = header.DecodeFromBytes(data[:11])
+	c.Assert(err, Not(IsNil))
+	c.Check(err, Equals, packetserr.DecodeError{
+		Layer:  "UDP",
+		Field:  "Length",
+		Offset: 4,
+		Err:    packetserr.UDPLengthInvalid{Length: 12, Len: 11},
+	})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := header.DecodeFromBytes(data); err != nil {
+			c.Fatal(err)
+		}
+	})
+
+	c.Check(allocs, Equals, float64(0))
+}
+
+func (t *TestSuite) BenchmarkUnmarshalUDPHeader(c *C) {
+	data := checksumCorpus[1].data[20:]
+
+	for i := 0; i < c.N; i++ {
+		packets.UnmarshalUDPHeader(data)
+	}
+}
+
+func (t *TestSuite) BenchmarkUDPHeader_DecodeFromBytes(c *C) {
+	data := checksumCorpus[1].data[20:]
+
+	var header packets.UDPHeader
+
+	for i := 0; i < c.N; i++ {
+		header.DecodeFromBytes(data)
+	}
+}
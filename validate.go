@@ -0,0 +1,234 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets
+
+import "fmt"
+
+// Severity is how serious the protocol violation of a Finding is.
+type Severity uint8
+
+// These are the severities of the findings returned by the Validate() methods.
+const (
+	// SeverityWarning is for headers that break a rule of the RFC, but which
+	// receivers are expected to cope with, such as by ignoring the field.
+	SeverityWarning Severity = iota + 1
+
+	// SeverityError is for headers that can't be correct, and are likely to be
+	// dropped or mishandled by the receiver or any middlebox on the way.
+	SeverityError
+)
+
+var severityNames = map[Severity]string{
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// FindingCode identifies the protocol violation of a Finding, so that findings
+// can be checked for without matching on their messages.
+type FindingCode uint8
+
+// These are the protocol violations found by the Validate() methods.
+const (
+	FindingSYNFIN                  FindingCode = iota + 1 // TCP SYN and FIN are both set
+	FindingSYNRST                                         // TCP SYN and RST are both set
+	FindingReservedBits                                   // TCP Reserved bits aren't zero
+	FindingUrgentPointerWithoutURG                        // TCP UrgentPointer is set, but URG isn't
+	FindingAckNumWithoutACK                               // TCP AckNum is set, but ACK isn't
+	FindingOptionAfterEOL                                 // TCP option follows the End of Option List
+	FindingDuplicateOption                                // TCP MSS or Window Scale option appears more than once
+	FindingSYNOnlyOption                                  // TCP option that's only allowed on a SYN segment
+	FindingUDPLengthMismatch                              // UDP Length doesn't match the length of the datagram
+)
+
+var findingCodeNames = map[FindingCode]string{
+	FindingSYNFIN:                  "SYNFIN",
+	FindingSYNRST:                  "SYNRST",
+	FindingReservedBits:            "ReservedBits",
+	FindingUrgentPointerWithoutURG: "UrgentPointerWithoutURG",
+	FindingAckNumWithoutACK:        "AckNumWithoutACK",
+	FindingOptionAfterEOL:          "OptionAfterEOL",
+	FindingDuplicateOption:         "DuplicateOption",
+	FindingSYNOnlyOption:           "SYNOnlyOption",
+	FindingUDPLengthMismatch:       "UDPLengthMismatch",
+}
+
+func (fc FindingCode) String() string {
+	if name, ok := findingCodeNames[fc]; ok {
+		return name
+	}
+
+	return "Unknown"
+}
+
+// Finding is a struct representing a protocol violation found in a header by one
+// of the Validate() methods. The Message describes the violation in terms of the
+// fields of the header.
+type Finding struct {
+	Code     FindingCode
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Code)
+}
+
+// Validate is a method to check the *TCPHeader for violations of the RFCs, such
+// as SYN and FIN both being set or options that are only allowed on a SYN segment.
+// This is meant for checking crafted headers before sending them, or captured
+// headers when analyzing them. If nothing is found the slice is nil.
+//
+// The fields are checked as they're set, so fields that are filled in when
+// marshaling aren't considered. If the RawOptions field is set, such as by
+// decoding the header, the options are checked as they are in it instead of the
+// Options field, which doesn't hold the options following an End of Option List
+// option. The index of each option in the messages is then its position in the
+// RawOptions, counting No-Operation options.
+func (tcp *TCPHeader) Validate() []Finding {
+	var findings []Finding
+
+	add := func(code FindingCode, severity Severity, format string, a ...interface{}) {
+		findings = append(findings, Finding{Code: code, Severity: severity, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if tcp.SYN && tcp.FIN {
+		add(FindingSYNFIN, SeverityError, "SYN and FIN are both set")
+	}
+
+	if tcp.SYN && tcp.RST {
+		add(FindingSYNRST, SeverityError, "SYN and RST are both set")
+	}
+
+	if tcp.Reserved != 0 {
+		add(FindingReservedBits, SeverityWarning, "Reserved is %d, but must be zero", tcp.Reserved)
+	}
+
+	if tcp.AckNum != 0 && !tcp.ACK {
+		add(FindingAckNumWithoutACK, SeverityWarning, "AckNum is %d, but ACK isn't set", tcp.AckNum)
+	}
+
+	if tcp.UrgentPointer != 0 && !tcp.URG {
+		add(FindingUrgentPointerWithoutURG, SeverityWarning, "UrgentPointer is %d, but URG isn't set", tcp.UrgentPointer)
+	}
+
+	var eol, afterEOL bool
+
+	seen := make(map[uint8]bool)
+
+	opts := tcp.Options
+
+	if tcp.RawOptions != nil {
+		opts = tcpOptionsOnWire(tcp.RawOptions)
+	}
+
+	for index, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if eol && opt.Kind != TCPOptionKindEOL && !afterEOL {
+			add(FindingOptionAfterEOL, SeverityWarning, "option %d (%s) follows the End of Option List", index, tcpOptionName(opt.Kind))
+			afterEOL = true
+		}
+
+		switch opt.Kind {
+		case TCPOptionKindEOL:
+			eol = true
+		case TCPOptionKindMSS, TCPOptionKindWindowScale:
+			if seen[opt.Kind] {
+				add(FindingDuplicateOption, SeverityWarning, "option %d is a duplicate %s option", index, tcpOptionName(opt.Kind))
+			}
+
+			seen[opt.Kind] = true
+
+			fallthrough
+		case TCPOptionKindSACKPermitted:
+			if !tcp.SYN {
+				add(FindingSYNOnlyOption, SeverityWarning, "option %d (%s) is only allowed when SYN is set", index, tcpOptionName(opt.Kind))
+			}
+		}
+	}
+
+	return findings
+}
+
+// tcpOptionName returns the name of the kind of TCP option, for the messages of
+// the findings.
+func tcpOptionName(kind uint8) string {
+	if name, ok := tcpOptionNames[kind]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("kind %d", kind)
+}
+
+// tcpOptionsOnWire splits the options data in to every option in it, unlike
+// decodeTCPOptionSlice which skips No-Operation options and stops at the End of
+// Option List. If an option runs past the end of the data it's returned with
+// only its Kind, and nothing after it is.
+func tcpOptionsOnWire(data []byte) TCPOptionSlice {
+	var opts TCPOptionSlice
+
+	for i := 0; i < len(data); {
+		kind := data[i]
+
+		if kind == TCPOptionKindEOL || kind == TCPOptionKindNOP {
+			opts = append(opts, &TCPOption{Kind: kind})
+			i++
+
+			continue
+		}
+
+		if i+2 > len(data) || data[i+1] < 2 || i+int(data[i+1]) > len(data) {
+			return append(opts, &TCPOption{Kind: kind})
+		}
+
+		length := int(data[i+1])
+
+		opts = append(opts, &TCPOption{Kind: kind, Length: data[i+1], Data: data[i+2 : i+length]})
+		i += length
+	}
+
+	return opts
+}
+
+// Validate is a method to check the *UDPHeader for violations of the RFCs, in
+// the same way as TCPHeader.Validate(). The only violation found is a Length that
+// doesn't match the length of the datagram, including the Payload. A Length of
+// zero is filled in when marshaling, so it's only a violation if ZeroLength is set
+// and the datagram isn't too large for the Length field.
+//
+// The Payload of a decoded header stops at the Length, so if the RawLength field
+// is set, such as by decoding the header, it's used as the length of the datagram.
+func (udp *UDPHeader) Validate() []Finding {
+	var findings []Finding
+
+	datagramLen := udpHeaderLen + len(udp.Payload)
+
+	if udp.RawLength != 0 {
+		datagramLen = udp.RawLength
+	}
+
+	switch {
+	case udp.Length == 0 && !udp.ZeroLength:
+	case udp.Length == 0 && datagramLen > maxUint16:
+	case int(udp.Length) != datagramLen:
+		findings = append(findings, Finding{
+			Code:     FindingUDPLengthMismatch,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("Length is %d, but the datagram is %d bytes", udp.Length, datagramLen),
+		})
+	}
+
+	return findings
+}
@@ -0,0 +1,236 @@
+// Copyright 2015 Tim Heckman. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause
+// license that can be found in the LICENSE file.
+
+package packets_test
+
+import (
+	"github.com/theckman/packets"
+	. "gopkg.in/check.v1"
+)
+
+// findingCodes returns the codes of the findings, in order.
+func findingCodes(findings []packets.Finding) []packets.FindingCode {
+	var codes []packets.FindingCode
+
+	for _, f := range findings {
+		codes = append(codes, f.Code)
+	}
+
+	return codes
+}
+
+func (t *TestSuite) TestTCPHeader_Validate(c *C) {
+	wscale, err := packets.NewWindowScaleOption(7)
+	c.Assert(err, IsNil)
+
+	tcp := &packets.TCPHeader{
+		SourcePort:      44273,
+		DestinationPort: 22,
+		SYN:             true,
+		Options:         packets.TCPOptionSlice{packets.NewMSSOption(1460), wscale, packets.NewSACKPermittedOption()},
+	}
+
+	c.Check(tcp.Validate(), IsNil)
+
+	//
+	// TEST CONTROL FLAGS
+	//
+	tcp.FIN = true
+	tcp.RST = true
+
+	findings := tcp.Validate()
+	c.Assert(findings, HasLen, 2)
+	c.Check(findings[0], Equals, packets.Finding{
+		Code:     packets.FindingSYNFIN,
+		Severity: packets.SeverityError,
+		Message:  "SYN and FIN are both set",
+	})
+	c.Check(findings[1].Code, Equals, packets.FindingSYNRST)
+	c.Check(findings[1].Severity, Equals, packets.SeverityError)
+	c.Check(findings[1].String(), Equals, "error: SYN and RST are both set (SYNRST)")
+
+	//
+	// TEST FIELDS WITHOUT THEIR FLAGS
+	//
+	tcp.FIN, tcp.RST = false, false
+	tcp.Reserved = 5
+	tcp.AckNum = 42
+	tcp.UrgentPointer = 7
+
+	findings = tcp.Validate()
+	c.Check(findingCodes(findings), DeepEquals, []packets.FindingCode{
+		packets.FindingReservedBits,
+		packets.FindingAckNumWithoutACK,
+		packets.FindingUrgentPointerWithoutURG,
+	})
+
+	for _, f := range findings {
+		c.Check(f.Severity, Equals, packets.SeverityWarning)
+	}
+
+	c.Check(findings[0].Message, Equals, "Reserved is 5, but must be zero")
+	c.Check(findings[1].Message, Equals, "AckNum is 42, but ACK isn't set")
+	c.Check(findings[2].Message, Equals, "UrgentPointer is 7, but URG isn't set")
+
+	tcp.Reserved = 0
+	tcp.ACK = true
+	tcp.URG = true
+
+	c.Check(tcp.Validate(), IsNil)
+
+	//
+	// TEST OPTIONS
+	//
+	tcp.SYN = false
+	tcp.Options = packets.TCPOptionSlice{
+		packets.NewMSSOption(1460),
+		nil,
+		packets.NewMSSOption(536),
+		{Kind: packets.TCPOptionKindEOL},
+		packets.NewTimestampOption(1, 2),
+		wscale,
+	}
+
+	findings = tcp.Validate()
+	c.Check(findingCodes(findings), DeepEquals, []packets.FindingCode{
+		packets.FindingSYNOnlyOption,
+		packets.FindingDuplicateOption,
+		packets.FindingSYNOnlyOption,
+		packets.FindingOptionAfterEOL,
+		packets.FindingSYNOnlyOption,
+	})
+
+	c.Check(findings[0].Message, Equals, "option 0 (Maximum Segment Size) is only allowed when SYN is set")
+	c.Check(findings[1].Message, Equals, "option 2 is a duplicate Maximum Segment Size option")
+	c.Check(findings[3].Message, Equals, "option 4 (Timestamps) follows the End of Option List")
+	c.Check(findings[4].Message, Equals, "option 5 (Window Scale) is only allowed when SYN is set")
+
+	//
+	// TEST DECODED OPTIONS AFTER EOL
+	//
+	tcp = &packets.TCPHeader{SourcePort: 44273, DestinationPort: 22, SYN: true}
+
+	data, err := tcp.Marshal()
+	c.Assert(err, IsNil)
+
+	// add an EOL option followed by an MSS option
+	data = append(data, 0x00, 0x02, 0x04, 0x05, 0xb4, 0x00, 0x00, 0x00)
+	data[12] = 7 << 4
+
+	header, err := packets.UnmarshalTCPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.Options, HasLen, 0)
+
+	findings = header.Validate()
+	c.Assert(findings, HasLen, 1)
+	c.Check(findings[0].Code, Equals, packets.FindingOptionAfterEOL)
+	c.Check(findings[0].Message, Equals, "option 1 (Maximum Segment Size) follows the End of Option List")
+
+	// padding of zeroes after the EOL option is fine
+	copy(data[21:], []byte{0, 0, 0, 0, 0, 0, 0})
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(header.Validate(), IsNil)
+
+	//
+	// TEST DECODED DUPLICATE OPTIONS
+	//
+	data = data[:20]
+
+	// add two MSS options and a Window Scale option after a NOP option
+	data = append(data, 0x02, 0x04, 0x05, 0xb4, 0x02, 0x04, 0x05, 0xb4, 0x01, 0x03, 0x03, 0x07)
+	data[12] = 8 << 4
+
+	c.Assert(header.DecodeFromBytes(data), IsNil)
+	c.Check(header.Options, HasLen, 3)
+
+	findings = header.Validate()
+	c.Assert(findings, HasLen, 1)
+	c.Check(findings[0].Code, Equals, packets.FindingDuplicateOption)
+
+	header.SYN = false
+
+	findings = header.Validate()
+	c.Assert(findings, HasLen, 4)
+	c.Check(findingCodes(findings), DeepEquals, []packets.FindingCode{
+		packets.FindingSYNOnlyOption,
+		packets.FindingDuplicateOption,
+		packets.FindingSYNOnlyOption,
+		packets.FindingSYNOnlyOption,
+	})
+	c.Check(findings[1].Message, Equals, "option 1 is a duplicate Maximum Segment Size option")
+	c.Check(findings[3].Message, Equals, "option 3 (Window Scale) is only allowed when SYN is set")
+}
+
+func (t *TestSuite) TestUDPHeader_Validate(c *C) {
+	c.Check(t.u.Validate(), IsNil)
+
+	// a zero Length is filled in when marshaling
+	t.u.Length = 0
+	c.Check(t.u.Validate(), IsNil)
+
+	t.u.Length = 42
+
+	findings := t.u.Validate()
+	c.Assert(findings, HasLen, 1)
+	c.Check(findings[0], Equals, packets.Finding{
+		Code:     packets.FindingUDPLengthMismatch,
+		Severity: packets.SeverityError,
+		Message:  "Length is 42, but the datagram is 12 bytes",
+	})
+
+	//
+	// TEST ZERO LENGTH
+	//
+	t.u.Length = 0
+	t.u.ZeroLength = true
+
+	c.Check(findingCodes(t.u.Validate()), DeepEquals, []packets.FindingCode{packets.FindingUDPLengthMismatch})
+
+	// a jumbogram is too large for the Length field
+	t.u.Payload = make([]byte, 70000)
+	c.Check(t.u.Validate(), IsNil)
+
+	//
+	// TEST DECODED DATAGRAMS
+	//
+	t.u.Payload = []byte{0xde, 0xad, 0xbe, 0xef}
+	t.u.ZeroLength = false
+
+	data, err := t.u.Marshal()
+	c.Assert(err, IsNil)
+
+	// the Length stops short of the data in the datagram
+	data = append(data, 0xca, 0xfe)
+
+	header, err := packets.UnmarshalUDPHeader(data)
+	c.Assert(err, IsNil)
+	c.Check(header.RawLength, Equals, 14)
+
+	findings = header.Validate()
+	c.Assert(findings, HasLen, 1)
+	c.Check(findings[0].Code, Equals, packets.FindingUDPLengthMismatch)
+	c.Check(findings[0].Message, Equals, "Length is 12, but the datagram is 14 bytes")
+
+	c.Assert(header.DecodeFromBytes(data[:12]), IsNil)
+	c.Check(header.RawLength, Equals, 12)
+	c.Check(header.Validate(), IsNil)
+}
+
+func (t *TestSuite) TestFinding_String(c *C) {
+	c.Check(packets.SeverityWarning.String(), Equals, "warning")
+	c.Check(packets.SeverityError.String(), Equals, "error")
+	c.Check(packets.Severity(0).String(), Equals, "unknown")
+
+	c.Check(packets.FindingDuplicateOption.String(), Equals, "DuplicateOption")
+	c.Check(packets.FindingCode(0).String(), Equals, "Unknown")
+
+	f := packets.Finding{
+		Code:     packets.FindingUrgentPointerWithoutURG,
+		Severity: packets.SeverityWarning,
+		Message:  "UrgentPointer is 7, but URG isn't set",
+	}
+
+	c.Check(f.String(), Equals, "warning: UrgentPointer is 7, but URG isn't set (UrgentPointerWithoutURG)")
+}